@@ -0,0 +1,301 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"perfprofiler/pkg/core/backend"
+	"perfprofiler/pkg/profiling/capture"
+	"perfprofiler/pkg/profiling/export"
+	"perfprofiler/pkg/profiling/export/flamegraph"
+	"perfprofiler/pkg/profiling/export/pprof"
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/profiling/task/base"
+	"perfprofiler/pkg/tools"
+)
+
+const replayUsage = `Usage: perfprofiler replay <info|symbolize|backend> -bundle <bundle file> [arguments]
+  info       print the captured machine, processes and profiles in the bundle
+  symbolize  re-symbolize the profiles by the module files, and write them into the directory
+  backend    send the profiles to the backend, the task must be created in the backend first`
+
+func runCapture(args []string, out io.Writer) error {
+	targets := &targetFlags{}
+	flags := flag.NewFlagSet("capture", flag.ContinueOnError)
+	targets.register(flags)
+	types := flags.String("types", "on_cpu", "the profiling types, on_cpu or off_cpu, separated by comma")
+	duration := flags.Duration("duration", 30*time.Second, "the duration of the profiling")
+	period := flags.String("period", "10ms", "the dump period of the on-cpu profiling")
+	configFile := flags.String("config", "", "the agent config file packaged into the bundle")
+	output := flags.String("o", "", "the bundle file, default is capture-<hostname>-<time>.tar.gz")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *duration <= 0 {
+		return fmt.Errorf("the duration must be bigger than 0")
+	}
+	opts := &capture.Options{Duration: *duration, AgentVersion: version,
+		TaskConfig: &base.TaskConfig{OnCPU: &base.OnCPUConfig{Period: *period}}}
+	for _, t := range strings.Split(*types, ",") {
+		switch profile.Type(strings.TrimSpace(t)) {
+		case profile.TypeOnCPU:
+			opts.Types = append(opts.Types, base.TargetTypeOnCPU)
+		case profile.TypeOffCPU:
+			opts.Types = append(opts.Types, base.TargetTypeOffCPU)
+		default:
+			return fmt.Errorf("unknown profiling type: %s", t)
+		}
+	}
+	if *configFile != "" {
+		content, err := os.ReadFile(*configFile)
+		if err != nil {
+			return fmt.Errorf("read the agent config failure: %v", err)
+		}
+		opts.AgentConfig = content
+	}
+	var err error
+	if opts.Pids, opts.Entities, err = targets.targets(); err != nil {
+		return err
+	}
+	if *output == "" {
+		*output = fmt.Sprintf("capture-%s-%s.tar.gz", tools.Hostname(), time.Now().Format("20060102150405"))
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	bundle, err := capture.Capture(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if err := bundle.WriteFile(*output); err != nil {
+		return fmt.Errorf("write the bundle failure: %v", err)
+	}
+	for _, e := range bundle.Manifest.Errors {
+		fmt.Fprintf(out, "warning: %s\n", e)
+	}
+	_, err = fmt.Fprintf(out, "captured %d profiles of %d processes into %s\n",
+		len(bundle.Entries), len(bundle.Manifest.Processes), *output)
+	return err
+}
+
+type replayFlags struct {
+	flags *flag.FlagSet
+
+	bundle  string
+	symbols string
+	// symbolize
+	output string
+	format string
+	// backend
+	backend  backend.Config
+	task     string
+	agentID  string
+	service  string
+	profType string
+}
+
+func newReplayFlags(name string) *replayFlags {
+	f := &replayFlags{flags: flag.NewFlagSet("replay "+name, flag.ContinueOnError)}
+	f.flags.StringVar(&f.bundle, "bundle", "", "the bundle file")
+	switch name {
+	case "symbolize":
+		f.flags.StringVar(&f.symbols, "symbols", "", "the directories of the module files, separated by comma")
+		f.flags.StringVar(&f.output, "o", ".", "the output directory")
+		f.flags.StringVar(&f.format, "format", "pprof", "the output format, pprof or folded")
+	case "backend":
+		f.flags.StringVar(&f.symbols, "symbols", "", "re-symbolize the profiles by the module files in the directories before send")
+		f.flags.StringVar(&f.backend.Addr, "addr", "", "the backend address")
+		f.flags.StringVar(&f.backend.Authentication, "auth", "", "the auth value of the backend")
+		f.flags.BoolVar(&f.backend.EnableTLS, "tls", false, "enable TLS connect to the backend")
+		f.flags.StringVar(&f.backend.CaPemPath, "ca", "", "the CA file of the backend TLS")
+		f.flags.BoolVar(&f.backend.InsecureSkipVerify, "insecure-skip-verify", false, "skip verify the backend certificate")
+		f.flags.StringVar(&f.task, "task", "", "the ID of the profiling task created in the backend")
+		f.flags.StringVar(&f.agentID, "agent-id", "", "the agent ID reports the processes, default is replay-<hostname>")
+		f.flags.StringVar(&f.service, "service", "", "the service of the processes captured without the service")
+		f.flags.StringVar(&f.profType, "type", "", "only send the profiles of the type, on_cpu or off_cpu")
+	}
+	return f
+}
+
+func runReplay(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", replayUsage)
+	}
+	switch args[0] {
+	case "info", "symbolize", "backend":
+	default:
+		return fmt.Errorf("unknown replay command: %s\n%s", args[0], replayUsage)
+	}
+	f := newReplayFlags(args[0])
+	if err := f.flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if f.bundle == "" {
+		return fmt.Errorf("the bundle file must be provided")
+	}
+	bundle, err := capture.ReadFile(f.bundle)
+	if err != nil {
+		return err
+	}
+	switch args[0] {
+	case "info":
+		return printBundle(bundle, out)
+	case "symbolize":
+		return symbolizeBundle(bundle, f, out)
+	default:
+		return replayBundle(bundle, f, out)
+	}
+}
+
+func printBundle(bundle *capture.Bundle, out io.Writer) error {
+	m, system := bundle.Manifest, bundle.System
+	fmt.Fprintf(out, "version: %d, agent: %s, created: %s, duration: %s\n",
+		m.Version, m.AgentVersion, m.CreateTime.Format(time.RFC3339), m.Duration)
+	fmt.Fprintf(out, "host: %s, ip: %s", system.Hostname, system.HostIP)
+	if system.Uname != nil {
+		fmt.Fprintf(out, ", kernel: %s %s", system.Uname.Release, system.Uname.Machine)
+	}
+	if system.Distribution != nil {
+		fmt.Fprintf(out, ", distribution: %s %s", system.Distribution.Name, system.Distribution.Version)
+	}
+	fmt.Fprintf(out, ", agent config: %t\n\n", len(bundle.Config) > 0)
+
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PID\tSERVICE\tINSTANCE\tPROCESS\tEXE")
+	for _, p := range m.Processes {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", p.Pid, p.Service, p.Instance, p.Process, p.Exe)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "PID\tTYPE\tSAMPLES\tMODULES\tFILE")
+	for i, e := range bundle.Entries {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%s\n", e.Raw.Pid, e.Raw.Type, len(e.Raw.Samples), len(e.Raw.Modules),
+			m.Profiles[i].Symbolized)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	for _, e := range m.Errors {
+		fmt.Fprintf(out, "error: %s\n", e)
+	}
+	return nil
+}
+
+// resymbolize the profiles of the bundle when the symbol directories provided, otherwise use the bundled profiles
+func (f *replayFlags) resymbolize(bundle *capture.Bundle, out io.Writer) ([]*capture.Entry, error) {
+	if f.symbols == "" {
+		return bundle.Entries, nil
+	}
+	files, err := capture.NewSymbolFiles(strings.Split(f.symbols, ","))
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*capture.Entry, 0, len(bundle.Entries))
+	for _, e := range bundle.Entries {
+		p, missing, err := capture.Resymbolize(e.Raw, files, e.Profile)
+		if err != nil {
+			return nil, err
+		}
+		if len(missing) > 0 {
+			fmt.Fprintf(out, "pid %d %s: the modules not found, using the bundled symbols: %s\n",
+				e.Raw.Pid, e.Raw.Type, strings.Join(missing, ", "))
+		}
+		result = append(result, &capture.Entry{Raw: e.Raw, Profile: p})
+	}
+	return result, nil
+}
+
+func symbolizeBundle(bundle *capture.Bundle, f *replayFlags, out io.Writer) error {
+	if f.symbols == "" {
+		return fmt.Errorf("the symbol directories must be provided")
+	}
+	var suffix string
+	var write func(w io.Writer, p *profile.Profile) error
+	switch strings.ToLower(f.format) {
+	case "pprof":
+		suffix, write = ".pb.gz", pprof.Write
+	case "folded":
+		suffix = ".folded"
+		write = func(w io.Writer, p *profile.Profile) error {
+			return flamegraph.WriteFolded(w, flamegraph.Fold(p, &flamegraph.Options{}))
+		}
+	default:
+		return fmt.Errorf("unknown output format: %s", f.format)
+	}
+	entries, err := f.resymbolize(bundle, out)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(f.output, 0o755); err != nil {
+		return err
+	}
+	for i, e := range entries {
+		file := filepath.Join(f.output, fmt.Sprintf("%d-%s-%d%s", e.Raw.Pid, e.Raw.Type, i, suffix))
+		if err := export.WriteFile(file, func(w *os.File) error {
+			return write(w, e.Profile)
+		}); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s\n", file)
+	}
+	return nil
+}
+
+func replayBundle(bundle *capture.Bundle, f *replayFlags, out io.Writer) error {
+	if f.backend.Addr == "" {
+		return fmt.Errorf("the backend address must be provided")
+	}
+	switch profile.Type(f.profType) {
+	case "", profile.TypeOnCPU, profile.TypeOffCPU:
+	default:
+		return fmt.Errorf("unknown profile type: %s", f.profType)
+	}
+	if f.agentID == "" {
+		f.agentID = "replay-" + tools.Hostname()
+	}
+	entries, err := f.resymbolize(bundle, out)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	f.backend.CheckPeriod = 5
+	client := backend.NewClient(&f.backend)
+	if err := client.Start(ctx); err != nil {
+		return fmt.Errorf("connect to the backend failure: %v", err)
+	}
+	defer client.Stop()
+	count, err := capture.Replay(ctx, client.GetConnection(), bundle, entries, &capture.ReplayOptions{
+		TaskID: f.task, AgentID: f.agentID, Type: profile.Type(f.profType), Service: f.service})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "replayed %d profiles to the task %s\n", count, f.task)
+	return err
+}
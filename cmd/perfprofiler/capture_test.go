@@ -0,0 +1,70 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"perfprofiler/pkg/profiling/capture"
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/tools/profiling"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReplayCommand(t *testing.T) {
+	dir := t.TempDir()
+	p := &profile.Profile{Type: profile.TypeOnCPU, Pid: 10, StartTime: time.Unix(100, 0), EndTime: time.Unix(101, 0),
+		Samples: []*profile.Sample{{Count: 2, Locations: []*profile.Location{
+			{Address: 0x1010, Frames: []*profiling.Frame{{Name: "work"}}},
+			{Address: 0x1020, Frames: []*profiling.Frame{{Name: "main"}}}}}}}
+	bundle := &capture.Bundle{
+		Manifest: &capture.Manifest{CreateTime: time.Unix(100, 0), Duration: "1s",
+			Processes: []*capture.Process{{Pid: 10, Service: "svc", Process: "app", Exe: "/app"}},
+			Errors:    []string{"the process 11 could not be profiling"}},
+		System:  &capture.System{Hostname: "host"},
+		Entries: []*capture.Entry{{Raw: capture.NewRawProfile(p), Profile: p}},
+	}
+	file := filepath.Join(dir, "bundle.tar.gz")
+	assert.NoError(t, bundle.WriteFile(file))
+
+	out := &bytes.Buffer{}
+	assert.NoError(t, runReplay([]string{"info", "-bundle", file}, out))
+	assert.Contains(t, out.String(), "host: host")
+	assert.Contains(t, out.String(), "profiles/10-on_cpu-0.pb.gz")
+	assert.Contains(t, out.String(), "error: the process 11 could not be profiling")
+
+	// the modules not found, the bundled symbols are used
+	out.Reset()
+	output := filepath.Join(dir, "output")
+	assert.NoError(t, runReplay([]string{"symbolize", "-bundle", file, "-symbols", t.TempDir(),
+		"-format", "folded", "-o", output}, out))
+	folded, err := os.ReadFile(filepath.Join(output, "10-on_cpu-0.folded"))
+	assert.NoError(t, err)
+	assert.Equal(t, "main;work 2\n", string(folded))
+
+	assert.Error(t, runReplay([]string{"symbolize", "-bundle", file}, out))
+	assert.Error(t, runReplay([]string{"backend", "-bundle", file}, out))
+	assert.Error(t, runReplay([]string{"info"}, out))
+	assert.Error(t, runReplay([]string{"delete", "-bundle", file}, out))
+	assert.Error(t, runCapture([]string{"-pid", "1", "-types", "memory"}, out))
+}
@@ -0,0 +1,221 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"perfprofiler/pkg/profiling/control"
+	"perfprofiler/pkg/profiling/sink"
+	"perfprofiler/pkg/profiling/task"
+	"perfprofiler/pkg/profiling/task/base"
+)
+
+const (
+	defaultControlAddress = "/var/run/perfprofiler.sock"
+
+	controlUsage = `Usage: perfprofiler ctl <command> [-addr <socket path or tcp://host:port>] [arguments]
+  tasks       list the active profiling tasks
+  task        show the task by the ID
+  create      create a local profiling task of the processes
+  cancel      cancel the task by the ID
+  processes   list the detected processes and whether they are profilable
+  continuous  show the continuous profiling policies and the recent triggers
+  spool       show the depth and counters of the data failed to send to the backend`
+)
+
+type controlFlags struct {
+	flags *flag.FlagSet
+
+	addr     string
+	token    string
+	json     bool
+	pids     string
+	taskType string
+	duration time.Duration
+}
+
+func newControlFlags(name string) *controlFlags {
+	f := &controlFlags{flags: flag.NewFlagSet("ctl "+name, flag.ContinueOnError)}
+	f.flags.StringVar(&f.addr, "addr", defaultControlAddress, "the control API address of the agent, the unix socket path or tcp://host:port")
+	f.flags.StringVar(&f.token, "token", "", "the auth token of the control API")
+	switch name {
+	case "create":
+		f.flags.StringVar(&f.pids, "pid", "", "the process IDs to profile, separated by comma")
+		f.flags.StringVar(&f.taskType, "type", "on_cpu", "the profiling type, on_cpu, off_cpu or network")
+		f.flags.DurationVar(&f.duration, "duration", time.Minute, "the running duration of the task")
+	case "tasks", "processes", "continuous", "spool":
+		f.flags.BoolVar(&f.json, "json", false, "print the result as JSON")
+	}
+	return f
+}
+
+func runControl(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", controlUsage)
+	}
+	switch args[0] {
+	case "tasks", "task", "create", "cancel", "processes", "continuous", "spool":
+	default:
+		return fmt.Errorf("unknown ctl command: %s\n%s", args[0], controlUsage)
+	}
+	f := newControlFlags(args[0])
+	if err := f.flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	client := control.NewClient(f.addr, f.token)
+
+	switch args[0] {
+	case "tasks":
+		tasks, err := client.Tasks()
+		if err != nil {
+			return err
+		}
+		if f.json {
+			return printJSON(out, tasks)
+		}
+		return printTasks(out, tasks)
+	case "task", "cancel":
+		if f.flags.NArg() != 1 {
+			return fmt.Errorf("the task ID must be provided")
+		}
+		if args[0] == "cancel" {
+			if err := client.CancelTask(f.flags.Arg(0)); err != nil {
+				return err
+			}
+			_, err := fmt.Fprintf(out, "task %s canceled\n", f.flags.Arg(0))
+			return err
+		}
+		t, err := client.Task(f.flags.Arg(0))
+		if err != nil {
+			return err
+		}
+		return printJSON(out, t)
+	case "create":
+		return createTask(client, f, out)
+	case "processes":
+		processes, err := client.Processes()
+		if err != nil {
+			return err
+		}
+		if f.json {
+			return printJSON(out, processes)
+		}
+		return printProcesses(out, processes)
+	case "spool":
+		stats, err := client.Spool()
+		if err != nil {
+			return err
+		}
+		if f.json {
+			return printJSON(out, stats)
+		}
+		return printSpool(out, stats)
+	default:
+		status, err := client.Continuous()
+		if err != nil {
+			return err
+		}
+		if f.json {
+			return printJSON(out, status)
+		}
+		return printContinuous(out, status)
+	}
+}
+
+func createTask(client *control.Client, f *controlFlags, out io.Writer) error {
+	if f.pids == "" {
+		return fmt.Errorf("the pid must be provided")
+	}
+	pids, err := parsePids(f.pids)
+	if err != nil {
+		return err
+	}
+	t, err := client.CreateTask(&control.CreateTaskRequest{Pids: pids, Type: base.TargetType(strings.ToUpper(f.taskType)),
+		Duration: f.duration.String()})
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(out, "task %s created\n", t.TaskID)
+	return err
+}
+
+func printTasks(out io.Writer, tasks []*task.Status) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TASK\tORIGIN\tTYPE\tPIDS\tRUNNING\tSTART\tDURATION")
+	for _, t := range tasks {
+		start := "-"
+		if !t.StartRunningTime.IsZero() {
+			start = t.StartRunningTime.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%v\t%t\t%s\t%s\n", t.TaskID, t.Origin, t.TargetType, t.Pids, t.Running,
+			start, t.MaxRunningDuration)
+	}
+	return w.Flush()
+}
+
+func printProcesses(out io.Writer, processes []*control.ProcessStatus) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "PID\tID\tSERVICE\tINSTANCE\tPROCESS\tPROFILABLE\tMODULES")
+	for _, p := range processes {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%t\t%d\n", p.Pid, p.ID, p.Service, p.Instance, p.Process, p.Profilable, p.ModuleCount)
+	}
+	return w.Flush()
+}
+
+func printContinuous(out io.Writer, status *control.ContinuousStatus) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tTYPE\tPROCESSES\tCHECKS")
+	for _, p := range status.Policies {
+		checks := make([]string, 0, len(p.Items))
+		for _, item := range p.Items {
+			checks = append(checks, fmt.Sprintf("%s>%s(%d/%d)", item.CheckType, item.Threshold, item.Count, item.Period))
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\n", p.Service, p.TargetType, p.ProcessCount, strings.Join(checks, ","))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintln(out)
+	w = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "TRIGGERED\tTASK\tTYPE\tPID\tSERVICE\tCAUSES")
+	for _, t := range status.Triggers {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\n", t.Time.Format(time.RFC3339), t.TaskID, t.TargetType, t.Pid,
+			t.Service, strings.Join(t.Causes, "; "))
+	}
+	return w.Flush()
+}
+
+func printSpool(out io.Writer, stats *sink.SpoolStats) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "FILES\tITEMS\tBYTES\tSPOOLED\tRESENT\tDROPPED")
+	fmt.Fprintf(w, "%d\t%d\t%d\t%d\t%d\t%d\n", stats.Files, stats.Items, stats.Bytes, stats.Spooled, stats.Resent, stats.Dropped)
+	return w.Flush()
+}
+
+func printJSON(out io.Writer, data interface{}) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
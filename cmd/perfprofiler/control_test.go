@@ -0,0 +1,88 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunControl(t *testing.T) {
+	var created map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/v1/tasks":
+			_, _ = w.Write([]byte(`[{"taskId": "local-1", "origin": "local", "targetType": "ON_CPU", "pids": [1], "running": true}]`))
+		case r.Method == http.MethodPost && r.URL.Path == "/v1/tasks":
+			_ = json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusCreated)
+			_, _ = w.Write([]byte(`{"taskId": "local-2"}`))
+		case r.Method == http.MethodDelete && r.URL.Path == "/v1/tasks/local-1":
+			w.WriteHeader(http.StatusNoContent)
+		case r.URL.Path == "/v1/spool":
+			_, _ = w.Write([]byte(`{"files": 2, "items": 5, "dropped": 7}`))
+		case r.URL.Path == "/v1/processes":
+			_, _ = w.Write([]byte(`[{"id": "p1", "pid": 1, "service": "svc", "process": "main", "profilable": true, "moduleCount": 3}]`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error": "the task is not found"}`))
+		}
+	}))
+	defer server.Close()
+	addr := "tcp://" + strings.TrimPrefix(server.URL, "http://")
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr string
+	}{
+		{name: "tasks", args: []string{"tasks", "-addr", addr}, want: "local-1"},
+		{name: "tasks json", args: []string{"tasks", "-addr", addr, "-json"}, want: `"taskId": "local-1"`},
+		{name: "create", args: []string{"create", "-addr", addr, "-pid", "1,2", "-type", "network"}, want: "task local-2 created"},
+		{name: "create without pid", args: []string{"create", "-addr", addr}, wantErr: "pid must be provided"},
+		{name: "cancel", args: []string{"cancel", "-addr", addr, "local-1"}, want: "task local-1 canceled"},
+		{name: "cancel unknown", args: []string{"cancel", "-addr", addr, "local-3"}, wantErr: "not found"},
+		{name: "task without id", args: []string{"task", "-addr", addr}, wantErr: "task ID must be provided"},
+		{name: "processes", args: []string{"processes", "-addr", addr}, want: "svc"},
+		{name: "spool", args: []string{"spool", "-addr", addr}, want: "2      5      0      0        0       7"},
+		{name: "unknown command", args: []string{"unknown"}, wantErr: "unknown ctl command"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			err := runControl(tt.args, out)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Contains(t, out.String(), tt.want)
+		})
+	}
+	assert.Equal(t, "NETWORK", created["type"])
+	assert.Equal(t, []interface{}{float64(1), float64(2)}, created["pids"])
+	assert.Equal(t, "1m0s", created["duration"])
+}
@@ -0,0 +1,106 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"perfprofiler/pkg/boot"
+)
+
+// set by the Makefile
+var (
+	version = "dev"
+	date    = ""
+	commit  = ""
+	builtBy = ""
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(args []string, out io.Writer) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{name: "start", usage: "start the profiler agent with the config file", run: runStart},
+		{name: "capture", usage: "capture the profiles of the processes into a bundle file", run: runCapture},
+		{name: "replay", usage: "re-symbolize the bundle or send it to the backend", run: runReplay},
+		{name: "store", usage: "query the profiles in the local profile store", run: runStore},
+		{name: "top", usage: "show the hottest functions of the processes in real time", run: runTop},
+		{name: "ctl", usage: "manage the profiling tasks of the running agent", run: runControl},
+		{name: "version", usage: "print the version", run: runVersion},
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage(os.Stderr)
+		os.Exit(2)
+	}
+	for _, c := range commands {
+		if c.name != os.Args[1] {
+			continue
+		}
+		if err := c.run(os.Args[2:], os.Stdout); err != nil {
+			if err != flag.ErrHelp {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", c.name, err)
+			}
+			os.Exit(1)
+		}
+		return
+	}
+	if os.Args[1] != "help" && os.Args[1] != "-h" && os.Args[1] != "--help" {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", os.Args[1])
+	}
+	usage(os.Stderr)
+	os.Exit(2)
+}
+
+func usage(out io.Writer) {
+	fmt.Fprintln(out, "Usage: perfprofiler <command> [arguments]")
+	fmt.Fprintln(out, "Commands:")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-10s %s\n", c.name, c.usage)
+	}
+}
+
+func runStart(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("start", flag.ContinueOnError)
+	configFile := flags.String("config", "", "the config file of the agent")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *configFile == "" {
+		return fmt.Errorf("the config file must be provided")
+	}
+	// the modules are shutdown when received the terminal signals
+	return boot.RunModules(context.Background(), *configFile, nil)
+}
+
+func runVersion(args []string, out io.Writer) error {
+	_, err := fmt.Fprintf(out, "version: %s, commit: %s, date: %s, built by: %s\n", version, commit, date, builtBy)
+	return err
+}
@@ -0,0 +1,282 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"perfprofiler/pkg/profiling/export/flamegraph"
+	"perfprofiler/pkg/profiling/export/pprof"
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/profiling/store"
+)
+
+const storeUsage = `Usage: perfprofiler store <list|merge|export|diff> -dir <store directory> [arguments]
+  list    list the profiles matched the query
+  merge   merge the profiles matched the query into one profile
+  export  export a profile by the ID
+  diff    compare the current profile against the baseline profile by the IDs`
+
+type storeFlags struct {
+	flags *flag.FlagSet
+
+	dir      string
+	service  string
+	instance string
+	process  string
+	task     string
+	pid      int
+	profType string
+	from     string
+	to       string
+	id       string
+	baseline string
+	current  string
+	format   string
+	output   string
+	json     bool
+}
+
+func newStoreFlags(name string) *storeFlags {
+	f := &storeFlags{flags: flag.NewFlagSet("store "+name, flag.ContinueOnError)}
+	f.flags.StringVar(&f.dir, "dir", "", "the directory of the profile store")
+	switch name {
+	case "export":
+		f.flags.StringVar(&f.id, "id", "", "the ID of the profile")
+	case "diff":
+		f.flags.StringVar(&f.baseline, "baseline", "", "the ID of the baseline profile")
+		f.flags.StringVar(&f.current, "current", "", "the ID of the current profile")
+	default:
+		f.flags.StringVar(&f.service, "service", "", "the service name")
+		f.flags.StringVar(&f.instance, "instance", "", "the instance name")
+		f.flags.StringVar(&f.process, "process", "", "the process name")
+		f.flags.StringVar(&f.task, "task", "", "the task ID")
+		f.flags.IntVar(&f.pid, "pid", 0, "the process ID")
+		f.flags.StringVar(&f.profType, "type", "", "the profile type, on_cpu or off_cpu")
+		f.flags.StringVar(&f.from, "from", "", "the start of time range, RFC3339 time or the duration before now such as 1h")
+		f.flags.StringVar(&f.to, "to", "", "the end of time range, RFC3339 time or the duration before now such as 10m")
+	}
+	switch name {
+	case "list":
+		f.flags.BoolVar(&f.json, "json", false, "print the profiles as the JSON lines")
+	case "diff":
+		f.flags.StringVar(&f.format, "format", "svg", "the output format, svg, folded or json")
+		f.flags.StringVar(&f.output, "o", "", "the output file, write to the stdout when empty")
+	default:
+		f.flags.StringVar(&f.format, "format", "pprof", "the output format, pprof or folded")
+		f.flags.StringVar(&f.output, "o", "", "the output file, write to the stdout when empty")
+	}
+	return f
+}
+
+func (f *storeFlags) query(now time.Time) (*store.Query, error) {
+	from, err := parseTime(f.from, now)
+	if err != nil {
+		return nil, fmt.Errorf("parsing the from time failure: %v", err)
+	}
+	to, err := parseTime(f.to, now)
+	if err != nil {
+		return nil, fmt.Errorf("parsing the to time failure: %v", err)
+	}
+	switch profile.Type(f.profType) {
+	case "", profile.TypeOnCPU, profile.TypeOffCPU:
+	default:
+		return nil, fmt.Errorf("unknown profile type: %s", f.profType)
+	}
+	return &store.Query{Service: f.service, Instance: f.instance, Process: f.process, TaskID: f.task,
+		Pid: int32(f.pid), Type: profile.Type(f.profType), From: from, To: to}, nil
+}
+
+// parseTime parses the RFC3339 time or the duration before now, the zero time is returned when empty
+func parseTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func runStore(args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", storeUsage)
+	}
+	f := newStoreFlags(args[0])
+	switch args[0] {
+	case "list", "merge", "export", "diff":
+	default:
+		return fmt.Errorf("unknown store command: %s\n%s", args[0], storeUsage)
+	}
+	if err := f.flags.Parse(args[1:]); err != nil {
+		return err
+	}
+	if f.dir == "" {
+		return fmt.Errorf("the store directory must be provided")
+	}
+	s, err := store.Open(f.dir)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		return listProfiles(s, f, out)
+	case "merge":
+		return mergeProfiles(s, f, out)
+	case "diff":
+		return diffProfiles(s, f, out)
+	default:
+		return exportProfile(s, f, out)
+	}
+}
+
+func listProfiles(s *store.Store, f *storeFlags, out io.Writer) error {
+	query, err := f.query(time.Now())
+	if err != nil {
+		return err
+	}
+	records := s.Query(query)
+	if f.json {
+		encoder := json.NewEncoder(out)
+		for _, r := range records {
+			if err := encoder.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTYPE\tSTART\tEND\tPID\tSERVICE\tINSTANCE\tPROCESS\tTASK\tSAMPLES\tSIZE")
+	for _, r := range records {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%d\t%d\n", r.ID, r.Type,
+			r.StartTime.Format(time.RFC3339), r.EndTime.Format(time.RFC3339), r.Pid,
+			r.Service, r.Instance, r.Process, r.TaskID, r.Samples, r.Size)
+	}
+	return w.Flush()
+}
+
+func mergeProfiles(s *store.Store, f *storeFlags, out io.Writer) error {
+	query, err := f.query(time.Now())
+	if err != nil {
+		return err
+	}
+	records := s.Query(query)
+	if len(records) == 0 {
+		return fmt.Errorf("no profiles matched")
+	}
+	profiles, err := s.LoadAll(records)
+	if err != nil {
+		return err
+	}
+	merged, err := profile.Merge(profiles)
+	if err != nil {
+		return fmt.Errorf("%v, please filter the profiles by the type", err)
+	}
+	return writeProfile(merged, f, out)
+}
+
+func exportProfile(s *store.Store, f *storeFlags, out io.Writer) error {
+	p, err := loadProfile(s, f.id)
+	if err != nil {
+		return err
+	}
+	return writeProfile(p, f, out)
+}
+
+func diffProfiles(s *store.Store, f *storeFlags, out io.Writer) error {
+	baseline, err := loadProfile(s, f.baseline)
+	if err != nil {
+		return fmt.Errorf("baseline %v", err)
+	}
+	current, err := loadProfile(s, f.current)
+	if err != nil {
+		return fmt.Errorf("current %v", err)
+	}
+	opts := &flamegraph.Options{ColorKernel: true}
+	result, err := flamegraph.Diff(baseline, current, opts)
+	if err != nil {
+		return err
+	}
+	var write func(w io.Writer) error
+	switch strings.ToLower(f.format) {
+	case "svg":
+		write = func(w io.Writer) error {
+			return flamegraph.WriteDiffSVG(w, result, opts)
+		}
+	case "folded":
+		write = func(w io.Writer) error {
+			return flamegraph.WriteDiffFolded(w, result)
+		}
+	case "json":
+		write = func(w io.Writer) error {
+			return flamegraph.WriteDiffJSON(w, result)
+		}
+	default:
+		return fmt.Errorf("unknown output format: %s", f.format)
+	}
+	return writeOutput(f.output, out, write)
+}
+
+func loadProfile(s *store.Store, id string) (*profile.Profile, error) {
+	record := s.Find(id)
+	if record == nil {
+		return nil, fmt.Errorf("could not found the profile: %s", id)
+	}
+	return s.Load(record)
+}
+
+func writeProfile(p *profile.Profile, f *storeFlags, out io.Writer) error {
+	var write func(w io.Writer) error
+	switch strings.ToLower(f.format) {
+	case "pprof":
+		write = func(w io.Writer) error {
+			return pprof.Write(w, p)
+		}
+	case "folded":
+		write = func(w io.Writer) error {
+			return flamegraph.WriteFolded(w, flamegraph.Fold(p, &flamegraph.Options{}))
+		}
+	default:
+		return fmt.Errorf("unknown output format: %s", f.format)
+	}
+	return writeOutput(f.output, out, write)
+}
+
+// writeOutput into the output file, or the stdout when the output is empty
+func writeOutput(output string, out io.Writer, write func(w io.Writer) error) error {
+	if output == "" {
+		return write(out)
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,92 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/export/pprof"
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/profiling/store"
+	"perfprofiler/pkg/tools/profiling"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreCommand(t *testing.T) {
+	dir := t.TempDir()
+	s, err := store.NewStore(&store.Config{Directory: dir})
+	assert.NoError(t, err)
+	now := time.Now()
+	for i, name := range []string{"main", "main", "other"} {
+		_, err = s.Write(&profile.Profile{
+			TaskID: "task", Type: profile.TypeOnCPU, Pid: int32(i + 1),
+			Entity:    &api.ProcessEntity{ServiceName: "svc", InstanceName: "instance"},
+			StartTime: now.Add(time.Duration(i-3) * time.Hour), EndTime: now.Add(time.Duration(i-3)*time.Hour + time.Minute),
+			Samples: []*profile.Sample{{Count: 2,
+				Locations: []*profile.Location{{Address: 1, Frames: []*profiling.Frame{{Name: name}}}}}},
+		})
+		assert.NoError(t, err)
+	}
+
+	out := &bytes.Buffer{}
+	assert.NoError(t, runStore([]string{"list", "-dir", dir, "-from", "150m"}, out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.True(t, strings.HasPrefix(lines[0], "ID "))
+
+	// the same address is different functions in the processes
+	out.Reset()
+	assert.NoError(t, runStore([]string{"merge", "-dir", dir, "-service", "svc", "-format", "folded"}, out))
+	assert.Equal(t, "main 4\nother 2\n", out.String())
+
+	output := filepath.Join(t.TempDir(), "merged.pb.gz")
+	assert.NoError(t, runStore([]string{"merge", "-dir", dir, "-to", "90m", "-o", output}, out))
+	merged, err := pprof.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Len(t, merged.Samples, 2)
+	assert.Equal(t, int32(0), merged.Pid)
+
+	out.Reset()
+	id := s.Query(&store.Query{Pid: 3})[0].ID
+	assert.NoError(t, runStore([]string{"export", "-dir", dir, "-id", id, "-format", "folded"}, out))
+	assert.Equal(t, "other 2\n", out.String())
+
+	// the baseline is normalized to the total of the current
+	out.Reset()
+	baseline := s.Query(&store.Query{Pid: 1})[0].ID
+	assert.NoError(t, runStore([]string{"diff", "-dir", dir, "-baseline", baseline, "-current", id, "-format", "folded"}, out))
+	assert.Equal(t, "main 2 0\nother 0 2\n", out.String())
+	output = filepath.Join(t.TempDir(), "diff.svg")
+	assert.NoError(t, runStore([]string{"diff", "-dir", dir, "-baseline", baseline, "-current", id, "-o", output}, out))
+	content, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), "<svg")
+	assert.Error(t, runStore([]string{"diff", "-dir", dir, "-baseline", "unknown", "-current", id}, out))
+
+	assert.Error(t, runStore([]string{"export", "-dir", dir, "-id", "unknown"}, out))
+	assert.Error(t, runStore([]string{"merge", "-dir", dir, "-service", "unknown"}, out))
+	assert.Error(t, runStore([]string{"list", "-dir", filepath.Join(dir, "unknown")}, out))
+	assert.Error(t, runStore([]string{"delete", "-dir", dir}, out))
+}
@@ -0,0 +1,123 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/debug"
+)
+
+// targetFlags are the processes to profile, by the pids or all processes tracked by the running agent
+type targetFlags struct {
+	pids    string
+	agent   string
+	token   string
+	service string
+}
+
+func (f *targetFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.pids, "pid", "", "the process IDs to profile, separated by comma")
+	flags.StringVar(&f.agent, "agent", "", "the debug server address of the running agent, profile all tracked processes")
+	flags.StringVar(&f.token, "token", "", "the auth token of the agent debug server")
+	flags.StringVar(&f.service, "service", "", "only profile the tracked processes of the service")
+}
+
+// targets of the profiling, the processes are listed from the agent when the pids are not provided
+func (f *targetFlags) targets() ([]int32, map[int32]*api.ProcessEntity, error) {
+	if f.pids != "" {
+		pids, err := parsePids(f.pids)
+		return pids, nil, err
+	}
+	if f.agent == "" {
+		return nil, nil, fmt.Errorf("the pid or the agent address must be provided")
+	}
+	return agentProcesses(f.agent, f.token, f.service)
+}
+
+// parsePids separated by comma
+func parsePids(value string) ([]int32, error) {
+	var pids []int32
+	for _, s := range strings.Split(value, ",") {
+		pid, err := strconv.ParseInt(strings.TrimSpace(s), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("the pid format not right: %s", s)
+		}
+		pids = append(pids, int32(pid))
+	}
+	return pids, nil
+}
+
+// agentProcesses lists the profilable processes tracked by the agent through the debug server
+func agentProcesses(address, token, service string) ([]int32, map[int32]*api.ProcessEntity, error) {
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(address, "/")+debug.ProcessesPath, http.NoBody)
+	if err != nil {
+		return nil, nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("query the processes from the agent failure: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, nil, fmt.Errorf("query the processes from the agent failure: %s, %s", resp.Status, bytes.TrimSpace(body))
+	}
+	var processes []struct {
+		Pid        int32    `json:"pid"`
+		Layer      string   `json:"layer"`
+		Service    string   `json:"service"`
+		Instance   string   `json:"instance"`
+		Process    string   `json:"process"`
+		Labels     []string `json:"labels"`
+		Profilable bool     `json:"profilable"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&processes); err != nil {
+		return nil, nil, fmt.Errorf("decode the processes failure: %v", err)
+	}
+	var pids []int32
+	entities := make(map[int32]*api.ProcessEntity)
+	for _, p := range processes {
+		if !p.Profilable || (service != "" && p.Service != service) || entities[p.Pid] != nil {
+			continue
+		}
+		pids = append(pids, p.Pid)
+		entities[p.Pid] = &api.ProcessEntity{Layer: p.Layer, ServiceName: p.Service, InstanceName: p.Instance,
+			ProcessName: p.Process, Labels: p.Labels}
+	}
+	if len(pids) == 0 {
+		return nil, nil, fmt.Errorf("no profilable process tracked by the agent")
+	}
+	return pids, entities, nil
+}
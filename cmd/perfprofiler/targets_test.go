@@ -0,0 +1,67 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/debug"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgentProcesses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != debug.ProcessesPath || r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`[
+			{"pid": 1, "service": "svc", "instance": "a", "process": "main", "profilable": true},
+			{"pid": 2, "service": "svc", "instance": "b", "process": "script", "profilable": false},
+			{"pid": 3, "service": "other", "instance": "c", "process": "main", "profilable": true}]`))
+	}))
+	defer server.Close()
+
+	pids, entities, err := agentProcesses(server.URL, "secret", "")
+	assert.NoError(t, err)
+	assert.Equal(t, []int32{1, 3}, pids)
+	assert.Equal(t, &api.ProcessEntity{ServiceName: "svc", InstanceName: "a", ProcessName: "main"}, entities[1])
+
+	pids, _, err = agentProcesses(server.Listener.Addr().String(), "secret", "other")
+	assert.NoError(t, err)
+	assert.Equal(t, []int32{3}, pids)
+
+	_, _, err = agentProcesses(server.URL, "secret", "unknown")
+	assert.Error(t, err)
+	_, _, err = agentProcesses(server.URL, "wrong", "")
+	assert.Error(t, err)
+}
+
+func TestTargets(t *testing.T) {
+	_, _, err := (&targetFlags{}).targets()
+	assert.Error(t, err)
+	_, _, err = (&targetFlags{pids: "1,a"}).targets()
+	assert.Error(t, err)
+	pids, _, err := (&targetFlags{pids: "1, 2"}).targets()
+	assert.NoError(t, err)
+	assert.Equal(t, []int32{1, 2}, pids)
+}
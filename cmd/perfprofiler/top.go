@@ -0,0 +1,288 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/profiling/task/base"
+	"perfprofiler/pkg/profiling/task/local"
+	"perfprofiler/pkg/profiling/top"
+)
+
+// the rows of the threads in the terminal, the rest rows are used by the functions
+const (
+	topThreadRows = 5
+	topHeaderRows = 9
+)
+
+type topFlags struct {
+	targetFlags
+	profType   string
+	space      string
+	period     string
+	interval   time.Duration
+	window     time.Duration
+	rows       int
+	iterations int
+}
+
+// topState is the display state changed by the keyboard
+type topState struct {
+	targetType   base.TargetType
+	space        top.Space
+	byCumulative bool
+	frozen       bool
+	// the profiles of the recent refreshes in the window, the latest is the last
+	history    [][]*profile.Profile
+	maxHistory int
+	threads    []*top.ThreadUsage
+	message    string
+}
+
+type topAction int
+
+const (
+	topActionNone topAction = iota
+	topActionRender
+	topActionSwitch
+	topActionQuit
+)
+
+func runTop(args []string, out io.Writer) error {
+	f := &topFlags{}
+	flags := flag.NewFlagSet("top", flag.ContinueOnError)
+	f.register(flags)
+	flags.StringVar(&f.profType, "type", "on_cpu", "the profiling type, on_cpu or off_cpu")
+	flags.StringVar(&f.space, "space", "user", "the functions space, user or kernel")
+	flags.StringVar(&f.period, "period", "10ms", "the dump period of the on-cpu profiling")
+	flags.DurationVar(&f.interval, "interval", time.Second, "the refresh interval")
+	flags.DurationVar(&f.window, "window", 5*time.Second, "the time window of the aggregated samples")
+	flags.IntVar(&f.rows, "rows", 0, "the max rows of the functions, fit the terminal height when 0")
+	flags.IntVar(&f.iterations, "n", 0, "exit after the refreshes count, run until quit when 0")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	state, err := f.initState()
+	if err != nil {
+		return err
+	}
+	pids, entities, err := f.targets()
+	if err != nil {
+		return err
+	}
+
+	session, err := local.NewSession(&base.TaskConfig{OnCPU: &base.OnCPUConfig{Period: f.period}}, pids, entities)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	if err = session.Start(ctx, state.targetType); err != nil {
+		return err
+	}
+
+	// the keyboard controls only work in the terminal
+	interactive := out == io.Writer(os.Stdout) && term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+	keys := make(chan byte)
+	if interactive {
+		old, err := term.MakeRaw(int(os.Stdin.Fd()))
+		if err != nil {
+			return fmt.Errorf("could not set the terminal to raw mode: %v", err)
+		}
+		defer term.Restore(int(os.Stdin.Fd()), old)
+		// the new line does not return the carriage in the raw mode
+		out = &crlfWriter{out: out}
+		go readKeys(os.Stdin, keys)
+	}
+
+	sampler := top.NewThreadSampler("")
+	sampler.Sample(pids, time.Now())
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for refreshes := 0; ; {
+		select {
+		case <-ctx.Done():
+			return nil
+		case key := <-keys:
+			switch state.handleKey(key) {
+			case topActionQuit:
+				return nil
+			case topActionSwitch:
+				state.switchType(ctx, session)
+			case topActionRender:
+			default:
+				continue
+			}
+		case now := <-ticker.C:
+			profiles, err := session.Flush()
+			if err != nil {
+				state.message = fmt.Sprintf("flush the profiling data failure: %v", err)
+			}
+			threads := sampler.Sample(pids, now)
+			if !state.frozen {
+				state.add(profiles, threads)
+			}
+			refreshes++
+			if f.iterations > 0 && refreshes >= f.iterations {
+				return state.render(out, pids, f.rows, interactive)
+			}
+		}
+		if err := state.render(out, pids, f.rows, interactive); err != nil {
+			return err
+		}
+	}
+}
+
+func (f *topFlags) initState() (*topState, error) {
+	state := &topState{space: top.Space(f.space)}
+	switch profile.Type(f.profType) {
+	case profile.TypeOnCPU:
+		state.targetType = base.TargetTypeOnCPU
+	case profile.TypeOffCPU:
+		state.targetType = base.TargetTypeOffCPU
+	default:
+		return nil, fmt.Errorf("unknown profiling type: %s", f.profType)
+	}
+	if state.space != top.SpaceUser && state.space != top.SpaceKernel {
+		return nil, fmt.Errorf("unknown functions space: %s", f.space)
+	}
+	if f.interval <= 0 {
+		return nil, fmt.Errorf("the refresh interval must be bigger than 0")
+	}
+	if f.window < f.interval {
+		return nil, fmt.Errorf("the window could not be smaller than the refresh interval")
+	}
+	state.maxHistory = int((f.window + f.interval - 1) / f.interval)
+	return state, nil
+}
+
+func (s *topState) handleKey(key byte) topAction {
+	switch key {
+	case 'q', 'Q', 3: // ctrl-c is not a signal in the raw mode
+		return topActionQuit
+	case 'u':
+		s.space = top.SpaceUser
+	case 'k':
+		s.space = top.SpaceKernel
+	case 'c':
+		s.byCumulative = !s.byCumulative
+	case ' ':
+		s.frozen = !s.frozen
+	case 'o', 'f':
+		targetType := base.TargetTypeOnCPU
+		if key == 'f' {
+			targetType = base.TargetTypeOffCPU
+		}
+		if targetType == s.targetType {
+			return topActionNone
+		}
+		s.targetType = targetType
+		return topActionSwitch
+	default:
+		return topActionNone
+	}
+	return topActionRender
+}
+
+// switch the runners to the current target type, the samples of the previous type are dropped
+func (s *topState) switchType(ctx context.Context, session *local.Session) {
+	s.history, s.frozen, s.message = nil, false, ""
+	if err := session.Start(ctx, s.targetType); err != nil {
+		s.message = fmt.Sprintf("switch to %s failure: %v", s.targetType, err)
+	}
+}
+
+func (s *topState) add(profiles []*profile.Profile, threads []*top.ThreadUsage) {
+	s.history = append(s.history, profiles)
+	if len(s.history) > s.maxHistory {
+		s.history = s.history[len(s.history)-s.maxHistory:]
+	}
+	s.threads = threads
+}
+
+func (s *topState) profileType() profile.Type {
+	if s.targetType == base.TargetTypeOffCPU {
+		return profile.TypeOffCPU
+	}
+	return profile.TypeOnCPU
+}
+
+func (s *topState) render(out io.Writer, pids []int32, rows int, interactive bool) error {
+	var profiles []*profile.Profile
+	for _, h := range s.history {
+		profiles = append(profiles, h...)
+	}
+	view := &top.View{
+		Time:         time.Now(),
+		Pids:         pids,
+		Table:        top.Aggregate(profiles, s.profileType(), s.space, s.byCumulative),
+		Threads:      s.threads,
+		Frozen:       s.frozen,
+		ByCumulative: s.byCumulative,
+		FunctionRows: rows,
+		ThreadRows:   topThreadRows,
+		Message:      s.message,
+	}
+	if interactive {
+		if width, height, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+			view.Width = width
+			if rows <= 0 {
+				view.FunctionRows = height - topHeaderRows - topThreadRows
+			}
+		}
+	}
+	if view.FunctionRows <= 0 {
+		view.FunctionRows = 20
+	}
+	return top.Render(out, view, interactive)
+}
+
+func readKeys(in io.Reader, keys chan<- byte) {
+	buf := make([]byte, 1)
+	for {
+		if _, err := in.Read(buf); err != nil {
+			return
+		}
+		keys <- buf[0]
+	}
+}
+
+// crlfWriter writes the new line as the carriage return and new line
+type crlfWriter struct {
+	out io.Writer
+}
+
+func (w *crlfWriter) Write(p []byte) (int, error) {
+	if _, err := w.out.Write(bytes.ReplaceAll(p, []byte("\n"), []byte("\r\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
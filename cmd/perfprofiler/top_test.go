@@ -0,0 +1,67 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"perfprofiler/pkg/profiling/task/base"
+	"perfprofiler/pkg/profiling/top"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopState(t *testing.T) {
+	f := &topFlags{profType: "on_cpu", space: "user", interval: time.Second, window: 2500 * time.Millisecond}
+	state, err := f.initState()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, state.maxHistory)
+	for i := 0; i < 5; i++ {
+		state.add(nil, nil)
+	}
+	assert.Len(t, state.history, 3)
+
+	tests := []struct {
+		key    byte
+		action topAction
+		check  func(s *topState) bool
+	}{
+		{key: 'k', action: topActionRender, check: func(s *topState) bool { return s.space == top.SpaceKernel }},
+		{key: 'u', action: topActionRender, check: func(s *topState) bool { return s.space == top.SpaceUser }},
+		{key: 'c', action: topActionRender, check: func(s *topState) bool { return s.byCumulative }},
+		{key: ' ', action: topActionRender, check: func(s *topState) bool { return s.frozen }},
+		{key: 'o', action: topActionNone, check: func(s *topState) bool { return s.targetType == base.TargetTypeOnCPU }},
+		{key: 'f', action: topActionSwitch, check: func(s *topState) bool { return s.targetType == base.TargetTypeOffCPU }},
+		{key: 'x', action: topActionNone, check: func(s *topState) bool { return true }},
+		{key: 'q', action: topActionQuit, check: func(s *topState) bool { return true }},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.action, state.handleKey(tt.key), "key: %c", tt.key)
+		assert.True(t, tt.check(state), "key: %c", tt.key)
+	}
+
+	for _, invalid := range []*topFlags{
+		{profType: "memory", space: "user", interval: time.Second, window: time.Second},
+		{profType: "on_cpu", space: "both", interval: time.Second, window: time.Second},
+		{profType: "on_cpu", space: "user", interval: time.Second, window: time.Millisecond},
+	} {
+		_, err = invalid.initState()
+		assert.Error(t, err)
+	}
+}
@@ -23,6 +23,7 @@ import (
 	"perfprofiler/pkg/module"
 	"perfprofiler/pkg/process"
 	"perfprofiler/pkg/profiling"
+	"perfprofiler/pkg/relay"
 )
 
 func init() {
@@ -31,4 +32,5 @@ func init() {
 	module.Register(core.NewModule())
 	module.Register(process.NewModule())
 	module.Register(profiling.NewModule())
+	module.Register(relay.NewModule())
 }
@@ -33,5 +33,7 @@ type Operator interface {
 	// GetConnectionStatus of connection
 	GetConnectionStatus() ConnectionStatus
 	// RegisterListener of connection status change
-	RegisterListener() chan<- ConnectionStatus
+	RegisterListener() <-chan ConnectionStatus
+	// Certificates of the TLS connection, empty when the TLS is disabled
+	Certificates() []*CertificateInfo
 }
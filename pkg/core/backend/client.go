@@ -22,7 +22,12 @@ import (
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
+	"net"
 	"os"
+	"sync"
+	"sync/atomic"
+
+	"perfprofiler/pkg/logger"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
@@ -30,49 +35,99 @@ import (
 	"google.golang.org/grpc/metadata"
 )
 
+var log = logger.GetLogger("core", "backend")
+
 type Client struct {
 	config *Config
 
-	conn      *grpc.ClientConn
-	status    ConnectionStatus
-	listeners []chan<- ConnectionStatus
-	ctx       context.Context
-	cancel    context.CancelFunc
+	options   []grpc.DialOption
+	resolver  hostResolver
+	failover  *failover
+	addresses []string
+	// the original "<host>:<port>" of the resolved addresses
+	authorities map[string]string
+	conn        *switchableConn
+	// the calls found the server unavailable, check the connection immediately
+	unavailable chan struct{}
+	// the connection of the higher priority server, switched to when it is ready
+	probe *probe
+
+	// the credentials are reloaded when the files changed
+	token            atomic.Value
+	authHash         string
+	tlsHash          string
+	certificatesLock sync.RWMutex
+	certificates     []*CertificateInfo
+
+	statusLock sync.Mutex
+	status     ConnectionStatus
+	listeners  []chan ConnectionStatus
+	ctx        context.Context
+	cancel     context.CancelFunc
 }
 
 func NewClient(config *Config) *Client {
-	return &Client{config: config}
+	return &Client{config: config, resolver: net.DefaultResolver.LookupHost, conn: &switchableConn{},
+		unavailable: make(chan struct{}, 1)}
 }
 
 // Start the backend client and connect to server
 func (c *Client) Start(parent context.Context) error {
 	c.ctx, c.cancel = context.WithCancel(parent)
+	if err := c.loadCredentials(); err != nil {
+		return err
+	}
 	// build config
 	options, err := c.buildConfig(c.config)
 	if err != nil {
 		return err
 	}
+	c.options = options
+	if c.failover, err = newFailover(c.config); err != nil {
+		return err
+	}
+	if c.addresses, c.authorities, err = resolveAddresses(c.ctx, c.resolver, c.config.Addr); err != nil {
+		return err
+	}
 
 	// build connection
-	addr := c.config.Addr
-	conn, err := grpc.Dial(addr, options...)
+	conn, err := c.dial(c.addresses[0])
 	if err != nil {
 		return err
 	}
-	c.conn = conn
+	c.conn.swap(conn, c.addresses[0])
+	if len(c.addresses) > 1 {
+		log.Infof("the backend addresses: %v, failover policy: %s", c.addresses, c.failover.policy)
+	}
 
 	// register status change
 	go c.registerCheckStatus(c.ctx)
 	return nil
 }
 
+func (c *Client) dial(addr string) (*grpc.ClientConn, error) {
+	options := c.options
+	if authority := c.authorities[addr]; authority != "" {
+		// the resolved IP is dialed, but the TLS certificate is verified by the original host
+		options = append(append(make([]grpc.DialOption, 0, len(options)+1), options...), grpc.WithAuthority(authority))
+	}
+	conn, err := grpc.Dial(addr, options...)
+	if err != nil {
+		return nil, err
+	}
+	// connect in the background, so the state could tell whether the server is available
+	conn.Connect()
+	return conn, nil
+}
+
 func (c *Client) GetConnection() grpc.ClientConnInterface {
 	return c.conn
 }
 
 func (c *Client) Stop() error {
 	c.cancel()
-	return c.conn.Close()
+	conn, _ := c.conn.current()
+	return conn.Close()
 }
 
 func (c *Client) buildConfig(conf *Config) ([]grpc.DialOption, error) {
@@ -88,28 +143,31 @@ func (c *Client) buildConfig(conf *Config) ([]grpc.DialOption, error) {
 		options = append(options, grpc.WithTransportCredentials(insecure.NewCredentials()))
 	}
 
-	if conf.Authentication != "" {
-		authHeader := metadata.New(map[string]string{"Authentication": conf.Authentication})
-		options = append(options,
-			grpc.WithStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
-				method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
-				ctx = metadata.NewOutgoingContext(ctx, authHeader)
-				stream, err := streamer(ctx, desc, cc, method, opts...)
-				if err != nil {
-					c.reportError(err)
-				}
-				return stream, err
-			}),
-			grpc.WithUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{},
-				cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-				ctx = metadata.NewOutgoingContext(ctx, authHeader)
-				err := invoker(ctx, method, req, reply, cc, opts...)
-				if err != nil {
-					c.reportError(err)
-				}
-				return err
-			}))
-	}
+	// the errors are reported for the failover, the auth header is only added when configured,
+	// the token is read in each call, so the reloaded token is used without reconnecting
+	options = append(options,
+		grpc.WithStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+			method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			if token := c.currentToken(); token != "" {
+				ctx = metadata.NewOutgoingContext(ctx, metadata.New(map[string]string{"Authentication": token}))
+			}
+			stream, err := streamer(ctx, desc, cc, method, opts...)
+			if err != nil {
+				c.reportError(err)
+			}
+			return stream, err
+		}),
+		grpc.WithUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{},
+			cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			if token := c.currentToken(); token != "" {
+				ctx = metadata.NewOutgoingContext(ctx, metadata.New(map[string]string{"Authentication": token}))
+			}
+			err := invoker(ctx, method, req, reply, cc, opts...)
+			if err != nil {
+				c.reportError(err)
+			}
+			return err
+		}))
 
 	return options, nil
 }
@@ -0,0 +1,324 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package backend
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+
+	commonv3 "skywalking.apache.org/repo/goapi/collect/common/v3"
+	profiling_v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
+)
+
+// fakeServer answers the task query with its name, so the test knows which server is connected
+type fakeServer struct {
+	profiling_v3.UnimplementedEBPFProfilingServiceServer
+
+	name    string
+	address string
+	creds   credentials.TransportCredentials
+	server  *grpc.Server
+
+	lock  sync.Mutex
+	token string
+}
+
+func (f *fakeServer) QueryTasks(ctx context.Context, query *profiling_v3.EBPFProfilingTaskQuery) (*commonv3.Commands, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.token = ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok && len(md.Get("Authentication")) > 0 {
+		f.token = md.Get("Authentication")[0]
+	}
+	return &commonv3.Commands{Commands: []*commonv3.Command{{Command: f.name}}}, nil
+}
+
+// lastToken of the query
+func (f *fakeServer) lastToken() string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.token
+}
+
+func (f *fakeServer) CollectProfilingData(stream profiling_v3.EBPFProfilingService_CollectProfilingDataServer) error {
+	for {
+		if _, err := stream.Recv(); err == io.EOF {
+			return stream.SendAndClose(&commonv3.Commands{})
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// start the server, the previous address is reused when restarting
+func (f *fakeServer) start(t *testing.T) {
+	address := f.address
+	if address == "" {
+		address = "127.0.0.1:0"
+	}
+	listener, err := net.Listen("tcp", address)
+	assert.NoError(t, err)
+	f.address = listener.Addr().String()
+	options := make([]grpc.ServerOption, 0)
+	if f.creds != nil {
+		options = append(options, grpc.Creds(f.creds))
+	}
+	f.server = grpc.NewServer(options...)
+	profiling_v3.RegisterEBPFProfilingServiceServer(f.server, f)
+	go func() {
+		_ = f.server.Serve(listener)
+	}()
+}
+
+func (f *fakeServer) stop() {
+	f.server.Stop()
+}
+
+func startFakeServers(t *testing.T, names ...string) []*fakeServer {
+	servers := make([]*fakeServer, 0, len(names))
+	for _, name := range names {
+		s := &fakeServer{name: name}
+		s.start(t)
+		t.Cleanup(s.stop)
+		servers = append(servers, s)
+	}
+	return servers
+}
+
+func startClient(t *testing.T, config *Config) *Client {
+	if config.CheckPeriod == 0 {
+		config.CheckPeriod = 1
+	}
+	config.FailoverBackoff, config.FailoverMaxBackoff, config.FailbackInterval = "10ms", "40ms", "10ms"
+	client := NewClient(config)
+	assert.NoError(t, client.Start(context.Background()))
+	t.Cleanup(func() {
+		_ = client.Stop()
+	})
+	return client
+}
+
+// waitServer until the query is answered by the server, the failed queries trigger the failover
+func waitServer(t *testing.T, client profiling_v3.EBPFProfilingServiceClient, name string) {
+	assert.Eventually(t, func() bool {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		commands, err := client.QueryTasks(ctx, &profiling_v3.EBPFProfilingTaskQuery{})
+		return err == nil && commands.Commands[0].Command == name
+	}, 10*time.Second, 20*time.Millisecond, "waiting the server %s", name)
+}
+
+func TestRoundRobinFailover(t *testing.T) {
+	servers := startFakeServers(t, "a", "b", "c")
+	addresses := make([]string, 0, len(servers))
+	for _, s := range servers {
+		addresses = append(addresses, s.address)
+	}
+	client := startClient(t, &Config{Addr: strings.Join(addresses, ",")})
+	statuses := client.RegisterListener()
+	profilingClient := profiling_v3.NewEBPFProfilingServiceClient(client.GetConnection())
+	waitServer(t, profilingClient, "a")
+
+	// the active stream is broken when the server stopped, the new stream goes to the next server
+	stream, err := profilingClient.CollectProfilingData(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&profiling_v3.EBPFProfilingData{}))
+	servers[0].stop()
+	_, err = stream.CloseAndRecv()
+	assert.Error(t, err)
+	waitServer(t, profilingClient, "b")
+	assert.Equal(t, Disconnect, <-statuses)
+
+	stream, err = profilingClient.CollectProfilingData(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(&profiling_v3.EBPFProfilingData{}))
+	_, err = stream.CloseAndRecv()
+	assert.NoError(t, err)
+
+	// rotate to the restarted first server after the last server down
+	servers[0].start(t)
+	servers[1].stop()
+	waitServer(t, profilingClient, "c")
+	servers[2].stop()
+	waitServer(t, profilingClient, "a")
+	assert.Eventually(t, func() bool {
+		return client.GetConnectionStatus() == Connected
+	}, 5*time.Second, 20*time.Millisecond)
+}
+
+func TestPriorityFailover(t *testing.T) {
+	servers := startFakeServers(t, "b", "c")
+	// the first address is not listening
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	down := listener.Addr().String()
+	assert.NoError(t, listener.Close())
+
+	client := startClient(t, &Config{Addr: fmt.Sprintf("%s, %s, %s", down, servers[0].address, servers[1].address),
+		FailoverPolicy: FailoverPriority})
+	profilingClient := profiling_v3.NewEBPFProfilingServiceClient(client.GetConnection())
+	waitServer(t, profilingClient, "b")
+	servers[0].stop()
+	waitServer(t, profilingClient, "c")
+}
+
+func TestPriorityFailback(t *testing.T) {
+	servers := startFakeServers(t, "a", "b")
+	client := startClient(t, &Config{Addr: servers[0].address + "," + servers[1].address, FailoverPolicy: FailoverPriority})
+	profilingClient := profiling_v3.NewEBPFProfilingServiceClient(client.GetConnection())
+	waitServer(t, profilingClient, "a")
+	servers[0].stop()
+	waitServer(t, profilingClient, "b")
+
+	// switch back to the first server once it is recovered, the queries keep succeeding on the second server
+	servers[0].start(t)
+	waitServer(t, profilingClient, "a")
+}
+
+func TestFailbackCandidates(t *testing.T) {
+	addresses := []string{"a", "b", "c"}
+	tests := []struct {
+		name    string
+		policy  string
+		current string
+		want    []string
+	}{
+		{name: "priority on the first", policy: FailoverPriority, current: "a", want: []string{}},
+		{name: "priority on the last", policy: FailoverPriority, current: "c", want: []string{"a", "b"}},
+		{name: "round robin", policy: FailoverRoundRobin, current: "c", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newFailover(&Config{FailoverPolicy: tt.policy})
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, f.failbackCandidates(addresses, tt.current))
+		})
+	}
+}
+
+func TestFailoverNext(t *testing.T) {
+	addresses := []string{"a", "b", "c"}
+	tests := []struct {
+		name    string
+		policy  string
+		current []string
+		want    []string
+	}{
+		{name: "round robin", policy: FailoverRoundRobin, current: []string{"a", "b", "c", "x"}, want: []string{"b", "c", "a", "a"}},
+		{name: "priority", policy: FailoverPriority, current: []string{"a", "b", "c", "a"}, want: []string{"b", "c", "a", "b"}},
+		{name: "priority from the middle", policy: FailoverPriority, current: []string{"b", "a"}, want: []string{"a", "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newFailover(&Config{FailoverPolicy: tt.policy, FailoverBackoff: "1s", FailoverMaxBackoff: "4s"})
+			assert.NoError(t, err)
+			now := time.Now()
+			for i, current := range tt.current {
+				next, ok := f.next(addresses, current, now)
+				assert.True(t, ok)
+				assert.Equal(t, tt.want[i], next)
+				// waiting the backoff before the next switching
+				_, ok = f.next(addresses, next, now)
+				assert.False(t, ok)
+				now = now.Add(f.backoff)
+			}
+			assert.Equal(t, 4*time.Second, f.backoff)
+			f.connected()
+			assert.Equal(t, time.Second, f.backoff)
+			_, ok := f.next(addresses, "a", now)
+			assert.True(t, ok)
+		})
+	}
+
+	_, err := newFailover(&Config{FailoverPolicy: "random"})
+	assert.Error(t, err)
+	_, err = newFailover(&Config{FailoverBackoff: "1m", FailoverMaxBackoff: "1s"})
+	assert.Error(t, err)
+}
+
+func TestResolveAddresses(t *testing.T) {
+	resolver := func(ctx context.Context, host string) ([]string, error) {
+		if host == "oap" {
+			return []string{"10.0.0.2", "10.0.0.1"}, nil
+		}
+		return nil, fmt.Errorf("no such host")
+	}
+	tests := []struct {
+		name            string
+		addr            string
+		want            []string
+		wantAuthorities map[string]string
+		wantErr         bool
+	}{
+		{name: "single", addr: "oap:11800", want: []string{"oap:11800"}, wantAuthorities: map[string]string{}},
+		{name: "list", addr: "a:11800, b:11800,", want: []string{"a:11800", "b:11800"}, wantAuthorities: map[string]string{}},
+		{name: "dns", addr: "dns:///oap:11800,c:11800", want: []string{"10.0.0.1:11800", "10.0.0.2:11800", "c:11800"},
+			wantAuthorities: map[string]string{"10.0.0.1:11800": "oap:11800", "10.0.0.2:11800": "oap:11800"}},
+		{name: "unknown host", addr: "dns:///unknown:11800", wantErr: true},
+		{name: "without port", addr: "dns:///oap", wantErr: true},
+		{name: "empty", addr: " , ", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, authorities, err := resolveAddresses(context.Background(), resolver, tt.addr)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+			assert.Equal(t, tt.wantAuthorities, authorities)
+		})
+	}
+}
+
+func TestResolvedAddressTLS(t *testing.T) {
+	// the server certificate only contains the host name, not the IP
+	ca := newTestCA(t, "ca", time.Now().Add(time.Hour))
+	server := &fakeServer{name: "a", creds: credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{ca.server}})}
+	server.start(t)
+	t.Cleanup(server.stop)
+	ip, port, err := net.SplitHostPort(server.address)
+	assert.NoError(t, err)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	assert.NoError(t, os.WriteFile(caFile, ca.pem, 0o600))
+
+	config := &Config{Addr: "dns:///localhost:" + port, EnableTLS: true, CaPemPath: caFile, CheckPeriod: 1}
+	config.FailoverBackoff, config.FailoverMaxBackoff = "10ms", "40ms"
+	client := NewClient(config)
+	client.resolver = func(ctx context.Context, host string) ([]string, error) {
+		return []string{ip}, nil
+	}
+	assert.NoError(t, client.Start(context.Background()))
+	defer client.Stop()
+	waitServer(t, profiling_v3.NewEBPFProfilingServiceClient(client.GetConnection()), "a")
+}
@@ -18,7 +18,12 @@
 package backend
 
 type Config struct {
-	Addr string `mapstructure:"addr"` // Server address
+	Addr string `mapstructure:"addr"` // Server addresses separated by comma, "dns:///<host>:<port>" is resolved to all the IPs of the host
+	// Failover settings when the current server is down, only works with multiple addresses
+	FailoverPolicy     string `mapstructure:"failover_policy"`      // The next address is chosen by "round_robin"(default) or "priority"(the address order)
+	FailoverBackoff    string `mapstructure:"failover_backoff"`     // The backoff before switching again when the new server still down, default is 1s
+	FailoverMaxBackoff string `mapstructure:"failover_max_backoff"` // The max backoff of the exponential backoff, default is 30s
+	FailbackInterval   string `mapstructure:"failback_interval"`    // The interval of checking the recovered higher priority servers, only works with "priority", default is 30s
 	// TLS settings
 	EnableTLS          bool   `mapstructure:"enable_tls"`           // Enable TLS connect to server
 	ClientPemPath      string `mapstructure:"client_pem_path"`      // The file path of client.pem. The config only works when opening the TLS switch.
@@ -26,5 +31,6 @@ type Config struct {
 	CaPemPath          string `mapstructure:"ca_pem_path"`          // The file path oca.pem. The config only works when opening the TLS switch.
 	InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"` // Controls whether a client verifies the server's certificate chain and host name.
 	Authentication     string `mapstructure:"authentication"`       // The auth value when send request
-	CheckPeriod        int    `mapstructure:"check_period"`         // How frequently to check the connection(second)
+	AuthenticationFile string `mapstructure:"authentication_file"`  // The file path of the auth value, preferred over the inline value, reloaded when changed
+	CheckPeriod        int    `mapstructure:"check_period"`         // How frequently to check the connection and reload the changed token and TLS files(second)
 }
@@ -0,0 +1,222 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package backend
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+const (
+	FailoverRoundRobin = "round_robin"
+	FailoverPriority   = "priority"
+
+	dnsPrefix = "dns:///"
+
+	defaultFailoverBackoff    = time.Second
+	defaultFailoverMaxBackoff = 30 * time.Second
+	defaultFailbackInterval   = 30 * time.Second
+)
+
+type hostResolver func(ctx context.Context, host string) ([]string, error)
+
+// resolveAddresses of the config, the "dns:///" address is resolved to all the IPs of the host,
+// the authorities keep the original host of the resolved addresses, works for the TLS server name verification
+func resolveAddresses(ctx context.Context, resolver hostResolver, addr string) (result []string, authorities map[string]string,
+	err error) {
+	result, authorities = make([]string, 0), make(map[string]string)
+	for _, a := range strings.Split(addr, ",") {
+		a = strings.TrimSpace(a)
+		if a == "" {
+			continue
+		}
+		target, ok := strings.CutPrefix(a, dnsPrefix)
+		if !ok {
+			result = append(result, a)
+			continue
+		}
+		host, port, err := net.SplitHostPort(target)
+		if err != nil {
+			return nil, nil, fmt.Errorf("illegal backend address: %s, error: %v", a, err)
+		}
+		ips, err := resolver(ctx, host)
+		if err != nil {
+			return nil, nil, fmt.Errorf("resolve the backend address failure: %s, error: %v", host, err)
+		}
+		// keep the order stable, so the round-robin would not be disturbed by the re-resolving
+		sort.Strings(ips)
+		for _, ip := range ips {
+			resolved := net.JoinHostPort(ip, port)
+			result = append(result, resolved)
+			authorities[resolved] = target
+		}
+	}
+	if len(result) == 0 {
+		return nil, nil, fmt.Errorf("no backend address: %q", addr)
+	}
+	return result, authorities, nil
+}
+
+// failover chooses the next address when the current server is down,
+// the switching is backoff exponentially until the server is connected
+type failover struct {
+	policy                     string
+	initialBackoff, maxBackoff time.Duration
+	failbackInterval           time.Duration
+	random                     *rand.Rand
+
+	backoff    time.Duration
+	nextSwitch time.Time
+	// the addresses down after the last connected, works for the priority policy
+	tried map[string]bool
+}
+
+func newFailover(config *Config) (*failover, error) {
+	f := &failover{policy: config.FailoverPolicy, initialBackoff: defaultFailoverBackoff, maxBackoff: defaultFailoverMaxBackoff,
+		failbackInterval: defaultFailbackInterval, random: rand.New(rand.NewSource(time.Now().UnixNano())),
+		tried: make(map[string]bool)}
+	switch f.policy {
+	case "":
+		f.policy = FailoverRoundRobin
+	case FailoverRoundRobin, FailoverPriority:
+	default:
+		return nil, fmt.Errorf("unknown backend failover policy: %s", f.policy)
+	}
+	var err error
+	if config.FailoverBackoff != "" {
+		if f.initialBackoff, err = time.ParseDuration(config.FailoverBackoff); err != nil {
+			return nil, fmt.Errorf("parsing the backend failover backoff failure: %v", err)
+		}
+	}
+	if config.FailoverMaxBackoff != "" {
+		if f.maxBackoff, err = time.ParseDuration(config.FailoverMaxBackoff); err != nil {
+			return nil, fmt.Errorf("parsing the backend failover max backoff failure: %v", err)
+		}
+	}
+	if config.FailbackInterval != "" {
+		if f.failbackInterval, err = time.ParseDuration(config.FailbackInterval); err != nil {
+			return nil, fmt.Errorf("parsing the backend failback interval failure: %v", err)
+		}
+	}
+	if f.initialBackoff <= 0 || f.maxBackoff < f.initialBackoff {
+		return nil, fmt.Errorf("the backend failover backoff must be positive and not bigger than the max backoff")
+	}
+	f.backoff = f.initialBackoff
+	return f, nil
+}
+
+// next address of the current address which down, returns false when waiting for the backoff
+func (f *failover) next(addresses []string, current string, now time.Time) (string, bool) {
+	if now.Before(f.nextSwitch) {
+		return "", false
+	}
+	f.tried[current] = true
+	result := ""
+	if f.policy == FailoverPriority {
+		for _, a := range addresses {
+			if !f.tried[a] {
+				result = a
+				break
+			}
+		}
+		// all the addresses are down, start again from the highest priority
+		if result == "" {
+			f.tried = make(map[string]bool)
+			result = addresses[0]
+		}
+	} else {
+		result = addresses[0]
+		for i, a := range addresses {
+			if a == current {
+				result = addresses[(i+1)%len(addresses)]
+				break
+			}
+		}
+	}
+
+	// the first switching is immediate, the following switching waits the jittered backoff
+	f.nextSwitch = now.Add(f.backoff/2 + time.Duration(f.random.Int63n(int64(f.backoff/2)+1)))
+	f.backoff *= 2
+	if f.backoff > f.maxBackoff {
+		f.backoff = f.maxBackoff
+	}
+	return result, true
+}
+
+// failbackCandidates are the addresses with the higher priority than the current address,
+// empty when the policy is not the priority
+func (f *failover) failbackCandidates(addresses []string, current string) []string {
+	if f.policy != FailoverPriority {
+		return nil
+	}
+	for i, a := range addresses {
+		if a == current {
+			return addresses[:i]
+		}
+	}
+	return addresses
+}
+
+// connected resets the backoff
+func (f *failover) connected() {
+	f.backoff, f.nextSwitch = f.initialBackoff, time.Time{}
+	if len(f.tried) > 0 {
+		f.tried = make(map[string]bool)
+	}
+}
+
+// switchableConn is the stable connection for the service clients, the calls are sent to the current server
+type switchableConn struct {
+	lock sync.RWMutex
+	conn *grpc.ClientConn
+	addr string
+}
+
+func (s *switchableConn) current() (*grpc.ClientConn, string) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.conn, s.addr
+}
+
+// swap the connection, returns the previous connection
+func (s *switchableConn) swap(conn *grpc.ClientConn, addr string) *grpc.ClientConn {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	previous := s.conn
+	s.conn, s.addr = conn, addr
+	return previous
+}
+
+func (s *switchableConn) Invoke(ctx context.Context, method string, args, reply interface{}, opts ...grpc.CallOption) error {
+	conn, _ := s.current()
+	return conn.Invoke(ctx, method, args, reply, opts...)
+}
+
+func (s *switchableConn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string,
+	opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	conn, _ := s.current()
+	return conn.NewStream(ctx, desc, method, opts...)
+}
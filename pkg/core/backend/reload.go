@@ -0,0 +1,205 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package backend
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// the certificates expire soon are warned when loaded
+const certificateExpiryWarning = 7 * 24 * time.Hour
+
+// CertificateInfo is the TLS certificate used to connect to the backend
+type CertificateInfo struct {
+	Path     string
+	Subject  string
+	Serial   string
+	NotAfter time.Time
+}
+
+// loadToken of the authentication, the file is preferred over the inline value
+func loadToken(conf *Config) (string, error) {
+	if conf.AuthenticationFile == "" {
+		return conf.Authentication, nil
+	}
+	content, err := os.ReadFile(conf.AuthenticationFile)
+	if err != nil {
+		return "", fmt.Errorf("reading the authentication file failure: %v", err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+func tlsFiles(conf *Config) []string {
+	if !conf.EnableTLS {
+		return nil
+	}
+	files := make([]string, 0, 3)
+	for _, f := range []string{conf.CaPemPath, conf.ClientPemPath, conf.ClientKeyPath} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// hashFiles of the content, the unreadable file returns the error
+func hashFiles(files []string) (string, error) {
+	hash := sha256.New()
+	for _, f := range files {
+		content, err := os.ReadFile(f)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "%s:%d\n", f, len(content))
+		hash.Write(content)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// loadCertificates of the CA and client certificate files
+func loadCertificates(conf *Config) ([]*CertificateInfo, error) {
+	if !conf.EnableTLS {
+		return nil, nil
+	}
+	result := make([]*CertificateInfo, 0)
+	for _, path := range []string{conf.CaPemPath, conf.ClientPemPath} {
+		if path == "" {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for block, rest := pem.Decode(content); block != nil; block, rest = pem.Decode(rest) {
+			if block.Type != "CERTIFICATE" {
+				continue
+			}
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("parsing the certificate of %s failure: %v", path, err)
+			}
+			result = append(result, &CertificateInfo{Path: path, Subject: cert.Subject.String(),
+				Serial: cert.SerialNumber.String(), NotAfter: cert.NotAfter})
+		}
+	}
+	return result, nil
+}
+
+// Certificates used to connect to the backend, empty when the TLS is disabled
+func (c *Client) Certificates() []*CertificateInfo {
+	c.certificatesLock.RLock()
+	defer c.certificatesLock.RUnlock()
+	return c.certificates
+}
+
+func (c *Client) currentToken() string {
+	token, _ := c.token.Load().(string)
+	return token
+}
+
+// loadCredentials at the startup, the token and TLS files must be readable
+func (c *Client) loadCredentials() error {
+	token, err := loadToken(c.config)
+	if err != nil {
+		return err
+	}
+	c.token.Store(token)
+	if c.authHash, err = hashFiles(nonEmpty(c.config.AuthenticationFile)); err != nil {
+		return err
+	}
+	if c.tlsHash, err = hashFiles(tlsFiles(c.config)); err != nil {
+		return err
+	}
+	return c.updateCertificates()
+}
+
+func nonEmpty(file string) []string {
+	if file == "" {
+		return nil
+	}
+	return []string{file}
+}
+
+func (c *Client) updateCertificates() error {
+	certificates, err := loadCertificates(c.config)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, cert := range certificates {
+		if cert.NotAfter.Sub(now) < certificateExpiryWarning {
+			log.Warnf("the backend certificate %q of %s expires at %s", cert.Subject, cert.Path, cert.NotAfter.Format(time.RFC3339))
+		}
+	}
+	c.certificatesLock.Lock()
+	defer c.certificatesLock.Unlock()
+	c.certificates = certificates
+	return nil
+}
+
+// reloadCredentials when the token or TLS files changed, the previous credentials are kept when the files are illegal,
+// the TLS changing reconnects to the current server with the new credentials
+func (c *Client) reloadCredentials() {
+	if authHash, err := hashFiles(nonEmpty(c.config.AuthenticationFile)); err != nil {
+		log.Warnf("checking the authentication file failure, keep using the previous token: %v", err)
+	} else if authHash != c.authHash {
+		token, err := loadToken(c.config)
+		if err != nil {
+			log.Warnf("reloading the authentication token failure, keep using the previous token: %v", err)
+		} else {
+			c.token.Store(token)
+			c.authHash = authHash
+			log.Infof("the backend authentication token is reloaded")
+		}
+	}
+
+	tlsHash, err := hashFiles(tlsFiles(c.config))
+	if err != nil {
+		log.Warnf("checking the TLS files failure, keep using the previous credentials: %v", err)
+		return
+	} else if tlsHash == c.tlsHash {
+		return
+	}
+	options, err := c.buildConfig(c.config)
+	if err != nil {
+		log.Warnf("rebuilding the TLS credentials failure, keep using the previous credentials: %v", err)
+		return
+	}
+	if err := c.updateCertificates(); err != nil {
+		log.Warnf("reading the TLS certificates failure, keep using the previous credentials: %v", err)
+		return
+	}
+	c.options, c.tlsHash = options, tlsHash
+	_, addr := c.conn.current()
+	conn, err := c.dial(addr)
+	if err != nil {
+		log.Warnf("reconnect to the backend %s with the new TLS credentials failure: %v", addr, err)
+		return
+	}
+	if err := c.conn.swap(conn, addr).Close(); err != nil {
+		log.Warnf("close the previous connection of the backend %s failure: %v", addr, err)
+	}
+	log.Infof("the backend TLS credentials are reloaded, reconnected to %s", addr)
+}
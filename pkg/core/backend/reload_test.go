@@ -0,0 +1,144 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package backend
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/credentials"
+
+	profiling_v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
+)
+
+func TestReloadToken(t *testing.T) {
+	servers := startFakeServers(t, "a")
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("first\n"), 0o600))
+	// the credentials are only reloaded by the test
+	client := startClient(t, &Config{Addr: servers[0].address, Authentication: "inline", AuthenticationFile: tokenFile,
+		CheckPeriod: 3600})
+	profilingClient := profiling_v3.NewEBPFProfilingServiceClient(client.GetConnection())
+	waitServer(t, profilingClient, "a")
+	assert.Equal(t, "first", servers[0].lastToken())
+
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("second"), 0o600))
+	client.reloadCredentials()
+	waitServer(t, profilingClient, "a")
+	assert.Equal(t, "second", servers[0].lastToken())
+
+	// the previous token is kept when the file is removed
+	assert.NoError(t, os.Remove(tokenFile))
+	client.reloadCredentials()
+	waitServer(t, profilingClient, "a")
+	assert.Equal(t, "second", servers[0].lastToken())
+}
+
+// testCA signs the server certificate of the localhost
+type testCA struct {
+	pem    []byte
+	server tls.Certificate
+}
+
+func newTestCA(t *testing.T, name string, notAfter time.Time) *testCA {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	caTemplate := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: name},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: notAfter, IsCA: true, BasicConstraintsValid: true,
+		KeyUsage: x509.KeyUsageCertSign}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	assert.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	assert.NoError(t, err)
+
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	serverTemplate := &x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "localhost"},
+		DNSNames: []string{"localhost"}, NotBefore: time.Now().Add(-time.Hour), NotAfter: notAfter,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}
+	serverDER, err := x509.CreateCertificate(rand.Reader, serverTemplate, ca, &serverKey.PublicKey, caKey)
+	assert.NoError(t, err)
+	return &testCA{
+		pem:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		server: tls.Certificate{Certificate: [][]byte{serverDER}, PrivateKey: serverKey},
+	}
+}
+
+func TestReloadTLS(t *testing.T) {
+	first := newTestCA(t, "first", time.Now().Add(48*time.Hour).Truncate(time.Second))
+	second := newTestCA(t, "second", time.Now().Add(96*time.Hour).Truncate(time.Second))
+	// the server certificate is rotated without restarting
+	var serverCert atomic.Value
+	serverCert.Store(&first.server)
+	server := &fakeServer{name: "a", creds: credentials.NewTLS(&tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return serverCert.Load().(*tls.Certificate), nil
+		}})}
+	server.start(t)
+	t.Cleanup(server.stop)
+	_, port, err := net.SplitHostPort(server.address)
+	assert.NoError(t, err)
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	assert.NoError(t, os.WriteFile(caFile, first.pem, 0o600))
+	client := startClient(t, &Config{Addr: net.JoinHostPort("localhost", port), EnableTLS: true, CaPemPath: caFile,
+		CheckPeriod: 3600})
+	profilingClient := profiling_v3.NewEBPFProfilingServiceClient(client.GetConnection())
+	waitServer(t, profilingClient, "a")
+	assert.Equal(t, "CN=first", client.Certificates()[0].Subject)
+
+	// the illegal CA file is not loaded
+	previous, _ := client.conn.current()
+	serverCert.Store(&second.server)
+	assert.NoError(t, os.WriteFile(caFile, []byte("illegal"), 0o600))
+	client.reloadCredentials()
+	assert.Equal(t, "CN=first", client.Certificates()[0].Subject)
+	current, _ := client.conn.current()
+	assert.Same(t, previous, current)
+
+	// reconnected with the new CA, the server certificate signed by the new CA is trusted
+	assert.NoError(t, os.WriteFile(caFile, second.pem, 0o600))
+	client.reloadCredentials()
+	current, _ = client.conn.current()
+	assert.NotSame(t, previous, current)
+	waitServer(t, profilingClient, "a")
+	certificates := client.Certificates()
+	assert.Len(t, certificates, 1)
+	assert.Equal(t, &CertificateInfo{Path: caFile, Subject: "CN=second", Serial: "1", NotAfter: second.notAfter(t)},
+		certificates[0])
+}
+
+func (c *testCA) notAfter(t *testing.T) time.Time {
+	block, _ := pem.Decode(c.pem)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.NoError(t, err)
+	return cert.NotAfter
+}
@@ -21,6 +21,7 @@ import (
 	"context"
 	"time"
 
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/connectivity"
 	"google.golang.org/grpc/status"
@@ -30,27 +31,141 @@ func (c *Client) registerCheckStatus(ctx context.Context) {
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	timeTicker := time.NewTicker(time.Duration(c.config.CheckPeriod) * time.Second)
+	defer timeTicker.Stop()
 	for {
 		select {
 		case <-timeTicker.C:
-			state := c.conn.GetState()
-			if state == connectivity.Shutdown || state == connectivity.TransientFailure {
-				c.updateStatus(Disconnect)
-			} else if state == connectivity.Ready || state == connectivity.Idle {
-				c.updateStatus(Connected)
-			}
+			c.reloadCredentials()
+			c.checkStatus(ctx, false)
+		case <-c.unavailable:
+			c.checkStatus(ctx, true)
 		case <-ctx.Done():
-			timeTicker.Stop()
+			c.closeProbe()
+			return
+		}
+	}
+}
+
+// checkStatus of the current server, switch to the next server when it is down
+func (c *Client) checkStatus(ctx context.Context, unavailable bool) {
+	conn, addr := c.conn.current()
+	state := conn.GetState()
+	switch {
+	case state == connectivity.Ready:
+		c.updateStatus(Connected)
+		c.failover.connected()
+		c.failback(addr, time.Now())
+		return
+	case state == connectivity.Idle && !unavailable:
+		c.updateStatus(Connected)
+		// the connection is idle after the server closed, reconnect it, so the next check could find the server down
+		conn.Connect()
+		return
+	case state == connectivity.Connecting && !unavailable:
+		return
+	}
+	c.updateStatus(Disconnect)
+	c.switchServer(ctx, addr)
+}
+
+// switchServer to the next address by the failover policy, the addresses are resolved again before switching
+func (c *Client) switchServer(ctx context.Context, current string) {
+	if addresses, authorities, err := resolveAddresses(ctx, c.resolver, c.config.Addr); err != nil {
+		log.Warnf("resolve the backend addresses failure, keep using the previous addresses: %v", err)
+	} else {
+		c.addresses, c.authorities = addresses, authorities
+	}
+	if len(c.addresses) == 1 && c.addresses[0] == current {
+		// only one server, reconnecting by the gRPC itself
+		return
+	}
+	next, ok := c.failover.next(c.addresses, current, time.Now())
+	if !ok {
+		return
+	}
+	c.closeProbe()
+	conn, err := c.dial(next)
+	if err != nil {
+		log.Warnf("connect to the backend %s failure: %v", next, err)
+		return
+	}
+	if ctx.Err() != nil {
+		_ = conn.Close()
+		return
+	}
+	// the running calls of the previous server are canceled, the callers would call again through the new server
+	if err := c.conn.swap(conn, next).Close(); err != nil {
+		log.Warnf("close the connection of the backend %s failure: %v", current, err)
+	}
+	log.Warnf("the backend %s is unavailable, switched to %s", current, next)
+}
+
+// probe is the connection of a higher priority server, for checking whether the server is recovered
+type probe struct {
+	conn *grpc.ClientConn
+	addr string
+	// the index of the probed address in the failback candidates, the next candidate is probed after failure
+	index int
+	next  time.Time
+}
+
+// failback to the recovered higher priority server when connected to the lower priority one, works for the priority policy
+func (c *Client) failback(current string, now time.Time) {
+	candidates := c.failover.failbackCandidates(c.addresses, current)
+	if len(candidates) == 0 {
+		c.closeProbe()
+		return
+	}
+	if c.probe == nil {
+		c.probe = &probe{next: now.Add(c.failover.failbackInterval)}
+	}
+	p := c.probe
+	if p.conn != nil {
+		switch p.conn.GetState() {
+		case connectivity.Ready:
+			previous := c.conn.swap(p.conn, p.addr)
+			log.Infof("the higher priority backend %s is recovered, switched from %s", p.addr, current)
+			c.probe = nil
+			if err := previous.Close(); err != nil {
+				log.Warnf("close the connection of the backend %s failure: %v", current, err)
+			}
+			return
+		case connectivity.Idle, connectivity.Connecting:
 			return
 		}
+		// still down, probe the next candidate after the interval
+		_ = p.conn.Close()
+		p.conn, p.index, p.next = nil, p.index+1, now.Add(c.failover.failbackInterval)
 	}
+	if now.Before(p.next) {
+		return
+	}
+	addr := candidates[p.index%len(candidates)]
+	conn, err := c.dial(addr)
+	if err != nil {
+		log.Warnf("connect to the backend %s for the failback failure: %v", addr, err)
+		p.next = now.Add(c.failover.failbackInterval)
+		return
+	}
+	p.conn, p.addr = conn, addr
+}
+
+func (c *Client) closeProbe() {
+	if c.probe != nil && c.probe.conn != nil {
+		_ = c.probe.conn.Close()
+	}
+	c.probe = nil
 }
 
 func (c *Client) GetConnectionStatus() ConnectionStatus {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
 	return c.status
 }
 
-func (c *Client) RegisterListener() chan<- ConnectionStatus {
+func (c *Client) RegisterListener() <-chan ConnectionStatus {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
 	statuses := make(chan ConnectionStatus, 1)
 	c.listeners = append(c.listeners, statuses)
 	return statuses
@@ -67,14 +182,30 @@ func (c *Client) reportError(err error) {
 			errCode == codes.Unauthenticated || errCode == codes.ResourceExhausted || errCode == codes.Unknown {
 			c.updateStatus(Disconnect)
 		}
+		if errCode == codes.Unavailable {
+			select {
+			case c.unavailable <- struct{}{}:
+			default:
+			}
+		}
 	}
 }
 
 func (c *Client) updateStatus(s ConnectionStatus) {
+	c.statusLock.Lock()
+	defer c.statusLock.Unlock()
 	if c.status != s {
 		c.status = s
 		for _, lis := range c.listeners {
-			lis <- s
+			// only the latest status is kept, the slow listener should not block the status checking
+			select {
+			case <-lis:
+			default:
+			}
+			select {
+			case lis <- s:
+			default:
+			}
 		}
 	}
 }
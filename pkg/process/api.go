@@ -24,6 +24,8 @@ type Operator interface {
 	FindProcessByID(processID string) api.ProcessInterface
 	// FindProcessByPID get all processes with difference entity through process PID
 	FindProcessByPID(pid int32) []api.ProcessInterface
+	// GetAllProcesses find all detected processes, including the processes not registered to the backend
+	GetAllProcesses() []api.ProcessInterface
 	// FindAllRegisteredProcesses find all registered processes
 	FindAllRegisteredProcesses() []api.ProcessInterface
 	// AddListener add new process listener
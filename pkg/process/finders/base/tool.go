@@ -21,6 +21,7 @@ import (
 	"fmt"
 	"reflect"
 	"sort"
+	"strings"
 
 	v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/process/v3"
 
@@ -56,6 +57,12 @@ func tryToFindFileExecutePath(ps *process.Process) string {
 	if path.Exists(pathInNs) {
 		return pathInNs
 	}
+	// the executable file has been deleted or replaced, read the running file from the process
+	if strings.HasSuffix(exe, " (deleted)") {
+		if procExe := host.GetFileInHost(fmt.Sprintf("/proc/%d/exe", ps.Pid)); path.Exists(procExe) {
+			return procExe
+		}
+	}
 	return ""
 }
 
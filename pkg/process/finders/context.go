@@ -69,6 +69,7 @@ func (p *ProcessContext) Entity() *api.ProcessEntity {
 	return p.detectProcess.Entity()
 }
 
+// ProfilingStat of the process, the new loaded modules(such as dlopen) are appended into the stat when symbolize
 func (p *ProcessContext) ProfilingStat() *profiling.Info {
 	return p.detectProcess.ProfilingStat()
 }
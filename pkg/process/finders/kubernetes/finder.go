@@ -238,6 +238,10 @@ func (f *ProcessFinder) buildProcesses(p *process.Process, pc *PodContainer) ([]
 		entity.ProcessName, err = f.buildEntity(err, p, pc, builder.ProcessNameBuilder)
 		entity.Labels = builder.Labels
 		if err != nil {
+			// the built processes are dropped, release the symbol tables
+			for _, ps := range processes {
+				ps.ProfilingStat().Release()
+			}
 			return nil, err
 		}
 		processes = append(processes, NewProcess(p, cmdline, pc, entity))
@@ -355,6 +355,7 @@ func (p *ProcessFinder) regexFindMatchedProcesses() ([]*Process, error) {
 		ps.entity.Labels = finderConfig.ParsedLabels
 		if err != nil {
 			log.Warnf("failed to build the process data for pid: %d, reason: %v", pro.Pid, err)
+			ps.profiling.Release()
 			continue
 		} else {
 			findedProcesses = append(findedProcesses, ps)
@@ -377,8 +378,12 @@ func (p *ProcessFinder) regexFindMatchedProcesses() ([]*Process, error) {
 		reportProcess := psList[0]
 		if len(psList) > 1 {
 			pidList := make([]int32, 0)
-			for _, ps := range psList {
+			for i, ps := range psList {
 				pidList = append(pidList, ps.pid)
+				// the not reported processes are dropped, release the symbol tables
+				if i > 0 {
+					ps.profiling.Release()
+				}
 			}
 			log.WithField("command_line", reportProcess.cmd).
 				WithField("service_name", reportProcess.entity.ServiceName).
@@ -19,6 +19,9 @@ package finders
 
 import (
 	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -63,8 +66,11 @@ func NewProcessStorage(ctx context.Context, moduleManager *module.Manager, repor
 	// working with core module
 	coreOperator := moduleManager.FindModule(core.ModuleName).(core.Operator)
 	roverID := coreOperator.InstanceID()
-	backendConn := coreOperator.BackendOperator().GetConnection()
-	processClient := v3.NewEBPFProcessServiceClient(backendConn)
+	// the processes are registered locally when working without the backend
+	var processClient v3.EBPFProcessServiceClient
+	if backend := coreOperator.BackendOperator(); backend != nil {
+		processClient = v3.NewEBPFProcessServiceClient(backend.GetConnection())
+	}
 	ctx, cancel := context.WithCancel(ctx)
 	fs := make(map[api.ProcessDetectType]base.ProcessFinder)
 	for _, f := range finderList {
@@ -147,6 +153,11 @@ func (s *ProcessStorage) reportAllProcesses() error {
 		}
 	}
 
+	if s.processClient == nil {
+		s.registerProcessesLocally(waitReportProcesses)
+		return nil
+	}
+
 	// if rover should report the properties, then need to force remove all keep alive processes to report
 	shouldReportProperties := atomic.AddInt64(&s.reportedCount, 1)%int64(s.propertiesReportFactor) == 0
 	if shouldReportProperties {
@@ -237,6 +248,22 @@ func (s *ProcessStorage) processesReport(waitReportProcesses []*ProcessContext)
 	return nil
 }
 
+// registerProcessesLocally without the backend, the process ID is generated by the pid and entity
+func (s *ProcessStorage) registerProcessesLocally(processes []*ProcessContext) {
+	if len(processes) == 0 {
+		return
+	}
+	eventBuilder := s.newProcessEventBuilder(ProcessOperateAdd)
+	for _, p := range processes {
+		entity := p.Entity()
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(strings.Join([]string{entity.Layer, entity.ServiceName, entity.InstanceName, entity.ProcessName}, "\n")))
+		s.updateProcessToUploadSuccess(p, fmt.Sprintf("local-%d-%08x", p.Pid(), h.Sum32()))
+		eventBuilder.AddProcess(p.Pid(), p)
+	}
+	eventBuilder.Send()
+}
+
 func (s *ProcessStorage) SyncAllProcessInFinder(finder api.ProcessDetectType, processes []base.DetectedProcess) {
 	s.mutex.Lock()
 	defer s.mutex.Unlock()
@@ -253,6 +280,10 @@ func (s *ProcessStorage) SyncAllProcessInFinder(finder api.ProcessDetectType, pr
 		founded := false
 		for _, existingProcess := range existingProcesses {
 			if syncProcess.Pid() == existingProcess.Pid() && syncProcess.Entity().SameWith(existingProcess.Entity()) {
+				// the detected process is duplicated with the existing process, release the symbol tables
+				if syncProcess != existingProcess.detectProcess {
+					syncProcess.ProfilingStat().Release()
+				}
 				newProcesses = append(newProcesses, existingProcess)
 				existingProcessHasFounded[existingProcess] = true
 				founded = true
@@ -275,6 +306,7 @@ func (s *ProcessStorage) SyncAllProcessInFinder(finder api.ProcessDetectType, pr
 		}
 		log.Infof("the process has been recognized as dead, so deleted. pid: %d, entity: %s, id: %s", p.Pid(), p.Entity(), p.id)
 		eventBuilder.AddProcess(p.Pid(), p)
+		p.ProfilingStat().Release()
 	}
 
 	s.processes[finder] = newProcesses
@@ -0,0 +1,270 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package capture
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"time"
+
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/export/pprof"
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/tools/operator"
+)
+
+// BundleVersion is the version of the bundle layout
+const BundleVersion = 1
+
+// the files in the bundle
+const (
+	manifestFile = "manifest.json"
+	systemFile   = "system.json"
+	configFile   = "agent.yaml"
+	profilesDir  = "profiles"
+)
+
+// Bundle is the profiling data captured on a machine, works for analyzing it in other environments
+type Bundle struct {
+	Manifest *Manifest
+	System   *System
+	// Config is the content of the agent config file, empty when not provided
+	Config []byte
+	// Entries of the captured profiles, ordered the same with the manifest
+	Entries []*Entry
+}
+
+// Manifest is the index of the bundle
+type Manifest struct {
+	Version      int             `json:"version"`
+	AgentVersion string          `json:"agentVersion"`
+	CreateTime   time.Time       `json:"createTime"`
+	Duration     string          `json:"duration"`
+	Types        []profile.Type  `json:"types"`
+	Processes    []*Process      `json:"processes"`
+	Profiles     []*ProfileFiles `json:"profiles"`
+	Errors       []string        `json:"errors,omitempty"`
+}
+
+// Process is the metadata of the captured process
+type Process struct {
+	Pid         int32    `json:"pid"`
+	Layer       string   `json:"layer"`
+	Service     string   `json:"service"`
+	Instance    string   `json:"instance"`
+	Process     string   `json:"process"`
+	Labels      []string `json:"labels"`
+	Exe         string   `json:"exe"`
+	CommandLine string   `json:"commandLine"`
+}
+
+// ProfileFiles are the files of a captured profile in the bundle
+type ProfileFiles struct {
+	Pid  int32        `json:"pid"`
+	Type profile.Type `json:"type"`
+	// the raw stack counts with the unsymbolized addresses
+	Raw string `json:"raw"`
+	// the symbolized profile in pprof format
+	Symbolized string `json:"symbolized"`
+}
+
+// System is the information of the captured machine
+type System struct {
+	Hostname     string                     `json:"hostname"`
+	HostIP       string                     `json:"hostIp"`
+	Uname        *operator.UnameInfo        `json:"uname"`
+	Distribution *operator.DistributionInfo `json:"distribution"`
+}
+
+// Entry is a captured profile of a process
+type Entry struct {
+	Raw *RawProfile
+	// Profile is the symbolized profile in the capturing machine
+	Profile *profile.Profile
+}
+
+// Entity of the process, return nil if the process not in the manifest
+func (m *Manifest) Entity(pid int32) *api.ProcessEntity {
+	for _, p := range m.Processes {
+		if p.Pid == pid {
+			return &api.ProcessEntity{Layer: p.Layer, ServiceName: p.Service, InstanceName: p.Instance,
+				ProcessName: p.Process, Labels: p.Labels}
+		}
+	}
+	return nil
+}
+
+// Write the bundle as the gzipped tarball, the profile files in the manifest are generated by the entries
+func (b *Bundle) Write(w io.Writer) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	modTime := b.Manifest.CreateTime
+	b.Manifest.Version = BundleVersion
+	b.Manifest.Profiles = make([]*ProfileFiles, 0, len(b.Entries))
+	files := make(map[string][]byte)
+	for i, e := range b.Entries {
+		name := fmt.Sprintf("%d-%s-%d", e.Raw.Pid, e.Raw.Type, i)
+		entry := &ProfileFiles{Pid: e.Raw.Pid, Type: e.Raw.Type,
+			Raw: path.Join(profilesDir, name+".raw.json"), Symbolized: path.Join(profilesDir, name+".pb.gz")}
+		raw, err := json.Marshal(e.Raw)
+		if err != nil {
+			return err
+		}
+		symbolized := &bytes.Buffer{}
+		if err := pprof.Write(symbolized, e.Profile); err != nil {
+			return fmt.Errorf("encode the profile of pid %d failure: %v", e.Raw.Pid, err)
+		}
+		files[entry.Raw], files[entry.Symbolized] = raw, symbolized.Bytes()
+		b.Manifest.Profiles = append(b.Manifest.Profiles, entry)
+	}
+
+	writeFile := func(name string, content []byte) error {
+		header := &tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), ModTime: modTime}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(content)
+		return err
+	}
+	manifest, err := json.MarshalIndent(b.Manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(manifestFile, manifest); err != nil {
+		return err
+	}
+	system, err := json.MarshalIndent(b.System, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(systemFile, system); err != nil {
+		return err
+	}
+	if len(b.Config) > 0 {
+		if err := writeFile(configFile, b.Config); err != nil {
+			return err
+		}
+	}
+	for _, f := range b.Manifest.Profiles {
+		if err := writeFile(f.Raw, files[f.Raw]); err != nil {
+			return err
+		}
+		if err := writeFile(f.Symbolized, files[f.Symbolized]); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// WriteFile writes the bundle into the file
+func (b *Bundle) WriteFile(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err := b.Write(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Read the bundle from the gzipped tarball
+func Read(r io.Reader) (*Bundle, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("the bundle is not a gzipped file: %v", err)
+	}
+	defer gz.Close()
+	files := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("reading the bundle failure: %v", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		content, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		files[path.Clean(header.Name)] = content
+	}
+
+	bundle := &Bundle{Manifest: &Manifest{}, System: &System{}, Config: files[configFile]}
+	if err := unmarshalFile(files, manifestFile, bundle.Manifest); err != nil {
+		return nil, err
+	}
+	if bundle.Manifest.Version > BundleVersion {
+		return nil, fmt.Errorf("the bundle version %d is not supported, the max supported version is %d",
+			bundle.Manifest.Version, BundleVersion)
+	}
+	if err := unmarshalFile(files, systemFile, bundle.System); err != nil {
+		return nil, err
+	}
+	for _, f := range bundle.Manifest.Profiles {
+		entry := &Entry{Raw: &RawProfile{}}
+		if err := unmarshalFile(files, f.Raw, entry.Raw); err != nil {
+			return nil, err
+		}
+		symbolized, ok := files[path.Clean(f.Symbolized)]
+		if !ok {
+			return nil, fmt.Errorf("the file %s not found in the bundle", f.Symbolized)
+		}
+		if entry.Profile, err = pprof.Decode(bytes.NewReader(symbolized)); err != nil {
+			return nil, fmt.Errorf("decode the profile %s failure: %v", f.Symbolized, err)
+		}
+		entry.Profile.Entity = bundle.Manifest.Entity(entry.Raw.Pid)
+		bundle.Entries = append(bundle.Entries, entry)
+	}
+	return bundle, nil
+}
+
+// ReadFile reads the bundle from the file
+func ReadFile(file string) (*Bundle, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f)
+}
+
+func unmarshalFile(files map[string][]byte, name string, v interface{}) error {
+	content, ok := files[path.Clean(name)]
+	if !ok {
+		return fmt.Errorf("the file %s not found in the bundle", name)
+	}
+	if err := json.Unmarshal(content, v); err != nil {
+		return fmt.Errorf("parsing the file %s failure: %v", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package capture
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"perfprofiler/pkg/logger"
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/profiling/task/base"
+	"perfprofiler/pkg/profiling/task/local"
+	"perfprofiler/pkg/tools"
+	"perfprofiler/pkg/tools/operator"
+)
+
+var log = logger.GetLogger("profiling", "capture")
+
+// Options of capturing the profiling data
+type Options struct {
+	Pids []int32
+	// Entities of the processes, optional
+	Entities   map[int32]*api.ProcessEntity
+	Types      []base.TargetType
+	Duration   time.Duration
+	TaskConfig *base.TaskConfig
+	// AgentConfig is the content of the agent config file, optional
+	AgentConfig  []byte
+	AgentVersion string
+}
+
+type capturing struct {
+	process    api.ProcessInterface
+	targetType base.TargetType
+	runner     base.ProfileTaskRunner
+}
+
+// Capture runs the profiling tasks of each type on each process for the duration, and builds the bundle.
+// The runner start failures are recorded in the manifest, it fails only when no runner started.
+func Capture(ctx context.Context, opts *Options) (*Bundle, error) {
+	processes, err := local.NewProcesses(opts.Pids, opts.Entities)
+	if err != nil {
+		return nil, err
+	}
+	defer local.ReleaseProcesses(processes)
+
+	manifest := &Manifest{AgentVersion: opts.AgentVersion, CreateTime: time.Now(), Duration: opts.Duration.String()}
+	for _, t := range opts.Types {
+		manifest.Types = append(manifest.Types, ProfileType(t))
+	}
+	runners := make([]*capturing, 0)
+	for _, p := range processes {
+		manifest.Processes = append(manifest.Processes, newProcess(p))
+		for _, t := range opts.Types {
+			runner, err := local.StartRunner(ctx, opts.TaskConfig, t, p)
+			if err != nil {
+				log.Warnf("start the %s profiling of pid %d failure: %v", t, p.Pid(), err)
+				manifest.Errors = append(manifest.Errors, err.Error())
+				continue
+			}
+			runners = append(runners, &capturing{process: p, targetType: t, runner: runner})
+		}
+	}
+	if len(runners) == 0 {
+		return nil, fmt.Errorf("no profiling started: %v", manifest.Errors)
+	}
+	log.Infof("capturing %d profiling tasks in %s", len(runners), opts.Duration)
+
+	select {
+	case <-time.After(opts.Duration):
+	case <-ctx.Done():
+		for _, r := range runners {
+			local.StopRunner(r.runner)
+		}
+		return nil, ctx.Err()
+	}
+
+	bundle := &Bundle{Manifest: manifest, System: CollectSystem(), Config: opts.AgentConfig}
+	for _, r := range runners {
+		p, err := local.FlushProfile(r.runner)
+		local.StopRunner(r.runner)
+		if err != nil {
+			manifest.Errors = append(manifest.Errors,
+				fmt.Sprintf("flush the %s profiling of pid %d failure: %v", r.targetType, r.process.Pid(), err))
+			continue
+		}
+		if p == nil {
+			continue
+		}
+		bundle.Entries = append(bundle.Entries, &Entry{Raw: NewRawProfile(p), Profile: p})
+	}
+	return bundle, nil
+}
+
+// ProfileType of the profiling target type
+func ProfileType(t base.TargetType) profile.Type {
+	if t == base.TargetTypeOffCPU {
+		return profile.TypeOffCPU
+	}
+	return profile.TypeOnCPU
+}
+
+func newProcess(p api.ProcessInterface) *Process {
+	result := &Process{Pid: p.Pid()}
+	if e := p.Entity(); e != nil {
+		result.Layer, result.Service, result.Instance, result.Process, result.Labels =
+			e.Layer, e.ServiceName, e.InstanceName, e.ProcessName, e.Labels
+	}
+	result.Exe, _ = p.ExeName()
+	if original := p.OriginalProcess(); original != nil {
+		result.CommandLine, _ = original.Cmdline()
+	}
+	return result
+}
+
+// CollectSystem information of the current machine, the unavailable information is empty
+func CollectSystem() *System {
+	system := &System{Hostname: tools.Hostname(), HostIP: tools.DefaultHostIPAddress()}
+	var err error
+	if system.Uname, err = operator.GetOSUname(); err != nil {
+		log.Warnf("could not read the uname: %v", err)
+	}
+	if system.Distribution, err = operator.GetDistributionInfo(); err != nil {
+		log.Warnf("could not read the distribution info: %v", err)
+	}
+	return system
+}
@@ -0,0 +1,230 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package capture
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/tools/operator"
+	"perfprofiler/pkg/tools/profiling"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	common_v3 "skywalking.apache.org/repo/goapi/collect/common/v3"
+	process_v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/process/v3"
+	v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
+)
+
+func testBundle() *Bundle {
+	start := time.Unix(100, 0)
+	p := &profile.Profile{
+		TaskID: "task", Type: profile.TypeOnCPU, Pid: 10, StartTime: start, EndTime: start.Add(time.Second), Period: 10,
+		Entity: &api.ProcessEntity{Layer: "OS_LINUX", ServiceName: "svc", InstanceName: "ins", ProcessName: "app"},
+		Modules: []*profiling.Module{{Name: "/app", BuildID: "abc",
+			Ranges: []*profiling.ModuleRange{{StartAddr: 0x1000, EndAddr: 0x2000}}}},
+		Samples: []*profile.Sample{{Count: 3, Duration: 30, Locations: []*profile.Location{
+			{Address: 0xffff0010, Kernel: true, Frames: []*profiling.Frame{{Name: "do_syscall"}}},
+			{Address: 0x1010, Frames: []*profiling.Frame{{Name: "work"}}},
+			{Address: 0x1020, Frames: []*profiling.Frame{{Name: "main"}}},
+		}}},
+	}
+	return &Bundle{
+		Manifest: &Manifest{AgentVersion: "dev", CreateTime: start, Duration: "1s", Types: []profile.Type{profile.TypeOnCPU},
+			Processes: []*Process{{Pid: 10, Layer: "OS_LINUX", Service: "svc", Instance: "ins", Process: "app",
+				Exe: "/app", CommandLine: "/app -v"}}},
+		System: &System{Hostname: "host", HostIP: "10.0.0.1", Uname: &operator.UnameInfo{Release: "5.15.0"},
+			Distribution: &operator.DistributionInfo{Name: "ubuntu", Version: "22.04"}},
+		Config:  []byte("logger:\n  level: INFO\n"),
+		Entries: []*Entry{{Raw: NewRawProfile(p), Profile: p}},
+	}
+}
+
+func TestBundle(t *testing.T) {
+	bundle := testBundle()
+	raw := bundle.Entries[0].Raw
+	assert.Equal(t, []*RawSample{{Kernel: []uint64{0xffff0010}, User: []uint64{0x1010, 0x1020}, Count: 3, Duration: 30}},
+		raw.Samples)
+	assert.Equal(t, map[uint64]string{0xffff0010: "do_syscall"}, raw.KernelSymbols)
+	assert.Equal(t, []*RawModule{{Name: "/app", BuildID: "abc", Ranges: []*RawRange{{Start: 0x1000, End: 0x2000}}}},
+		raw.Modules)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, bundle.Write(buf))
+	read, err := Read(buf)
+	assert.NoError(t, err)
+	assert.Equal(t, BundleVersion, read.Manifest.Version)
+	assert.Equal(t, bundle.Manifest.Processes, read.Manifest.Processes)
+	assert.Equal(t, []*ProfileFiles{{Pid: 10, Type: profile.TypeOnCPU,
+		Raw: "profiles/10-on_cpu-0.raw.json", Symbolized: "profiles/10-on_cpu-0.pb.gz"}}, read.Manifest.Profiles)
+	assert.Equal(t, bundle.System, read.System)
+	assert.Equal(t, bundle.Config, read.Config)
+	assert.Len(t, read.Entries, 1)
+	assert.Equal(t, raw.Samples, read.Entries[0].Raw.Samples)
+	assert.Equal(t, raw.StartTime.UnixNano(), read.Entries[0].Raw.StartTime.UnixNano())
+	decoded := read.Entries[0].Profile
+	assert.Equal(t, "task", decoded.TaskID)
+	assert.Equal(t, "svc", decoded.Entity.ServiceName)
+	assert.Equal(t, []string{"do_syscall", "work", "main"}, decoded.Samples[0].FunctionNames())
+
+	_, err = Read(bytes.NewReader([]byte("not a bundle")))
+	assert.Error(t, err)
+}
+
+// resymbolizeTarget is symbolized from the test binary
+func resymbolizeTarget() {
+}
+
+func TestResymbolize(t *testing.T) {
+	exe, err := os.Executable()
+	assert.NoError(t, err)
+	buildID, err := profiling.FileBuildID(exe)
+	assert.NoError(t, err)
+	address := uint64(reflect.ValueOf(resymbolizeTarget).Pointer())
+
+	raw := &RawProfile{Type: profile.TypeOnCPU, Pid: 1, KernelSymbols: map[uint64]string{0xffff0010: "do_syscall"},
+		Modules: []*RawModule{
+			{Name: "/opt/app/" + filepath.Base(exe), BuildID: buildID, Ranges: []*RawRange{{Start: 0x1000, End: math.MaxUint64}}},
+			{Name: "/lib/libmissing.so", BuildID: "not-exists"},
+		},
+		Samples: []*RawSample{
+			{Kernel: []uint64{0xffff0010, 0xffff0020}, User: []uint64{address}, Count: 2},
+			{User: []uint64{0x10}, Count: 1},
+		},
+	}
+	fallback := &profile.Profile{Samples: []*profile.Sample{{Locations: []*profile.Location{
+		{Address: 0x10, Frames: []*profiling.Frame{{Name: "bundled"}}}}}}}
+
+	// the files are found by the build-id, the name is not required to be the same
+	dir := filepath.Dir(exe)
+	files, err := NewSymbolFiles([]string{dir})
+	assert.NoError(t, err)
+	assert.Equal(t, exe, files.Find(raw.Modules[0]))
+	assert.Empty(t, files.Find(raw.Modules[1]))
+	assert.Equal(t, exe, files.Find(&RawModule{Name: "/any/" + filepath.Base(exe)}))
+
+	p, missing, err := Resymbolize(raw, files, fallback)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/lib/libmissing.so"}, missing)
+	assert.Len(t, p.Modules, 1)
+	assert.Equal(t, []string{"do_syscall", profile.MissingSymbol,
+		"perfprofiler/pkg/profiling/capture.resymbolizeTarget"}, p.Samples[0].FunctionNames())
+	assert.True(t, p.Samples[0].Locations[0].Kernel)
+	assert.Equal(t, []string{"bundled"}, p.Samples[1].FunctionNames())
+}
+
+type fakeBackend struct {
+	process_v3.UnimplementedEBPFProcessServiceServer
+	v3.UnimplementedEBPFProfilingServiceServer
+
+	lock    sync.Mutex
+	reports []*process_v3.EBPFProcessReportList
+	data    []*v3.EBPFProfilingData
+}
+
+func (b *fakeBackend) ReportProcesses(ctx context.Context,
+	req *process_v3.EBPFProcessReportList) (*process_v3.EBPFReportProcessDownstream, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.reports = append(b.reports, req)
+	result := &process_v3.EBPFReportProcessDownstream{}
+	for _, p := range req.Processes {
+		host := p.GetHostProcess()
+		result.Processes = append(result.Processes, &process_v3.EBPFProcessDownstream{
+			ProcessId: "process-" + host.Entity.ProcessName,
+			Process: &process_v3.EBPFProcessDownstream_HostProcess{HostProcess: &process_v3.EBPFHostProcessDownstream{
+				Pid: host.Pid, EntityMetadata: host.Entity}},
+		})
+	}
+	return result, nil
+}
+
+func (b *fakeBackend) CollectProfilingData(stream v3.EBPFProfilingService_CollectProfilingDataServer) error {
+	for {
+		data, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&common_v3.Commands{})
+		} else if err != nil {
+			return err
+		}
+		b.lock.Lock()
+		b.data = append(b.data, data)
+		b.lock.Unlock()
+	}
+}
+
+func TestReplay(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := grpc.NewServer()
+	fake := &fakeBackend{}
+	process_v3.RegisterEBPFProcessServiceServer(server, fake)
+	v3.RegisterEBPFProfilingServiceServer(server, fake)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Stop()
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	bundle := testBundle()
+	ctx := context.Background()
+	_, err = Replay(ctx, conn, bundle, bundle.Entries, &ReplayOptions{})
+	assert.Error(t, err)
+	count, err := Replay(ctx, conn, bundle, bundle.Entries, &ReplayOptions{TaskID: "task-1", AgentID: "agent"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	count, err = Replay(ctx, conn, bundle, bundle.Entries,
+		&ReplayOptions{TaskID: "task-1", AgentID: "agent", Type: profile.TypeOffCPU})
+	assert.NoError(t, err)
+	assert.Zero(t, count)
+
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	assert.Len(t, fake.reports, 2)
+	assert.Equal(t, "agent", fake.reports[0].EbpfAgentID)
+	assert.Len(t, fake.data, 1)
+	data := fake.data[0]
+	assert.Equal(t, "task-1", data.Task.TaskId)
+	assert.Equal(t, "process-app", data.Task.ProcessId)
+	assert.Equal(t, int64(101000), data.Task.CurrentTime)
+	onCPU := data.GetOnCPU()
+	assert.Equal(t, int32(3), onCPU.DumpCount)
+	assert.Len(t, onCPU.Stacks, 2)
+	assert.Equal(t, []string{"do_syscall"}, onCPU.Stacks[0].StackSymbols)
+	assert.Equal(t, []string{"work", "main"}, onCPU.Stacks[1].StackSymbols)
+
+	// the process without the service requires the service provided
+	bundle.Manifest.Processes[0].Service = ""
+	_, err = Replay(ctx, conn, bundle, bundle.Entries, &ReplayOptions{TaskID: "task-1"})
+	assert.Error(t, err)
+}
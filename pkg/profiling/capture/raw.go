@@ -0,0 +1,217 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package capture
+
+import (
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/tools/process"
+	"perfprofiler/pkg/tools/profiling"
+)
+
+// RawProfile is the stack counts with the unsymbolized addresses,
+// the user space addresses could be re-symbolized by the module files with the same build-id
+type RawProfile struct {
+	TaskID    string       `json:"taskId"`
+	Type      profile.Type `json:"type"`
+	Pid       int32        `json:"pid"`
+	StartTime time.Time    `json:"startTime"`
+	EndTime   time.Time    `json:"endTime"`
+	Period    int64        `json:"period"`
+	Modules   []*RawModule `json:"modules"`
+	Samples   []*RawSample `json:"samples"`
+	// the kernel symbols of the kernel addresses, the kernel addresses could not be symbolized in other machines
+	KernelSymbols map[uint64]string `json:"kernelSymbols"`
+}
+
+// RawModule is the module mapped in the process
+type RawModule struct {
+	Name    string      `json:"name"`
+	Path    string      `json:"path"`
+	BuildID string      `json:"buildId"`
+	Ranges  []*RawRange `json:"ranges"`
+}
+
+type RawRange struct {
+	Start      uint64 `json:"start"`
+	End        uint64 `json:"end"`
+	FileOffset uint64 `json:"fileOffset"`
+}
+
+// RawSample is a stack with the addresses from the leaf to the root
+type RawSample struct {
+	Kernel   []uint64 `json:"kernel,omitempty"`
+	User     []uint64 `json:"user,omitempty"`
+	Count    int64    `json:"count"`
+	Duration int64    `json:"duration"`
+}
+
+// NewRawProfile from the symbolized profile, keeps the addresses and modules of the stacks
+func NewRawProfile(p *profile.Profile) *RawProfile {
+	raw := &RawProfile{TaskID: p.TaskID, Type: p.Type, Pid: p.Pid, StartTime: p.StartTime, EndTime: p.EndTime,
+		Period: p.Period, KernelSymbols: make(map[uint64]string)}
+	for _, m := range p.Modules {
+		module := &RawModule{Name: m.Name, Path: m.Path, BuildID: m.BuildID}
+		for _, r := range m.Ranges {
+			module.Ranges = append(module.Ranges, &RawRange{Start: r.StartAddr, End: r.EndAddr, FileOffset: r.FileOffset})
+		}
+		raw.Modules = append(raw.Modules, module)
+	}
+	for _, s := range p.Samples {
+		sample := &RawSample{Count: s.Count, Duration: s.Duration}
+		for _, l := range s.Locations {
+			if !l.Kernel {
+				sample.User = append(sample.User, l.Address)
+				continue
+			}
+			sample.Kernel = append(sample.Kernel, l.Address)
+			if len(l.Frames) > 0 {
+				raw.KernelSymbols[l.Address] = l.Frames[len(l.Frames)-1].Name
+			}
+		}
+		raw.Samples = append(raw.Samples, sample)
+	}
+	return raw
+}
+
+// SymbolFiles are the module files in the directories, found by the build-id or the file name
+type SymbolFiles struct {
+	byBuildID map[string]string
+	byName    map[string][]string
+}
+
+// NewSymbolFiles scans the ELF files in the directories recursively
+func NewSymbolFiles(dirs []string) (*SymbolFiles, error) {
+	files := &SymbolFiles{byBuildID: make(map[string]string), byName: make(map[string][]string)}
+	for _, dir := range dirs {
+		err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			buildID, err := profiling.FileBuildID(file)
+			if err != nil {
+				// not an ELF file
+				return nil
+			}
+			if buildID != "" && files.byBuildID[buildID] == "" {
+				files.byBuildID[buildID] = file
+			}
+			name := filepath.Base(file)
+			files.byName[name] = append(files.byName[name], file)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("scan the symbol files in %s failure: %v", dir, err)
+		}
+	}
+	return files, nil
+}
+
+// Find the file of the module, the build-id must be the same when the module has the build-id
+func (s *SymbolFiles) Find(m *RawModule) string {
+	if m.BuildID != "" {
+		return s.byBuildID[m.BuildID]
+	}
+	if files := s.byName[filepath.Base(m.Name)]; len(files) > 0 {
+		return files[0]
+	}
+	return ""
+}
+
+// Resymbolize the raw profile by the module files, the addresses of the modules which not found in the files
+// use the frames of the fallback profile, such as the profile symbolized in the capturing machine.
+// Returns the profile and the names of the modules not found.
+func Resymbolize(raw *RawProfile, files *SymbolFiles, fallback *profile.Profile) (*profile.Profile, []string, error) {
+	result := &profile.Profile{TaskID: raw.TaskID, Type: raw.Type, Pid: raw.Pid, StartTime: raw.StartTime,
+		EndTime: raw.EndTime, Period: raw.Period}
+	if fallback != nil {
+		result.Entity = fallback.Entity
+	}
+	modules := make(map[string]*profiling.Module)
+	var missing []string
+	for _, m := range raw.Modules {
+		file := files.Find(m)
+		if file == "" {
+			missing = append(missing, m.Name)
+			continue
+		}
+		ranges := make([]*profiling.ModuleRange, 0, len(m.Ranges))
+		for _, r := range m.Ranges {
+			ranges = append(ranges, &profiling.ModuleRange{StartAddr: r.Start, EndAddr: r.End, FileOffset: r.FileOffset})
+		}
+		module, err := process.LoadModuleFile(m.Name, file, ranges)
+		if err != nil {
+			return nil, nil, fmt.Errorf("load the module %s from %s failure: %v", m.Name, file, err)
+		}
+		modules[m.Name] = module
+		result.Modules = append(result.Modules, module)
+	}
+	sort.Strings(missing)
+	info := profiling.NewInfo(modules)
+
+	fallbackFrames := make(map[uint64][]*profiling.Frame)
+	if fallback != nil {
+		for _, s := range fallback.Samples {
+			for _, l := range s.Locations {
+				if !l.Kernel {
+					fallbackFrames[l.Address] = l.Frames
+				}
+			}
+		}
+	}
+	locations := make(map[uint64]*profile.Location)
+	location := func(address uint64, kernel bool) *profile.Location {
+		key := address
+		if kernel {
+			// the kernel and user space addresses are not overlapped, the key is only for avoiding the mistake
+			key = ^address
+		}
+		if l := locations[key]; l != nil {
+			return l
+		}
+		l := &profile.Location{Address: address, Kernel: kernel}
+		if kernel {
+			if name := raw.KernelSymbols[address]; name != "" {
+				l.Frames = []*profiling.Frame{{Name: name}}
+			}
+		} else if l.Frames = info.FindFrames(address); len(l.Frames) == 0 {
+			l.Frames = fallbackFrames[address]
+		}
+		if len(l.Frames) == 0 {
+			l.Frames = []*profiling.Frame{{Name: profile.MissingSymbol}}
+		}
+		locations[key] = l
+		return l
+	}
+	for _, s := range raw.Samples {
+		sample := &profile.Sample{Count: s.Count, Duration: s.Duration}
+		for _, addr := range s.Kernel {
+			sample.Locations = append(sample.Locations, location(addr, true))
+		}
+		for _, addr := range s.User {
+			sample.Locations = append(sample.Locations, location(addr, false))
+		}
+		result.Samples = append(result.Samples, sample)
+	}
+	return result, missing, nil
+}
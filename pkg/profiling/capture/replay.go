@@ -0,0 +1,185 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package capture
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"google.golang.org/grpc"
+
+	"perfprofiler/pkg/profiling/profile"
+
+	commonv3 "skywalking.apache.org/repo/goapi/collect/common/v3"
+	process_v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/process/v3"
+	v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
+)
+
+// the default entity of the processes captured without the entity
+const defaultLayer = "OS_LINUX"
+
+// ReplayOptions of sending the bundle to the backend
+type ReplayOptions struct {
+	// TaskID of the profiling task created in the backend, the data are attached to it
+	TaskID string
+	// AgentID reports the processes
+	AgentID string
+	// Type of the profiles to replay, all types are replayed when empty
+	Type profile.Type
+	// Service of the processes which captured without the service
+	Service string
+}
+
+// Replay the profiles in the bundle to the backend, the processes are reported first to get the process IDs,
+// the profiles could be re-symbolized before replay. Returns the count of replayed profiles.
+func Replay(ctx context.Context, conn grpc.ClientConnInterface, bundle *Bundle, entries []*Entry,
+	opts *ReplayOptions) (int, error) {
+	if opts.TaskID == "" {
+		return 0, fmt.Errorf("the task ID must be provided")
+	}
+	processIDs, err := reportProcesses(ctx, process_v3.NewEBPFProcessServiceClient(conn), bundle, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	stream, err := v3.NewEBPFProfilingServiceClient(conn).CollectProfilingData(ctx)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, e := range entries {
+		if opts.Type != "" && e.Profile.Type != opts.Type {
+			continue
+		}
+		processID := processIDs[e.Profile.Pid]
+		if processID == "" {
+			return count, fmt.Errorf("the process %d is not reported to the backend", e.Profile.Pid)
+		}
+		data := profilingData(e.Profile)
+		if len(data) == 0 {
+			continue
+		}
+		data[0].Task = &v3.EBPFProfilingTaskMetadata{
+			TaskId:             opts.TaskID,
+			ProcessId:          processID,
+			ProfilingStartTime: e.Profile.StartTime.UnixMilli(),
+			CurrentTime:        e.Profile.EndTime.UnixMilli(),
+		}
+		for _, d := range data {
+			if err := stream.Send(d); err != nil {
+				return count, err
+			}
+		}
+		count++
+	}
+	_, err = stream.CloseAndRecv()
+	return count, err
+}
+
+func reportProcesses(ctx context.Context, client process_v3.EBPFProcessServiceClient, bundle *Bundle,
+	opts *ReplayOptions) (map[int32]string, error) {
+	properties := make([]*process_v3.EBPFProcessProperties, 0, len(bundle.Manifest.Processes))
+	entities := make(map[int32]*process_v3.EBPFProcessEntityMetadata)
+	for _, p := range bundle.Manifest.Processes {
+		entity := &process_v3.EBPFProcessEntityMetadata{Layer: p.Layer, ServiceName: p.Service, InstanceName: p.Instance,
+			ProcessName: p.Process, Labels: p.Labels}
+		if entity.ServiceName == "" {
+			if opts.Service == "" {
+				return nil, fmt.Errorf("the process %d is captured without the service, please provide the service", p.Pid)
+			}
+			entity.ServiceName = opts.Service
+		}
+		if entity.Layer == "" {
+			entity.Layer = defaultLayer
+		}
+		if entity.InstanceName == "" {
+			entity.InstanceName = bundle.System.Hostname
+		}
+		entities[p.Pid] = entity
+		properties = append(properties, &process_v3.EBPFProcessProperties{Metadata: &process_v3.EBPFProcessProperties_HostProcess{
+			HostProcess: &process_v3.EBPFHostProcessMetadata{
+				Pid:    p.Pid,
+				Entity: entity,
+				Properties: []*commonv3.KeyStringValuePair{
+					{Key: "host_ip", Value: bundle.System.HostIP},
+					{Key: "pid", Value: strconv.FormatInt(int64(p.Pid), 10)},
+					{Key: "command_line", Value: p.CommandLine},
+					{Key: "support_ebpf_profiling", Value: "true"},
+				},
+			},
+		}})
+	}
+	downstream, err := client.ReportProcesses(ctx, &process_v3.EBPFProcessReportList{Processes: properties, EbpfAgentID: opts.AgentID})
+	if err != nil {
+		return nil, fmt.Errorf("report the processes failure: %v", err)
+	}
+	result := make(map[int32]string)
+	for _, d := range downstream.GetProcesses() {
+		host := d.GetHostProcess()
+		if host == nil {
+			continue
+		}
+		entity := entities[host.GetPid()]
+		if entity != nil && entity.ServiceName == host.GetEntityMetadata().GetServiceName() &&
+			entity.InstanceName == host.GetEntityMetadata().GetInstanceName() &&
+			entity.ProcessName == host.GetEntityMetadata().GetProcessName() {
+			result[host.GetPid()] = d.ProcessId
+		}
+	}
+	return result, nil
+}
+
+// profilingData converts the samples to the backend protocol, the stack IDs are only unique in the profile
+func profilingData(p *profile.Profile) []*v3.EBPFProfilingData {
+	result := make([]*v3.EBPFProfilingData, 0, len(p.Samples))
+	for i, s := range p.Samples {
+		var kernel, user []string
+		for _, l := range s.Locations {
+			for _, f := range l.Frames {
+				if l.Kernel {
+					kernel = append(kernel, f.Name)
+				} else {
+					user = append(user, f.Name)
+				}
+			}
+		}
+		var stacks []*v3.EBPFProfilingStackMetadata
+		if len(kernel) > 0 {
+			stacks = append(stacks, &v3.EBPFProfilingStackMetadata{
+				StackType: v3.EBPFProfilingStackType_PROCESS_KERNEL_SPACE, StackId: int32(i + 1), StackSymbols: kernel})
+		}
+		if len(user) > 0 {
+			stacks = append(stacks, &v3.EBPFProfilingStackMetadata{
+				StackType: v3.EBPFProfilingStackType_PROCESS_USER_SPACE, StackId: int32(i + 1), StackSymbols: user})
+		}
+		if len(stacks) == 0 {
+			continue
+		}
+		data := &v3.EBPFProfilingData{}
+		if p.Type == profile.TypeOffCPU {
+			data.Profiling = &v3.EBPFProfilingData_OffCPU{OffCPU: &v3.EBPFOffCPUProfiling{
+				Stacks: stacks, SwitchCount: int32(s.Count), Duration: s.Duration}}
+		} else {
+			data.Profiling = &v3.EBPFProfilingData_OnCPU{OnCPU: &v3.EBPFOnCPUProfiling{
+				Stacks: stacks, DumpCount: int32(s.Count)}}
+		}
+		result = append(result, data)
+	}
+	return result
+}
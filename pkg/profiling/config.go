@@ -20,6 +20,10 @@ package profiling
 import (
 	"perfprofiler/pkg/module"
 	continuousBase "perfprofiler/pkg/profiling/continuous/base"
+	"perfprofiler/pkg/profiling/control"
+	"perfprofiler/pkg/profiling/debug"
+	"perfprofiler/pkg/profiling/sink"
+	"perfprofiler/pkg/profiling/standalone"
 	taskBase "perfprofiler/pkg/profiling/task/base"
 )
 
@@ -28,7 +32,13 @@ type Config struct {
 
 	CheckInterval string `mapstructure:"check_interval"` // Check the profiling task interval
 	FlushInterval string `mapstructure:"flush_interval"` // Flush profiling data interval
+	SymbolNaming  string `mapstructure:"symbol_naming"`  // The style of symbol names, "full" or "simplified"(without template arguments)
 
-	TaskConfig       *taskBase.TaskConfig             `mapstructure:"task"`       // Profiling task config
-	ContinuousConfig *continuousBase.ContinuousConfig `mapstructure:"continuous"` // Continuous profiling config
+	TaskConfig       *taskBase.TaskConfig             `mapstructure:"task"`         // Profiling task config
+	ContinuousConfig *continuousBase.ContinuousConfig `mapstructure:"continuous"`   // Continuous profiling config
+	DebugServer      *debug.Config                    `mapstructure:"debug_server"` // The HTTP server of on-demand pprof profiling
+	Sinks            []*sink.Config                   `mapstructure:"sinks"`        // The destinations of the profiling data, default is the SkyWalking backend
+	Standalone       *standalone.Config               `mapstructure:"standalone"`   // Run the profiling tasks defined in the local files
+	Control          *control.Config                  `mapstructure:"control"`      // The local API of managing the profiling tasks
+	Spool            *sink.SpoolConfig                `mapstructure:"spool"`        // Keep the data failed to send to the backend on the disk and resend later
 }
@@ -23,6 +23,8 @@ type ContinuousConfig struct {
 	FetchInterval string        `mapstructure:"fetch_interval"` // The interval of fetch metrics from the system
 	CheckInterval string        `mapstructure:"check_interval"` // The interval of check metrics is reach the thresholds
 	Trigger       TriggerConfig `mapstructure:"trigger"`
+
+	PrometheusAddress string `mapstructure:"prometheus_address"` // The listen address of the Prometheus "/metrics" endpoint, disabled when empty
 }
 
 type TriggerConfig struct {
@@ -22,6 +22,7 @@ import (
 	"time"
 
 	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/sink"
 
 	v3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
 )
@@ -30,6 +31,26 @@ type MetricsAppender struct {
 	prefix    string
 	timestamp int64
 	meters    map[serviceInstanceMetadata][]*v3.MeterData // split by service instance
+
+	// the checked values and policy states, works for exposing the metrics locally
+	values []*ProcessValue
+	states []*PolicyState
+}
+
+// ProcessValue is the checked value of the process
+type ProcessValue struct {
+	Name    string
+	Process api.ProcessInterface
+	Value   float64
+}
+
+// PolicyState is the threshold state of the policy item for the process
+type PolicyState struct {
+	CheckType CheckType
+	Item      *PolicyItem
+	Process   api.ProcessInterface
+	// Matched count of the slots in the time windows which reached the threshold
+	Matched int
 }
 
 func NewMetricsAppender(prefix string) *MetricsAppender {
@@ -41,6 +62,7 @@ func NewMetricsAppender(prefix string) *MetricsAppender {
 }
 
 func (m *MetricsAppender) AppendProcessSingleValue(name string, p api.ProcessInterface, labels map[string]string, value float64) {
+	m.values = append(m.values, &ProcessValue{Name: name, Process: p, Value: value})
 	transformLabels := make([]*v3.Label, 0)
 	for k, v := range labels {
 		transformLabels = append(transformLabels, &v3.Label{Name: k, Value: v})
@@ -66,34 +88,36 @@ func (m *MetricsAppender) AppendProcessSingleValue(name string, p api.ProcessInt
 	})
 }
 
-func (m *MetricsAppender) Flush(ctx context.Context, client v3.MeterReportServiceClient) error {
-	if len(m.meters) == 0 {
-		return nil
-	}
+// AppendPolicyState records the matched count of the policy item, the policy is reached when the matched count
+// bigger than or equals to the count of item
+func (m *MetricsAppender) AppendPolicyState(checkType CheckType, item *PolicyItem, p api.ProcessInterface, matched int) {
+	m.states = append(m.states, &PolicyState{CheckType: checkType, Item: item, Process: p, Matched: matched})
+}
 
-	batch, err := client.CollectBatch(ctx)
-	if err != nil {
-		return err
-	}
+// Prefix of the metrics name
+func (m *MetricsAppender) Prefix() string {
+	return m.prefix
+}
 
-	for _, meters := range m.meters {
-		collection := &v3.MeterDataCollection{
-			MeterData: meters,
-		}
-		if e := batch.Send(collection); e != nil {
-			_ = m.closeSteam(batch)
-			return e
-		}
-	}
-	return m.closeSteam(batch)
+// Values which appended
+func (m *MetricsAppender) Values() []*ProcessValue {
+	return m.values
+}
+
+// PolicyStates which appended
+func (m *MetricsAppender) PolicyStates() []*PolicyState {
+	return m.states
 }
 
-func (m *MetricsAppender) closeSteam(batch v3.MeterReportService_CollectBatchClient) error {
-	_, err := batch.CloseAndRecv()
-	if err != nil {
-		return err
+func (m *MetricsAppender) Flush(ctx context.Context, s sink.Sink) error {
+	if len(m.meters) == 0 {
+		return nil
+	}
+	collections := make([]*v3.MeterDataCollection, 0, len(m.meters))
+	for _, meters := range m.meters {
+		collections = append(collections, &v3.MeterDataCollection{MeterData: meters})
 	}
-	return nil
+	return s.SendMeters(ctx, collections)
 }
 
 type serviceInstanceMetadata struct {
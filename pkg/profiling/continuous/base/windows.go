@@ -88,11 +88,15 @@ func NewTimeWindows[V any, R any](items []*PolicyItem, generator func() WindowDa
 }
 
 func (t *TimeWindows[V, R]) MatchRule(policy *PolicyItem, check func(slot R) bool) (lastMatch R, isMatch bool) {
+	lastMatch, matchedCount := t.MatchedCount(check)
+	return lastMatch, matchedCount >= policy.Count
+}
+
+// MatchedCount is the count of slots in the windows which matched the check
+func (t *TimeWindows[V, R]) MatchedCount(check func(slot R) bool) (lastMatch R, matchedCount int) {
 	t.windowLocker.RLock()
 	defer t.windowLocker.RUnlock()
 
-	needsCount := policy.Count
-	matchedCount := 0
 	for e := t.data.Back(); e != nil; e = e.Prev() {
 		getVal := e.Value.(*windowDataWrapper[V, R]).Get()
 		if check(getVal) {
@@ -100,7 +104,7 @@ func (t *TimeWindows[V, R]) MatchRule(policy *PolicyItem, check func(slot R) boo
 			lastMatch = getVal
 		}
 	}
-	return lastMatch, matchedCount >= needsCount
+	return lastMatch, matchedCount
 }
 
 func (t *TimeWindows[V, R]) ScalePeriod(items []*PolicyItem) {
@@ -121,13 +121,15 @@ func (r *ProcessBasedChecker[V]) Check(ctx base.CheckContext, metricsAppender *b
 			if data, hasData := info.Windows.FlushMostRecentData(); hasData {
 				metricsAppender.AppendProcessSingleValue(strings.ToLower(string(r.CheckType)), info.Process, nil, float64(data))
 			}
+			// check is reach the threshold
+			lastMatch, matched := info.Windows.MatchedCount(func(val V) bool {
+				return val >= threshold.Threshold
+			})
+			metricsAppender.AppendPolicyState(r.CheckType, threshold.Policy, info.Process, matched)
 			if !ctx.ShouldCheck(info.Process, threshold.Policy) {
 				continue
 			}
-			// check is reach the threshold
-			if lastMatch, enable := info.Windows.MatchRule(threshold.Policy, func(val V) bool {
-				return val >= threshold.Threshold
-			}); enable {
+			if matched >= threshold.Policy.Count {
 				causes = append(causes,
 					NewSingleValueCause(info.Process, threshold.Policy, r.MonitorType, float64(threshold.Threshold), float64(lastMatch)))
 			}
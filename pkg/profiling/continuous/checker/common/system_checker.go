@@ -100,18 +100,28 @@ func (s *SystemBasedChecker[V]) Check(ctx base.CheckContext, metricsAppender *ba
 	}
 
 	causes := make([]base.ThresholdCause, 0)
-	data, hasData := s.GlobalWindows.FlushMostRecentData()
-
-	for _, policy := range s.Policies {
-		if hasData {
+	// the system value is same for all the processes, the process in multiple policies only appends once
+	if data, hasData := s.GlobalWindows.FlushMostRecentData(); hasData {
+		appended := make(map[string]bool)
+		for _, policy := range s.Policies {
 			for _, p := range policy.Processes {
+				if appended[p.ID()] {
+					continue
+				}
+				appended[p.ID()] = true
 				metricsAppender.AppendProcessSingleValue(strings.ToLower(string(s.CheckType)), p, nil, float64(data))
 			}
 		}
-		lastMatch, isMatch := s.GlobalWindows.MatchRule(policy.Policy, func(val V) bool {
+	}
+
+	for _, policy := range s.Policies {
+		lastMatch, matched := s.GlobalWindows.MatchedCount(func(val V) bool {
 			return val >= policy.Threshold
 		})
-		if !isMatch {
+		for _, p := range policy.Processes {
+			metricsAppender.AppendPolicyState(s.CheckType, policy.Policy, p, matched)
+		}
+		if matched < policy.Policy.Count {
 			continue
 		}
 
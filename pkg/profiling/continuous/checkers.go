@@ -21,6 +21,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sync"
 	"time"
 
 	"perfprofiler/pkg/core"
@@ -29,9 +30,9 @@ import (
 	"perfprofiler/pkg/process/api"
 	"perfprofiler/pkg/profiling/continuous/base"
 	"perfprofiler/pkg/profiling/continuous/checker"
+	"perfprofiler/pkg/profiling/sink"
 
 	profilingv3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
-	meterv3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
 
 	"github.com/hashicorp/go-multierror"
 )
@@ -56,15 +57,25 @@ type Checkers struct {
 	triggers        *Triggers
 	policiesCache   map[string]*base.ServicePolicy
 
-	meterClient      meterv3.MeterReportServiceClient
+	// the policies synchronized to the checkers
+	synced      []*base.SyncPolicyWithProcesses
+	syncedMutex sync.RWMutex
+
+	// expose the checked metrics locally, nil when disabled
+	metrics *prometheusMetrics
+
+	sink             sink.Sink
 	continuousClient profilingv3.ContinuousProfilingServiceClient
 	ctx              context.Context
 }
 
-func NewCheckers(ctx context.Context, moduleMgr *module.Manager, conf *base.ContinuousConfig, triggers *Triggers) (*Checkers, error) {
-	connection := moduleMgr.FindModule(core.ModuleName).(core.Operator).BackendOperator().GetConnection()
-	meterClient := meterv3.NewMeterReportServiceClient(connection)
-	continuousClient := profilingv3.NewContinuousProfilingServiceClient(connection)
+func NewCheckers(ctx context.Context, moduleMgr *module.Manager, conf *base.ContinuousConfig, triggers *Triggers,
+	dataSink sink.Sink) (*Checkers, error) {
+	// the policies are not queried when working without the backend
+	var continuousClient profilingv3.ContinuousProfilingServiceClient
+	if backend := moduleMgr.FindModule(core.ModuleName).(core.Operator).BackendOperator(); backend != nil {
+		continuousClient = profilingv3.NewContinuousProfilingServiceClient(backend.GetConnection())
+	}
 
 	if conf.MeterPrefix == "" {
 		return nil, fmt.Errorf("the continuous profiling meter prefix cannot be empty")
@@ -89,7 +100,7 @@ func NewCheckers(ctx context.Context, moduleMgr *module.Manager, conf *base.Cont
 	}
 
 	return &Checkers{
-		meterClient:      meterClient,
+		sink:             dataSink,
 		continuousClient: continuousClient,
 		meterPrefix:      conf.MeterPrefix,
 		fetchDuration:    fetchDuration,
@@ -133,6 +144,9 @@ func (c *Checkers) Stop() error {
 }
 
 func (c *Checkers) CheckProfilingPolicies() error {
+	if c.continuousClient == nil {
+		return nil
+	}
 	// fetch and update the policies
 	if hasUpdate, err := c.updatePolicyCache(); err != nil {
 		return err
@@ -153,9 +167,18 @@ func (c *Checkers) CheckProfilingPolicies() error {
 	for _, checker := range checkerRegistration {
 		checker.SyncPolicies(policiesWithProcesses)
 	}
+	c.syncedMutex.Lock()
+	c.synced = policiesWithProcesses
+	c.syncedMutex.Unlock()
 	return nil
 }
 
+func (c *Checkers) syncedPolicies() []*base.SyncPolicyWithProcesses {
+	c.syncedMutex.RLock()
+	defer c.syncedMutex.RUnlock()
+	return c.synced
+}
+
 func (c *Checkers) fetchAllData() error {
 	var err error
 	for _, checker := range checkerRegistration {
@@ -170,7 +193,10 @@ func (c *Checkers) checkAllThresholds() {
 	// check all thresholds and send metrics
 	metricsAppender := base.NewMetricsAppender(c.meterPrefix)
 	causes := c.findAllMatchCauses(metricsAppender)
-	if e := metricsAppender.Flush(c.ctx, c.meterClient); e != nil {
+	if c.metrics != nil {
+		c.metrics.update(metricsAppender)
+	}
+	if e := metricsAppender.Flush(c.ctx, c.sink); e != nil {
 		log.Warnf("flush the checker metrics failure: %v", e)
 	}
 	if len(causes) == 0 {
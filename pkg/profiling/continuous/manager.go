@@ -19,11 +19,16 @@ package continuous
 
 import (
 	"context"
+	"time"
 
+	"perfprofiler/pkg/core"
 	"perfprofiler/pkg/logger"
 	"perfprofiler/pkg/module"
 	"perfprofiler/pkg/profiling/continuous/base"
+	"perfprofiler/pkg/profiling/sink"
 	"perfprofiler/pkg/profiling/task"
+
+	"github.com/hashicorp/go-multierror"
 )
 
 var log = logger.GetLogger("profiling", "continuous")
@@ -31,32 +36,46 @@ var log = logger.GetLogger("profiling", "continuous")
 type Manager struct {
 	checkers *Checkers
 	triggers *Triggers
+	metrics  *prometheusMetrics
 
 	ctx    context.Context
 	cancel context.CancelFunc
 }
 
-func NewManager(ctx context.Context, taskManager *task.Manager, moduleMgr *module.Manager, config *base.ContinuousConfig) (*Manager, error) {
+func NewManager(ctx context.Context, taskManager *task.Manager, moduleMgr *module.Manager, config *base.ContinuousConfig,
+	dataSink sink.Sink) (*Manager, error) {
 	m := &Manager{}
 	m.ctx, m.cancel = context.WithCancel(ctx)
 
 	// init all checkers and triggerRegistration
-	triggers, err := NewTriggers(m.ctx, moduleMgr, taskManager, config)
+	triggers, err := NewTriggers(m.ctx, moduleMgr, taskManager, config, dataSink)
 	if err != nil {
 		return nil, err
 	}
 	m.triggers = triggers
-	checkers, err := NewCheckers(m.ctx, moduleMgr, config, m.triggers)
+	checkers, err := NewCheckers(m.ctx, moduleMgr, config, m.triggers, dataSink)
 	if err != nil {
 		return nil, err
 	}
 	m.checkers = checkers
 
+	if config.PrometheusAddress != "" {
+		m.metrics = newPrometheusMetrics(config.PrometheusAddress, config.MeterPrefix)
+		m.checkers.metrics, m.triggers.metrics = m.metrics, m.metrics
+		if backend := moduleMgr.FindModule(core.ModuleName).(core.Operator).BackendOperator(); backend != nil {
+			m.metrics.certificates = backend.Certificates
+		}
+	}
 	return m, nil
 }
 
 func (m *Manager) Start() {
 	m.checkers.Start()
+	if m.metrics != nil {
+		if err := m.metrics.Start(); err != nil {
+			log.Warnf("start the Prometheus metrics endpoint failure: %v", err)
+		}
+	}
 }
 
 func (m *Manager) CheckPolicies() error {
@@ -65,6 +84,13 @@ func (m *Manager) CheckPolicies() error {
 
 func (m *Manager) Shutdown() error {
 	err := m.checkers.Stop()
+	if m.metrics != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if e := m.metrics.Shutdown(ctx); e != nil {
+			err = multierror.Append(err, e)
+		}
+	}
 	m.cancel()
 	return err
 }
@@ -0,0 +1,252 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package continuous
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"perfprofiler/pkg/core/backend"
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/continuous/base"
+)
+
+// PrometheusMetricsPath is the path of the Prometheus metrics endpoint
+const PrometheusMetricsPath = "/metrics"
+
+var unsafeMetricNameRegex = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+// prometheusMetrics exposes the latest checked values and policy states in the Prometheus text format,
+// the snapshot is replaced after each check, so the metrics of the removed processes are gone
+type prometheusMetrics struct {
+	address string
+	server  *http.Server
+
+	lock     sync.RWMutex
+	prefix   string
+	values   []*base.ProcessValue
+	states   []*base.PolicyState
+	triggers map[triggerCounterKey]int64
+
+	// the TLS certificates of the backend connection, nil when working without the backend
+	certificates func() []*backend.CertificateInfo
+}
+
+type triggerCounterKey struct {
+	service    string
+	policy     string
+	targetType base.TargetProfilingType
+	checkType  base.CheckType
+}
+
+func newPrometheusMetrics(address, prefix string) *prometheusMetrics {
+	m := &prometheusMetrics{address: address, prefix: prefix, triggers: make(map[triggerCounterKey]int64)}
+	mux := http.NewServeMux()
+	mux.Handle(PrometheusMetricsPath, m)
+	m.server = &http.Server{Addr: address, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return m
+}
+
+func (m *prometheusMetrics) Start() error {
+	listener, err := net.Listen("tcp", m.address)
+	if err != nil {
+		return fmt.Errorf("listen the Prometheus metrics endpoint failure: %v", err)
+	}
+	log.Infof("the Prometheus metrics endpoint is listening on %s", listener.Addr())
+	go func() {
+		if err := m.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Warnf("the Prometheus metrics endpoint stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (m *prometheusMetrics) Shutdown(ctx context.Context) error {
+	return m.server.Shutdown(ctx)
+}
+
+// update the snapshot by the appender of the latest check
+func (m *prometheusMetrics) update(appender *base.MetricsAppender) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.values, m.states = appender.Values(), appender.PolicyStates()
+}
+
+// addTrigger increases the trigger counters of the policies which caused the profiling task
+func (m *prometheusMetrics) addTrigger(service string, causes []base.ThresholdCause) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, c := range causes {
+		item := c.FromPolicy()
+		key := triggerCounterKey{service: service, policy: policyUUID(item.Policy),
+			targetType: item.Policy.TargetProfilingType}
+		for checkType, i := range item.Policy.Items {
+			if i == item {
+				key.checkType = checkType
+			}
+		}
+		m.triggers[key]++
+	}
+}
+
+func (m *prometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	buf := bufio.NewWriter(w)
+	m.write(buf)
+	if err := buf.Flush(); err != nil {
+		log.Warnf("writing the Prometheus metrics failure: %v", err)
+	}
+}
+
+type prometheusSample struct {
+	labels string
+	value  float64
+}
+
+func (m *prometheusMetrics) write(buf *bufio.Writer) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	values := make(map[string][]*prometheusSample)
+	for _, v := range m.values {
+		values[v.Name] = append(values[v.Name], &prometheusSample{labels: processLabels(v.Process, nil), value: v.Value})
+	}
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		m.writeFamily(buf, name, "gauge", fmt.Sprintf("The %s checked by the continuous profiling.", name), values[name])
+	}
+
+	matched, required, reached := make([]*prometheusSample, 0), make([]*prometheusSample, 0), make([]*prometheusSample, 0)
+	for _, s := range m.states {
+		// the processes could be matched by multiple service policies with the same item
+		labels := processLabels(s.Process, [][2]string{
+			{"policy", policyUUID(s.Item.Policy)},
+			{"target_type", string(s.Item.Policy.TargetProfilingType)},
+			{"check_type", string(s.CheckType)},
+			{"threshold", s.Item.Threshold},
+			{"period", strconv.Itoa(s.Item.Period)},
+		})
+		matched = append(matched, &prometheusSample{labels: labels, value: float64(s.Matched)})
+		required = append(required, &prometheusSample{labels: labels, value: float64(s.Item.Count)})
+		isReached := 0.0
+		if s.Matched >= s.Item.Count {
+			isReached = 1
+		}
+		reached = append(reached, &prometheusSample{labels: labels, value: isReached})
+	}
+	m.writeFamily(buf, "policy_window_matched_count", "gauge",
+		"The count of the time windows reached the threshold of the policy.", matched)
+	m.writeFamily(buf, "policy_window_required_count", "gauge",
+		"The count of the time windows which required to trigger the policy.", required)
+	m.writeFamily(buf, "policy_threshold_reached", "gauge",
+		"Whether the policy is reached, 1 is reached.", reached)
+
+	keys := make([]triggerCounterKey, 0, len(m.triggers))
+	for k := range m.triggers {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].service != keys[j].service {
+			return keys[i].service < keys[j].service
+		}
+		if keys[i].policy != keys[j].policy {
+			return keys[i].policy < keys[j].policy
+		}
+		if keys[i].targetType != keys[j].targetType {
+			return keys[i].targetType < keys[j].targetType
+		}
+		return keys[i].checkType < keys[j].checkType
+	})
+	triggers := make([]*prometheusSample, 0, len(keys))
+	for _, k := range keys {
+		triggers = append(triggers, &prometheusSample{labels: formatLabels([][2]string{
+			{"service", k.service}, {"policy", k.policy}, {"target_type", string(k.targetType)},
+			{"check_type", string(k.checkType)},
+		}), value: float64(m.triggers[k])})
+	}
+	m.writeFamily(buf, "policy_triggers_total", "counter",
+		"The count of the profiling tasks triggered by the policy.", triggers)
+
+	if m.certificates == nil {
+		return
+	}
+	// the index is the order of the certificate in the files, so the certificates with the same subject are still
+	// different series
+	certificates := m.certificates()
+	expiry := make([]*prometheusSample, 0, len(certificates))
+	for i, c := range certificates {
+		expiry = append(expiry, &prometheusSample{labels: formatLabels([][2]string{
+			{"index", strconv.Itoa(i)}, {"path", c.Path}, {"subject", c.Subject}, {"serial", c.Serial},
+		}), value: float64(c.NotAfter.Unix())})
+	}
+	m.writeFamily(buf, "backend_certificate_expiry_timestamp_seconds", "gauge",
+		"The expiry time of the backend TLS certificate in unix seconds.", expiry)
+}
+
+// policyUUID of the service policy, empty if the policy is not from the service
+func policyUUID(policy *base.Policy) string {
+	if policy.ServicePolicy == nil {
+		return ""
+	}
+	return policy.ServicePolicy.UUID
+}
+
+func (m *prometheusMetrics) writeFamily(buf *bufio.Writer, name, metricType, help string, samples []*prometheusSample) {
+	if len(samples) == 0 {
+		return
+	}
+	name = unsafeMetricNameRegex.ReplaceAllString(m.prefix+"_"+name, "_")
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+	for _, s := range samples {
+		fmt.Fprintf(buf, "%s{%s} %s\n", name, s.labels, strconv.FormatFloat(s.value, 'g', -1, 64))
+	}
+}
+
+func processLabels(p api.ProcessInterface, extra [][2]string) string {
+	labels := [][2]string{{"pid", strconv.Itoa(int(p.Pid()))}}
+	if e := p.Entity(); e != nil {
+		labels = append(labels, [2]string{"layer", e.Layer}, [2]string{"service", e.ServiceName},
+			[2]string{"instance", e.InstanceName}, [2]string{"process", e.ProcessName},
+			[2]string{"labels", strings.Join(e.Labels, ",")})
+	}
+	return formatLabels(append(labels, extra...))
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(labels [][2]string) string {
+	result := make([]string, 0, len(labels))
+	for _, l := range labels {
+		result = append(result, fmt.Sprintf(`%s="%s"`, l[0], labelValueEscaper.Replace(l[1])))
+	}
+	return strings.Join(result, ",")
+}
@@ -0,0 +1,112 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package continuous
+
+import (
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"perfprofiler/pkg/core/backend"
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/continuous/base"
+	"perfprofiler/pkg/profiling/continuous/checker/common"
+	"perfprofiler/pkg/tools/profiling"
+
+	"github.com/shirou/gopsutil/process"
+	"github.com/stretchr/testify/assert"
+
+	v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
+)
+
+type testProcess struct {
+	pid    int32
+	entity *api.ProcessEntity
+}
+
+func (p *testProcess) ID() string                        { return "id" }
+func (p *testProcess) Pid() int32                        { return p.pid }
+func (p *testProcess) DetectType() api.ProcessDetectType { return api.Scanner }
+func (p *testProcess) Entity() *api.ProcessEntity        { return p.entity }
+func (p *testProcess) ProfilingStat() *profiling.Info    { return nil }
+func (p *testProcess) ExeName() (string, error)          { return "", nil }
+func (p *testProcess) OriginalProcess() *process.Process { return nil }
+func (p *testProcess) PortIsExpose(port int) bool        { return false }
+func (p *testProcess) DetectNewExposePort(port int)      {}
+
+func TestPrometheusMetrics(t *testing.T) {
+	p := &testProcess{pid: 10, entity: &api.ProcessEntity{Layer: "GENERAL", ServiceName: "svc", InstanceName: "ins",
+		ProcessName: `app"1`, Labels: []string{"a", "b"}}}
+	policy := &base.Policy{TargetProfilingType: base.TargetProfilingTypeOnCPU, Items: map[base.CheckType]*base.PolicyItem{},
+		ServicePolicy: &base.ServicePolicy{Service: "svc", UUID: "policy-1"}}
+	item := &base.PolicyItem{Threshold: "80", Period: 5, Count: 3, Policy: policy}
+	policy.Items[base.CheckTypeProcessCPU] = item
+
+	appender := base.NewMetricsAppender("continuous")
+	appender.AppendProcessSingleValue("process_cpu", p, nil, 85.5)
+	appender.AppendPolicyState(base.CheckTypeProcessCPU, item, p, 3)
+	metrics := newPrometheusMetrics("", appender.Prefix())
+	metrics.update(appender)
+	cause := common.NewSingleValueCause(p, item, v3.ContinuousProfilingTriggeredMonitorType_ProcessCPU, 80, 85.5)
+	metrics.addTrigger("svc", []base.ThresholdCause{cause})
+	metrics.addTrigger("svc", []base.ThresholdCause{cause})
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", PrometheusMetricsPath, nil))
+	body, err := io.ReadAll(recorder.Body)
+	assert.NoError(t, err)
+	labels := `pid="10",layer="GENERAL",service="svc",instance="ins",process="app\"1",labels="a,b"`
+	policyLabels := labels + `,policy="policy-1",target_type="ON_CPU",check_type="PROCESS_CPU",threshold="80",period="5"`
+	assert.Equal(t, `# HELP continuous_process_cpu The process_cpu checked by the continuous profiling.
+# TYPE continuous_process_cpu gauge
+continuous_process_cpu{`+labels+`} 85.5
+# HELP continuous_policy_window_matched_count The count of the time windows reached the threshold of the policy.
+# TYPE continuous_policy_window_matched_count gauge
+continuous_policy_window_matched_count{`+policyLabels+`} 3
+# HELP continuous_policy_window_required_count The count of the time windows which required to trigger the policy.
+# TYPE continuous_policy_window_required_count gauge
+continuous_policy_window_required_count{`+policyLabels+`} 3
+# HELP continuous_policy_threshold_reached Whether the policy is reached, 1 is reached.
+# TYPE continuous_policy_threshold_reached gauge
+continuous_policy_threshold_reached{`+policyLabels+`} 1
+# HELP continuous_policy_triggers_total The count of the profiling tasks triggered by the policy.
+# TYPE continuous_policy_triggers_total counter
+continuous_policy_triggers_total{service="svc",policy="policy-1",target_type="ON_CPU",check_type="PROCESS_CPU"} 2
+`, string(body))
+
+	// the backend certificates are read in each request, the same certificate is still different series
+	notAfter := time.Unix(1700000000, 0)
+	metrics.certificates = func() []*backend.CertificateInfo {
+		return []*backend.CertificateInfo{{Path: "/etc/ca.pem", Subject: "CN=oap", Serial: "1", NotAfter: notAfter},
+			{Path: "/etc/ca.pem", Subject: "CN=oap", Serial: "1", NotAfter: notAfter}}
+	}
+	recorder = httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", PrometheusMetricsPath, nil))
+	assert.Contains(t, recorder.Body.String(), `# TYPE continuous_backend_certificate_expiry_timestamp_seconds gauge
+continuous_backend_certificate_expiry_timestamp_seconds{index="0",path="/etc/ca.pem",subject="CN=oap",serial="1"} 1.7e+09
+continuous_backend_certificate_expiry_timestamp_seconds{index="1",path="/etc/ca.pem",subject="CN=oap",serial="1"} 1.7e+09
+`)
+
+	// the snapshot is replaced by the next check
+	metrics.update(base.NewMetricsAppender("continuous"))
+	recorder = httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", PrometheusMetricsPath, nil))
+	assert.NotContains(t, recorder.Body.String(), "continuous_process_cpu")
+	assert.Contains(t, recorder.Body.String(), "continuous_policy_triggers_total")
+}
@@ -0,0 +1,125 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package continuous
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"perfprofiler/pkg/profiling/continuous/base"
+
+	v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
+)
+
+// the max count of the recent triggers
+const recentTriggerCount = 50
+
+// PolicyStatus is the running policy of the service
+type PolicyStatus struct {
+	Service      string                   `json:"service"`
+	UUID         string                   `json:"uuid"`
+	TargetType   base.TargetProfilingType `json:"targetType"`
+	Items        []*PolicyItemStatus      `json:"items"`
+	ProcessCount int                      `json:"processCount"`
+}
+
+type PolicyItemStatus struct {
+	CheckType base.CheckType `json:"checkType"`
+	Threshold string         `json:"threshold"`
+	Period    int            `json:"period"`
+	Count     int            `json:"count"`
+}
+
+// TriggerRecord is the profiling task triggered by the policies
+type TriggerRecord struct {
+	Time       time.Time                `json:"time"`
+	TaskID     string                   `json:"taskId"`
+	TargetType base.TargetProfilingType `json:"targetType"`
+	Pid        int32                    `json:"pid"`
+	Service    string                   `json:"service"`
+	Instance   string                   `json:"instance"`
+	Process    string                   `json:"process"`
+	Causes     []string                 `json:"causes"`
+}
+
+// triggerRecords keeps the recent triggers, the oldest record is removed when full
+type triggerRecords struct {
+	lock    sync.Mutex
+	records []*TriggerRecord
+}
+
+func (r *triggerRecords) add(record *TriggerRecord) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.records) >= recentTriggerCount {
+		r.records = r.records[1:]
+	}
+	r.records = append(r.records, record)
+}
+
+// recent records, the latest record is the first
+func (r *triggerRecords) recent() []*TriggerRecord {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	result := make([]*TriggerRecord, 0, len(r.records))
+	for i := len(r.records) - 1; i >= 0; i-- {
+		result = append(result, r.records[i])
+	}
+	return result
+}
+
+// Policies returns the status of the running policies
+func (m *Manager) Policies() []*PolicyStatus {
+	policies := m.checkers.syncedPolicies()
+	result := make([]*PolicyStatus, 0, len(policies))
+	for _, p := range policies {
+		status := &PolicyStatus{TargetType: p.Policy.TargetProfilingType, ProcessCount: len(p.Processes)}
+		if sp := p.Policy.ServicePolicy; sp != nil {
+			status.Service, status.UUID = sp.Service, sp.UUID
+		}
+		for checkType, item := range p.Policy.Items {
+			status.Items = append(status.Items, &PolicyItemStatus{
+				CheckType: checkType, Threshold: item.Threshold, Period: item.Period, Count: item.Count})
+		}
+		sort.Slice(status.Items, func(i, j int) bool {
+			return status.Items[i].CheckType < status.Items[j].CheckType
+		})
+		result = append(result, status)
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Service < result[j].Service
+	})
+	return result
+}
+
+// RecentTriggers returns the recent triggered tasks, the latest trigger is the first
+func (m *Manager) RecentTriggers() []*TriggerRecord {
+	return m.triggers.records.recent()
+}
+
+func describeCause(cause *v3.ContinuousProfilingCause) string {
+	if v := cause.GetSingleValue(); v != nil {
+		return fmt.Sprintf("%s: current %.2f, threshold %.2f", cause.GetType(), v.Current, v.Threshold)
+	}
+	if v := cause.GetUri(); v != nil {
+		return fmt.Sprintf("%s: %s", cause.GetType(), v.String())
+	}
+	return cause.GetType().String()
+}
@@ -19,13 +19,13 @@ package continuous
 
 import (
 	"context"
-	"fmt"
+	"time"
 
-	"perfprofiler/pkg/core"
 	"perfprofiler/pkg/module"
 	"perfprofiler/pkg/process/api"
 	"perfprofiler/pkg/profiling/continuous/base"
 	"perfprofiler/pkg/profiling/continuous/trigger"
+	"perfprofiler/pkg/profiling/sink"
 	"perfprofiler/pkg/profiling/task"
 	taskBase "perfprofiler/pkg/profiling/task/base"
 
@@ -44,16 +44,16 @@ func init() {
 }
 
 type Triggers struct {
-	taskManager      *task.Manager
-	continuousClient v3.ContinuousProfilingServiceClient
+	taskManager *task.Manager
+	sink        sink.Sink
+	records     *triggerRecords
+	metrics     *prometheusMetrics
 
 	ctx context.Context
 }
 
-func NewTriggers(ctx context.Context, moduleMgr *module.Manager, taskManager *task.Manager, conf *base.ContinuousConfig) (*Triggers, error) {
-	coreOperator := moduleMgr.FindModule(core.ModuleName).(core.Operator)
-	continuousClient := v3.NewContinuousProfilingServiceClient(coreOperator.BackendOperator().GetConnection())
-
+func NewTriggers(ctx context.Context, moduleMgr *module.Manager, taskManager *task.Manager, conf *base.ContinuousConfig,
+	dataSink sink.Sink) (*Triggers, error) {
 	var err error
 	for _, t := range triggerRegistration {
 		if e := t.Init(moduleMgr, conf); e != nil {
@@ -64,9 +64,10 @@ func NewTriggers(ctx context.Context, moduleMgr *module.Manager, taskManager *ta
 		return nil, err
 	}
 	return &Triggers{
-		taskManager:      taskManager,
-		continuousClient: continuousClient,
-		ctx:              ctx,
+		taskManager: taskManager,
+		sink:        dataSink,
+		records:     &triggerRecords{},
+		ctx:         ctx,
 	}, nil
 }
 
@@ -101,21 +102,7 @@ func (m *Triggers) ReportProcesses(process api.ProcessInterface, profilingProces
 			Causes:       transferCauses,
 		}
 		reportSetter(report)
-		profilingTask, err := m.continuousClient.ReportProfilingTask(m.ctx, report)
-		if err != nil {
-			return "", err
-		}
-
-		command := profilingTask.Commands[0]
-		if len(profilingTask.Commands) != 1 || command.GetCommand() != "ContinuousProfilingReportTask" {
-			return "", fmt.Errorf("the profiling task result is not right, command count: %d", len(profilingTask.Commands))
-		}
-		for _, kv := range command.GetArgs() {
-			if kv.GetKey() == "TaskId" {
-				return kv.GetValue(), nil
-			}
-		}
-		return "", fmt.Errorf("could not found the task ID from repoter")
+		return m.sink.ReportProfilingTask(m.ctx, report)
 	})
 	if err != nil {
 		return nil, err
@@ -123,6 +110,26 @@ func (m *Triggers) ReportProcesses(process api.ProcessInterface, profilingProces
 
 	// execute task from context
 	m.taskManager.StartTask(taskContext)
+	m.records.add(buildTriggerRecord(process, taskContext, cases))
+	if m.metrics != nil {
+		m.metrics.addTrigger(process.Entity().ServiceName, cases)
+	}
 
 	return taskContext, nil
 }
+
+func buildTriggerRecord(process api.ProcessInterface, taskContext *task.Context, cases []base.ThresholdCause) *TriggerRecord {
+	record := &TriggerRecord{
+		Time:     time.Now(),
+		TaskID:   taskContext.TaskID(),
+		Pid:      process.Pid(),
+		Service:  process.Entity().ServiceName,
+		Instance: process.Entity().InstanceName,
+		Process:  process.Entity().ProcessName,
+	}
+	for _, c := range cases {
+		record.TargetType = c.FromPolicy().Policy.TargetProfilingType
+		record.Causes = append(record.Causes, describeCause(c.GenerateTransferCause()))
+	}
+	return record
+}
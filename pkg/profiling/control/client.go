@@ -0,0 +1,130 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"perfprofiler/pkg/profiling/sink"
+	"perfprofiler/pkg/profiling/task"
+)
+
+// Client of the control API
+type Client struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// NewClient connects to the unix socket path, or "tcp://<host>:<port>"
+func NewClient(address, token string) *Client {
+	transport := &http.Transport{}
+	baseURL := "http://control"
+	if addr, ok := strings.CutPrefix(address, tcpPrefix); ok {
+		baseURL = "http://" + addr
+	} else {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", address)
+		}
+	}
+	return &Client{baseURL: baseURL, token: token, client: &http.Client{Transport: transport, Timeout: 30 * time.Second}}
+}
+
+// Tasks which active in the agent
+func (c *Client) Tasks() ([]*task.Status, error) {
+	result := make([]*task.Status, 0)
+	return result, c.do(http.MethodGet, tasksPath, nil, &result)
+}
+
+// Task by the ID
+func (c *Client) Task(id string) (*task.Status, error) {
+	result := &task.Status{}
+	return result, c.do(http.MethodGet, tasksPath+"/"+url.PathEscape(id), nil, result)
+}
+
+// CreateTask of the processes
+func (c *Client) CreateTask(req *CreateTaskRequest) (*task.Status, error) {
+	result := &task.Status{}
+	return result, c.do(http.MethodPost, tasksPath, req, result)
+}
+
+// CancelTask by the ID
+func (c *Client) CancelTask(id string) error {
+	return c.do(http.MethodDelete, tasksPath+"/"+url.PathEscape(id), nil, nil)
+}
+
+// Processes detected by the agent
+func (c *Client) Processes() ([]*ProcessStatus, error) {
+	result := make([]*ProcessStatus, 0)
+	return result, c.do(http.MethodGet, processesPath, nil, &result)
+}
+
+// Continuous profiling policies and triggers
+func (c *Client) Continuous() (*ContinuousStatus, error) {
+	result := &ContinuousStatus{}
+	return result, c.do(http.MethodGet, continuousPath, nil, result)
+}
+
+// Spool stats of the data failed to send
+func (c *Client) Spool() (*sink.SpoolStats, error) {
+	result := &sink.SpoolStats{}
+	return result, c.do(http.MethodGet, spoolPath, nil, result)
+}
+
+func (c *Client) do(method, path string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.baseURL+path, reader)
+	if err != nil {
+		return err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		e := &errorResponse{}
+		if err := json.NewDecoder(resp.Body).Decode(e); err != nil || e.Error == "" {
+			return fmt.Errorf("the control API response status: %s", resp.Status)
+		}
+		return fmt.Errorf("%s", e.Error)
+	}
+	if result == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
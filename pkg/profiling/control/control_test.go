@@ -0,0 +1,244 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package control
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/continuous"
+	"perfprofiler/pkg/profiling/sink"
+	"perfprofiler/pkg/profiling/task"
+	"perfprofiler/pkg/profiling/task/base"
+	"perfprofiler/pkg/tools/profiling"
+
+	"github.com/shirou/gopsutil/process"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProcess struct {
+	pid    int32
+	entity *api.ProcessEntity
+	stat   *profiling.Info
+}
+
+func (p *fakeProcess) ID() string                        { return fmt.Sprintf("id-%d", p.pid) }
+func (p *fakeProcess) Pid() int32                        { return p.pid }
+func (p *fakeProcess) DetectType() api.ProcessDetectType { return api.Scanner }
+func (p *fakeProcess) Entity() *api.ProcessEntity        { return p.entity }
+func (p *fakeProcess) ProfilingStat() *profiling.Info    { return p.stat }
+func (p *fakeProcess) ExeName() (string, error)          { return "", nil }
+func (p *fakeProcess) OriginalProcess() *process.Process { return nil }
+func (p *fakeProcess) PortIsExpose(port int) bool        { return false }
+func (p *fakeProcess) DetectNewExposePort(port int)      {}
+
+type fakeOperator struct {
+	lock  sync.Mutex
+	tasks []*task.Status
+	spool *sink.SpoolStats
+}
+
+func (f *fakeOperator) Processes() []api.ProcessInterface {
+	return []api.ProcessInterface{
+		&fakeProcess{pid: 2, entity: &api.ProcessEntity{ServiceName: "svc", ProcessName: "java"}},
+		&fakeProcess{pid: 1, entity: &api.ProcessEntity{ServiceName: "svc", ProcessName: "go"}, stat: profiling.NewInfo(nil)},
+	}
+}
+
+func (f *fakeOperator) ActiveTasks() []*task.Status {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return append([]*task.Status{}, f.tasks...)
+}
+
+func (f *fakeOperator) ContinuousPolicies() []*continuous.PolicyStatus {
+	return []*continuous.PolicyStatus{{Service: "svc", ProcessCount: 1}}
+}
+
+func (f *fakeOperator) RecentTriggers() []*continuous.TriggerRecord {
+	return []*continuous.TriggerRecord{{TaskID: "continuous-1", Causes: []string{"PROCESS_CPU"}}}
+}
+
+func (f *fakeOperator) CreateLocalTask(pids []int32, targetType base.TargetType, duration time.Duration) (*task.Status, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for _, pid := range pids {
+		if pid > 2 {
+			return nil, fmt.Errorf("%w: %d", task.ErrProcessNotFound, pid)
+		}
+	}
+	for _, t := range f.tasks {
+		if t.Pids[0] == pids[0] && t.TargetType == targetType {
+			return nil, fmt.Errorf("%w: %s", task.ErrTaskConflict, t.TaskID)
+		}
+	}
+	status := &task.Status{TaskID: fmt.Sprintf("local-%d", len(f.tasks)+1), TargetType: targetType, Origin: base.OriginLocal,
+		Pids: pids, MaxRunningDuration: duration}
+	f.tasks = append(f.tasks, status)
+	return status, nil
+}
+
+func (f *fakeOperator) SpoolStats() *sink.SpoolStats {
+	return f.spool
+}
+
+func (f *fakeOperator) CancelTask(taskID string) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for i, t := range f.tasks {
+		if t.TaskID == taskID {
+			f.tasks = append(f.tasks[:i], f.tasks[i+1:]...)
+			return nil
+		}
+	}
+	return task.ErrTaskNotFound
+}
+
+// startServer on the unix socket, the temp directory is short enough for the socket path
+func startServer(t *testing.T, config *Config) *Server {
+	if config.Address == "" {
+		dir, err := os.MkdirTemp("", "control")
+		assert.NoError(t, err)
+		t.Cleanup(func() {
+			_ = os.RemoveAll(dir)
+		})
+		config.Address = filepath.Join(dir, "control.sock")
+	}
+	s := NewServer(config, &fakeOperator{})
+	assert.NoError(t, s.Start())
+	t.Cleanup(func() {
+		_ = s.Shutdown(context.Background())
+	})
+	return s
+}
+
+func TestTasks(t *testing.T) {
+	config := &Config{}
+	s := startServer(t, config)
+	info, err := os.Stat(config.Address)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	client := NewClient(config.Address, "")
+
+	created, err := client.CreateTask(&CreateTaskRequest{Pids: []int32{1}, Type: "on_cpu", Duration: "1m"})
+	assert.NoError(t, err)
+	assert.Equal(t, base.OriginLocal, created.Origin)
+	assert.Equal(t, base.TargetTypeOnCPU, created.TargetType)
+	assert.Equal(t, time.Minute, created.MaxRunningDuration)
+
+	tests := []struct {
+		name    string
+		req     *CreateTaskRequest
+		wantErr string
+	}{
+		{name: "conflict", req: &CreateTaskRequest{Pids: []int32{1}, Type: "ON_CPU", Duration: "1m"}, wantErr: "another task"},
+		{name: "not found", req: &CreateTaskRequest{Pids: []int32{3}, Type: "OFF_CPU", Duration: "1m"}, wantErr: "not tracked"},
+		{name: "unknown type", req: &CreateTaskRequest{Pids: []int32{1}, Type: "memory", Duration: "1m"}, wantErr: "target type"},
+		{name: "illegal duration", req: &CreateTaskRequest{Pids: []int32{1}, Type: "ON_CPU", Duration: "1"}, wantErr: "duration"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := client.CreateTask(tt.req)
+			assert.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+
+	tasks, err := client.Tasks()
+	assert.NoError(t, err)
+	assert.Len(t, tasks, 1)
+	found, err := client.Task(created.TaskID)
+	assert.NoError(t, err)
+	assert.Equal(t, []int32{1}, found.Pids)
+	assert.NoError(t, client.CancelTask(created.TaskID))
+	assert.ErrorContains(t, client.CancelTask(created.TaskID), "not found")
+	_, err = client.Task(created.TaskID)
+	assert.ErrorContains(t, err, "not found")
+
+	// the socket is removed after shutdown
+	assert.NoError(t, s.Shutdown(context.Background()))
+	_, err = os.Stat(config.Address)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestStatus(t *testing.T) {
+	config := &Config{}
+	startServer(t, config)
+	client := NewClient(config.Address, "")
+
+	processes, err := client.Processes()
+	assert.NoError(t, err)
+	assert.Len(t, processes, 2)
+	assert.Equal(t, int32(1), processes[0].Pid)
+	assert.True(t, processes[0].Profilable)
+	assert.Equal(t, "go", processes[0].Process)
+	assert.False(t, processes[1].Profilable)
+
+	status, err := client.Continuous()
+	assert.NoError(t, err)
+	assert.Len(t, status.Policies, 1)
+	assert.Equal(t, "continuous-1", status.Triggers[0].TaskID)
+}
+
+func TestSpool(t *testing.T) {
+	operator := &fakeOperator{}
+	server := httptest.NewServer(NewServer(&Config{}, operator).Handler())
+	defer server.Close()
+	client := NewClient(tcpPrefix+strings.TrimPrefix(server.URL, "http://"), "")
+
+	_, err := client.Spool()
+	assert.ErrorContains(t, err, "disabled")
+	operator.spool = &sink.SpoolStats{Files: 1, Items: 3, Dropped: 2}
+	stats, err := client.Spool()
+	assert.NoError(t, err)
+	assert.Equal(t, operator.spool, stats)
+}
+
+func TestTCPAuthentication(t *testing.T) {
+	s := NewServer(&Config{AuthToken: "secret"}, &fakeOperator{})
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+	address := tcpPrefix + strings.TrimPrefix(server.URL, "http://")
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "missing token", token: "", wantErr: true},
+		{name: "wrong token", token: "other", wantErr: true},
+		{name: "correct token", token: "secret", wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClient(address, tt.token).Tasks()
+			if tt.wantErr {
+				assert.ErrorContains(t, err, "unauthorized")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
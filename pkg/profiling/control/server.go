@@ -0,0 +1,289 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package control
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"perfprofiler/pkg/logger"
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/continuous"
+	"perfprofiler/pkg/profiling/sink"
+	"perfprofiler/pkg/profiling/task"
+	"perfprofiler/pkg/profiling/task/base"
+)
+
+var log = logger.GetLogger("profiling", "control")
+
+const (
+	tasksPath      = "/v1/tasks"
+	processesPath  = "/v1/processes"
+	continuousPath = "/v1/continuous"
+	spoolPath      = "/v1/spool"
+
+	tcpPrefix = "tcp://"
+)
+
+type Config struct {
+	Address   string `mapstructure:"address"`    // The unix socket path, or "tcp://<host>:<port>" for TCP, disabled when empty
+	AuthToken string `mapstructure:"auth_token"` // The token of "Authorization: Bearer <token>" header, not checked when empty
+}
+
+// Operator manages the profiling tasks and provides the status of the agent
+type Operator interface {
+	// Processes detected by the agent
+	Processes() []api.ProcessInterface
+	// ActiveTasks of the profiling
+	ActiveTasks() []*task.Status
+	// ContinuousPolicies which running
+	ContinuousPolicies() []*continuous.PolicyStatus
+	// RecentTriggers of the continuous profiling
+	RecentTriggers() []*continuous.TriggerRecord
+	// CreateLocalTask of the processes
+	CreateLocalTask(pids []int32, targetType base.TargetType, duration time.Duration) (*task.Status, error)
+	// CancelTask by the task ID
+	CancelTask(taskID string) error
+	// SpoolStats of the data failed to send, nil when the spool is disabled
+	SpoolStats() *sink.SpoolStats
+}
+
+// CreateTaskRequest is the body of creating the task
+type CreateTaskRequest struct {
+	Pids     []int32         `json:"pids"`
+	Type     base.TargetType `json:"type"`
+	Duration string          `json:"duration"`
+}
+
+// ProcessStatus is the detected process and whether it supports the profiling
+type ProcessStatus struct {
+	ID          string   `json:"id"`
+	Pid         int32    `json:"pid"`
+	DetectType  string   `json:"detectType"`
+	Layer       string   `json:"layer"`
+	Service     string   `json:"service"`
+	Instance    string   `json:"instance"`
+	Process     string   `json:"process"`
+	Labels      []string `json:"labels"`
+	Profilable  bool     `json:"profilable"`
+	ModuleCount int      `json:"moduleCount"`
+}
+
+// ContinuousStatus is the running policies and the recent triggers
+type ContinuousStatus struct {
+	Policies []*continuous.PolicyStatus  `json:"policies"`
+	Triggers []*continuous.TriggerRecord `json:"triggers"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Server is the local API of managing the profiling tasks
+type Server struct {
+	config   *Config
+	operator Operator
+	server   *http.Server
+	socket   string
+}
+
+func NewServer(config *Config, operator Operator) *Server {
+	s := &Server{config: config, operator: operator}
+	mux := http.NewServeMux()
+	mux.HandleFunc(tasksPath, s.tasks)
+	mux.HandleFunc(tasksPath+"/", s.task)
+	mux.HandleFunc(processesPath, s.processes)
+	mux.HandleFunc(continuousPath, s.continuous)
+	mux.HandleFunc(spoolPath, s.spool)
+	s.server = &http.Server{Handler: s.authenticate(mux), ReadHeaderTimeout: 10 * time.Second}
+	return s
+}
+
+// Start listening in the background, the stale unix socket file is removed before listening
+func (s *Server) Start() error {
+	var listener net.Listener
+	var err error
+	if addr, ok := strings.CutPrefix(s.config.Address, tcpPrefix); ok {
+		if s.config.AuthToken == "" {
+			log.Warnf("the control API is listening on TCP without the auth token")
+		}
+		listener, err = net.Listen("tcp", addr)
+	} else {
+		if err = os.Remove(s.config.Address); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove the stale control socket failure: %v", err)
+		}
+		if listener, err = net.Listen("unix", s.config.Address); err == nil {
+			s.socket = s.config.Address
+			// only the owner could manage the tasks
+			err = os.Chmod(s.socket, 0o600)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("listen the control API failure: %v", err)
+	}
+	log.Infof("the control API is listening on %s", s.config.Address)
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Warnf("the control API stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	err := s.server.Shutdown(ctx)
+	if s.socket != "" {
+		_ = os.Remove(s.socket)
+	}
+	return err
+}
+
+// Handler of the server, works for the test
+func (s *Server) Handler() http.Handler {
+	return s.server.Handler
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.AuthToken != "" && subtle.ConstantTimeCompare(
+			[]byte(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")), []byte(s.config.AuthToken)) != 1 {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("unauthorized"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) tasks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, s.operator.ActiveTasks())
+	case http.MethodPost:
+		s.createTask(w, r)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+	}
+}
+
+func (s *Server) createTask(w http.ResponseWriter, r *http.Request) {
+	req := &CreateTaskRequest{}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("parsing the request failure: %v", err))
+		return
+	}
+	targetType, err := base.ParseTargetType(nil, strings.ToUpper(string(req.Type)))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	duration, err := time.ParseDuration(req.Duration)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("illegal duration: %q", req.Duration))
+		return
+	}
+	status, err := s.operator.CreateLocalTask(req.Pids, targetType, duration)
+	switch {
+	case errors.Is(err, task.ErrProcessNotFound):
+		writeError(w, http.StatusNotFound, err)
+	case errors.Is(err, task.ErrTaskConflict):
+		writeError(w, http.StatusConflict, err)
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err)
+	default:
+		log.Infof("created the local profiling task: %s", status.TaskID)
+		writeJSON(w, http.StatusCreated, status)
+	}
+}
+
+func (s *Server) task(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimPrefix(r.URL.Path, tasksPath+"/")
+	switch r.Method {
+	case http.MethodGet:
+		for _, t := range s.operator.ActiveTasks() {
+			if t.TaskID == id {
+				writeJSON(w, http.StatusOK, t)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, task.ErrTaskNotFound)
+	case http.MethodDelete:
+		if err := s.operator.CancelTask(id); errors.Is(err, task.ErrTaskNotFound) {
+			writeError(w, http.StatusNotFound, err)
+		} else if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+		} else {
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+	}
+}
+
+func (s *Server) processes(w http.ResponseWriter, r *http.Request) {
+	processes := s.operator.Processes()
+	result := make([]*ProcessStatus, 0, len(processes))
+	for _, p := range processes {
+		status := &ProcessStatus{ID: p.ID(), Pid: p.Pid(), DetectType: p.DetectType().Name()}
+		if stat := p.ProfilingStat(); stat != nil {
+			status.Profilable, status.ModuleCount = true, len(stat.GetModules())
+		}
+		if e := p.Entity(); e != nil {
+			status.Layer, status.Service, status.Instance, status.Process, status.Labels =
+				e.Layer, e.ServiceName, e.InstanceName, e.ProcessName, e.Labels
+		}
+		result = append(result, status)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Pid < result[j].Pid
+	})
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) continuous(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, &ContinuousStatus{Policies: s.operator.ContinuousPolicies(), Triggers: s.operator.RecentTriggers()})
+}
+
+func (s *Server) spool(w http.ResponseWriter, r *http.Request) {
+	stats := s.operator.SpoolStats()
+	if stats == nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("the spool is disabled"))
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Warnf("writing the json response failure: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &errorResponse{Error: err.Error()})
+}
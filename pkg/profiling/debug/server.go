@@ -0,0 +1,210 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package debug
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"perfprofiler/pkg/logger"
+	"perfprofiler/pkg/profiling/export/pprof"
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/profiling/task"
+	"perfprofiler/pkg/profiling/task/base"
+)
+
+var log = logger.GetLogger("profiling", "debug")
+
+const (
+	// ProfilePath is compatible with the net/http/pprof, so it could be used by "go tool pprof"
+	ProfilePath = "/debug/pprof/profile"
+	// ProcessesPath lists the processes tracked by the agent, it is served without the UI
+	ProcessesPath = "/debug/processes"
+
+	defaultSeconds        = 30
+	defaultMaxSeconds     = 300
+	defaultMaxConcurrency = 2
+)
+
+type Config struct {
+	Address        string `mapstructure:"address"`         // The listen address of the HTTP server, disabled when empty
+	AuthToken      string `mapstructure:"auth_token"`      // The token of "Authorization: Bearer <token>" header or "token" query
+	MaxConcurrency int    `mapstructure:"max_concurrency"` // The max count of the profiling at the same time, default is 2
+	MaxSeconds     int    `mapstructure:"max_seconds"`     // The max duration seconds of each profiling, default is 300
+	EnableUI       bool   `mapstructure:"enable_ui"`       // Serve the web UI for browsing processes and flame graphs
+}
+
+// Profiler runs the profiling on demand
+type Profiler interface {
+	ProfileOnDemand(ctx context.Context, pid int32, targetType base.TargetType, duration time.Duration) (*profile.Profile, error)
+}
+
+// Server answers the ad-hoc profile requests of the processes tracked by the agent
+type Server struct {
+	config     *Config
+	profiler   Profiler
+	status     StatusProvider
+	slots      chan struct{}
+	server     *http.Server
+	uiProfiles *uiProfiles
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewServer of the debug HTTP, the status provider works for the process listing and the UI
+func NewServer(config *Config, profiler Profiler, status StatusProvider) *Server {
+	concurrency := config.MaxConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultMaxConcurrency
+	}
+	s := &Server{config: config, profiler: profiler, status: status, slots: make(chan struct{}, concurrency),
+		uiProfiles: &uiProfiles{}}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	mux := http.NewServeMux()
+	mux.Handle(ProfilePath, s.authenticate(http.HandlerFunc(s.profile)))
+	if status != nil {
+		mux.Handle(ProcessesPath, s.authenticate(http.HandlerFunc(s.listProcesses)))
+	}
+	if config.EnableUI && status != nil {
+		s.registerUI(mux)
+	}
+	s.server = &http.Server{Addr: config.Address, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return s
+}
+
+// Start listening in the background
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.config.Address)
+	if err != nil {
+		return fmt.Errorf("listen the debug HTTP server failure: %v", err)
+	}
+	log.Infof("the debug HTTP server is listening on %s", listener.Addr())
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Warnf("the debug HTTP server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// Handler of the server, works for the test
+func (s *Server) Handler() http.Handler {
+	return s.server.Handler
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.config.AuthToken == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		token := r.URL.Query().Get("token")
+		if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			token = strings.TrimPrefix(auth, "Bearer ")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(s.config.AuthToken)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) profile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	pid, targetType, duration, err := s.parseRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+		defer func() {
+			<-s.slots
+		}()
+	default:
+		w.Header().Set("Retry-After", strconv.Itoa(int(duration.Seconds())))
+		http.Error(w, "too many profiling requests", http.StatusTooManyRequests)
+		return
+	}
+
+	p, err := s.profiler.ProfileOnDemand(r.Context(), pid, targetType, duration)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, task.ErrProcessNotFound) {
+			status = http.StatusNotFound
+		}
+		log.Warnf("on-demand profiling failure, pid: %d, error: %v", pid, err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%d.pb.gz"`, p.Type, pid))
+	if err := pprof.Write(w, p); err != nil {
+		log.Warnf("writing the pprof response failure, pid: %d, error: %v", pid, err)
+	}
+}
+
+func (s *Server) parseRequest(r *http.Request) (pid int32, targetType base.TargetType, duration time.Duration, err error) {
+	query := r.URL.Query()
+	p, err := strconv.ParseInt(query.Get("pid"), 10, 32)
+	if err != nil || p <= 0 {
+		return 0, "", 0, fmt.Errorf("illegal pid: %q", query.Get("pid"))
+	}
+
+	switch strings.ToLower(query.Get("type")) {
+	case "", "oncpu", "on_cpu":
+		targetType = base.TargetTypeOnCPU
+	case "offcpu", "off_cpu":
+		targetType = base.TargetTypeOffCPU
+	default:
+		return 0, "", 0, fmt.Errorf("unknown profiling type: %q, should be oncpu or offcpu", query.Get("type"))
+	}
+
+	seconds := defaultSeconds
+	if v := query.Get("seconds"); v != "" {
+		if seconds, err = strconv.Atoi(v); err != nil || seconds <= 0 {
+			return 0, "", 0, fmt.Errorf("illegal seconds: %q", v)
+		}
+	}
+	maxSeconds := s.config.MaxSeconds
+	if maxSeconds <= 0 {
+		maxSeconds = defaultMaxSeconds
+	}
+	if seconds > maxSeconds {
+		return 0, "", 0, fmt.Errorf("the seconds could not be bigger than %d", maxSeconds)
+	}
+	return int32(p), targetType, time.Duration(seconds) * time.Second, nil
+}
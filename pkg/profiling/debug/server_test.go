@@ -0,0 +1,134 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package debug
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/profiling/task"
+	"perfprofiler/pkg/profiling/task/base"
+	"perfprofiler/pkg/tools/profiling"
+
+	pprofile "github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProfiler struct {
+	block    chan struct{}
+	started  chan struct{}
+	requests []string
+}
+
+func (f *fakeProfiler) ProfileOnDemand(ctx context.Context, pid int32, targetType base.TargetType,
+	duration time.Duration) (*profile.Profile, error) {
+	f.requests = append(f.requests, fmt.Sprintf("%d-%s-%s", pid, targetType, duration))
+	if f.block != nil {
+		f.started <- struct{}{}
+		<-f.block
+	}
+	if pid == 404 {
+		return nil, task.ErrProcessNotFound
+	}
+	t := profile.TypeOnCPU
+	if targetType == base.TargetTypeOffCPU {
+		t = profile.TypeOffCPU
+	}
+	return &profile.Profile{TaskID: "on-demand", Type: t, Pid: pid, StartTime: time.Now(), EndTime: time.Now().Add(duration),
+		Samples: []*profile.Sample{{Locations: []*profile.Location{{Address: 1, Frames: []*profiling.Frame{{Name: "main"}}}},
+			Count: 1, Duration: 10}}}, nil
+}
+
+func TestProfile(t *testing.T) {
+	profiler := &fakeProfiler{}
+	server := httptest.NewServer(NewServer(&Config{AuthToken: "secret", MaxSeconds: 60}, profiler, nil).Handler())
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		query   string
+		token   string
+		status  int
+		request string
+	}{
+		{name: "unauthorized", query: "pid=1", status: http.StatusUnauthorized},
+		{name: "wrong token", query: "pid=1", token: "wrong", status: http.StatusUnauthorized},
+		{name: "default on-cpu", query: "pid=1", token: "secret", status: http.StatusOK, request: "1-ON_CPU-30s"},
+		{name: "query token", query: "pid=2&seconds=5&type=offcpu&token=secret", status: http.StatusOK,
+			request: "2-OFF_CPU-5s"},
+		{name: "illegal pid", query: "pid=abc", token: "secret", status: http.StatusBadRequest},
+		{name: "illegal type", query: "pid=1&type=memory", token: "secret", status: http.StatusBadRequest},
+		{name: "too long", query: "pid=1&seconds=61", token: "secret", status: http.StatusBadRequest},
+		{name: "not tracked", query: "pid=404", token: "secret", status: http.StatusNotFound, request: "404-ON_CPU-30s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profiler.requests = nil
+			req, err := http.NewRequest(http.MethodGet, server.URL+ProfilePath+"?"+tt.query, http.NoBody)
+			assert.NoError(t, err)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			assert.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, tt.status, resp.StatusCode)
+			if tt.request != "" {
+				assert.Equal(t, []string{tt.request}, profiler.requests)
+			} else {
+				assert.Empty(t, profiler.requests)
+			}
+			if resp.StatusCode == http.StatusOK {
+				p, err := pprofile.Parse(resp.Body)
+				assert.NoError(t, err)
+				assert.Len(t, p.Sample, 1)
+			}
+		})
+	}
+}
+
+func TestProfileConcurrencyLimit(t *testing.T) {
+	profiler := &fakeProfiler{block: make(chan struct{}), started: make(chan struct{}, 1)}
+	server := httptest.NewServer(NewServer(&Config{MaxConcurrency: 1}, profiler, nil).Handler())
+	defer server.Close()
+
+	finished := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(server.URL + ProfilePath + "?pid=1&seconds=1")
+		if err != nil {
+			finished <- 0
+			return
+		}
+		_ = resp.Body.Close()
+		finished <- resp.StatusCode
+	}()
+	<-profiler.started
+
+	resp, err := http.Get(server.URL + ProfilePath + "?pid=2&seconds=1")
+	assert.NoError(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	close(profiler.block)
+	assert.Equal(t, http.StatusOK, <-finished)
+}
@@ -0,0 +1,318 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package debug
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/continuous"
+	"perfprofiler/pkg/profiling/export/flamegraph"
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/profiling/task"
+	"perfprofiler/pkg/profiling/task/base"
+)
+
+// the max count of the recent profiles started from the UI
+const recentUIProfileCount = 20
+
+//go:embed ui
+var uiAssets embed.FS
+
+// StatusProvider provides the status of the agent for the UI
+type StatusProvider interface {
+	// Processes detected by the agent
+	Processes() []api.ProcessInterface
+	// ActiveTasks of the profiling
+	ActiveTasks() []*task.Status
+	// ContinuousPolicies which running
+	ContinuousPolicies() []*continuous.PolicyStatus
+	// RecentTriggers of the continuous profiling
+	RecentTriggers() []*continuous.TriggerRecord
+}
+
+type processView struct {
+	ID         string   `json:"id"`
+	Pid        int32    `json:"pid"`
+	DetectType string   `json:"detectType"`
+	Layer      string   `json:"layer"`
+	Service    string   `json:"service"`
+	Instance   string   `json:"instance"`
+	Process    string   `json:"process"`
+	Labels     []string `json:"labels"`
+	Profilable bool     `json:"profilable"`
+}
+
+// uiProfile is the profiling started from the UI, the flame graph is kept in memory
+type uiProfile struct {
+	ID        string          `json:"id"`
+	Pid       int32           `json:"pid"`
+	Type      base.TargetType `json:"type"`
+	Seconds   int             `json:"seconds"`
+	StartTime time.Time       `json:"startTime"`
+	Status    string          `json:"status"`
+	Error     string          `json:"error,omitempty"`
+
+	svg    []byte
+	result *profile.Profile
+}
+
+type uiProfiles struct {
+	lock     sync.Mutex
+	profiles []*uiProfile
+	sequence int
+}
+
+func (p *uiProfiles) add(profile *uiProfile) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.sequence++
+	profile.ID = strconv.Itoa(p.sequence)
+	if len(p.profiles) >= recentUIProfileCount {
+		p.profiles = p.profiles[1:]
+	}
+	p.profiles = append(p.profiles, profile)
+}
+
+func (p *uiProfiles) update(profile *uiProfile, f func(profile *uiProfile)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	f(profile)
+}
+
+func (p *uiProfiles) find(id string) *uiProfile {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	for _, profile := range p.profiles {
+		if profile.ID == id {
+			return profile
+		}
+	}
+	return nil
+}
+
+// list of the profiles, the latest profile is the first
+func (p *uiProfiles) list() []uiProfile {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	result := make([]uiProfile, 0, len(p.profiles))
+	for i := len(p.profiles) - 1; i >= 0; i-- {
+		result = append(result, *p.profiles[i])
+	}
+	return result
+}
+
+func (s *Server) registerUI(mux *http.ServeMux) {
+	assets, err := fs.Sub(uiAssets, "ui")
+	if err != nil {
+		log.Warnf("could not load the UI assets: %v", err)
+		return
+	}
+	mux.Handle("/", http.FileServer(http.FS(assets)))
+	mux.Handle("/api/processes", s.authenticate(http.HandlerFunc(s.listProcesses)))
+	mux.Handle("/api/tasks", s.authenticate(http.HandlerFunc(s.listTasks)))
+	mux.Handle("/api/continuous", s.authenticate(http.HandlerFunc(s.continuousStatus)))
+	mux.Handle("/api/profiles", s.authenticate(http.HandlerFunc(s.profiles)))
+	mux.Handle("/api/profiles/flamegraph", s.authenticate(http.HandlerFunc(s.flameGraph)))
+	mux.Handle("/api/profiles/diff", s.authenticate(http.HandlerFunc(s.diffFlameGraph)))
+}
+
+func (s *Server) listProcesses(w http.ResponseWriter, r *http.Request) {
+	processes := s.status.Processes()
+	result := make([]*processView, 0, len(processes))
+	for _, p := range processes {
+		view := &processView{ID: p.ID(), Pid: p.Pid(), DetectType: p.DetectType().Name(), Profilable: p.ProfilingStat() != nil}
+		if e := p.Entity(); e != nil {
+			view.Layer, view.Service, view.Instance, view.Process, view.Labels =
+				e.Layer, e.ServiceName, e.InstanceName, e.ProcessName, e.Labels
+		}
+		result = append(result, view)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Pid < result[j].Pid
+	})
+	writeJSON(w, result)
+}
+
+func (s *Server) listTasks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.status.ActiveTasks())
+}
+
+func (s *Server) continuousStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, map[string]interface{}{
+		"policies": s.status.ContinuousPolicies(),
+		"triggers": s.status.RecentTriggers(),
+	})
+}
+
+func (s *Server) profiles(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, s.uiProfiles.list())
+	case http.MethodPost:
+		s.startUIProfile(w, r)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// startUIProfile starts the profiling in the background, the UI polls the status until the flame graph generated
+func (s *Server) startUIProfile(w http.ResponseWriter, r *http.Request) {
+	pid, targetType, duration, err := s.parseRequest(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		http.Error(w, "too many profiling requests", http.StatusTooManyRequests)
+		return
+	}
+
+	profile := &uiProfile{Pid: pid, Type: targetType, Seconds: int(duration.Seconds()), StartTime: time.Now(), Status: "running"}
+	s.uiProfiles.add(profile)
+	view := *profile
+	go func() {
+		defer func() {
+			<-s.slots
+		}()
+		result, svg, err := s.renderFlameGraph(s.ctx, pid, targetType, duration)
+		s.uiProfiles.update(profile, func(profile *uiProfile) {
+			if err != nil {
+				profile.Status, profile.Error = "failed", err.Error()
+				return
+			}
+			profile.Status, profile.svg, profile.result = "finished", svg, result
+		})
+	}()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	writeJSON(w, view)
+}
+
+func (s *Server) renderFlameGraph(ctx context.Context, pid int32, targetType base.TargetType,
+	duration time.Duration) (*profile.Profile, []byte, error) {
+	p, err := s.profiler.ProfileOnDemand(ctx, pid, targetType, duration)
+	if err != nil {
+		return nil, nil, err
+	}
+	opts := &flamegraph.Options{ColorKernel: true}
+	buf := &bytes.Buffer{}
+	if err := flamegraph.WriteSVG(buf, p, flamegraph.Fold(p, opts), opts); err != nil {
+		return nil, nil, err
+	}
+	return p, buf.Bytes(), nil
+}
+
+func (s *Server) flameGraph(w http.ResponseWriter, r *http.Request) {
+	profile := s.uiProfiles.find(r.URL.Query().Get("id"))
+	if profile == nil {
+		http.Error(w, "profile not found", http.StatusNotFound)
+		return
+	}
+	var svg []byte
+	var status string
+	s.uiProfiles.update(profile, func(profile *uiProfile) {
+		svg, status = profile.svg, profile.Status
+	})
+	if svg == nil {
+		http.Error(w, fmt.Sprintf("the profile is %s", status), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	_, _ = w.Write(svg)
+}
+
+// diffFlameGraph renders the differential of the "current" profile against the "baseline" profile,
+// the "format" could be "svg"(default), "folded" or "json"
+func (s *Server) diffFlameGraph(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	baseline, err := s.finishedUIProfile(query.Get("baseline"))
+	if err != nil {
+		http.Error(w, "baseline "+err.Error(), http.StatusNotFound)
+		return
+	}
+	current, err := s.finishedUIProfile(query.Get("current"))
+	if err != nil {
+		http.Error(w, "current "+err.Error(), http.StatusNotFound)
+		return
+	}
+	opts := &flamegraph.Options{ColorKernel: true}
+	result, err := flamegraph.Diff(baseline, current, opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	buf := &bytes.Buffer{}
+	switch query.Get("format") {
+	case "", "svg":
+		w.Header().Set("Content-Type", "image/svg+xml")
+		err = flamegraph.WriteDiffSVG(buf, result, opts)
+	case "folded":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		err = flamegraph.WriteDiffFolded(buf, result)
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		err = flamegraph.WriteDiffJSON(buf, result)
+	default:
+		http.Error(w, fmt.Sprintf("unknown format: %s", query.Get("format")), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = w.Write(buf.Bytes())
+}
+
+func (s *Server) finishedUIProfile(id string) (*profile.Profile, error) {
+	found := s.uiProfiles.find(id)
+	if found == nil {
+		return nil, fmt.Errorf("profile not found")
+	}
+	var result *profile.Profile
+	var status string
+	s.uiProfiles.update(found, func(p *uiProfile) {
+		result, status = p.result, p.Status
+	})
+	if result == nil {
+		return nil, fmt.Errorf("profile is %s", status)
+	}
+	return result, nil
+}
+
+func writeJSON(w http.ResponseWriter, data interface{}) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		log.Warnf("writing the json response failure: %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+/*
+ * Licensed to Apache Software Foundation (ASF) under one or more contributor
+ * license agreements. See the NOTICE file distributed with
+ * this work for additional information regarding copyright
+ * ownership. Apache Software Foundation (ASF) licenses this file to you under
+ * the Apache License, Version 2.0 (the "License"); you may
+ * not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing,
+ * software distributed under the License is distributed on an
+ * "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+ * KIND, either express or implied.  See the License for the
+ * specific language governing permissions and limitations
+ * under the License.
+ */
+
+(function () {
+  "use strict";
+
+  // the token could be provided by the "token" query of the page
+  var token = new URLSearchParams(window.location.search).get("token") || "";
+  var processes = [];
+  // the finished profile which selected as the baseline of the differential flame graph
+  var baseline = null;
+
+  function api(path, options) {
+    options = options || {};
+    options.headers = options.headers || {};
+    if (token) {
+      options.headers["Authorization"] = "Bearer " + token;
+    }
+    return fetch(path, options).then(function (resp) {
+      if (!resp.ok) {
+        return resp.text().then(function (text) {
+          throw new Error(resp.status + ": " + text.trim());
+        });
+      }
+      return resp.json();
+    });
+  }
+
+  function showError(err) {
+    document.getElementById("error").textContent = err ? String(err.message || err) : "";
+  }
+
+  function cell(row, content) {
+    var td = document.createElement("td");
+    if (content instanceof Node) {
+      td.appendChild(content);
+    } else {
+      td.textContent = content === undefined || content === null ? "" : String(content);
+    }
+    row.appendChild(td);
+    return td;
+  }
+
+  function labels(values) {
+    var span = document.createElement("span");
+    (values || []).forEach(function (v) {
+      var l = document.createElement("span");
+      l.className = "label";
+      l.textContent = v;
+      span.appendChild(l);
+    });
+    return span;
+  }
+
+  function button(text, onClick, disabled) {
+    var b = document.createElement("button");
+    b.textContent = text;
+    b.disabled = !!disabled;
+    b.addEventListener("click", onClick);
+    return b;
+  }
+
+  function time(value) {
+    var d = new Date(value);
+    return isNaN(d.getTime()) || d.getFullYear() < 2000 ? "" : d.toLocaleString();
+  }
+
+  function fill(id, items, render) {
+    var body = document.getElementById(id);
+    body.textContent = "";
+    items.forEach(function (item) {
+      var row = document.createElement("tr");
+      render(row, item);
+      body.appendChild(row);
+    });
+  }
+
+  function renderProcesses() {
+    var filter = document.getElementById("filter").value.toLowerCase();
+    var matched = processes.filter(function (p) {
+      var text = [p.pid, p.service, p.instance, p.process, p.layer].concat(p.labels || []).join(" ").toLowerCase();
+      return text.indexOf(filter) >= 0;
+    });
+    fill("processes", matched, function (row, p) {
+      cell(row, p.pid);
+      cell(row, p.service);
+      cell(row, p.instance);
+      cell(row, p.process);
+      cell(row, p.layer);
+      cell(row, labels(p.labels));
+      cell(row, p.detectType);
+      var support = cell(row, p.profilable ? "supported" : "unsupported");
+      support.className = p.profilable ? "yes" : "no";
+      var actions = document.createElement("span");
+      actions.appendChild(button("On-CPU", function () { startProfile(p.pid, "oncpu"); }, !p.profilable));
+      actions.appendChild(button("Off-CPU", function () { startProfile(p.pid, "offcpu"); }, !p.profilable));
+      cell(row, actions);
+    });
+  }
+
+  function startProfile(pid, type) {
+    var seconds = document.getElementById("seconds").value || "10";
+    var query = "?pid=" + encodeURIComponent(pid) + "&type=" + type + "&seconds=" + encodeURIComponent(seconds);
+    api("api/profiles" + query, {method: "POST"}).then(function () {
+      showError(null);
+      refreshProfiles();
+    }).catch(showError);
+  }
+
+  function showViewer(title, url) {
+    if (token) {
+      url += "&token=" + encodeURIComponent(token);
+    }
+    document.getElementById("viewer-title").textContent = title;
+    document.getElementById("flamegraph").data = url;
+    document.getElementById("viewer").hidden = false;
+  }
+
+  function viewFlameGraph(p) {
+    showViewer("#" + p.id + " " + p.type + " of pid " + p.pid, "api/profiles/flamegraph?id=" + encodeURIComponent(p.id));
+  }
+
+  function viewDiff(p) {
+    showViewer("#" + p.id + " against baseline #" + baseline.id + " " + p.type,
+      "api/profiles/diff?baseline=" + encodeURIComponent(baseline.id) + "&current=" + encodeURIComponent(p.id));
+  }
+
+  function profileActions(p) {
+    var actions = document.createElement("span");
+    if (p.status !== "finished") {
+      return actions;
+    }
+    actions.appendChild(button("View", function () { viewFlameGraph(p); }));
+    var isBaseline = baseline !== null && baseline.id === p.id;
+    actions.appendChild(button(isBaseline ? "Baseline" : "Set Baseline", function () {
+      baseline = p;
+      refreshProfiles().catch(showError);
+    }, isBaseline));
+    if (baseline !== null && !isBaseline) {
+      actions.appendChild(button("Diff", function () { viewDiff(p); }, baseline.type !== p.type));
+    }
+    return actions;
+  }
+
+  function refreshProfiles() {
+    return api("api/profiles").then(function (profiles) {
+      // the baseline is removed when it's evicted from the recent profiles
+      if (baseline !== null && !profiles.some(function (p) { return p.id === baseline.id; })) {
+        baseline = null;
+      }
+      fill("profiles", profiles, function (row, p) {
+        cell(row, p.id);
+        cell(row, p.pid);
+        cell(row, p.type);
+        cell(row, time(p.startTime));
+        cell(row, p.seconds);
+        var status = cell(row, p.error ? p.status + ": " + p.error : p.status);
+        if (p.status === "failed") {
+          status.className = "failed";
+        }
+        cell(row, profileActions(p));
+      });
+    });
+  }
+
+  function refresh() {
+    Promise.all([
+      api("api/processes").then(function (result) {
+        processes = result || [];
+        renderProcesses();
+      }),
+      refreshProfiles(),
+      api("api/tasks").then(function (tasks) {
+        fill("tasks", tasks || [], function (row, t) {
+          cell(row, t.taskId);
+          cell(row, t.targetType);
+          cell(row, t.triggerType);
+          cell(row, (t.pids || []).join(", "));
+          cell(row, t.running ? "yes" : "no");
+          cell(row, time(t.startRunningTime));
+          cell(row, Math.round(t.maxRunningDuration / 1e9) + "s");
+        });
+      }),
+      api("api/continuous").then(function (status) {
+        fill("policies", status.policies || [], function (row, p) {
+          cell(row, p.service);
+          cell(row, p.targetType);
+          cell(row, labels((p.items || []).map(function (i) {
+            return i.checkType + " > " + i.threshold + " (" + i.count + "/" + i.period + "s)";
+          })));
+          cell(row, p.processCount);
+        });
+        fill("triggers", status.triggers || [], function (row, t) {
+          cell(row, time(t.time));
+          cell(row, t.taskId);
+          cell(row, t.targetType);
+          cell(row, t.pid);
+          cell(row, t.service);
+          cell(row, t.instance);
+          cell(row, labels(t.causes));
+        });
+      })
+    ]).then(function () {
+      showError(null);
+    }).catch(showError);
+  }
+
+  document.getElementById("filter").addEventListener("input", renderProcesses);
+  document.getElementById("viewer-close").addEventListener("click", function () {
+    document.getElementById("viewer").hidden = true;
+    document.getElementById("flamegraph").data = "";
+  });
+  refresh();
+  setInterval(refresh, 5000);
+})();
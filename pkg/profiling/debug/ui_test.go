@@ -0,0 +1,161 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package debug
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/continuous"
+	"perfprofiler/pkg/profiling/task"
+	"perfprofiler/pkg/tools/profiling"
+
+	"github.com/shirou/gopsutil/process"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeProcess struct {
+	pid    int32
+	entity *api.ProcessEntity
+	stat   *profiling.Info
+}
+
+func (p *fakeProcess) ID() string                        { return "id" }
+func (p *fakeProcess) Pid() int32                        { return p.pid }
+func (p *fakeProcess) DetectType() api.ProcessDetectType { return api.Scanner }
+func (p *fakeProcess) Entity() *api.ProcessEntity        { return p.entity }
+func (p *fakeProcess) ProfilingStat() *profiling.Info    { return p.stat }
+func (p *fakeProcess) ExeName() (string, error)          { return "", nil }
+func (p *fakeProcess) OriginalProcess() *process.Process { return nil }
+func (p *fakeProcess) PortIsExpose(port int) bool        { return false }
+func (p *fakeProcess) DetectNewExposePort(port int)      {}
+
+type fakeStatus struct{}
+
+func (f *fakeStatus) Processes() []api.ProcessInterface {
+	return []api.ProcessInterface{
+		&fakeProcess{pid: 2, entity: &api.ProcessEntity{ServiceName: "svc", Labels: []string{"a"}}},
+		&fakeProcess{pid: 1, entity: &api.ProcessEntity{ServiceName: "svc"}, stat: profiling.NewInfo(nil)},
+	}
+}
+
+func (f *fakeStatus) ActiveTasks() []*task.Status {
+	return []*task.Status{{TaskID: "task-1", Pids: []int32{1}}}
+}
+
+func (f *fakeStatus) ContinuousPolicies() []*continuous.PolicyStatus {
+	return []*continuous.PolicyStatus{{Service: "svc"}}
+}
+
+func (f *fakeStatus) RecentTriggers() []*continuous.TriggerRecord {
+	return []*continuous.TriggerRecord{{TaskID: "task-1", Causes: []string{"PROCESS_CPU"}}}
+}
+
+func get(t *testing.T, url string) (int, string) {
+	resp, err := http.Get(url)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return resp.StatusCode, string(body)
+}
+
+func TestUI(t *testing.T) {
+	s := NewServer(&Config{EnableUI: true, AuthToken: "secret"}, &fakeProfiler{}, &fakeStatus{})
+	defer s.cancel()
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	// the static assets do not require auth and must not load any remote resource
+	status, body := get(t, server.URL+"/")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `<script src="app.js">`)
+	assert.NotContains(t, body, `src="http`)
+	assert.NotContains(t, body, `href="http`)
+	status, _ = get(t, server.URL+"/app.js")
+	assert.Equal(t, http.StatusOK, status)
+
+	status, _ = get(t, server.URL+"/api/processes")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, body = get(t, server.URL+"/api/processes?token=secret")
+	assert.Equal(t, http.StatusOK, status)
+	var processes []*processView
+	assert.NoError(t, json.Unmarshal([]byte(body), &processes))
+	assert.Equal(t, []int32{1, 2}, []int32{processes[0].Pid, processes[1].Pid})
+	assert.True(t, processes[0].Profilable)
+	assert.False(t, processes[1].Profilable)
+	assert.Equal(t, []string{"a"}, processes[1].Labels)
+	status, _ = get(t, server.URL+ProcessesPath+"?token=secret")
+	assert.Equal(t, http.StatusOK, status)
+
+	status, body = get(t, server.URL+"/api/tasks?token=secret")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"taskId":"task-1"`)
+	status, body = get(t, server.URL+"/api/continuous?token=secret")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"policies":[{"service":"svc"`)
+	assert.Contains(t, body, `"causes":["PROCESS_CPU"]`)
+
+	// start the profiling and wait the flame graph generated
+	for i, profileType := range []string{"offcpu", "oncpu", "oncpu"} {
+		resp, err := http.Post(server.URL+"/api/profiles?token=secret&pid=1&seconds=1&type="+profileType, "", http.NoBody)
+		assert.NoError(t, err)
+		_ = resp.Body.Close()
+		assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+		assert.Eventually(t, func() bool {
+			_, body := get(t, server.URL+"/api/profiles?token=secret")
+			return strings.Count(body, `"status":"finished"`) == i+1
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+	status, body = get(t, server.URL+"/api/profiles/flamegraph?token=secret&id=1")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "Off-CPU Flame Graph")
+	status, _ = get(t, server.URL+"/api/profiles/flamegraph?token=secret&id=9")
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// the differential flame graph between the profiles
+	status, body = get(t, server.URL+"/api/profiles/diff?token=secret&baseline=2&current=3")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, "Differential On-CPU Flame Graph")
+	status, body = get(t, server.URL+"/api/profiles/diff?token=secret&baseline=2&current=3&format=folded")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "main 1 1\n", body)
+	status, _ = get(t, server.URL+"/api/profiles/diff?token=secret&baseline=1&current=3")
+	assert.Equal(t, http.StatusBadRequest, status)
+	status, _ = get(t, server.URL+"/api/profiles/diff?token=secret&baseline=9&current=3")
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestProcessesWithoutUI(t *testing.T) {
+	s := NewServer(&Config{}, &fakeProfiler{}, &fakeStatus{})
+	defer s.cancel()
+	server := httptest.NewServer(s.Handler())
+	defer server.Close()
+
+	status, body := get(t, server.URL+ProcessesPath)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, body, `"pid":1`)
+	status, _ = get(t, server.URL+"/api/processes")
+	assert.Equal(t, http.StatusNotFound, status)
+}
@@ -0,0 +1,63 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package export
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"perfprofiler/pkg/profiling/profile"
+)
+
+var unsafeFileNameRegex = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// ProfileFilePath builds the file path of the profile as "<dir>/<task id>/<type>-<start time millis><ext>",
+// the task directory is created when not exists
+func ProfileFilePath(dir string, p *profile.Profile, ext string) (string, error) {
+	return taskFilePath(dir, p, fmt.Sprintf("%s-%d%s", p.Type, p.StartTime.UnixMilli(), ext))
+}
+
+// ProcessProfileFilePath builds the file path of the profile as "<dir>/<task id>/<pid>-<type>-<start time millis><ext>",
+// the task directory is created when not exists
+func ProcessProfileFilePath(dir string, p *profile.Profile, ext string) (string, error) {
+	return taskFilePath(dir, p, fmt.Sprintf("%d-%s-%d%s", p.Pid, p.Type, p.StartTime.UnixMilli(), ext))
+}
+
+func taskFilePath(dir string, p *profile.Profile, name string) (string, error) {
+	taskDir := filepath.Join(dir, unsafeFileNameRegex.ReplaceAllString(p.TaskID, "_"))
+	if err := os.MkdirAll(taskDir, 0o755); err != nil {
+		return "", err
+	}
+	return filepath.Join(taskDir, name), nil
+}
+
+// WriteFile create the file and write the content by the writer, the file is removed when write failure
+func WriteFile(path string, write func(f *os.File) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(file); err != nil {
+		_ = file.Close()
+		_ = os.Remove(path)
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,248 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package flamegraph
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"perfprofiler/pkg/profiling/profile"
+)
+
+// DiffResult is the differential between the baseline and current profile,
+// the baseline values are normalized to the total value of the current profile
+type DiffResult struct {
+	Type     profile.Type `json:"type"`
+	Unit     string       `json:"unit"`
+	Baseline *DiffSource  `json:"baseline"`
+	Current  *DiffSource  `json:"current"`
+	// Frames which grew or shrank, ranked by the changes
+	Frames []*FrameDiff `json:"frames"`
+	Stacks []*DiffStack `json:"stacks"`
+}
+
+// DiffSource is the profile which compared
+type DiffSource struct {
+	TaskID    string    `json:"taskId"`
+	Pid       int32     `json:"pid"`
+	StartTime time.Time `json:"startTime"`
+	EndTime   time.Time `json:"endTime"`
+	// Total value of the profile before normalized
+	Total int64 `json:"total"`
+}
+
+// DiffStack is the stack with the normalized baseline value and the current value
+type DiffStack struct {
+	Frames   []string `json:"frames"`
+	Baseline int64    `json:"baseline"`
+	Current  int64    `json:"current"`
+}
+
+// FrameDiff is the changes of a frame, the self value only contains the leaf frames,
+// the total value contains the frame and all its children, the deltas are the percentage points of the total
+type FrameDiff struct {
+	Name          string  `json:"name"`
+	BaselineSelf  int64   `json:"baselineSelf"`
+	CurrentSelf   int64   `json:"currentSelf"`
+	BaselineTotal int64   `json:"baselineTotal"`
+	CurrentTotal  int64   `json:"currentTotal"`
+	SelfDelta     float64 `json:"selfDelta"`
+	TotalDelta    float64 `json:"totalDelta"`
+}
+
+// Diff the current profile against the baseline, such as the profile of a continuous profiling trigger
+// against the normal profile of the same service captured earlier.
+// Both profiles must be the same type and have samples.
+func Diff(baseline, current *profile.Profile, opts *Options) (*DiffResult, error) {
+	if baseline == nil || current == nil {
+		return nil, fmt.Errorf("the baseline and current profile must be provided")
+	}
+	if baseline.Type != current.Type {
+		return nil, fmt.Errorf("could not diff the %s profile against the %s baseline", current.Type, baseline.Type)
+	}
+	baselineStacks, currentStacks := Fold(baseline, opts), Fold(current, opts)
+	baselineTotal, currentTotal := totalValue(baselineStacks), totalValue(currentStacks)
+	if baselineTotal == 0 {
+		return nil, fmt.Errorf("the baseline profile has no samples")
+	}
+	if currentTotal == 0 {
+		return nil, fmt.Errorf("the current profile has no samples")
+	}
+
+	stacks := make(map[string]*DiffStack)
+	scale := float64(currentTotal) / float64(baselineTotal)
+	for _, s := range baselineStacks {
+		stacks[strings.Join(s.Frames, ";")] = &DiffStack{Frames: s.Frames, Baseline: int64(math.Round(float64(s.Value) * scale))}
+	}
+	for _, s := range currentStacks {
+		key := strings.Join(s.Frames, ";")
+		if exist := stacks[key]; exist != nil {
+			exist.Current = s.Value
+			continue
+		}
+		stacks[key] = &DiffStack{Frames: s.Frames, Current: s.Value}
+	}
+	result := &DiffResult{
+		Type:     current.Type,
+		Unit:     valueUnit(current.Type),
+		Baseline: newDiffSource(baseline, baselineTotal),
+		Current:  newDiffSource(current, currentTotal),
+		Stacks:   make([]*DiffStack, 0, len(stacks)),
+	}
+	for _, s := range stacks {
+		result.Stacks = append(result.Stacks, s)
+	}
+	sort.Slice(result.Stacks, func(i, j int) bool {
+		return strings.Join(result.Stacks[i].Frames, ";") < strings.Join(result.Stacks[j].Frames, ";")
+	})
+	result.Frames = rankFrames(result.Stacks, currentTotal)
+	return result, nil
+}
+
+func newDiffSource(p *profile.Profile, total int64) *DiffSource {
+	return &DiffSource{TaskID: p.TaskID, Pid: p.Pid, StartTime: p.StartTime, EndTime: p.EndTime, Total: total}
+}
+
+func totalValue(stacks []*FoldedStack) int64 {
+	var total int64
+	for _, s := range stacks {
+		total += s.Value
+	}
+	return total
+}
+
+func rankFrames(stacks []*DiffStack, total int64) []*FrameDiff {
+	frames := make(map[string]*FrameDiff)
+	frame := func(name string) *FrameDiff {
+		f := frames[name]
+		if f == nil {
+			f = &FrameDiff{Name: name}
+			frames[name] = f
+		}
+		return f
+	}
+	for _, s := range stacks {
+		leaf := frame(s.Frames[len(s.Frames)-1])
+		leaf.BaselineSelf += s.Baseline
+		leaf.CurrentSelf += s.Current
+		// the recursive frames only count once in the stack
+		counted := make(map[string]bool, len(s.Frames))
+		for _, name := range s.Frames {
+			if counted[name] {
+				continue
+			}
+			counted[name] = true
+			f := frame(name)
+			f.BaselineTotal += s.Baseline
+			f.CurrentTotal += s.Current
+		}
+	}
+
+	result := make([]*FrameDiff, 0, len(frames))
+	for _, f := range frames {
+		f.SelfDelta = percentage(f.CurrentSelf-f.BaselineSelf, total)
+		f.TotalDelta = percentage(f.CurrentTotal-f.BaselineTotal, total)
+		if f.SelfDelta == 0 && f.TotalDelta == 0 {
+			continue
+		}
+		result = append(result, f)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if math.Abs(a.SelfDelta) != math.Abs(b.SelfDelta) {
+			return math.Abs(a.SelfDelta) > math.Abs(b.SelfDelta)
+		}
+		if math.Abs(a.TotalDelta) != math.Abs(b.TotalDelta) {
+			return math.Abs(a.TotalDelta) > math.Abs(b.TotalDelta)
+		}
+		return a.Name < b.Name
+	})
+	return result
+}
+
+func percentage(value, total int64) float64 {
+	return math.Round(float64(value)*10000/float64(total)) / 100
+}
+
+// WriteDiffFolded writes the stacks as the "frame;frame;frame baseline current" lines,
+// same as the output of the difffolded.pl, which could be rendered by the flamegraph.pl directly
+func WriteDiffFolded(w io.Writer, result *DiffResult) error {
+	buf := bufio.NewWriter(w)
+	for _, s := range result.Stacks {
+		if _, err := fmt.Fprintf(buf, "%s %d %d\n", strings.Join(s.Frames, ";"), s.Baseline, s.Current); err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
+
+// WriteDiffJSON writes the whole differential result as the JSON document
+func WriteDiffJSON(w io.Writer, result *DiffResult) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result)
+}
+
+// WriteDiffSVG renders the differential flame graph, the frame widths are the current values,
+// the frames grew are red and shrank are blue. The frames only exist in the baseline are not rendered,
+// please check the frames table of the result for them.
+func WriteDiffSVG(w io.Writer, result *DiffResult, opts *Options) error {
+	root := &frameNode{name: "all"}
+	for _, s := range result.Stacks {
+		root.value += s.Current
+		root.baseline += s.Baseline
+		n := root
+		for _, f := range s.Frames {
+			n = n.child(f)
+			n.value += s.Current
+			n.baseline += s.Baseline
+		}
+	}
+
+	title := "Differential On-CPU Flame Graph"
+	if result.Type == profile.TypeOffCPU {
+		title = "Differential Off-CPU Flame Graph"
+	}
+	return writeSVG(w, root, &svgRenderer{
+		profileType: result.Type,
+		unit:        result.Unit,
+		opts:        opts,
+		diff:        true,
+		maxDelta:    maxDelta(root),
+	}, title, fmt.Sprintf("baseline: pid %d, task %s; current: pid %d, task %s",
+		result.Baseline.Pid, result.Baseline.TaskID, result.Current.Pid, result.Current.TaskID))
+}
+
+func maxDelta(n *frameNode) int64 {
+	result := n.value - n.baseline
+	if result < 0 {
+		result = -result
+	}
+	for _, c := range n.children {
+		if d := maxDelta(c); d > result {
+			result = d
+		}
+	}
+	return result
+}
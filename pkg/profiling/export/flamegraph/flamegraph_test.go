@@ -0,0 +1,141 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package flamegraph
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/tools/profiling"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testProfile(t profile.Type) *profile.Profile {
+	kernel := &profile.Location{Kernel: true, Frames: []*profiling.Frame{{Name: "schedule"}}}
+	inlined := &profile.Location{Frames: []*profiling.Frame{{Name: "inner"}, {Name: "outer"}}}
+	main := &profile.Location{Frames: []*profiling.Frame{{Name: "main"}}}
+	other := &profile.Location{Frames: []*profiling.Frame{{Name: "a;b<c>"}}}
+	return &profile.Profile{
+		TaskID: "task", Type: t, Pid: 1, StartTime: time.Unix(1, 0),
+		Samples: []*profile.Sample{
+			{Locations: []*profile.Location{kernel, inlined, main}, Count: 2, Duration: 2000},
+			{Locations: []*profile.Location{other, main}, Count: 1, Duration: 500},
+			{Locations: []*profile.Location{kernel, inlined, main}, Count: 3, Duration: 3000},
+		},
+	}
+}
+
+func TestFold(t *testing.T) {
+	tests := []struct {
+		name        string
+		profileType profile.Type
+		colorKernel bool
+		expected    string
+	}{
+		{
+			name:        "on-cpu",
+			profileType: profile.TypeOnCPU,
+			expected:    "main;a:b<c> 1\nmain;outer;inner;schedule 5\n",
+		},
+		{
+			name:        "off-cpu with kernel color",
+			profileType: profile.TypeOffCPU,
+			colorKernel: true,
+			expected:    "main;outer;inner;schedule_[k] 5\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			stacks := Fold(testProfile(tt.profileType), &Options{ColorKernel: tt.colorKernel})
+			assert.NoError(t, WriteFolded(buf, stacks))
+			assert.Equal(t, tt.expected, buf.String())
+		})
+	}
+}
+
+func TestWriteSVG(t *testing.T) {
+	p := testProfile(profile.TypeOnCPU)
+	opts := &Options{ColorKernel: true}
+	buf := &bytes.Buffer{}
+	assert.NoError(t, WriteSVG(buf, p, Fold(p, opts), opts))
+
+	// the SVG must be a valid xml document
+	decoder := xml.NewDecoder(bytes.NewReader(buf.Bytes()))
+	for {
+		_, err := decoder.Token()
+		if err != nil {
+			assert.Equal(t, "EOF", err.Error())
+			break
+		}
+	}
+	svg := buf.String()
+	assert.Equal(t, 6, strings.Count(svg, `class="f"`))
+	assert.Contains(t, svg, `data-n="a:b&lt;c&gt;"`)
+	assert.Contains(t, svg, "schedule_[k] (5 samples, 83.33%)")
+	assert.NotContains(t, svg, "<script src")
+}
+
+func TestDiff(t *testing.T) {
+	baseline := testProfile(profile.TypeOnCPU)
+	// the current profile have double samples, and the "a;b<c>" stack grew
+	current := testProfile(profile.TypeOnCPU)
+	current.TaskID = "current"
+	current.Samples[0].Count, current.Samples[1].Count, current.Samples[2].Count = 4, 6, 2
+
+	result, err := Diff(baseline, current, &Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(6), result.Baseline.Total)
+	assert.Equal(t, int64(12), result.Current.Total)
+
+	buf := &bytes.Buffer{}
+	assert.NoError(t, WriteDiffFolded(buf, result))
+	assert.Equal(t, "main;a:b<c> 2 6\nmain;outer;inner;schedule 10 6\n", buf.String())
+
+	names := make([]string, 0)
+	for _, f := range result.Frames {
+		names = append(names, f.Name)
+	}
+	assert.Equal(t, []string{"a:b<c>", "schedule", "inner", "outer"}, names)
+	assert.Equal(t, 33.33, result.Frames[0].SelfDelta)
+	assert.Equal(t, -33.33, result.Frames[1].SelfDelta)
+	assert.Equal(t, -33.33, result.Frames[2].TotalDelta)
+
+	buf.Reset()
+	assert.NoError(t, WriteDiffJSON(buf, result))
+	assert.Contains(t, buf.String(), `"taskId": "current"`)
+
+	buf.Reset()
+	assert.NoError(t, WriteDiffSVG(buf, result, &Options{}))
+	svg := buf.String()
+	assert.Contains(t, svg, "Differential On-CPU Flame Graph")
+	assert.Contains(t, svg, "a:b&lt;c&gt; (6 samples, 50.00%, +33.33%)")
+	// the most grew frame is the deepest red, and the most shrank is the deepest blue
+	assert.Contains(t, svg, `fill="rgb(255,0,0)"`)
+	assert.Contains(t, svg, `fill="rgb(0,0,255)"`)
+
+	_, err = Diff(baseline, testProfile(profile.TypeOffCPU), nil)
+	assert.Error(t, err)
+	_, err = Diff(&profile.Profile{Type: profile.TypeOnCPU}, current, nil)
+	assert.Error(t, err)
+}
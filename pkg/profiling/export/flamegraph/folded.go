@@ -0,0 +1,122 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package flamegraph
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"perfprofiler/pkg/profiling/profile"
+)
+
+// KernelAnnotation is appended to the kernel frames when the kernel frames are colored,
+// same as the annotation of the FlameGraph tools
+const KernelAnnotation = "_[k]"
+
+// Options of the flame graph
+type Options struct {
+	// ColorKernel to annotate and color the kernel frames differently from the user space frames
+	ColorKernel bool
+}
+
+// FoldedStack is a stack with the frames from the root to the leaf
+type FoldedStack struct {
+	Frames []string
+	Value  int64
+}
+
+func (s *FoldedStack) String() string {
+	return fmt.Sprintf("%s %d", strings.Join(s.Frames, ";"), s.Value)
+}
+
+// Fold the samples of profile into the folded stacks, the same stacks are merged and sorted by the frames.
+// The value of on-cpu is the sampled count, and the value of off-cpu is the duration in microseconds.
+func Fold(p *profile.Profile, opts *Options) []*FoldedStack {
+	stacks := make(map[string]*FoldedStack)
+	for _, s := range p.Samples {
+		value := sampleValue(p, s)
+		if value <= 0 {
+			continue
+		}
+		frames := make([]string, 0, len(s.Locations))
+		for i := len(s.Locations) - 1; i >= 0; i-- {
+			l := s.Locations[i]
+			for j := len(l.Frames) - 1; j >= 0; j-- {
+				frames = append(frames, frameName(l.Frames[j].Name, l.Kernel, opts))
+			}
+		}
+		if len(frames) == 0 {
+			continue
+		}
+		key := strings.Join(frames, ";")
+		if exist := stacks[key]; exist != nil {
+			exist.Value += value
+			continue
+		}
+		stacks[key] = &FoldedStack{Frames: frames, Value: value}
+	}
+
+	result := make([]*FoldedStack, 0, len(stacks))
+	for _, s := range stacks {
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return strings.Join(result[i].Frames, ";") < strings.Join(result[j].Frames, ";")
+	})
+	return result
+}
+
+// WriteFolded writes the stacks as the "frame;frame;frame count" lines
+func WriteFolded(w io.Writer, stacks []*FoldedStack) error {
+	buf := bufio.NewWriter(w)
+	for _, s := range stacks {
+		if _, err := fmt.Fprintln(buf, s.String()); err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
+
+func sampleValue(p *profile.Profile, s *profile.Sample) int64 {
+	if p.Type == profile.TypeOffCPU {
+		return s.Duration / int64(time.Microsecond)
+	}
+	return s.Count
+}
+
+// valueUnit is the unit of the value returned by the sampleValue
+func valueUnit(t profile.Type) string {
+	if t == profile.TypeOffCPU {
+		return "us"
+	}
+	return "samples"
+}
+
+func frameName(name string, kernel bool, opts *Options) string {
+	// the separators of folded format could not exist in the frame name
+	name = strings.ReplaceAll(name, ";", ":")
+	name = strings.ReplaceAll(name, "\n", " ")
+	if kernel && opts != nil && opts.ColorKernel {
+		name += KernelAnnotation
+	}
+	return name
+}
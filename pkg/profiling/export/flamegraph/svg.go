@@ -0,0 +1,323 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package flamegraph
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"sort"
+	"strings"
+
+	"perfprofiler/pkg/profiling/profile"
+)
+
+const (
+	imageWidth   = 1200
+	framePadding = 10
+	frameHeight  = 16
+	fontSize     = 12
+	fontWidth    = 0.59
+	topPadding   = fontSize * 3
+	bottomMargin = fontSize * 2
+	// the frames narrower than the min width(pixels) are not rendered to keep the file small
+	minFrameWidth = 0.1
+)
+
+type frameNode struct {
+	name     string
+	value    int64
+	baseline int64
+	children map[string]*frameNode
+}
+
+func (n *frameNode) child(name string) *frameNode {
+	if n.children == nil {
+		n.children = make(map[string]*frameNode)
+	}
+	c := n.children[name]
+	if c == nil {
+		c = &frameNode{name: name}
+		n.children[name] = c
+	}
+	return c
+}
+
+func (n *frameNode) sortedChildren() []*frameNode {
+	result := make([]*frameNode, 0, len(n.children))
+	for _, c := range n.children {
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].name < result[j].name
+	})
+	return result
+}
+
+func (n *frameNode) depth() int {
+	d := 0
+	for _, c := range n.children {
+		if cd := c.depth(); cd > d {
+			d = cd
+		}
+	}
+	return d + 1
+}
+
+// WriteSVG renders the folded stacks as a standalone interactive flame graph, the root is at the bottom.
+// Click a frame to zoom, use the search button(or ctrl+F) to highlight the frames matched by the regex.
+func WriteSVG(w io.Writer, p *profile.Profile, stacks []*FoldedStack, opts *Options) error {
+	root := &frameNode{name: "all"}
+	for _, s := range stacks {
+		root.value += s.Value
+		n := root
+		for _, f := range s.Frames {
+			n = n.child(f)
+			n.value += s.Value
+		}
+	}
+
+	title := "On-CPU Flame Graph"
+	if p.Type == profile.TypeOffCPU {
+		title = "Off-CPU Flame Graph"
+	}
+	return writeSVG(w, root, &svgRenderer{
+		profileType: p.Type,
+		unit:        valueUnit(p.Type),
+		opts:        opts,
+	}, title, fmt.Sprintf("pid: %d, task: %s", p.Pid, p.TaskID))
+}
+
+func writeSVG(w io.Writer, root *frameNode, r *svgRenderer, title, subtitle string) error {
+	height := root.depth()*frameHeight + topPadding + bottomMargin + framePadding
+
+	buf := bufio.NewWriter(w)
+	fmt.Fprintf(buf, `<?xml version="1.0" standalone="no"?>
+<svg version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" onload="init(evt)" xmlns="http://www.w3.org/2000/svg">
+<style type="text/css">
+text { font-family: Verdana, sans-serif; font-size: %dpx; fill: rgb(0,0,0); }
+.f:hover { stroke: black; stroke-width: 0.5; cursor: pointer; }
+.btn { cursor: pointer; }
+</style>
+<script type="text/ecmascript"><![CDATA[
+var width = %d, padding = %d, fontSize = %d, fontWidth = %v, unit = %q;
+%s
+]]></script>
+<rect x="0" y="0" width="100%%" height="100%%" fill="rgb(248,248,248)"/>
+<text x="%d" y="%d" text-anchor="middle" style="font-size:%dpx">%s</text>
+<text x="%d" y="%d">%s</text>
+<text id="reset" class="btn" x="%d" y="%d" style="display:none" onclick="resetZoom()">Reset Zoom</text>
+<text id="search" class="btn" x="%d" y="%d" text-anchor="end" onclick="search()">Search</text>
+<text id="matched" x="%d" y="%d" text-anchor="end"></text>
+<text id="details" x="%d" y="%d"> </text>
+`, imageWidth, height, imageWidth, height, fontSize,
+		imageWidth, framePadding, fontSize, fontWidth, r.unit, svgScript,
+		imageWidth/2, fontSize*2, fontSize+5, html.EscapeString(title),
+		framePadding, fontSize*2, html.EscapeString(subtitle),
+		framePadding, fontSize*2+fontSize+2,
+		imageWidth-framePadding, fontSize*2,
+		imageWidth-framePadding, height-fontSize/2,
+		framePadding, height-fontSize/2)
+
+	if root.value > 0 {
+		r.buf, r.total, r.bottom = buf, root.value, height-bottomMargin
+		r.scale = float64(imageWidth-2*framePadding) / float64(root.value)
+		r.render(root, 0, 0)
+	}
+	fmt.Fprintln(buf, "</svg>")
+	return buf.Flush()
+}
+
+type svgRenderer struct {
+	profileType profile.Type
+	unit        string
+	opts        *Options
+	// diff to color the frames by the delta between the baseline and current value
+	diff     bool
+	maxDelta int64
+
+	buf    *bufio.Writer
+	total  int64
+	scale  float64
+	bottom int
+}
+
+func (r *svgRenderer) render(n *frameNode, x int64, depth int) {
+	width := float64(n.value) * r.scale
+	if width < minFrameWidth {
+		return
+	}
+	px := float64(framePadding) + float64(x)*r.scale
+	py := r.bottom - (depth+1)*frameHeight
+	info := fmt.Sprintf("%s (%d %s, %.2f%%)", n.name, n.value, r.unit, float64(n.value)*100/float64(r.total))
+	color := r.color(n.name, depth)
+	if r.diff {
+		info = fmt.Sprintf("%s (%d %s, %.2f%%, %+.2f%%)", n.name, n.value, r.unit,
+			float64(n.value)*100/float64(r.total), float64(n.value-n.baseline)*100/float64(r.total))
+		color = r.diffColor(n)
+	}
+	name := html.EscapeString(n.name)
+	fmt.Fprintf(r.buf, `<g class="f" data-n="%s" data-x="%d" data-w="%d" data-d="%d" onclick="zoom(this)" `+
+		`onmouseover="showDetails(this)" onmouseout="showDetails(null)">`+
+		`<title>%s</title><rect x="%.1f" y="%d" width="%.1f" height="%d" rx="2" fill="%s"/>`+
+		`<text x="%.1f" y="%d">%s</text></g>`+"\n",
+		name, x, n.value, depth, html.EscapeString(info), px, py, width, frameHeight-1,
+		color, px+3, py+frameHeight-4, html.EscapeString(frameLabel(n.name, width)))
+
+	for _, c := range n.sortedChildren() {
+		r.render(c, x, depth+1)
+		x += c.value
+	}
+}
+
+// color of the frame, the same name always have the same color
+func (r *svgRenderer) color(name string, depth int) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	sum := h.Sum32()
+	v1, v2, v3 := float64(sum&0xff)/255, float64(sum>>8&0xff)/255, float64(sum>>16&0xff)/255
+
+	switch {
+	case depth == 0:
+		return "rgb(210,210,210)"
+	case strings.HasPrefix(name, profile.MissingSymbol):
+		return "rgb(180,180,180)"
+	case r.opts != nil && r.opts.ColorKernel && strings.HasSuffix(name, KernelAnnotation):
+		return fmt.Sprintf("rgb(%d,%d,%d)", 190+int(65*v1), 90+int(65*v1), 0)
+	case r.profileType == profile.TypeOffCPU:
+		return fmt.Sprintf("rgb(%d,%d,%d)", int(55*v2), 80+int(60*v2), 205+int(50*v2))
+	default:
+		return fmt.Sprintf("rgb(%d,%d,%d)", 205+int(50*v3), int(230*v1), int(55*v2))
+	}
+}
+
+// diffColor is red when the frame grew and blue when shrank, the more changes the deeper color
+func (r *svgRenderer) diffColor(n *frameNode) string {
+	delta := n.value - n.baseline
+	if delta == 0 || r.maxDelta == 0 {
+		return "rgb(250,250,250)"
+	}
+	ratio := float64(delta) / float64(r.maxDelta)
+	if ratio < 0 {
+		ratio = -ratio
+	}
+	fade := 210 - int(210*ratio)
+	if delta > 0 {
+		return fmt.Sprintf("rgb(255,%d,%d)", fade, fade)
+	}
+	return fmt.Sprintf("rgb(%d,%d,255)", fade, fade)
+}
+
+// frameLabel truncates the name to fit the frame width
+func frameLabel(name string, width float64) string {
+	chars := int((width - 6) / (fontSize * fontWidth))
+	if chars < 3 {
+		return ""
+	}
+	if len(name) <= chars {
+		return name
+	}
+	return name[:chars-2] + ".."
+}
+
+const svgScript = `var frames = [], total = 0, searching = false;
+function init(evt) {
+	var gs = document.getElementsByClassName("f");
+	for (var i = 0; i < gs.length; i++) {
+		var g = gs[i];
+		frames.push({g: g, name: g.getAttribute("data-n"), x: +g.getAttribute("data-x"),
+			w: +g.getAttribute("data-w"), d: +g.getAttribute("data-d"),
+			rect: g.getElementsByTagName("rect")[0], text: g.getElementsByTagName("text")[0]});
+		if (+g.getAttribute("data-d") == 0) total = +g.getAttribute("data-w");
+	}
+	document.addEventListener("keydown", function(e) {
+		if ((e.ctrlKey || e.metaKey) && e.key == "f") { e.preventDefault(); search(); }
+		if (e.key == "Escape") { resetZoom(); }
+	});
+}
+function label(name, w) {
+	var chars = Math.floor((w - 6) / (fontSize * fontWidth));
+	if (chars < 3) return "";
+	return name.length <= chars ? name : name.substring(0, chars - 2) + "..";
+}
+function layout(x0, w0, d0) {
+	var scale = (width - 2 * padding) / w0;
+	frames.forEach(function(f) {
+		var visible, x, w;
+		if (f.d < d0) {
+			visible = f.x <= x0 && f.x + f.w >= x0 + w0;
+			x = padding; w = width - 2 * padding;
+		} else {
+			visible = f.x >= x0 && f.x + f.w <= x0 + w0;
+			x = padding + (f.x - x0) * scale; w = f.w * scale;
+		}
+		f.g.style.display = visible && w >= 0.1 ? "" : "none";
+		f.g.style.opacity = f.d < d0 ? 0.5 : 1;
+		f.rect.setAttribute("x", x);
+		f.rect.setAttribute("width", w);
+		f.text.setAttribute("x", x + 3);
+		f.text.textContent = label(f.name, w);
+	});
+}
+function zoom(g) {
+	var f = frames.filter(function(f) { return f.g == g; })[0];
+	layout(f.x, f.w, f.d);
+	document.getElementById("reset").style.display = f.d > 0 ? "" : "none";
+}
+function resetZoom() {
+	layout(0, total, 0);
+	document.getElementById("reset").style.display = "none";
+}
+function showDetails(g) {
+	document.getElementById("details").textContent = g ? g.getElementsByTagName("title")[0].textContent : " ";
+}
+function search() {
+	var matched = document.getElementById("matched");
+	frames.forEach(function(f) {
+		if (f.fill) { f.rect.setAttribute("fill", f.fill); f.fill = null; }
+	});
+	if (searching) {
+		searching = false;
+		matched.textContent = "";
+		document.getElementById("search").textContent = "Search";
+		return;
+	}
+	var term = prompt("Search the frames(regex):", "");
+	if (!term) return;
+	var re;
+	try { re = new RegExp(term); } catch (e) { alert(e); return; }
+	var ranges = [];
+	frames.forEach(function(f) {
+		if (f.d == 0 || !re.test(f.name)) return;
+		f.fill = f.rect.getAttribute("fill");
+		f.rect.setAttribute("fill", "rgb(230,0,230)");
+		ranges.push([f.x, f.x + f.w]);
+	});
+	ranges.sort(function(a, b) { return a[0] - b[0]; });
+	var sum = 0, end = 0;
+	ranges.forEach(function(r) {
+		if (r[1] <= end) return;
+		sum += r[1] - Math.max(r[0], end);
+		end = r[1];
+	});
+	searching = true;
+	document.getElementById("search").textContent = "Reset Search";
+	matched.textContent = "Matched: " + (total > 0 ? (100 * sum / total).toFixed(2) : 0) + "%";
+}`
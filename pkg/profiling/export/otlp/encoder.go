@@ -0,0 +1,306 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"crypto/rand"
+	"fmt"
+	"sort"
+
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/tools/profiling"
+
+	common_v1 "go.opentelemetry.io/proto/otlp/common/v1"
+	profiles_v1 "go.opentelemetry.io/proto/otlp/profiles/v1experimental"
+	resource_v1 "go.opentelemetry.io/proto/otlp/resource/v1"
+)
+
+const (
+	scopeName = "perfprofiler"
+
+	kernelMappingFile  = "[kernel.kallsyms]"
+	unknownMappingFile = "[unknown]"
+	frameTypeKernel    = "kernel"
+	frameTypeNative    = "native"
+)
+
+// Encode the profiles into the OpenTelemetry profiles data model, the profiles of the same process are in
+// the same resource
+func Encode(profiles []*profile.Profile) []*profiles_v1.ResourceProfiles {
+	result := make([]*profiles_v1.ResourceProfiles, 0)
+	resources := make(map[int32]*profiles_v1.ScopeProfiles)
+	for _, p := range profiles {
+		scope := resources[p.Pid]
+		if scope == nil {
+			scope = &profiles_v1.ScopeProfiles{Scope: &common_v1.InstrumentationScope{Name: scopeName}}
+			resources[p.Pid] = scope
+			result = append(result, &profiles_v1.ResourceProfiles{
+				Resource:      &resource_v1.Resource{Attributes: resourceAttributes(p.Pid, p.Entity)},
+				ScopeProfiles: []*profiles_v1.ScopeProfiles{scope},
+			})
+		}
+		scope.Profiles = append(scope.Profiles, EncodeProfile(p))
+	}
+	return result
+}
+
+// EncodeProfile encodes a profile with the deduplicated string, function, location, and mapping tables
+func EncodeProfile(p *profile.Profile) *profiles_v1.ProfileContainer {
+	e := &encoder{
+		result:    &profiles_v1.Profile{},
+		strings:   make(map[string]int64),
+		locations: make(map[locationKey]int64),
+		functions: make(map[functionKey]uint64),
+
+		kernelMapping:  -1,
+		unknownMapping: -1,
+	}
+	e.str("")
+	e.addMappings(p.Modules)
+
+	result := e.result
+	switch p.Type {
+	case profile.TypeOffCPU:
+		result.SampleType = []*profiles_v1.ValueType{e.valueType("switches", "count"), e.valueType("off-cpu", "nanoseconds")}
+	default:
+		result.SampleType = []*profiles_v1.ValueType{e.valueType("samples", "count"), e.valueType("cpu", "nanoseconds")}
+		result.PeriodType = e.valueType("cpu", "nanoseconds")
+		result.Period = p.Period
+	}
+	result.DefaultSampleType = 1
+	result.TimeNanos = p.StartTime.UnixNano()
+	result.DurationNanos = p.EndTime.Sub(p.StartTime).Nanoseconds()
+	result.Comment = []int64{e.str(fmt.Sprintf("task: %s", p.TaskID))}
+
+	for _, s := range p.Samples {
+		sample := &profiles_v1.Sample{
+			LocationsStartIndex: uint64(len(result.LocationIndices)),
+			LocationsLength:     uint64(len(s.Locations)),
+			Value:               []int64{s.Count, s.Duration},
+		}
+		for _, l := range s.Locations {
+			result.LocationIndices = append(result.LocationIndices, e.location(l))
+		}
+		for _, t := range s.Timestamps {
+			sample.TimestampsUnixNano = append(sample.TimestampsUnixNano, uint64(t.UnixNano()))
+		}
+		result.Sample = append(result.Sample, sample)
+	}
+
+	return &profiles_v1.ProfileContainer{
+		ProfileId:         newProfileID(),
+		StartTimeUnixNano: uint64(p.StartTime.UnixNano()),
+		EndTimeUnixNano:   uint64(p.EndTime.UnixNano()),
+		Attributes: []*common_v1.KeyValue{
+			stringAttribute("profile.task.id", p.TaskID),
+			stringAttribute("profile.type", string(p.Type)),
+		},
+		Profile: result,
+	}
+}
+
+func resourceAttributes(pid int32, entity *api.ProcessEntity) []*common_v1.KeyValue {
+	result := []*common_v1.KeyValue{intAttribute("process.pid", int64(pid))}
+	if entity == nil {
+		return result
+	}
+	result = append(result,
+		stringAttribute("service.name", entity.ServiceName),
+		stringAttribute("service.instance.id", entity.InstanceName),
+		stringAttribute("process.executable.name", entity.ProcessName),
+		stringAttribute("skywalking.layer", entity.Layer))
+	if len(entity.Labels) > 0 {
+		labels := make([]*common_v1.AnyValue, 0, len(entity.Labels))
+		for _, l := range entity.Labels {
+			labels = append(labels, &common_v1.AnyValue{Value: &common_v1.AnyValue_StringValue{StringValue: l}})
+		}
+		result = append(result, &common_v1.KeyValue{Key: "skywalking.labels", Value: &common_v1.AnyValue{
+			Value: &common_v1.AnyValue_ArrayValue{ArrayValue: &common_v1.ArrayValue{Values: labels}}}})
+	}
+	return result
+}
+
+func stringAttribute(key, value string) *common_v1.KeyValue {
+	return &common_v1.KeyValue{Key: key, Value: &common_v1.AnyValue{Value: &common_v1.AnyValue_StringValue{StringValue: value}}}
+}
+
+func intAttribute(key string, value int64) *common_v1.KeyValue {
+	return &common_v1.KeyValue{Key: key, Value: &common_v1.AnyValue{Value: &common_v1.AnyValue_IntValue{IntValue: value}}}
+}
+
+func newProfileID() []byte {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return id
+}
+
+type encoder struct {
+	result *profiles_v1.Profile
+
+	strings   map[string]int64
+	ranges    []*moduleRange
+	locations map[locationKey]int64
+	functions map[functionKey]uint64
+
+	// the index of kernel and unknown mappings, -1 means not created
+	kernelMapping  int
+	unknownMapping int
+}
+
+type moduleRange struct {
+	r     *profiling.ModuleRange
+	index uint64
+}
+
+type locationKey struct {
+	address uint64
+	kernel  bool
+}
+
+type functionKey struct {
+	name string
+	file string
+}
+
+func (e *encoder) str(s string) int64 {
+	if index, exist := e.strings[s]; exist {
+		return index
+	}
+	index := int64(len(e.result.StringTable))
+	e.strings[s] = index
+	e.result.StringTable = append(e.result.StringTable, s)
+	return index
+}
+
+func (e *encoder) valueType(t, unit string) *profiles_v1.ValueType {
+	return &profiles_v1.ValueType{
+		Type:                   e.str(t),
+		Unit:                   e.str(unit),
+		AggregationTemporality: profiles_v1.AggregationTemporality_AGGREGATION_TEMPORALITY_DELTA,
+	}
+}
+
+// addMappings of all module ranges, the main binary is the first mapping
+func (e *encoder) addMappings(modules []*profiling.Module) {
+	modules = append([]*profiling.Module(nil), modules...)
+	sort.SliceStable(modules, func(i, j int) bool {
+		return modules[i].Type == profiling.ModuleTypeExec && modules[j].Type != profiling.ModuleTypeExec
+	})
+	for _, m := range modules {
+		for _, r := range m.Ranges {
+			index := e.addMapping(&profiles_v1.Mapping{
+				MemoryStart: r.StartAddr,
+				MemoryLimit: r.EndAddr,
+				FileOffset:  r.FileOffset,
+				Filename:    e.str(m.Name),
+				BuildId:     e.str(m.BuildID),
+				BuildIdKind: profiles_v1.BuildIdKind_BUILD_ID_LINKER,
+			})
+			e.ranges = append(e.ranges, &moduleRange{r: r, index: index})
+		}
+	}
+}
+
+func (e *encoder) addMapping(m *profiles_v1.Mapping) uint64 {
+	index := uint64(len(e.result.Mapping))
+	m.Id = index + 1
+	e.result.Mapping = append(e.result.Mapping, m)
+	return index
+}
+
+// mapping index of the location, the kernel and unknown mappings are created when used
+func (e *encoder) mapping(l *profile.Location) uint64 {
+	if l.Kernel {
+		return e.lazyMapping(&e.kernelMapping, kernelMappingFile)
+	}
+	for _, r := range e.ranges {
+		if l.Address >= r.r.StartAddr && l.Address < r.r.EndAddr {
+			return r.index
+		}
+	}
+	return e.lazyMapping(&e.unknownMapping, unknownMappingFile)
+}
+
+func (e *encoder) lazyMapping(index *int, file string) uint64 {
+	if *index < 0 {
+		*index = int(e.addMapping(&profiles_v1.Mapping{Filename: e.str(file)}))
+	}
+	return uint64(*index)
+}
+
+func (e *encoder) location(l *profile.Location) int64 {
+	key := locationKey{address: l.Address, kernel: l.Kernel}
+	if index, exist := e.locations[key]; exist {
+		return index
+	}
+	mappingIndex := e.mapping(l)
+	mapping := e.result.Mapping[mappingIndex]
+	loc := &profiles_v1.Location{
+		Id:           uint64(len(e.result.Location) + 1),
+		MappingIndex: mappingIndex,
+		Address:      l.Address,
+		TypeIndex:    uint32(e.str(frameTypeNative)),
+	}
+	if l.Kernel {
+		loc.TypeIndex = uint32(e.str(frameTypeKernel))
+		// the kernel mapping covers all kernel addresses
+		if mapping.MemoryStart == 0 || l.Address < mapping.MemoryStart {
+			mapping.MemoryStart = l.Address
+		}
+		if l.Address >= mapping.MemoryLimit {
+			mapping.MemoryLimit = l.Address + 1
+		}
+	}
+	for _, f := range l.Frames {
+		loc.Line = append(loc.Line, &profiles_v1.Line{FunctionIndex: e.function(f), Line: int64(f.Line)})
+		if f.Name != profile.MissingSymbol {
+			mapping.HasFunctions = true
+		}
+		if f.File != "" {
+			mapping.HasFilenames = true
+		}
+		if f.Line > 0 {
+			mapping.HasLineNumbers = true
+		}
+	}
+	if len(l.Frames) > 1 {
+		mapping.HasInlineFrames = true
+	}
+	index := int64(len(e.result.Location))
+	e.locations[key] = index
+	e.result.Location = append(e.result.Location, loc)
+	return index
+}
+
+func (e *encoder) function(f *profiling.Frame) uint64 {
+	key := functionKey{name: f.Name, file: f.File}
+	if index, exist := e.functions[key]; exist {
+		return index
+	}
+	index := uint64(len(e.result.Function))
+	name := e.str(f.Name)
+	e.result.Function = append(e.result.Function, &profiles_v1.Function{
+		Id:         index + 1,
+		Name:       name,
+		SystemName: name,
+		Filename:   e.str(f.File),
+	})
+	e.functions[key] = index
+	return index
+}
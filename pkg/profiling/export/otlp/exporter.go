@@ -0,0 +1,125 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	"perfprofiler/pkg/profiling/profile"
+
+	collector_v1 "go.opentelemetry.io/proto/otlp/collector/profiles/v1experimental"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+const defaultTimeout = 10 * time.Second
+
+// Config of the OTLP profiles exporter, the profiles are sent with the "v1experimental" profiles proto.
+// the proto is unstable and could change in the next releases, so the collector must accept the same version.
+// go.opentelemetry.io/proto/otlp v1.3.1 is the first release shipping it, and it requires grpc v1.64
+type Config struct {
+	Endpoint           string            `mapstructure:"endpoint"`             // The OTLP gRPC endpoint, disabled when empty
+	EnableTLS          bool              `mapstructure:"enable_tls"`           // Enable TLS connect to the endpoint
+	CaPemPath          string            `mapstructure:"ca_pem_path"`          // The file path of ca.pem, using the system CA when empty
+	InsecureSkipVerify bool              `mapstructure:"insecure_skip_verify"` // Skip verify the server's certificate chain and host name
+	Headers            map[string]string `mapstructure:"headers"`              // The headers(metadata) when send request
+	Timeout            string            `mapstructure:"timeout"`              // The timeout of each export request, default is 10s
+}
+
+// Exporter sends the profiles to the OTLP profiles service
+type Exporter struct {
+	conn    *grpc.ClientConn
+	client  collector_v1.ProfilesServiceClient
+	headers metadata.MD
+	timeout time.Duration
+}
+
+func NewExporter(config *Config) (*Exporter, error) {
+	timeout := defaultTimeout
+	if config.Timeout != "" {
+		t, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("parsing the OTLP timeout failure: %v", err)
+		}
+		timeout = t
+	}
+	transport := insecure.NewCredentials()
+	if config.EnableTLS {
+		tlsConfig, err := buildTLSConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		transport = credentials.NewTLS(tlsConfig)
+	}
+	conn, err := grpc.Dial(config.Endpoint, grpc.WithTransportCredentials(transport))
+	if err != nil {
+		return nil, fmt.Errorf("connect to the OTLP endpoint failure: %s, error: %v", config.Endpoint, err)
+	}
+	return &Exporter{
+		conn:    conn,
+		client:  collector_v1.NewProfilesServiceClient(conn),
+		headers: metadata.New(config.Headers),
+		timeout: timeout,
+	}, nil
+}
+
+// Export the profiles in one request
+func (e *Exporter) Export(ctx context.Context, profiles []*profile.Profile) error {
+	if len(profiles) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(metadata.NewOutgoingContext(ctx, e.headers), e.timeout)
+	defer cancel()
+	resp, err := e.client.Export(ctx, &collector_v1.ExportProfilesServiceRequest{ResourceProfiles: Encode(profiles)})
+	if err != nil {
+		return err
+	}
+	if partial := resp.GetPartialSuccess(); partial != nil && partial.RejectedProfiles > 0 {
+		return fmt.Errorf("%d profiles rejected by the OTLP endpoint: %s", partial.RejectedProfiles, partial.ErrorMessage)
+	}
+	return nil
+}
+
+func (e *Exporter) Close() error {
+	return e.conn.Close()
+}
+
+func buildTLSConfig(config *Config) (*tls.Config, error) {
+	// nolint
+	tlsConfig := &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	if config.CaPemPath == "" {
+		return tlsConfig, nil
+	}
+	caPem, err := os.ReadFile(config.CaPemPath)
+	if err != nil {
+		return nil, err
+	}
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(caPem) {
+		return nil, fmt.Errorf("failed to append certificates: %s", config.CaPemPath)
+	}
+	tlsConfig.RootCAs = certPool
+	return tlsConfig, nil
+}
@@ -0,0 +1,155 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package otlp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/tools/profiling"
+
+	"github.com/stretchr/testify/assert"
+	collector_v1 "go.opentelemetry.io/proto/otlp/collector/profiles/v1experimental"
+	common_v1 "go.opentelemetry.io/proto/otlp/common/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+type fakeCollector struct {
+	collector_v1.UnimplementedProfilesServiceServer
+	lock     sync.Mutex
+	requests []*collector_v1.ExportProfilesServiceRequest
+	headers  []metadata.MD
+}
+
+func (c *fakeCollector) Export(ctx context.Context,
+	req *collector_v1.ExportProfilesServiceRequest) (*collector_v1.ExportProfilesServiceResponse, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	md, _ := metadata.FromIncomingContext(ctx)
+	c.requests = append(c.requests, req)
+	c.headers = append(c.headers, md)
+	return &collector_v1.ExportProfilesServiceResponse{}, nil
+}
+
+func startFakeCollector(t *testing.T) (*fakeCollector, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := grpc.NewServer()
+	collector := &fakeCollector{}
+	collector_v1.RegisterProfilesServiceServer(server, collector)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+	return collector, listener.Addr().String()
+}
+
+func testProfile(pid int32) *profile.Profile {
+	start := time.Unix(100, 0)
+	shared := &profile.Location{Address: 0x1010, Frames: []*profiling.Frame{
+		{Name: "inner", File: "main.c", Line: 1}, {Name: "outer", File: "main.c", Line: 2}}}
+	return &profile.Profile{
+		TaskID: "task", Type: profile.TypeOnCPU, Pid: pid, StartTime: start, EndTime: start.Add(time.Second),
+		Period: 10,
+		Entity: &api.ProcessEntity{Layer: "OS_LINUX", ServiceName: "svc", InstanceName: "ins", ProcessName: "proc",
+			Labels: []string{"a"}},
+		Modules: []*profiling.Module{
+			{Name: "/lib.so", Type: profiling.ModuleTypeSo, Ranges: []*profiling.ModuleRange{{StartAddr: 0x8000, EndAddr: 0x9000}}},
+			{Name: "/app", Type: profiling.ModuleTypeExec, BuildID: "abc",
+				Ranges: []*profiling.ModuleRange{{StartAddr: 0x1000, EndAddr: 0x2000}}},
+		},
+		Samples: []*profile.Sample{
+			{Locations: []*profile.Location{{Address: 0xffff0010, Kernel: true,
+				Frames: []*profiling.Frame{{Name: "schedule"}}}, shared}, Count: 2, Duration: 20},
+			{Locations: []*profile.Location{{Address: 0x8010, Frames: []*profiling.Frame{{Name: "inner", File: "main.c"}}},
+				shared}, Count: 1, Duration: 10},
+		},
+	}
+}
+
+func TestEncodeProfile(t *testing.T) {
+	container := EncodeProfile(testProfile(1))
+	p := container.Profile
+	str := func(i int64) string {
+		return p.StringTable[i]
+	}
+	assert.Equal(t, "", p.StringTable[0])
+	seen := make(map[string]bool)
+	for _, s := range p.StringTable {
+		assert.False(t, seen[s], "duplicate string: %s", s)
+		seen[s] = true
+	}
+
+	// the main binary is the first mapping
+	assert.Equal(t, "/app", str(p.Mapping[0].Filename))
+	assert.Equal(t, "abc", str(p.Mapping[0].BuildId))
+	assert.True(t, p.Mapping[0].HasInlineFrames)
+	assert.Len(t, p.Mapping, 3)
+	assert.Equal(t, "[kernel.kallsyms]", str(p.Mapping[2].Filename))
+
+	// the shared location and function are deduplicated
+	assert.Len(t, p.Location, 3)
+	assert.Len(t, p.Function, 3)
+	assert.Equal(t, []int64{0, 1, 2, 1}, p.LocationIndices)
+	assert.Equal(t, uint64(2), p.Sample[1].LocationsStartIndex)
+	assert.Equal(t, uint64(2), p.Sample[1].LocationsLength)
+	assert.Equal(t, []int64{2, 20}, p.Sample[0].Value)
+
+	shared := p.Location[1]
+	assert.Equal(t, uint64(0), shared.MappingIndex)
+	assert.Equal(t, "native", str(int64(shared.TypeIndex)))
+	assert.Equal(t, "inner", str(p.Function[shared.Line[0].FunctionIndex].Name))
+	assert.Equal(t, int64(2), shared.Line[1].Line)
+	assert.Equal(t, "kernel", str(int64(p.Location[0].TypeIndex)))
+	assert.Equal(t, []string{"samples", "cpu"}, []string{str(p.SampleType[0].Type), str(p.SampleType[1].Type)})
+	assert.Len(t, container.ProfileId, 16)
+}
+
+func TestExporter(t *testing.T) {
+	collector, addr := startFakeCollector(t)
+	exporter, err := NewExporter(&Config{Endpoint: addr, Headers: map[string]string{"authorization": "token"}})
+	assert.NoError(t, err)
+	defer exporter.Close()
+
+	assert.NoError(t, exporter.Export(context.Background(), []*profile.Profile{testProfile(1), testProfile(2), testProfile(1)}))
+	assert.Len(t, collector.requests, 1)
+	assert.Equal(t, []string{"token"}, collector.headers[0].Get("authorization"))
+
+	resources := collector.requests[0].ResourceProfiles
+	assert.Len(t, resources, 2)
+	assert.Len(t, resources[0].ScopeProfiles[0].Profiles, 2)
+	attributes := make(map[string]*common_v1.AnyValue)
+	for _, kv := range resources[0].Resource.Attributes {
+		attributes[kv.Key] = kv.Value
+	}
+	assert.Equal(t, "svc", attributes["service.name"].GetStringValue())
+	assert.Equal(t, "ins", attributes["service.instance.id"].GetStringValue())
+	assert.Equal(t, "OS_LINUX", attributes["skywalking.layer"].GetStringValue())
+	assert.Equal(t, int64(1), attributes["process.pid"].GetIntValue())
+	assert.Equal(t, "a", attributes["skywalking.labels"].GetArrayValue().Values[0].GetStringValue())
+
+	// no request when no profiles
+	assert.NoError(t, exporter.Export(context.Background(), nil))
+	assert.Len(t, collector.requests, 1)
+}
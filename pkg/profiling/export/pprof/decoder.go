@@ -0,0 +1,108 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pprof
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/tools/profiling"
+
+	pprofile "github.com/google/pprof/profile"
+)
+
+// Decode the pprof written by the Encode back to the profile, the modules are not decoded
+func Decode(r io.Reader) (*profile.Profile, error) {
+	decoded, err := pprofile.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(decoded.SampleType) != 2 {
+		return nil, fmt.Errorf("the sample types count must be 2, current is: %d", len(decoded.SampleType))
+	}
+	result := &profile.Profile{
+		StartTime: time.Unix(0, decoded.TimeNanos),
+		EndTime:   time.Unix(0, decoded.TimeNanos+decoded.DurationNanos),
+		Period:    decoded.Period,
+	}
+	switch decoded.SampleType[0].Type {
+	case "samples":
+		result.Type = profile.TypeOnCPU
+	case "switches":
+		result.Type = profile.TypeOffCPU
+	default:
+		return nil, fmt.Errorf("unknown sample type: %s", decoded.SampleType[0].Type)
+	}
+	for _, c := range decoded.Comments {
+		if taskID, found := strings.CutPrefix(c, "task: "); found {
+			result.TaskID = taskID
+		} else if pid, found := strings.CutPrefix(c, "pid: "); found {
+			if v, err := strconv.ParseInt(pid, 10, 32); err == nil {
+				result.Pid = int32(v)
+			}
+		}
+	}
+
+	locations := make(map[uint64]*profile.Location)
+	for _, s := range decoded.Sample {
+		sample := &profile.Sample{Count: s.Value[0], Duration: s.Value[1]}
+		for _, l := range s.Location {
+			loc := locations[l.ID]
+			if loc == nil {
+				loc = decodeLocation(l)
+				locations[l.ID] = loc
+			}
+			sample.Locations = append(sample.Locations, loc)
+		}
+		result.Samples = append(result.Samples, sample)
+	}
+	return result, nil
+}
+
+// ReadFile decodes the profile from the pprof file
+func ReadFile(path string) (*profile.Profile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Decode(file)
+}
+
+func decodeLocation(l *pprofile.Location) *profile.Location {
+	result := &profile.Location{
+		Address: l.Address,
+		Kernel:  l.Mapping != nil && l.Mapping.File == kernelMappingFile,
+	}
+	for _, line := range l.Line {
+		if line.Function == nil {
+			continue
+		}
+		result.Frames = append(result.Frames, &profiling.Frame{
+			Name: line.Function.Name,
+			File: line.Function.Filename,
+			Line: int(line.Line),
+		})
+	}
+	return result
+}
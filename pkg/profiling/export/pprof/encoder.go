@@ -0,0 +1,205 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pprof
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/tools/profiling"
+
+	pprofile "github.com/google/pprof/profile"
+)
+
+// kernelMappingFile is the file name of the kernel mapping, same as the perf tool
+const kernelMappingFile = "[kernel.kallsyms]"
+
+// Encode the profile into the pprof format
+func Encode(p *profile.Profile) (*pprofile.Profile, error) {
+	result := &pprofile.Profile{
+		TimeNanos:     p.StartTime.UnixNano(),
+		DurationNanos: p.EndTime.Sub(p.StartTime).Nanoseconds(),
+		Comments:      []string{fmt.Sprintf("task: %s", p.TaskID), fmt.Sprintf("pid: %d", p.Pid)},
+	}
+	switch p.Type {
+	case profile.TypeOnCPU:
+		result.SampleType = []*pprofile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}}
+		result.PeriodType = &pprofile.ValueType{Type: "cpu", Unit: "nanoseconds"}
+		result.Period = p.Period
+	case profile.TypeOffCPU:
+		result.SampleType = []*pprofile.ValueType{{Type: "switches", Unit: "count"}, {Type: "off-cpu", Unit: "nanoseconds"}}
+	default:
+		return nil, fmt.Errorf("unknown profile type: %s", p.Type)
+	}
+
+	e := newEncoder(result, p)
+	for _, s := range p.Samples {
+		sample := &pprofile.Sample{Value: []int64{s.Count, s.Duration}}
+		for _, l := range s.Locations {
+			sample.Location = append(sample.Location, e.location(l))
+		}
+		result.Sample = append(result.Sample, sample)
+	}
+	e.addKernelMapping()
+	return result, result.CheckValid()
+}
+
+// Write the profile as the gzipped pprof protobuf
+func Write(w io.Writer, p *profile.Profile) error {
+	encoded, err := Encode(p)
+	if err != nil {
+		return err
+	}
+	return encoded.Write(w)
+}
+
+type encoder struct {
+	result *pprofile.Profile
+
+	mappings  map[*profiling.ModuleRange]*pprofile.Mapping
+	ranges    []*moduleRange
+	locations map[locationKey]*pprofile.Location
+	functions map[functionKey]*pprofile.Function
+
+	// the kernel mapping is built after all kernel locations found
+	kernelMapping   *pprofile.Mapping
+	kernelLocations []*pprofile.Location
+}
+
+type moduleRange struct {
+	module *profiling.Module
+	r      *profiling.ModuleRange
+}
+
+// locationKey contains the frames, the same address could be different functions in the merged profile of processes
+type locationKey struct {
+	address uint64
+	kernel  bool
+	frames  string
+}
+
+type functionKey struct {
+	name string
+	file string
+}
+
+func newEncoder(result *pprofile.Profile, p *profile.Profile) *encoder {
+	e := &encoder{
+		result:    result,
+		mappings:  make(map[*profiling.ModuleRange]*pprofile.Mapping),
+		locations: make(map[locationKey]*pprofile.Location),
+		functions: make(map[functionKey]*pprofile.Function),
+	}
+	for _, m := range p.Modules {
+		for _, r := range m.Ranges {
+			e.ranges = append(e.ranges, &moduleRange{module: m, r: r})
+		}
+	}
+	return e
+}
+
+func (e *encoder) location(l *profile.Location) *pprofile.Location {
+	names := make([]string, 0, len(l.Frames))
+	for _, f := range l.Frames {
+		names = append(names, f.Name)
+	}
+	key := locationKey{address: l.Address, kernel: l.Kernel, frames: strings.Join(names, ";")}
+	if loc := e.locations[key]; loc != nil {
+		return loc
+	}
+	loc := &pprofile.Location{ID: uint64(len(e.result.Location) + 1), Address: l.Address}
+	if l.Kernel {
+		loc.Mapping = e.kernelMappingOf()
+		e.kernelLocations = append(e.kernelLocations, loc)
+	} else {
+		loc.Mapping = e.mapping(l.Address)
+	}
+	for _, f := range l.Frames {
+		loc.Line = append(loc.Line, pprofile.Line{Function: e.function(f), Line: int64(f.Line)})
+	}
+	if loc.Mapping != nil && len(loc.Line) > 0 && loc.Line[0].Function.Name != profile.MissingSymbol {
+		loc.Mapping.HasFunctions = true
+	}
+	e.locations[key] = loc
+	e.result.Location = append(e.result.Location, loc)
+	return loc
+}
+
+func (e *encoder) mapping(address uint64) *pprofile.Mapping {
+	for _, mr := range e.ranges {
+		if address < mr.r.StartAddr || address >= mr.r.EndAddr {
+			continue
+		}
+		if m := e.mappings[mr.r]; m != nil {
+			return m
+		}
+		m := &pprofile.Mapping{
+			ID:      uint64(len(e.result.Mapping) + 1),
+			Start:   mr.r.StartAddr,
+			Limit:   mr.r.EndAddr,
+			Offset:  mr.r.FileOffset,
+			File:    mr.module.Name,
+			BuildID: mr.module.BuildID,
+		}
+		e.mappings[mr.r] = m
+		e.result.Mapping = append(e.result.Mapping, m)
+		return m
+	}
+	return nil
+}
+
+func (e *encoder) kernelMappingOf() *pprofile.Mapping {
+	if e.kernelMapping == nil {
+		e.kernelMapping = &pprofile.Mapping{ID: uint64(len(e.result.Mapping) + 1), File: kernelMappingFile}
+		e.result.Mapping = append(e.result.Mapping, e.kernelMapping)
+	}
+	return e.kernelMapping
+}
+
+// addKernelMapping update the address range of kernel mapping which covers all kernel locations
+func (e *encoder) addKernelMapping() {
+	if e.kernelMapping == nil {
+		return
+	}
+	for i, l := range e.kernelLocations {
+		if i == 0 || l.Address < e.kernelMapping.Start {
+			e.kernelMapping.Start = l.Address
+		}
+		if l.Address >= e.kernelMapping.Limit {
+			e.kernelMapping.Limit = l.Address + 1
+		}
+	}
+}
+
+func (e *encoder) function(f *profiling.Frame) *pprofile.Function {
+	key := functionKey{name: f.Name, file: f.File}
+	if fun := e.functions[key]; fun != nil {
+		return fun
+	}
+	fun := &pprofile.Function{
+		ID:         uint64(len(e.result.Function) + 1),
+		Name:       f.Name,
+		SystemName: f.Name,
+		Filename:   f.File,
+	}
+	e.functions[key] = fun
+	e.result.Function = append(e.result.Function, fun)
+	return fun
+}
@@ -0,0 +1,148 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pprof
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/tools/profiling"
+
+	pprofile "github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+)
+
+func testProfile(t profile.Type) *profile.Profile {
+	start := time.Unix(1700000000, 0)
+	kernel := &profile.Location{Address: 0xffffffff81000010, Kernel: true,
+		Frames: []*profiling.Frame{{Name: "do_syscall_64"}}}
+	inlined := &profile.Location{Address: 0x401010, Frames: []*profiling.Frame{
+		{Name: "main.inner", File: "main.go", Line: 10},
+		{Name: "main.outer", File: "main.go", Line: 20},
+	}}
+	missing := &profile.Location{Address: 0x7f0000001000, Frames: []*profiling.Frame{{Name: profile.MissingSymbol}}}
+	return &profile.Profile{
+		TaskID:    "task/1",
+		Type:      t,
+		Pid:       100,
+		StartTime: start,
+		EndTime:   start.Add(10 * time.Second),
+		Period:    int64(10 * time.Millisecond),
+		Modules: []*profiling.Module{
+			{Name: "/app", BuildID: "abcd", Ranges: []*profiling.ModuleRange{{StartAddr: 0x400000, EndAddr: 0x500000}}},
+			{Name: "/lib/libc.so", Ranges: []*profiling.ModuleRange{{StartAddr: 0x7f0000000000, EndAddr: 0x7f0000100000,
+				FileOffset: 0x1000}}},
+		},
+		Samples: []*profile.Sample{
+			{Locations: []*profile.Location{kernel, inlined}, Count: 3, Duration: 3 * int64(10*time.Millisecond)},
+			{Locations: []*profile.Location{missing, inlined}, Count: 1, Duration: int64(10 * time.Millisecond)},
+		},
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name        string
+		profileType profile.Type
+		sampleTypes []string
+		period      int64
+	}{
+		{name: "on-cpu", profileType: profile.TypeOnCPU, sampleTypes: []string{"samples/count", "cpu/nanoseconds"},
+			period: int64(10 * time.Millisecond)},
+		{name: "off-cpu", profileType: profile.TypeOffCPU, sampleTypes: []string{"switches/count", "off-cpu/nanoseconds"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			assert.NoError(t, Write(buf, testProfile(tt.profileType)))
+			result, err := pprofile.Parse(buf)
+			assert.NoError(t, err)
+
+			sampleTypes := make([]string, 0)
+			for _, s := range result.SampleType {
+				sampleTypes = append(sampleTypes, s.Type+"/"+s.Unit)
+			}
+			assert.Equal(t, tt.sampleTypes, sampleTypes)
+			assert.Equal(t, tt.period, result.Period)
+			assert.Equal(t, int64(10*time.Second), result.DurationNanos)
+
+			// the inlined location is shared between samples
+			assert.Len(t, result.Sample, 2)
+			assert.Len(t, result.Location, 3)
+			assert.Same(t, result.Sample[0].Location[1], result.Sample[1].Location[1])
+			assert.Equal(t, []int64{3, 3 * int64(10*time.Millisecond)}, result.Sample[0].Value)
+
+			inlined := result.Sample[0].Location[1]
+			assert.Len(t, inlined.Line, 2)
+			assert.Equal(t, "main.inner", inlined.Line[0].Function.Name)
+			assert.Equal(t, int64(20), inlined.Line[1].Line)
+			assert.Equal(t, "/app", inlined.Mapping.File)
+			assert.Equal(t, "abcd", inlined.Mapping.BuildID)
+			assert.True(t, inlined.Mapping.HasFunctions)
+
+			missing := result.Sample[1].Location[0]
+			assert.Equal(t, "/lib/libc.so", missing.Mapping.File)
+			assert.Equal(t, uint64(0x1000), missing.Mapping.Offset)
+			assert.False(t, missing.Mapping.HasFunctions)
+
+			kernel := result.Sample[0].Location[0]
+			assert.Equal(t, kernelMappingFile, kernel.Mapping.File)
+			assert.True(t, kernel.Address >= kernel.Mapping.Start && kernel.Address < kernel.Mapping.Limit)
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	for _, profileType := range []profile.Type{profile.TypeOnCPU, profile.TypeOffCPU} {
+		t.Run(string(profileType), func(t *testing.T) {
+			expected := testProfile(profileType)
+			buf := &bytes.Buffer{}
+			assert.NoError(t, Write(buf, expected))
+			decoded, err := Decode(buf)
+			assert.NoError(t, err)
+
+			assert.Equal(t, expected.TaskID, decoded.TaskID)
+			assert.Equal(t, expected.Type, decoded.Type)
+			assert.Equal(t, expected.Pid, decoded.Pid)
+			assert.True(t, expected.StartTime.Equal(decoded.StartTime))
+			assert.True(t, expected.EndTime.Equal(decoded.EndTime))
+			assert.Len(t, decoded.Samples, 2)
+			for i, s := range expected.Samples {
+				assert.Equal(t, s.Count, decoded.Samples[i].Count)
+				assert.Equal(t, s.Duration, decoded.Samples[i].Duration)
+				assert.Equal(t, s.Locations, decoded.Samples[i].Locations)
+			}
+			assert.Same(t, decoded.Samples[0].Locations[1], decoded.Samples[1].Locations[1])
+		})
+	}
+}
+
+func TestWriter(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := NewWriter(dir)
+	assert.NoError(t, err)
+	path, err := writer.Write(testProfile(profile.TypeOnCPU))
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "task_1", "on_cpu-1700000000000.pb.gz"), path)
+	decoded, err := ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "task/1", decoded.TaskID)
+}
@@ -0,0 +1,49 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pprof
+
+import (
+	"fmt"
+	"os"
+
+	"perfprofiler/pkg/profiling/export"
+	"perfprofiler/pkg/profiling/profile"
+)
+
+// Writer writes the profiles into the local directory, each task have its own sub directory
+type Writer struct {
+	dir string
+}
+
+func NewWriter(dir string) (*Writer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("could not create the pprof directory: %s, error: %v", dir, err)
+	}
+	return &Writer{dir: dir}, nil
+}
+
+// Write the profile as "<dir>/<task id>/<type>-<start time millis>.pb.gz", return the written file path
+func (w *Writer) Write(p *profile.Profile) (string, error) {
+	path, err := export.ProfileFilePath(w.dir, p, ".pb.gz")
+	if err != nil {
+		return "", err
+	}
+	return path, export.WriteFile(path, func(f *os.File) error {
+		return Write(f, p)
+	})
+}
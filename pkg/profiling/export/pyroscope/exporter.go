@@ -0,0 +1,231 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pyroscope
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+
+	"perfprofiler/pkg/profiling/export/flamegraph"
+	"perfprofiler/pkg/profiling/profile"
+)
+
+const (
+	defaultTimeout         = 10 * time.Second
+	defaultApplicationName = "{service}"
+	// the spy name of the eBPF profiler in the Pyroscope
+	spyName = "ebpfspy"
+	// the default sample rate(Hz) when the period of profile is unknown
+	defaultSampleRate = 100
+)
+
+// the tags when not configured
+var defaultTags = map[string]string{
+	"layer":    "{layer}",
+	"instance": "{instance}",
+	"process":  "{process}",
+}
+
+var (
+	unsafeNameRegex     = regexp.MustCompile(`[^a-zA-Z0-9._/-]`)
+	unsafeTagKeyRegex   = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+	unsafeTagValueRegex = regexp.MustCompile(`[,{}="\s]`)
+)
+
+// Config of the Pyroscope exporter, the application name and tag values are the templates,
+// support placeholders: {layer}, {service}, {instance}, {process}, {pid}, {task} and {labels}(joined by "|")
+type Config struct {
+	Endpoint          string            `mapstructure:"endpoint"`            // The Pyroscope server address, such as "http://pyroscope:4040", disabled when empty
+	ApplicationName   string            `mapstructure:"application_name"`    // The template of application name, default is "{service}"
+	Tags              map[string]string `mapstructure:"tags"`                // The tag name to the value template, default is the layer, instance and process
+	AuthToken         string            `mapstructure:"auth_token"`          // The bearer token of the request
+	BasicAuthUser     string            `mapstructure:"basic_auth_user"`     // The basic auth user, such as the Grafana Cloud user ID
+	BasicAuthPassword string            `mapstructure:"basic_auth_password"` // The basic auth password
+	TenantID          string            `mapstructure:"tenant_id"`           // The tenant ID(X-Scope-OrgID header) of the multi-tenant server
+	Headers           map[string]string `mapstructure:"headers"`             // The extra headers when send request
+	Timeout           string            `mapstructure:"timeout"`             // The timeout of each push request, default is 10s
+}
+
+// Exporter pushes the on-cpu profiles to the "/ingest" endpoint of Pyroscope(or Grafana Phlare) in the folded format
+type Exporter struct {
+	config  *Config
+	ingest  string
+	client  *http.Client
+	appName string
+	tags    map[string]string
+}
+
+func NewExporter(config *Config) (*Exporter, error) {
+	timeout := defaultTimeout
+	if config.Timeout != "" {
+		t, err := time.ParseDuration(config.Timeout)
+		if err != nil {
+			return nil, fmt.Errorf("parsing the Pyroscope timeout failure: %v", err)
+		}
+		timeout = t
+	}
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, fmt.Errorf("the Pyroscope endpoint is not a valid URL: %s", config.Endpoint)
+	}
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + "/ingest"
+	appName, tags := config.ApplicationName, config.Tags
+	if appName == "" {
+		appName = defaultApplicationName
+	}
+	if tags == nil {
+		tags = defaultTags
+	}
+	return &Exporter{
+		config:  config,
+		ingest:  endpoint.String(),
+		client:  &http.Client{Timeout: timeout},
+		appName: appName,
+		tags:    tags,
+	}, nil
+}
+
+// Export pushes each on-cpu profile in a request, the other types of profiles are ignored
+func (e *Exporter) Export(ctx context.Context, profiles []*profile.Profile) error {
+	var result error
+	for _, p := range profiles {
+		if p.Type != profile.TypeOnCPU {
+			continue
+		}
+		if err := e.push(ctx, p); err != nil {
+			result = multierror.Append(result, fmt.Errorf("pushing the profile of task %s failure: %v", p.TaskID, err))
+		}
+	}
+	return result
+}
+
+func (e *Exporter) push(ctx context.Context, p *profile.Profile) error {
+	body := &bytes.Buffer{}
+	stacks := flamegraph.Fold(p, &flamegraph.Options{})
+	if len(stacks) == 0 {
+		return nil
+	}
+	if err := flamegraph.WriteFolded(body, stacks); err != nil {
+		return err
+	}
+
+	sampleRate := int64(defaultSampleRate)
+	if p.Period > 0 {
+		sampleRate = int64(time.Second) / p.Period
+	}
+	from, until := p.StartTime.Unix(), p.EndTime.Unix()
+	if until <= from {
+		until = from + 1
+	}
+	query := url.Values{}
+	query.Set("name", e.Name(p))
+	query.Set("from", strconv.FormatInt(from, 10))
+	query.Set("until", strconv.FormatInt(until, 10))
+	query.Set("format", "folded")
+	query.Set("sampleRate", strconv.FormatInt(sampleRate, 10))
+	query.Set("spyName", spyName)
+	query.Set("units", "samples")
+	query.Set("aggregationType", "sum")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.ingest+"?"+query.Encode(), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	for k, v := range e.config.Headers {
+		req.Header.Set(k, v)
+	}
+	if e.config.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", e.config.TenantID)
+	}
+	if e.config.AuthToken != "" {
+		req.Header.Set("Authorization", "Bearer "+e.config.AuthToken)
+	} else if e.config.BasicAuthUser != "" {
+		req.SetBasicAuth(e.config.BasicAuthUser, e.config.BasicAuthPassword)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("response status: %s, message: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	_, _ = io.Copy(io.Discard, resp.Body)
+	return nil
+}
+
+// Name of the profile in the Pyroscope, such as "service.cpu{instance=a,process=b}", the empty tags are ignored
+func (e *Exporter) Name(p *profile.Profile) string {
+	replacer := e.replacer(p)
+	appName := unsafeNameRegex.ReplaceAllString(replacer.Replace(e.appName), "_")
+	if appName == "" {
+		appName = "unknown"
+	}
+	keys := make([]string, 0, len(e.tags))
+	for k := range e.tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tags := make([]string, 0, len(keys))
+	for _, k := range keys {
+		value := unsafeTagValueRegex.ReplaceAllString(replacer.Replace(e.tags[k]), "_")
+		if value == "" {
+			continue
+		}
+		tags = append(tags, unsafeTagKeyRegex.ReplaceAllString(k, "_")+"="+value)
+	}
+	return fmt.Sprintf("%s.cpu{%s}", appName, strings.Join(tags, ","))
+}
+
+func (e *Exporter) replacer(p *profile.Profile) *strings.Replacer {
+	var layer, service, instance, process string
+	var labels []string
+	if p.Entity != nil {
+		layer, service, instance, process = p.Entity.Layer, p.Entity.ServiceName, p.Entity.InstanceName, p.Entity.ProcessName
+		labels = append(labels, p.Entity.Labels...)
+		sort.Strings(labels)
+	}
+	return strings.NewReplacer(
+		"{layer}", layer,
+		"{service}", service,
+		"{instance}", instance,
+		"{process}", process,
+		"{pid}", strconv.FormatInt(int64(p.Pid), 10),
+		"{task}", p.TaskID,
+		"{labels}", strings.Join(labels, "|"),
+	)
+}
+
+func (e *Exporter) Close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
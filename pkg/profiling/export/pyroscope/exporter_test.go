@@ -0,0 +1,153 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pyroscope
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/tools/profiling"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type ingestRequest struct {
+	path    string
+	query   map[string]string
+	auth    string
+	tenant  string
+	payload string
+}
+
+type fakePyroscope struct {
+	lock     sync.Mutex
+	requests []*ingestRequest
+	status   int
+}
+
+func (f *fakePyroscope) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	req := &ingestRequest{path: r.URL.Path, query: make(map[string]string), auth: r.Header.Get("Authorization"),
+		tenant: r.Header.Get("X-Scope-OrgID"), payload: string(body)}
+	for k := range r.URL.Query() {
+		req.query[k] = r.URL.Query().Get(k)
+	}
+	f.lock.Lock()
+	f.requests = append(f.requests, req)
+	f.lock.Unlock()
+	if f.status != 0 {
+		http.Error(w, "invalid name", f.status)
+	}
+}
+
+func testProfile(t profile.Type) *profile.Profile {
+	main := &profile.Location{Address: 1, Frames: []*profiling.Frame{{Name: "main"}}}
+	work := &profile.Location{Address: 2, Frames: []*profiling.Frame{{Name: "work"}}}
+	return &profile.Profile{
+		TaskID: "task", Type: t, Pid: 10, Period: int64(10 * time.Millisecond),
+		Entity: &api.ProcessEntity{Layer: "GENERAL", ServiceName: "svc", InstanceName: "node a",
+			ProcessName: "app", Labels: []string{"b", "a"}},
+		StartTime: time.Unix(1700000000, 0), EndTime: time.Unix(1700000010, 0),
+		Samples: []*profile.Sample{
+			{Locations: []*profile.Location{work, main}, Count: 3},
+			{Locations: []*profile.Location{main}, Count: 1},
+		},
+	}
+}
+
+func TestExport(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		status  int
+		appName string
+		auth    string
+		tenant  string
+		err     bool
+	}{
+		{
+			name:    "default tags",
+			config:  &Config{AuthToken: "token"},
+			appName: "svc.cpu{instance=node_a,layer=GENERAL,process=app}",
+			auth:    "Bearer token",
+		},
+		{
+			name: "custom tags with basic auth",
+			config: &Config{ApplicationName: "{layer}/{service}", BasicAuthUser: "user", BasicAuthPassword: "pass",
+				TenantID: "tenant", Tags: map[string]string{"pid": "{pid}", "labels": "{labels}", "task-id": "{task}", "raw": "{unknown}x"}},
+			appName: "GENERAL/svc.cpu{labels=a|b,pid=10,raw=_unknown_x,task_id=task}",
+			auth:    "Basic dXNlcjpwYXNz",
+			tenant:  "tenant",
+		},
+		{
+			name:   "server failure",
+			config: &Config{},
+			status: http.StatusBadRequest,
+			err:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakePyroscope{status: tt.status}
+			server := httptest.NewServer(fake)
+			defer server.Close()
+			tt.config.Endpoint = server.URL + "/"
+			exporter, err := NewExporter(tt.config)
+			assert.NoError(t, err)
+			defer exporter.Close()
+
+			// the off-cpu profile is ignored
+			err = exporter.Export(context.Background(), []*profile.Profile{testProfile(profile.TypeOnCPU), testProfile(profile.TypeOffCPU)})
+			if tt.err {
+				assert.ErrorContains(t, err, "invalid name")
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, fake.requests, 1)
+			req := fake.requests[0]
+			assert.Equal(t, "/ingest", req.path)
+			assert.Equal(t, map[string]string{
+				"name":            tt.appName,
+				"from":            "1700000000",
+				"until":           "1700000010",
+				"format":          "folded",
+				"sampleRate":      "100",
+				"spyName":         "ebpfspy",
+				"units":           "samples",
+				"aggregationType": "sum",
+			}, req.query)
+			assert.Equal(t, tt.auth, req.auth)
+			assert.Equal(t, tt.tenant, req.tenant)
+			assert.Equal(t, "main 1\nmain;work 3\n", req.payload)
+		})
+	}
+}
+
+func TestNewExporter(t *testing.T) {
+	_, err := NewExporter(&Config{Endpoint: "pyroscope:4040"})
+	assert.Error(t, err)
+	_, err = NewExporter(&Config{Endpoint: "http://pyroscope:4040", Timeout: "1x"})
+	assert.Error(t, err)
+}
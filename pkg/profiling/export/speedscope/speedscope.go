@@ -0,0 +1,192 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package speedscope
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"perfprofiler/pkg/profiling/profile"
+)
+
+const (
+	schemaURL      = "https://www.speedscope.app/file-format-schema.json"
+	exporterName   = "perfprofiler"
+	kernelFileName = "[kernel.kallsyms]"
+)
+
+// File is the root of speedscope file format
+type File struct {
+	Schema             string     `json:"$schema"`
+	Shared             Shared     `json:"shared"`
+	Profiles           []*Profile `json:"profiles"`
+	Name               string     `json:"name,omitempty"`
+	ActiveProfileIndex int        `json:"activeProfileIndex"`
+	Exporter           string     `json:"exporter,omitempty"`
+}
+
+type Shared struct {
+	Frames []*Frame `json:"frames"`
+}
+
+type Frame struct {
+	Name string `json:"name"`
+	File string `json:"file,omitempty"`
+	Line int    `json:"line,omitempty"`
+}
+
+// Profile is the "sampled" or "evented" profile
+type Profile struct {
+	Type       string `json:"type"`
+	Name       string `json:"name"`
+	Unit       string `json:"unit"`
+	StartValue int64  `json:"startValue"`
+	EndValue   int64  `json:"endValue"`
+	// Samples and Weights only exists in the "sampled" profile, each sample is the frame indexes from the root to the leaf
+	Samples [][]int `json:"samples,omitempty"`
+	Weights []int64 `json:"weights,omitempty"`
+	// Events only exists in the "evented" profile
+	Events []*Event `json:"events,omitempty"`
+}
+
+// Event of open("O") or close("C") a frame
+type Event struct {
+	Type  string `json:"type"`
+	Frame int    `json:"frame"`
+	At    int64  `json:"at"`
+}
+
+// Encode the profile as the speedscope file, the "sampled" profile aggregates all samples,
+// and the "evented" profile is appended when the samples have timestamps
+func Encode(p *profile.Profile) *File {
+	e := &encoder{frames: make(map[Frame]int)}
+	name := fmt.Sprintf("%s pid %d", p.Type, p.Pid)
+	sampled := &Profile{Type: "sampled", Name: name, Unit: "nanoseconds"}
+	timedStacks := make([]*timedStack, 0)
+	for _, s := range p.Samples {
+		stack := e.stack(s)
+		if len(stack) == 0 {
+			continue
+		}
+		sampled.Samples = append(sampled.Samples, stack)
+		sampled.Weights = append(sampled.Weights, s.Duration)
+		sampled.EndValue += s.Duration
+
+		if len(s.Timestamps) == 0 {
+			continue
+		}
+		duration := s.Duration / int64(len(s.Timestamps))
+		for _, t := range s.Timestamps {
+			timedStacks = append(timedStacks, &timedStack{
+				stack: stack, start: t.Sub(p.StartTime).Nanoseconds(), duration: duration})
+		}
+	}
+
+	result := &File{
+		Schema:   schemaURL,
+		Profiles: []*Profile{sampled},
+		Name:     fmt.Sprintf("task %s, %s", p.TaskID, name),
+		Exporter: exporterName,
+	}
+	if len(timedStacks) > 0 {
+		result.Profiles = append(result.Profiles, evented(fmt.Sprintf("%s timeline", name), timedStacks))
+	}
+	result.Shared.Frames = e.frameList
+	return result
+}
+
+// Write the profile as the speedscope JSON
+func Write(w io.Writer, p *profile.Profile) error {
+	return json.NewEncoder(w).Encode(Encode(p))
+}
+
+type encoder struct {
+	frames    map[Frame]int
+	frameList []*Frame
+}
+
+// stack of the sample from the root to the leaf
+func (e *encoder) stack(s *profile.Sample) []int {
+	result := make([]int, 0, len(s.Locations))
+	for i := len(s.Locations) - 1; i >= 0; i-- {
+		l := s.Locations[i]
+		for j := len(l.Frames) - 1; j >= 0; j-- {
+			f := Frame{Name: l.Frames[j].Name, File: l.Frames[j].File, Line: l.Frames[j].Line}
+			if l.Kernel && f.File == "" {
+				f.File = kernelFileName
+			}
+			result = append(result, e.frame(f))
+		}
+	}
+	return result
+}
+
+func (e *encoder) frame(f Frame) int {
+	if index, exist := e.frames[f]; exist {
+		return index
+	}
+	index := len(e.frameList)
+	e.frames[f] = index
+	e.frameList = append(e.frameList, &f)
+	return index
+}
+
+type timedStack struct {
+	stack    []int
+	start    int64
+	duration int64
+}
+
+// evented builds the timeline of the stacks ordered by the time, the frames shared with the previous stack are kept
+// opened, and the stack is closed when the next stack started or its duration finished
+func evented(name string, stacks []*timedStack) *Profile {
+	sort.SliceStable(stacks, func(i, j int) bool {
+		return stacks[i].start < stacks[j].start
+	})
+	result := &Profile{Type: "evented", Name: name, Unit: "nanoseconds", StartValue: stacks[0].start}
+	opened := make([]int, 0)
+	closeTo := func(depth int, at int64) {
+		for len(opened) > depth {
+			result.Events = append(result.Events, &Event{Type: "C", Frame: opened[len(opened)-1], At: at})
+			opened = opened[:len(opened)-1]
+		}
+	}
+	var end int64
+	for _, s := range stacks {
+		at := s.start
+		if at > end {
+			// the previous stack has finished before the current stack
+			closeTo(0, end)
+		}
+		common := 0
+		for common < len(opened) && common < len(s.stack) && opened[common] == s.stack[common] {
+			common++
+		}
+		closeTo(common, at)
+		for _, f := range s.stack[common:] {
+			result.Events = append(result.Events, &Event{Type: "O", Frame: f, At: at})
+			opened = append(opened, f)
+		}
+		end = at + s.duration
+	}
+	closeTo(0, end)
+	result.EndValue = end
+	return result
+}
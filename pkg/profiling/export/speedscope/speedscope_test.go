@@ -0,0 +1,106 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package speedscope
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/tools/profiling"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func location(kernel bool, names ...string) *profile.Location {
+	frames := make([]*profiling.Frame, 0, len(names))
+	for _, n := range names {
+		frames = append(frames, &profiling.Frame{Name: n})
+	}
+	return &profile.Location{Kernel: kernel, Frames: frames}
+}
+
+func TestEncodeSampled(t *testing.T) {
+	p := &profile.Profile{TaskID: "task", Type: profile.TypeOnCPU, Pid: 1, Samples: []*profile.Sample{
+		{Locations: []*profile.Location{location(true, "schedule"), location(false, "inner", "outer")}, Duration: 30},
+		{Locations: []*profile.Location{location(false, "outer")}, Duration: 10},
+	}}
+	file := Encode(p)
+	assert.Len(t, file.Profiles, 1)
+	sampled := file.Profiles[0]
+	assert.Equal(t, "sampled", sampled.Type)
+	assert.Equal(t, [][]int{{0, 1, 2}, {0}}, sampled.Samples)
+	assert.Equal(t, []int64{30, 10}, sampled.Weights)
+	assert.Equal(t, int64(40), sampled.EndValue)
+	assert.Equal(t, "outer", file.Shared.Frames[0].Name)
+	assert.Equal(t, kernelFileName, file.Shared.Frames[2].File)
+
+	// the result should be valid JSON with the schema
+	buf := &bytes.Buffer{}
+	assert.NoError(t, Write(buf, p))
+	var parsed map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &parsed))
+	assert.Equal(t, schemaURL, parsed["$schema"])
+}
+
+func TestEncodeEvented(t *testing.T) {
+	start := time.Unix(100, 0)
+	at := func(n int64) time.Time {
+		return start.Add(time.Duration(n))
+	}
+	p := &profile.Profile{TaskID: "task", Type: profile.TypeOffCPU, Pid: 1, StartTime: start, Samples: []*profile.Sample{
+		// main -> a, at 0 and 20
+		{Locations: []*profile.Location{location(false, "a", "main")}, Duration: 20, Timestamps: []time.Time{at(0), at(20)}},
+		// main -> b, at 10
+		{Locations: []*profile.Location{location(false, "b", "main")}, Duration: 5, Timestamps: []time.Time{at(10)}},
+	}}
+	file := Encode(p)
+	assert.Len(t, file.Profiles, 2)
+	evented := file.Profiles[1]
+	assert.Equal(t, "evented", evented.Type)
+
+	type event struct {
+		t     string
+		frame string
+		at    int64
+	}
+	events := make([]event, 0)
+	for _, e := range evented.Events {
+		events = append(events, event{e.Type, file.Shared.Frames[e.Frame].Name, e.At})
+	}
+	assert.Equal(t, []event{
+		{"O", "main", 0}, {"O", "a", 0},
+		{"C", "a", 10}, {"O", "b", 10},
+		{"C", "b", 15}, {"C", "main", 15},
+		{"O", "main", 20}, {"O", "a", 20},
+		{"C", "a", 30}, {"C", "main", 30},
+	}, events)
+	assert.Equal(t, int64(30), evented.EndValue)
+}
+
+func TestWriter(t *testing.T) {
+	dir := t.TempDir()
+	writer, err := NewWriter(dir)
+	assert.NoError(t, err)
+	path, err := writer.Write(&profile.Profile{TaskID: "task", Type: profile.TypeOnCPU, Pid: 10, StartTime: time.UnixMilli(5)})
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "task", "10-on_cpu-5.speedscope.json"), path)
+}
@@ -20,12 +20,24 @@ package profiling
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 	"time"
 
 	"perfprofiler/pkg/profiling/continuous"
+	"perfprofiler/pkg/profiling/control"
+	"perfprofiler/pkg/profiling/debug"
+	"perfprofiler/pkg/profiling/sink"
+	"perfprofiler/pkg/profiling/standalone"
 
+	"perfprofiler/pkg/core"
+	"perfprofiler/pkg/core/backend"
 	"perfprofiler/pkg/module"
+	"perfprofiler/pkg/process"
+	"perfprofiler/pkg/process/api"
 	"perfprofiler/pkg/profiling/task"
+	"perfprofiler/pkg/profiling/task/base"
+
+	"google.golang.org/grpc"
 )
 
 // Manager the profiling task, receive them from the backend side
@@ -34,6 +46,15 @@ type Manager struct {
 	flushInterval     time.Duration
 	taskManager       *task.Manager
 	continuousManager *continuous.Manager
+	debugServer       *debug.Server
+	controlServer     *control.Server
+	sink              sink.Sink
+	spools            *sink.Spools
+	standalone        *standalone.Scheduler
+	processOperator   process.Operator
+
+	// the profiling data is flushing in the background
+	flushing atomic.Bool
 
 	ctx    context.Context
 	cancel context.CancelFunc
@@ -50,29 +71,101 @@ func NewManager(ctx context.Context, manager *module.Manager, conf *Config) (*Ma
 		return nil, fmt.Errorf("parse profiling data flush interval failure: %v", err)
 	}
 
-	taskManager, err := task.NewManager(ctx, manager, conf.TaskConfig)
+	var connection grpc.ClientConnInterface
+	var spools *sink.Spools
+	backendOperator := manager.FindModule(core.ModuleName).(core.Operator).BackendOperator()
+	if backendOperator != nil {
+		connection = backendOperator.GetConnection()
+	}
+	configs := sinkConfigs(conf, connection != nil)
+	// only the data of the remote sinks is spooled, the local sinks are always available
+	if conf.Spool != nil && conf.Spool.Directory != "" {
+		var statuses <-chan backend.ConnectionStatus
+		if backendOperator != nil && containsSink(configs, sink.TypeSkyWalking) {
+			statuses = backendOperator.RegisterListener()
+		}
+		spools = sink.NewSpools(conf.Spool, statuses)
+	}
+	dataSink, err := sink.NewSink(configs, connection, spools)
 	if err != nil {
 		return nil, err
 	}
+	log.Infof("the profiling data is sent to the %s sink", dataSink.Name())
 
-	continuousManager, err := continuous.NewManager(ctx, taskManager, manager, conf.ContinuousConfig)
+	taskManager, err := task.NewManager(ctx, manager, conf.TaskConfig, dataSink)
 	if err != nil {
+		_ = dataSink.Close()
+		return nil, err
+	}
+
+	continuousManager, err := continuous.NewManager(ctx, taskManager, manager, conf.ContinuousConfig, dataSink)
+	if err != nil {
+		_ = dataSink.Close()
 		return nil, err
 	}
 	ctx, cancel := context.WithCancel(ctx)
-	return &Manager{
+	result := &Manager{
 		checkInterval:     checkDuration,
 		flushInterval:     flushDuration,
 		taskManager:       taskManager,
 		continuousManager: continuousManager,
+		sink:              dataSink,
+		spools:            spools,
+		processOperator:   manager.FindModule(process.ModuleName).(process.Operator),
 		ctx:               ctx,
 		cancel:            cancel,
-	}, nil
+	}
+	if conf.Standalone != nil && conf.Standalone.TaskPath != "" {
+		if result.standalone, err = standalone.NewScheduler(ctx, conf.Standalone, taskManager, result.processOperator); err != nil {
+			cancel()
+			_ = dataSink.Close()
+			return nil, err
+		}
+	}
+	if conf.DebugServer != nil && conf.DebugServer.Address != "" {
+		result.debugServer = debug.NewServer(conf.DebugServer, taskManager, result)
+	}
+	if conf.Control != nil && conf.Control.Address != "" {
+		result.controlServer = control.NewServer(conf.Control, result)
+	}
+	return result, nil
+}
+
+// sinkConfigs of the profiling data, the backend is used by default when it is configured
+func sinkConfigs(conf *Config, hasBackend bool) []*sink.Config {
+	if len(conf.Sinks) > 0 {
+		return conf.Sinks
+	}
+	if !hasBackend {
+		return []*sink.Config{{Type: sink.TypeNone}}
+	}
+	return []*sink.Config{{Type: sink.TypeSkyWalking}}
+}
+
+func containsSink(configs []*sink.Config, sinkType string) bool {
+	for _, c := range configs {
+		if c.Type == sinkType {
+			return true
+		}
+	}
+	return false
 }
 
 func (m *Manager) Start() {
 	m.taskManager.Start()
+	if m.spools != nil {
+		m.spools.Start(m.ctx)
+	}
 	m.continuousManager.Start()
+	if m.standalone != nil {
+		m.standalone.Start()
+	}
+	if m.debugServer != nil {
+		m.logErrorIfContains(m.debugServer.Start(), "start debug server")
+	}
+	if m.controlServer != nil {
+		m.logErrorIfContains(m.controlServer.Start(), "start control API")
+	}
 	go func() {
 		checkTicker := time.NewTicker(m.checkInterval)
 		flushTicker := time.NewTicker(m.flushInterval)
@@ -82,7 +175,7 @@ func (m *Manager) Start() {
 				m.logErrorIfContains(m.taskManager.StartingWatchTask(), "check profiling task")
 				m.logErrorIfContains(m.continuousManager.CheckPolicies(), "check profiling policies")
 			case <-flushTicker.C:
-				m.logErrorIfContains(m.taskManager.FlushProfilingData(), "flush profiling task")
+				m.flushProfilingData()
 			case <-m.ctx.Done():
 				checkTicker.Stop()
 				return
@@ -91,6 +184,57 @@ func (m *Manager) Start() {
 	}()
 }
 
+// flushProfilingData in the background, so the large flush and the remote export would not block the checking,
+// skip the flush if the previous flush still running
+func (m *Manager) flushProfilingData() {
+	if !m.flushing.CompareAndSwap(false, true) {
+		log.Warnf("the previous profiling data flush is still running, skip this flush")
+		return
+	}
+	go func() {
+		defer m.flushing.Store(false)
+		m.logErrorIfContains(m.taskManager.FlushProfilingData(), "flush profiling task")
+	}()
+}
+
+// Processes detected by the agent
+func (m *Manager) Processes() []api.ProcessInterface {
+	return m.processOperator.GetAllProcesses()
+}
+
+// ActiveTasks of the profiling
+func (m *Manager) ActiveTasks() []*task.Status {
+	return m.taskManager.ActiveTasks()
+}
+
+// ContinuousPolicies which running
+func (m *Manager) ContinuousPolicies() []*continuous.PolicyStatus {
+	return m.continuousManager.Policies()
+}
+
+// RecentTriggers of the continuous profiling
+func (m *Manager) RecentTriggers() []*continuous.TriggerRecord {
+	return m.continuousManager.RecentTriggers()
+}
+
+// CreateLocalTask of the processes from the control API
+func (m *Manager) CreateLocalTask(pids []int32, targetType base.TargetType, duration time.Duration) (*task.Status, error) {
+	return m.taskManager.CreateLocalTask(pids, targetType, duration)
+}
+
+// CancelTask by the task ID from the control API
+func (m *Manager) CancelTask(taskID string) error {
+	return m.taskManager.CancelTask(taskID)
+}
+
+// SpoolStats of the data failed to send, nil when the spool is disabled
+func (m *Manager) SpoolStats() *sink.SpoolStats {
+	if m.spools == nil {
+		return nil
+	}
+	return m.spools.Stats()
+}
+
 func (m *Manager) logErrorIfContains(err error, t string) {
 	if err != nil {
 		log.Warnf("%s failure: %v", t, err)
@@ -98,12 +242,31 @@ func (m *Manager) logErrorIfContains(err error, t string) {
 }
 
 func (m *Manager) Shutdown() error {
+	if m.standalone != nil {
+		m.standalone.Stop()
+	}
 	if err := m.taskManager.Shutdown(); err != nil {
 		log.Warnf("task manager shutdown failure: %v", err)
 	}
 	if err := m.continuousManager.Shutdown(); err != nil {
 		log.Warnf("continuous profiling manager shutdown failure: %v", err)
 	}
+	if err := m.sink.Close(); err != nil {
+		log.Warnf("sink shutdown failure: %v", err)
+	}
+	// the running requests are not waited too long
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if m.debugServer != nil {
+		if err := m.debugServer.Shutdown(ctx); err != nil {
+			log.Warnf("debug server shutdown failure: %v", err)
+		}
+	}
+	if m.controlServer != nil {
+		if err := m.controlServer.Shutdown(ctx); err != nil {
+			log.Warnf("control API shutdown failure: %v", err)
+		}
+	}
 	m.cancel()
 	return nil
 }
@@ -26,6 +26,7 @@ import (
 	"perfprofiler/pkg/logger"
 	"perfprofiler/pkg/module"
 	"perfprofiler/pkg/process"
+	profiling_tool "perfprofiler/pkg/tools/profiling"
 )
 
 const ModuleName = "profiling"
@@ -62,6 +63,11 @@ func (m *Module) Start(ctx context.Context, mgr *module.Manager) error {
 	if err := m.config.TaskConfig.Validate(); err != nil {
 		return err
 	}
+	symbolNameStyle, err := profiling_tool.ParseSymbolNameStyle(m.config.SymbolNaming)
+	if err != nil {
+		return err
+	}
+	profiling_tool.SetSymbolNameStyle(symbolNameStyle)
 
 	manager, err := NewManager(ctx, mgr, m.config)
 	if err != nil {
@@ -0,0 +1,141 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package profile
+
+import (
+	"fmt"
+	"time"
+
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/tools/profiling"
+)
+
+// Type of the profile
+type Type string
+
+const (
+	TypeOnCPU  Type = "on_cpu"
+	TypeOffCPU Type = "off_cpu"
+)
+
+// Profile is the stacks of a profiling task in a flush period, with the raw addresses and modules of the process,
+// works for exporting the profiling data to the other formats
+type Profile struct {
+	TaskID string
+	Type   Type
+	Pid    int32
+	// Entity of the process, such as the service and instance
+	Entity *api.ProcessEntity
+	// the collected time range of the profile
+	StartTime time.Time
+	EndTime   time.Time
+	// the sampling period in nanoseconds, only exists in on-cpu profiling
+	Period int64
+	// the modules of the process, the kernel is not included
+	Modules []*profiling.Module
+	Samples []*Sample
+}
+
+// Sample is a stack with the values
+type Sample struct {
+	// Locations from the leaf to the root, the kernel locations are before the user space locations
+	Locations []*Location
+	// Count of sampled(on-cpu) or switched(off-cpu) times
+	Count int64
+	// Duration in nanoseconds of the stack, on-cpu is calculated by the period
+	Duration int64
+	// Timestamps of each sampled event, only exists when the runner records the time of samples
+	Timestamps []time.Time
+}
+
+// Location is an address in the stack
+type Location struct {
+	Address uint64
+	Kernel  bool
+	// Frames of the address, from the innermost(inlined) function to the outermost function,
+	// the name of frame is MissingSymbol when the address could not be symbolized
+	Frames []*profiling.Frame
+}
+
+// MissingSymbol is the name of the address which could not be symbolized
+const MissingSymbol = "[MISSING]"
+
+// FunctionNames of the sample from the leaf to the root, the inlined functions are expanded
+func (s *Sample) FunctionNames() []string {
+	result := make([]string, 0, len(s.Locations))
+	for _, l := range s.Locations {
+		for _, f := range l.Frames {
+			result = append(result, f.Name)
+		}
+	}
+	return result
+}
+
+// FindModule which contains the address, return nil if not found
+func (p *Profile) FindModule(address uint64) *profiling.Module {
+	for _, m := range p.Modules {
+		for _, r := range m.Ranges {
+			if address >= r.StartAddr && address < r.EndAddr {
+				return m
+			}
+		}
+	}
+	return nil
+}
+
+// Merge the profiles with the same type into one profile, such as the profiles of a service over a time range.
+// The task and pid are kept when all profiles are the same, otherwise they are cleared.
+func Merge(profiles []*Profile) (*Profile, error) {
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("no profiles to merge")
+	}
+	first := profiles[0]
+	result := &Profile{
+		TaskID:    first.TaskID,
+		Type:      first.Type,
+		Pid:       first.Pid,
+		Entity:    first.Entity,
+		StartTime: first.StartTime,
+		EndTime:   first.EndTime,
+		Period:    first.Period,
+		Modules:   first.Modules,
+	}
+	for _, p := range profiles {
+		if p.Type != result.Type {
+			return nil, fmt.Errorf("could not merge the %s profile with the %s profile", p.Type, result.Type)
+		}
+		if p.TaskID != result.TaskID {
+			result.TaskID = ""
+		}
+		if p.Pid != result.Pid {
+			result.Pid, result.Modules = 0, nil
+		}
+		if p.Entity != result.Entity && (p.Entity == nil || result.Entity == nil ||
+			p.Entity.ServiceName != result.Entity.ServiceName || p.Entity.InstanceName != result.Entity.InstanceName) {
+			result.Entity = nil
+		}
+		if p.StartTime.Before(result.StartTime) {
+			result.StartTime = p.StartTime
+		}
+		if p.EndTime.After(result.EndTime) {
+			result.EndTime = p.EndTime
+		}
+		result.Samples = append(result.Samples, p.Samples...)
+	}
+	return result, nil
+}
@@ -0,0 +1,132 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sink
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"perfprofiler/pkg/profiling/profile"
+
+	"github.com/hashicorp/go-multierror"
+
+	profiling_v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
+	meter_v3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+// FanOut sends the data to all the sinks, the data is dropped when there have no sinks
+type FanOut struct {
+	sinks []Sink
+}
+
+func NewFanOut(sinks ...Sink) *FanOut {
+	return &FanOut{sinks: sinks}
+}
+
+func (f *FanOut) Name() string {
+	if len(f.sinks) == 0 {
+		return TypeNone
+	}
+	names := make([]string, 0, len(f.sinks))
+	for _, s := range f.sinks {
+		names = append(names, s.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+// SendProfilingData to all the sinks, the failure of a sink does not affect the others
+func (f *FanOut) SendProfilingData(ctx context.Context, data []*profiling_v3.EBPFProfilingData) error {
+	var result error
+	for _, s := range f.sinks {
+		if err := s.SendProfilingData(ctx, data); err != nil {
+			result = multierror.Append(result, fmt.Errorf("%s sink: %v", s.Name(), err))
+		}
+	}
+	return result
+}
+
+// SendProfiles to all the sinks, the failure of a sink does not affect the others
+func (f *FanOut) SendProfiles(ctx context.Context, profiles []*profile.Profile) error {
+	var result error
+	for _, s := range f.sinks {
+		if err := s.SendProfiles(ctx, profiles); err != nil {
+			result = multierror.Append(result, fmt.Errorf("%s sink: %v", s.Name(), err))
+		}
+	}
+	return result
+}
+
+// ReportProfilingTask to all the sinks, the task ID issued by the SkyWalking backend is preferred whatever the order,
+// otherwise the task ID of the first success sink is used
+func (f *FanOut) ReportProfilingTask(ctx context.Context, report *profiling_v3.ContinuousProfilingReport) (string, error) {
+	if len(f.sinks) == 0 {
+		return "", fmt.Errorf("no sink to report the profiling task")
+	}
+	var taskID, backendTaskID string
+	var backendErr, result error
+	hasBackend := false
+	for _, s := range f.sinks {
+		id, err := s.ReportProfilingTask(ctx, report)
+		if s.Name() == TypeSkyWalking {
+			hasBackend = true
+			backendTaskID, backendErr = id, err
+		}
+		if err != nil {
+			result = multierror.Append(result, fmt.Errorf("%s sink: %v", s.Name(), err))
+			continue
+		}
+		if taskID == "" {
+			taskID = id
+		}
+	}
+	// the data sent under the other task ID would never be received by the backend task
+	if hasBackend {
+		if backendErr != nil {
+			return "", result
+		}
+		taskID = backendTaskID
+	}
+	if taskID == "" {
+		return "", result
+	}
+	if result != nil {
+		log.Warnf("report the profiling task %s partially failure: %v", taskID, result)
+	}
+	return taskID, nil
+}
+
+func (f *FanOut) SendMeters(ctx context.Context, meters []*meter_v3.MeterDataCollection) error {
+	var result error
+	for _, s := range f.sinks {
+		if err := s.SendMeters(ctx, meters); err != nil {
+			result = multierror.Append(result, fmt.Errorf("%s sink: %v", s.Name(), err))
+		}
+	}
+	return result
+}
+
+func (f *FanOut) Close() error {
+	var result error
+	for _, s := range f.sinks {
+		if err := s.Close(); err != nil {
+			result = multierror.Append(result, fmt.Errorf("closing the %s sink failure: %v", s.Name(), err))
+		}
+	}
+	return result
+}
@@ -0,0 +1,61 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sink
+
+import (
+	"context"
+
+	"perfprofiler/pkg/profiling/profile"
+
+	"github.com/google/uuid"
+
+	profiling_v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
+	meter_v3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+// None drops the data, the continuous profiling tasks are given the local generated task ID,
+// so the triggered tasks still run and export the profiles locally
+type None struct{}
+
+func NewNone() *None {
+	return &None{}
+}
+
+func (n *None) Name() string {
+	return TypeNone
+}
+
+func (n *None) SendProfilingData(ctx context.Context, data []*profiling_v3.EBPFProfilingData) error {
+	return nil
+}
+
+func (n *None) SendProfiles(ctx context.Context, profiles []*profile.Profile) error {
+	return nil
+}
+
+func (n *None) ReportProfilingTask(ctx context.Context, report *profiling_v3.ContinuousProfilingReport) (string, error) {
+	return uuid.New().String(), nil
+}
+
+func (n *None) SendMeters(ctx context.Context, meters []*meter_v3.MeterDataCollection) error {
+	return nil
+}
+
+func (n *None) Close() error {
+	return nil
+}
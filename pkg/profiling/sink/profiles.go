@@ -0,0 +1,101 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sink
+
+import (
+	"context"
+	"fmt"
+
+	"perfprofiler/pkg/profiling/profile"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/go-multierror"
+
+	profiling_v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
+	meter_v3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+// ProfileWriter writes the profile to the local file, returns the written file path
+type ProfileWriter interface {
+	Write(p *profile.Profile) (string, error)
+}
+
+// ProfileExporter sends the profiles to the remote service
+type ProfileExporter interface {
+	Export(ctx context.Context, profiles []*profile.Profile) error
+	Close() error
+}
+
+// Profiles only accepts the symbolized profiles, the profiling data and the meters are ignored,
+// the continuous profiling tasks are given the local generated task ID
+type Profiles struct {
+	name   string
+	send   func(ctx context.Context, profiles []*profile.Profile) error
+	closer func() error
+}
+
+// NewProfileFiles writes each profile to the local files by the writer
+func NewProfileFiles(name string, writer ProfileWriter) *Profiles {
+	return &Profiles{name: name, send: func(ctx context.Context, profiles []*profile.Profile) error {
+		var result error
+		for _, p := range profiles {
+			path, err := writer.Write(p)
+			if err != nil {
+				result = multierror.Append(result, fmt.Errorf("writing the profile of task %s failure: %v", p.TaskID, err))
+				continue
+			}
+			log.Debugf("the profile of task %s has been written: %s", p.TaskID, path)
+		}
+		return result
+	}}
+}
+
+// NewProfileExporter sends the profiles of each flush to the remote service by the exporter
+func NewProfileExporter(name string, exporter ProfileExporter) *Profiles {
+	return &Profiles{name: name, send: exporter.Export, closer: exporter.Close}
+}
+
+func (p *Profiles) Name() string {
+	return p.name
+}
+
+func (p *Profiles) SendProfilingData(ctx context.Context, data []*profiling_v3.EBPFProfilingData) error {
+	return nil
+}
+
+func (p *Profiles) SendProfiles(ctx context.Context, profiles []*profile.Profile) error {
+	if len(profiles) == 0 {
+		return nil
+	}
+	return p.send(ctx, profiles)
+}
+
+func (p *Profiles) ReportProfilingTask(ctx context.Context, report *profiling_v3.ContinuousProfilingReport) (string, error) {
+	return uuid.New().String(), nil
+}
+
+func (p *Profiles) SendMeters(ctx context.Context, meters []*meter_v3.MeterDataCollection) error {
+	return nil
+}
+
+func (p *Profiles) Close() error {
+	if p.closer == nil {
+		return nil
+	}
+	return p.closer()
+}
@@ -0,0 +1,186 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sink
+
+import (
+	"context"
+	"fmt"
+
+	"perfprofiler/pkg/logger"
+	"perfprofiler/pkg/profiling/export/flamegraph"
+	"perfprofiler/pkg/profiling/export/otlp"
+	"perfprofiler/pkg/profiling/export/pprof"
+	"perfprofiler/pkg/profiling/export/pyroscope"
+	"perfprofiler/pkg/profiling/export/speedscope"
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/profiling/store"
+
+	"google.golang.org/grpc"
+
+	profiling_v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
+	meter_v3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+var log = logger.GetLogger("profiling", "sink")
+
+const (
+	TypeSkyWalking = "skywalking"
+	TypeFile       = "file"
+	TypeStdout     = "stdout"
+	TypeNone       = "none"
+	TypePprof      = "pprof"
+	TypeFlameGraph = "flame_graph"
+	TypeSpeedscope = "speedscope"
+	TypeStore      = "store"
+	TypeOTLP       = "otlp"
+	TypePyroscope  = "pyroscope"
+)
+
+// Sink is the destination of the profiling data, the continuous profiling task reports and the meters
+type Sink interface {
+	// Name of the sink in the logs
+	Name() string
+	// SendProfilingData flushed in one period, only the first data of each task have the task metadata
+	SendProfilingData(ctx context.Context, data []*profiling_v3.EBPFProfilingData) error
+	// SendProfiles flushed in one period with the symbolized stacks, ignored by the sinks of the profiling data
+	SendProfiles(ctx context.Context, profiles []*profile.Profile) error
+	// ReportProfilingTask triggered by the continuous profiling, returns the task ID
+	ReportProfilingTask(ctx context.Context, report *profiling_v3.ContinuousProfilingReport) (string, error)
+	// SendMeters of the continuous profiling checkers
+	SendMeters(ctx context.Context, meters []*meter_v3.MeterDataCollection) error
+	Close() error
+}
+
+type Config struct {
+	// The type of sink, "skywalking", "file", "stdout", "none", "pprof", "flame_graph", "speedscope", "store", "otlp" or "pyroscope"
+	Type        string            `mapstructure:"type"`
+	Path        string            `mapstructure:"path"`         // The file path of the "file" sink, or the directory of the "pprof", "flame_graph" and "speedscope" sinks
+	KernelColor bool              `mapstructure:"kernel_color"` // Color the kernel frames differently in the "flame_graph" sink
+	Store       *store.Config     `mapstructure:"store"`        // The local profile store with the retention limits of the "store" sink
+	OTLP        *otlp.Config      `mapstructure:"otlp"`         // The OTLP endpoint of the "otlp" sink, unstable proto
+	Pyroscope   *pyroscope.Config `mapstructure:"pyroscope"`    // The Pyroscope ingest endpoint of the "pyroscope" sink, only the on-cpu profiles are pushed
+}
+
+// NewSink builds the sink from the configs, multiple sinks are fan-out, the backend connection is used by the skywalking sink,
+// the remote sinks are wrapped by the spools when it is not nil
+func NewSink(configs []*Config, backend grpc.ClientConnInterface, spools *Spools) (Sink, error) {
+	sinks := make([]Sink, 0, len(configs))
+	for _, c := range configs {
+		s, err := newSink(c, backend, spools)
+		if err != nil {
+			for _, created := range sinks {
+				_ = created.Close()
+			}
+			return nil, err
+		}
+		sinks = append(sinks, s)
+	}
+	switch len(sinks) {
+	case 0:
+		return NewNone(), nil
+	case 1:
+		return sinks[0], nil
+	}
+	return NewFanOut(sinks...), nil
+}
+
+// WithoutBackend excludes the skywalking sinks, for the data which is unknown by the backend,
+// the returned sink shares the sinks with the original one, so it should not be closed
+func WithoutBackend(s Sink) Sink {
+	if f, ok := s.(*FanOut); ok {
+		sinks := make([]Sink, 0, len(f.sinks))
+		for _, delegate := range f.sinks {
+			if delegate.Name() != TypeSkyWalking {
+				sinks = append(sinks, delegate)
+			}
+		}
+		return NewFanOut(sinks...)
+	}
+	if s.Name() == TypeSkyWalking {
+		return NewNone()
+	}
+	return s
+}
+
+func newSink(config *Config, backend grpc.ClientConnInterface, spools *Spools) (Sink, error) {
+	switch config.Type {
+	case TypeSkyWalking:
+		if backend == nil {
+			return nil, fmt.Errorf("the skywalking sink requires the backend connection")
+		}
+		return spools.Wrap(NewSkyWalking(backend))
+	case TypeOTLP:
+		if config.OTLP == nil || config.OTLP.Endpoint == "" {
+			return nil, fmt.Errorf("the otlp sink endpoint must be set")
+		}
+		exporter, err := otlp.NewExporter(config.OTLP)
+		if err != nil {
+			return nil, err
+		}
+		return spools.Wrap(NewProfileExporter(TypeOTLP, exporter))
+	case TypePyroscope:
+		if config.Pyroscope == nil || config.Pyroscope.Endpoint == "" {
+			return nil, fmt.Errorf("the pyroscope sink endpoint must be set")
+		}
+		exporter, err := pyroscope.NewExporter(config.Pyroscope)
+		if err != nil {
+			return nil, err
+		}
+		return spools.Wrap(NewProfileExporter(TypePyroscope, exporter))
+	case TypePprof, TypeFlameGraph, TypeSpeedscope:
+		if config.Path == "" {
+			return nil, fmt.Errorf("the %s sink path must be set", config.Type)
+		}
+		writer, err := newProfileWriter(config)
+		if err != nil {
+			return nil, err
+		}
+		return NewProfileFiles(config.Type, writer), nil
+	case TypeStore:
+		if config.Store == nil || config.Store.Directory == "" {
+			return nil, fmt.Errorf("the store sink directory must be set")
+		}
+		s, err := store.NewStore(config.Store)
+		if err != nil {
+			return nil, err
+		}
+		return NewProfileFiles(TypeStore, s), nil
+	case TypeFile:
+		if config.Path == "" {
+			return nil, fmt.Errorf("the file sink path must be set")
+		}
+		return NewFile(config.Path)
+	case TypeStdout:
+		return NewStdout(), nil
+	case TypeNone:
+		return NewNone(), nil
+	default:
+		return nil, fmt.Errorf("unknown sink type: %s", config.Type)
+	}
+}
+
+func newProfileWriter(config *Config) (ProfileWriter, error) {
+	switch config.Type {
+	case TypePprof:
+		return pprof.NewWriter(config.Path)
+	case TypeFlameGraph:
+		return flamegraph.NewWriter(config.Path, &flamegraph.Options{ColorKernel: config.KernelColor})
+	default:
+		return speedscope.NewWriter(config.Path)
+	}
+}
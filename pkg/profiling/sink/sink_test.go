@@ -0,0 +1,353 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"perfprofiler/pkg/profiling/export/otlp"
+	"perfprofiler/pkg/profiling/export/pyroscope"
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/profiling/store"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	commonv3 "skywalking.apache.org/repo/goapi/collect/common/v3"
+	profiling_v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
+	meter_v3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+func TestNewSink(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.jsonl")
+	tests := []struct {
+		name     string
+		configs  []*Config
+		backend  grpc.ClientConnInterface
+		wantName string
+		wantErr  bool
+	}{
+		{name: "none", configs: []*Config{{Type: TypeNone}}, wantName: "none"},
+		{name: "empty", configs: nil, wantName: "none"},
+		{name: "file", configs: []*Config{{Type: TypeFile, Path: path}}, wantName: "file"},
+		{name: "fan-out", configs: []*Config{{Type: TypeFile, Path: path}, {Type: TypeStdout}}, wantName: "file,stdout"},
+		{name: "file without path", configs: []*Config{{Type: TypeFile}}, wantErr: true},
+		{name: "skywalking without backend", configs: []*Config{{Type: TypeSkyWalking}}, wantErr: true},
+		{name: "unknown", configs: []*Config{{Type: TypeStdout}, {Type: "kafka"}}, wantErr: true},
+		{name: "profile files", configs: []*Config{{Type: TypePprof, Path: dir}, {Type: TypeFlameGraph, Path: dir},
+			{Type: TypeSpeedscope, Path: dir}}, wantName: "pprof,flame_graph,speedscope"},
+		{name: "pprof without path", configs: []*Config{{Type: TypePprof}}, wantErr: true},
+		{name: "store", configs: []*Config{{Type: TypeStore, Store: &store.Config{Directory: dir}}}, wantName: "store"},
+		{name: "store without directory", configs: []*Config{{Type: TypeStore}}, wantErr: true},
+		{name: "otlp", configs: []*Config{{Type: TypeOTLP, OTLP: &otlp.Config{Endpoint: "127.0.0.1:4317"}}}, wantName: "otlp"},
+		{name: "otlp without endpoint", configs: []*Config{{Type: TypeOTLP}}, wantErr: true},
+		{name: "pyroscope", configs: []*Config{{Type: TypePyroscope,
+			Pyroscope: &pyroscope.Config{Endpoint: "http://127.0.0.1:4040"}}}, wantName: "pyroscope"},
+		{name: "pyroscope with illegal endpoint", configs: []*Config{{Type: TypePyroscope,
+			Pyroscope: &pyroscope.Config{Endpoint: "pyroscope"}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewSink(tt.configs, tt.backend, nil)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantName, s.Name())
+			assert.NoError(t, s.Close())
+		})
+	}
+}
+
+func testProfilingData() []*profiling_v3.EBPFProfilingData {
+	return []*profiling_v3.EBPFProfilingData{{
+		Task: &profiling_v3.EBPFProfilingTaskMetadata{TaskId: "task", ProcessId: "process"},
+		Profiling: &profiling_v3.EBPFProfilingData_OnCPU{OnCPU: &profiling_v3.EBPFOnCPUProfiling{
+			Stacks: []*profiling_v3.EBPFProfilingStackMetadata{{StackSymbols: []string{"main"}}}, DumpCount: 2}},
+	}}
+}
+
+func TestWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter("test", buf)
+	ctx := context.Background()
+	assert.NoError(t, w.SendProfilingData(ctx, testProfilingData()))
+	taskID, err := w.ReportProfilingTask(ctx, &profiling_v3.ContinuousProfilingReport{ServiceName: "svc"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, taskID)
+	assert.NoError(t, w.SendMeters(ctx, []*meter_v3.MeterDataCollection{{MeterData: []*meter_v3.MeterData{{Service: "svc"}}}}))
+	assert.NoError(t, w.SendMeters(ctx, nil))
+
+	records := make([]*Record, 0)
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		r := &Record{}
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), r))
+		records = append(records, r)
+	}
+	assert.Len(t, records, 3)
+	assert.Equal(t, RecordProfilingData, records[0].Type)
+	assert.Contains(t, string(records[0].Data), `"dumpCount":2`)
+	assert.Equal(t, RecordProfilingTask, records[1].Type)
+	assert.Equal(t, taskID, records[1].TaskID)
+	assert.Contains(t, string(records[1].Data), `"serviceName":"svc"`)
+	assert.Equal(t, RecordMeters, records[2].Type)
+
+	path := filepath.Join(t.TempDir(), "data.jsonl")
+	for i := 0; i < 2; i++ {
+		f, err := NewFile(path)
+		assert.NoError(t, err)
+		assert.NoError(t, f.SendProfilingData(ctx, testProfilingData()))
+		assert.NoError(t, f.Close())
+	}
+	content, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, bytes.Count(content, []byte("\n")))
+}
+
+type fakeSink struct {
+	name     string
+	taskID   string
+	err      error
+	data     int
+	profiles int
+}
+
+func (f *fakeSink) Name() string {
+	return f.name
+}
+
+func (f *fakeSink) SendProfilingData(ctx context.Context, data []*profiling_v3.EBPFProfilingData) error {
+	f.data += len(data)
+	return f.err
+}
+
+func (f *fakeSink) SendProfiles(ctx context.Context, profiles []*profile.Profile) error {
+	f.profiles += len(profiles)
+	return f.err
+}
+
+func (f *fakeSink) ReportProfilingTask(ctx context.Context, report *profiling_v3.ContinuousProfilingReport) (string, error) {
+	return f.taskID, f.err
+}
+
+func (f *fakeSink) SendMeters(ctx context.Context, meters []*meter_v3.MeterDataCollection) error {
+	return f.err
+}
+
+func (f *fakeSink) Close() error {
+	return f.err
+}
+
+func TestFanOut(t *testing.T) {
+	ctx := context.Background()
+	failed := &fakeSink{name: "failed", err: fmt.Errorf("unavailable")}
+	first := &fakeSink{name: "first", taskID: "1"}
+	second := &fakeSink{name: "second", taskID: "2"}
+	f := NewFanOut(failed, first, second)
+
+	err := f.SendProfilingData(ctx, testProfilingData())
+	assert.ErrorContains(t, err, "failed sink: unavailable")
+	assert.Equal(t, 1, first.data)
+	assert.Equal(t, 1, second.data)
+	err = f.SendProfiles(ctx, []*profile.Profile{testSinkProfile()})
+	assert.ErrorContains(t, err, "failed sink: unavailable")
+	assert.Equal(t, 1, first.profiles)
+	assert.Equal(t, 1, second.profiles)
+	taskID, err := f.ReportProfilingTask(ctx, &profiling_v3.ContinuousProfilingReport{})
+	assert.NoError(t, err)
+	assert.Equal(t, "1", taskID)
+	assert.Error(t, f.Close())
+
+	_, err = NewFanOut(failed).ReportProfilingTask(ctx, &profiling_v3.ContinuousProfilingReport{})
+	assert.Error(t, err)
+	_, err = NewFanOut().ReportProfilingTask(ctx, &profiling_v3.ContinuousProfilingReport{})
+	assert.Error(t, err)
+
+	// the task ID of the backend is used whatever the order
+	backend := &fakeSink{name: TypeSkyWalking, taskID: "backend"}
+	taskID, err = NewFanOut(first, backend).ReportProfilingTask(ctx, &profiling_v3.ContinuousProfilingReport{})
+	assert.NoError(t, err)
+	assert.Equal(t, "backend", taskID)
+	backend.err = fmt.Errorf("unavailable")
+	_, err = NewFanOut(first, backend).ReportProfilingTask(ctx, &profiling_v3.ContinuousProfilingReport{})
+	assert.ErrorContains(t, err, "skywalking sink: unavailable")
+}
+
+func TestWithoutBackend(t *testing.T) {
+	ctx := context.Background()
+	backend := &fakeSink{name: TypeSkyWalking}
+	file := &fakeSink{name: TypeFile}
+	tests := []struct {
+		name     string
+		sink     Sink
+		wantName string
+	}{
+		{name: "skywalking", sink: backend, wantName: TypeNone},
+		{name: "file", sink: file, wantName: TypeFile},
+		{name: "fan-out", sink: NewFanOut(backend, file), wantName: TypeFile},
+		{name: "fan-out of skywalking", sink: NewFanOut(backend), wantName: TypeNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backend.data, file.data = 0, 0
+			s := WithoutBackend(tt.sink)
+			assert.Equal(t, tt.wantName, s.Name())
+			assert.NoError(t, s.SendProfilingData(ctx, testProfilingData()))
+			assert.Equal(t, 0, backend.data)
+		})
+	}
+}
+
+type fakeExporter struct {
+	profiles []*profile.Profile
+	closed   bool
+}
+
+func (f *fakeExporter) Export(ctx context.Context, profiles []*profile.Profile) error {
+	f.profiles = append(f.profiles, profiles...)
+	return nil
+}
+
+func (f *fakeExporter) Close() error {
+	f.closed = true
+	return nil
+}
+
+func TestProfiles(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	s, err := NewSink([]*Config{{Type: TypePprof, Path: dir}}, nil, nil)
+	assert.NoError(t, err)
+	// only the profiles are written
+	assert.NoError(t, s.SendProfilingData(ctx, testProfilingData()))
+	assert.NoError(t, s.SendMeters(ctx, []*meter_v3.MeterDataCollection{{}}))
+	assert.NoError(t, s.SendProfiles(ctx, []*profile.Profile{testSinkProfile()}))
+	entries, err := os.ReadDir(filepath.Join(dir, "task"))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	taskID, err := s.ReportProfilingTask(ctx, &profiling_v3.ContinuousProfilingReport{})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, taskID)
+	assert.NoError(t, s.Close())
+
+	exporter := &fakeExporter{}
+	remote := NewProfileExporter(TypeOTLP, exporter)
+	assert.NoError(t, remote.SendProfiles(ctx, nil))
+	assert.NoError(t, remote.SendProfiles(ctx, []*profile.Profile{testSinkProfile()}))
+	assert.Len(t, exporter.profiles, 1)
+	assert.NoError(t, remote.Close())
+	assert.True(t, exporter.closed)
+}
+
+func TestNone(t *testing.T) {
+	ctx := context.Background()
+	none := NewNone()
+	assert.NoError(t, none.SendProfilingData(ctx, testProfilingData()))
+	assert.NoError(t, none.SendMeters(ctx, []*meter_v3.MeterDataCollection{{}}))
+	// the triggered task still runs with the local task ID
+	taskID, err := none.ReportProfilingTask(ctx, &profiling_v3.ContinuousProfilingReport{})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, taskID)
+}
+
+type fakeBackend struct {
+	profiling_v3.UnimplementedEBPFProfilingServiceServer
+	profiling_v3.UnimplementedContinuousProfilingServiceServer
+	meter_v3.UnimplementedMeterReportServiceServer
+
+	data   []*profiling_v3.EBPFProfilingData
+	meters []*meter_v3.MeterDataCollection
+}
+
+func (b *fakeBackend) CollectProfilingData(stream profiling_v3.EBPFProfilingService_CollectProfilingDataServer) error {
+	for {
+		data, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&commonv3.Commands{})
+		} else if err != nil {
+			return err
+		}
+		b.data = append(b.data, data)
+	}
+}
+
+func (b *fakeBackend) ReportProfilingTask(ctx context.Context,
+	report *profiling_v3.ContinuousProfilingReport) (*commonv3.Commands, error) {
+	if report.ServiceName == "" {
+		return &commonv3.Commands{}, nil
+	}
+	return &commonv3.Commands{Commands: []*commonv3.Command{{Command: "ContinuousProfilingReportTask",
+		Args: []*commonv3.KeyStringValuePair{{Key: "TaskId", Value: "task-" + report.ServiceName}}}}}, nil
+}
+
+func (b *fakeBackend) CollectBatch(stream meter_v3.MeterReportService_CollectBatchServer) error {
+	for {
+		collection, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&commonv3.Commands{})
+		} else if err != nil {
+			return err
+		}
+		b.meters = append(b.meters, collection)
+	}
+}
+
+func TestSkyWalking(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := grpc.NewServer()
+	backend := &fakeBackend{}
+	profiling_v3.RegisterEBPFProfilingServiceServer(server, backend)
+	profiling_v3.RegisterContinuousProfilingServiceServer(server, backend)
+	meter_v3.RegisterMeterReportServiceServer(server, backend)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer server.Stop()
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	s, err := NewSink([]*Config{{Type: TypeSkyWalking}}, conn, nil)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	assert.NoError(t, s.SendProfilingData(ctx, testProfilingData()))
+	assert.NoError(t, s.SendMeters(ctx, []*meter_v3.MeterDataCollection{{}, {}}))
+	taskID, err := s.ReportProfilingTask(ctx, &profiling_v3.ContinuousProfilingReport{ServiceName: "svc"})
+	assert.NoError(t, err)
+	assert.Equal(t, "task-svc", taskID)
+	_, err = s.ReportProfilingTask(ctx, &profiling_v3.ContinuousProfilingReport{})
+	assert.Error(t, err)
+
+	assert.Len(t, backend.data, 1)
+	assert.Equal(t, "task", backend.data[0].Task.TaskId)
+	assert.Len(t, backend.meters, 2)
+}
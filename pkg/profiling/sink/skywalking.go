@@ -0,0 +1,111 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sink
+
+import (
+	"context"
+	"fmt"
+
+	"perfprofiler/pkg/profiling/profile"
+
+	"google.golang.org/grpc"
+
+	profiling_v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
+	meter_v3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+// SkyWalking sends the data to the SkyWalking backend
+type SkyWalking struct {
+	profilingClient  profiling_v3.EBPFProfilingServiceClient
+	continuousClient profiling_v3.ContinuousProfilingServiceClient
+	meterClient      meter_v3.MeterReportServiceClient
+}
+
+func NewSkyWalking(conn grpc.ClientConnInterface) *SkyWalking {
+	return &SkyWalking{
+		profilingClient:  profiling_v3.NewEBPFProfilingServiceClient(conn),
+		continuousClient: profiling_v3.NewContinuousProfilingServiceClient(conn),
+		meterClient:      meter_v3.NewMeterReportServiceClient(conn),
+	}
+}
+
+func (s *SkyWalking) Name() string {
+	return TypeSkyWalking
+}
+
+func (s *SkyWalking) SendProfilingData(ctx context.Context, data []*profiling_v3.EBPFProfilingData) error {
+	if len(data) == 0 {
+		return nil
+	}
+	stream, err := s.profilingClient.CollectProfilingData(ctx)
+	if err != nil {
+		return err
+	}
+	for _, d := range data {
+		// stop sending if the stream have found error
+		if err := stream.Send(d); err != nil {
+			return err
+		}
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+// SendProfiles is ignored, the backend symbolizes the stacks of the profiling data
+func (s *SkyWalking) SendProfiles(ctx context.Context, profiles []*profile.Profile) error {
+	return nil
+}
+
+func (s *SkyWalking) ReportProfilingTask(ctx context.Context, report *profiling_v3.ContinuousProfilingReport) (string, error) {
+	profilingTask, err := s.continuousClient.ReportProfilingTask(ctx, report)
+	if err != nil {
+		return "", err
+	}
+	if len(profilingTask.Commands) != 1 || profilingTask.Commands[0].GetCommand() != "ContinuousProfilingReportTask" {
+		return "", fmt.Errorf("the profiling task result is not right, command count: %d", len(profilingTask.Commands))
+	}
+	for _, kv := range profilingTask.Commands[0].GetArgs() {
+		if kv.GetKey() == "TaskId" {
+			return kv.GetValue(), nil
+		}
+	}
+	return "", fmt.Errorf("could not found the task ID from repoter")
+}
+
+func (s *SkyWalking) SendMeters(ctx context.Context, meters []*meter_v3.MeterDataCollection) error {
+	if len(meters) == 0 {
+		return nil
+	}
+	batch, err := s.meterClient.CollectBatch(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range meters {
+		if err := batch.Send(m); err != nil {
+			_, _ = batch.CloseAndRecv()
+			return err
+		}
+	}
+	_, err = batch.CloseAndRecv()
+	return err
+}
+
+func (s *SkyWalking) Close() error {
+	// the connection is owned by the core module
+	return nil
+}
@@ -0,0 +1,578 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sink
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"perfprofiler/pkg/core/backend"
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/export/pprof"
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/profiling/store"
+
+	"google.golang.org/protobuf/proto"
+
+	profiling_v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
+	meter_v3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+const (
+	defaultSpoolMaxSize          = "256MB"
+	defaultSpoolMaxAge           = "24h"
+	defaultSpoolRetryInterval    = "5s"
+	defaultSpoolMaxRetryInterval = "5m"
+
+	spoolKindData    = "data"
+	spoolKindMeter   = "meter"
+	spoolKindProfile = "profile"
+)
+
+// errBrokenSpoolFile means the spooled file could not be read, it would never be sent
+var errBrokenSpoolFile = errors.New("the spool file is broken")
+
+type SpoolConfig struct {
+	Directory        string `mapstructure:"directory"`          // The directory of the unsent data of the remote sinks, each sink has its own sub directory, disabled when empty
+	MaxSize          string `mapstructure:"max_size"`           // The max total size of the unsent data, the oldest is dropped when exceed, default is 256MB
+	MaxAge           string `mapstructure:"max_age"`            // The max age of the unsent data, the older is dropped, default is 24h
+	RetryInterval    string `mapstructure:"retry_interval"`     // The first retry interval after the failure, default is 5s
+	MaxRetryInterval string `mapstructure:"max_retry_interval"` // The max retry interval of the exponential backoff, default is 5m
+}
+
+// SpoolStats is the depth and counters of the spool
+type SpoolStats struct {
+	Files   int   `json:"files"`
+	Items   int   `json:"items"`
+	Bytes   int64 `json:"bytes"`
+	Spooled int64 `json:"spooled"`
+	Resent  int64 `json:"resent"`
+	Dropped int64 `json:"dropped"`
+}
+
+// spoolFile is a batch of unsent data, the name is "<unix nano>-<item count>.<kind>"
+type spoolFile struct {
+	path  string
+	kind  string
+	time  time.Time
+	items int
+	size  int64
+}
+
+// Spools keeps the unsent data of each remote sink by its own spool
+type Spools struct {
+	config   *SpoolConfig
+	statuses <-chan backend.ConnectionStatus
+	spools   []*Spool
+}
+
+// NewSpools of the remote sinks, the backend connection statuses only work for the skywalking sink, could be nil
+func NewSpools(config *SpoolConfig, statuses <-chan backend.ConnectionStatus) *Spools {
+	return &Spools{config: config, statuses: statuses}
+}
+
+// Wrap the remote sink by the spool in the sub directory of the sink name, return the sink directly when the spools is nil
+func (s *Spools) Wrap(delegate Sink) (Sink, error) {
+	if s == nil {
+		return delegate, nil
+	}
+	config := *s.config
+	config.Directory = filepath.Join(s.config.Directory, delegate.Name())
+	var statuses <-chan backend.ConnectionStatus
+	if delegate.Name() == TypeSkyWalking {
+		statuses = s.statuses
+	}
+	spool, err := NewSpool(&config, statuses)
+	if err != nil {
+		_ = delegate.Close()
+		return nil, err
+	}
+	s.spools = append(s.spools, spool)
+	return spool.Wrap(delegate), nil
+}
+
+// Start resending of all the spools in the background
+func (s *Spools) Start(ctx context.Context) {
+	for _, spool := range s.spools {
+		spool.Start(ctx)
+	}
+}
+
+// Stats of the unsent data of all the spools
+func (s *Spools) Stats() *SpoolStats {
+	result := &SpoolStats{}
+	for _, spool := range s.spools {
+		stats := spool.Stats()
+		result.Files += stats.Files
+		result.Items += stats.Items
+		result.Bytes += stats.Bytes
+		result.Spooled += stats.Spooled
+		result.Resent += stats.Resent
+		result.Dropped += stats.Dropped
+	}
+	return result
+}
+
+// Spool keeps the data which failed to send on the disk, and resend them with the exponential backoff,
+// the retry is started immediately when the backend is reconnected
+type Spool struct {
+	directory                       string
+	maxSize                         int64
+	maxAge                          time.Duration
+	retryInterval, maxRetryInterval time.Duration
+	statuses                        <-chan backend.ConnectionStatus
+	delegate                        Sink
+
+	lock    sync.Mutex
+	seq     int64
+	files   []*spoolFile
+	spooled int64
+	resent  int64
+	dropped int64
+
+	cancel context.CancelFunc
+}
+
+// NewSpool loads the unsent data of the directory, the statuses could be nil when the connection status is unknown
+func NewSpool(config *SpoolConfig, statuses <-chan backend.ConnectionStatus) (*Spool, error) {
+	s := &Spool{directory: config.Directory, statuses: statuses}
+	var err error
+	if s.maxSize, err = store.ParseSize(defaultString(config.MaxSize, defaultSpoolMaxSize)); err != nil {
+		return nil, fmt.Errorf("parsing the spool max size failure: %v", err)
+	}
+	if s.maxAge, err = time.ParseDuration(defaultString(config.MaxAge, defaultSpoolMaxAge)); err != nil {
+		return nil, fmt.Errorf("parsing the spool max age failure: %v", err)
+	}
+	if s.retryInterval, err = time.ParseDuration(defaultString(config.RetryInterval, defaultSpoolRetryInterval)); err != nil {
+		return nil, fmt.Errorf("parsing the spool retry interval failure: %v", err)
+	}
+	if s.maxRetryInterval, err = time.ParseDuration(defaultString(config.MaxRetryInterval, defaultSpoolMaxRetryInterval)); err != nil {
+		return nil, fmt.Errorf("parsing the spool max retry interval failure: %v", err)
+	}
+	if s.retryInterval <= 0 || s.maxRetryInterval < s.retryInterval {
+		return nil, fmt.Errorf("the spool retry interval must be positive and not bigger than the max retry interval")
+	}
+	if err := os.MkdirAll(s.directory, 0o700); err != nil {
+		return nil, fmt.Errorf("creating the spool directory failure: %v", err)
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func defaultString(value, defaultValue string) string {
+	if value == "" {
+		return defaultValue
+	}
+	return value
+}
+
+// Wrap the sink, the data is spooled when the sink sending failure
+func (s *Spool) Wrap(delegate Sink) Sink {
+	s.delegate = delegate
+	return s
+}
+
+// Start resending the unsent data in the background
+func (s *Spool) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+	go s.retryLoop(ctx)
+}
+
+func (s *Spool) Name() string {
+	return s.delegate.Name()
+}
+
+func (s *Spool) SendProfilingData(ctx context.Context, data []*profiling_v3.EBPFProfilingData) error {
+	err := s.delegate.SendProfilingData(ctx, data)
+	if err == nil || len(data) == 0 {
+		return err
+	}
+	messages := make([]proto.Message, 0, len(data))
+	for _, d := range data {
+		messages = append(messages, d)
+	}
+	return s.spool(spoolKindData, len(messages), func() ([][]byte, error) {
+		return marshalMessages(messages)
+	}, err)
+}
+
+// SendProfiles spools the profiles as pprof with the process entity, the modules of the profiles are not kept
+func (s *Spool) SendProfiles(ctx context.Context, profiles []*profile.Profile) error {
+	err := s.delegate.SendProfiles(ctx, profiles)
+	if err == nil || len(profiles) == 0 {
+		return err
+	}
+	return s.spool(spoolKindProfile, len(profiles), func() ([][]byte, error) {
+		return marshalProfiles(profiles)
+	}, err)
+}
+
+func (s *Spool) ReportProfilingTask(ctx context.Context, report *profiling_v3.ContinuousProfilingReport) (string, error) {
+	// the task ID is required immediately, so the report could not be resent later
+	return s.delegate.ReportProfilingTask(ctx, report)
+}
+
+func (s *Spool) SendMeters(ctx context.Context, meters []*meter_v3.MeterDataCollection) error {
+	err := s.delegate.SendMeters(ctx, meters)
+	if err == nil || len(meters) == 0 {
+		return err
+	}
+	messages := make([]proto.Message, 0, len(meters))
+	for _, m := range meters {
+		messages = append(messages, m)
+	}
+	return s.spool(spoolKindMeter, len(messages), func() ([][]byte, error) {
+		return marshalMessages(messages)
+	}, err)
+}
+
+func (s *Spool) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	return s.delegate.Close()
+}
+
+// Stats of the unsent data
+func (s *Spool) Stats() *SpoolStats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	stats := &SpoolStats{Files: len(s.files), Spooled: s.spooled, Resent: s.resent, Dropped: s.dropped}
+	for _, f := range s.files {
+		stats.Items += f.items
+		stats.Bytes += f.size
+	}
+	return stats
+}
+
+// spool the marshaled items into the file, the sending error is returned when the spool failure
+func (s *Spool) spool(kind string, items int, marshal func() ([][]byte, error), sendErr error) error {
+	payloads, err := marshal()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	var size int64
+	if err == nil {
+		s.seq++
+		path := filepath.Join(s.directory, fmt.Sprintf("%d-%d-%d.%s", now.UnixNano(), s.seq, items, kind))
+		if size, err = writeSpoolFile(path, payloads); err == nil {
+			s.files = append(s.files, &spoolFile{path: path, kind: kind, time: now, items: items, size: size})
+		}
+	}
+	if err != nil {
+		s.dropped += int64(items)
+		return fmt.Errorf("%v, and the spool failure: %v", sendErr, err)
+	}
+	s.spooled += int64(items)
+	s.pruneLocked(now)
+	log.Warnf("sending %d %s to the %s sink failure, spooled for retry: %v", items, kind, s.delegate.Name(), sendErr)
+	return nil
+}
+
+// pruneLocked removes the oldest files when exceed the max size or max age
+func (s *Spool) pruneLocked(now time.Time) {
+	var total int64
+	for _, f := range s.files {
+		total += f.size
+	}
+	for len(s.files) > 0 {
+		oldest := s.files[0]
+		if total <= s.maxSize && now.Sub(oldest.time) <= s.maxAge {
+			return
+		}
+		if err := os.Remove(oldest.path); err != nil && !os.IsNotExist(err) {
+			log.Warnf("removing the spool file failure: %s, error: %v", oldest.path, err)
+		}
+		log.Warnf("dropped %d spooled %s which exceed the spool limits", oldest.items, oldest.kind)
+		total -= oldest.size
+		s.dropped += int64(oldest.items)
+		s.files = s.files[1:]
+	}
+}
+
+func (s *Spool) retryLoop(ctx context.Context) {
+	interval := s.retryInterval
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case status := <-s.statuses:
+			if status != backend.Connected {
+				continue
+			}
+			interval = s.retryInterval
+		case <-timer.C:
+		}
+		if s.Resend(ctx) {
+			interval = s.retryInterval
+		} else {
+			interval *= 2
+			if interval > s.maxRetryInterval {
+				interval = s.maxRetryInterval
+			}
+		}
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(interval)
+	}
+}
+
+// Resend the spooled data from the oldest, stop at the first failure, returns whether all the data are sent
+func (s *Spool) Resend(ctx context.Context) bool {
+	for {
+		s.lock.Lock()
+		s.pruneLocked(time.Now())
+		if len(s.files) == 0 {
+			s.lock.Unlock()
+			return true
+		}
+		file := s.files[0]
+		s.lock.Unlock()
+
+		err := s.resendFile(ctx, file)
+		if err != nil && !errors.Is(err, errBrokenSpoolFile) {
+			log.Warnf("resending the spooled %s to the %s sink failure: %v", file.kind, s.delegate.Name(), err)
+			return false
+		}
+		s.lock.Lock()
+		// the file may be pruned when resending
+		if len(s.files) > 0 && s.files[0] == file {
+			s.files = s.files[1:]
+			if err != nil {
+				log.Warnf("dropped the broken spool file: %v", err)
+				s.dropped += int64(file.items)
+			} else {
+				s.resent += int64(file.items)
+			}
+		}
+		s.lock.Unlock()
+		if err := os.Remove(file.path); err != nil && !os.IsNotExist(err) {
+			log.Warnf("removing the spool file failure: %s, error: %v", file.path, err)
+		}
+	}
+}
+
+func (s *Spool) resendFile(ctx context.Context, file *spoolFile) error {
+	switch file.kind {
+	case spoolKindData:
+		data := make([]*profiling_v3.EBPFProfilingData, 0, file.items)
+		err := readSpoolFile(file.path, func(payload []byte) error {
+			d := &profiling_v3.EBPFProfilingData{}
+			data = append(data, d)
+			return proto.Unmarshal(payload, d)
+		})
+		if err != nil {
+			return fmt.Errorf("%w: %s, error: %v", errBrokenSpoolFile, file.path, err)
+		}
+		return s.delegate.SendProfilingData(ctx, data)
+	case spoolKindProfile:
+		profiles := make([]*profile.Profile, 0, file.items)
+		err := readSpoolFile(file.path, func(payload []byte) error {
+			p, err := unmarshalProfile(payload)
+			profiles = append(profiles, p)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("%w: %s, error: %v", errBrokenSpoolFile, file.path, err)
+		}
+		return s.delegate.SendProfiles(ctx, profiles)
+	default:
+		meters := make([]*meter_v3.MeterDataCollection, 0, file.items)
+		err := readSpoolFile(file.path, func(payload []byte) error {
+			m := &meter_v3.MeterDataCollection{}
+			meters = append(meters, m)
+			return proto.Unmarshal(payload, m)
+		})
+		if err != nil {
+			return fmt.Errorf("%w: %s, error: %v", errBrokenSpoolFile, file.path, err)
+		}
+		return s.delegate.SendMeters(ctx, meters)
+	}
+}
+
+// load the spooled files of the previous running
+func (s *Spool) load() error {
+	entries, err := os.ReadDir(s.directory)
+	if err != nil {
+		return fmt.Errorf("reading the spool directory failure: %v", err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		file, err := parseSpoolFile(s.directory, e)
+		if err != nil {
+			log.Warnf("ignored the unknown file in the spool directory: %s", e.Name())
+			continue
+		}
+		s.files = append(s.files, file)
+	}
+	sort.Slice(s.files, func(i, j int) bool {
+		return s.files[i].path < s.files[j].path
+	})
+	if len(s.files) > 0 {
+		log.Infof("loaded %d spooled files for resending", len(s.files))
+	}
+	return nil
+}
+
+func parseSpoolFile(directory string, entry os.DirEntry) (*spoolFile, error) {
+	name, kind, ok := strings.Cut(entry.Name(), ".")
+	if !ok || (kind != spoolKindData && kind != spoolKindMeter && kind != spoolKindProfile) {
+		return nil, fmt.Errorf("unknown kind")
+	}
+	parts := strings.Split(name, "-")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("illegal name")
+	}
+	nano, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	items, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	info, err := entry.Info()
+	if err != nil {
+		return nil, err
+	}
+	return &spoolFile{path: filepath.Join(directory, entry.Name()), kind: kind, time: time.Unix(0, nano),
+		items: items, size: info.Size()}, nil
+}
+
+// spooledProfile is the profile in the spool, the process entity is not kept by the pprof
+type spooledProfile struct {
+	Entity *api.ProcessEntity `json:"entity,omitempty"`
+	Pprof  []byte             `json:"pprof"`
+}
+
+func marshalMessages(messages []proto.Message) ([][]byte, error) {
+	result := make([][]byte, 0, len(messages))
+	for _, m := range messages {
+		data, err := proto.Marshal(m)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, data)
+	}
+	return result, nil
+}
+
+func marshalProfiles(profiles []*profile.Profile) ([][]byte, error) {
+	result := make([][]byte, 0, len(profiles))
+	for _, p := range profiles {
+		buf := &bytes.Buffer{}
+		if err := pprof.Write(buf, p); err != nil {
+			return nil, err
+		}
+		data, err := json.Marshal(&spooledProfile{Entity: p.Entity, Pprof: buf.Bytes()})
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, data)
+	}
+	return result, nil
+}
+
+func unmarshalProfile(payload []byte) (*profile.Profile, error) {
+	spooled := &spooledProfile{}
+	if err := json.Unmarshal(payload, spooled); err != nil {
+		return nil, err
+	}
+	p, err := pprof.Decode(bytes.NewReader(spooled.Pprof))
+	if err != nil {
+		return nil, err
+	}
+	p.Entity = spooled.Entity
+	return p, nil
+}
+
+// writeSpoolFile writes the payloads with the length prefix, returns the file size
+func writeSpoolFile(path string, payloads [][]byte) (int64, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, err
+	}
+	writer := bufio.NewWriter(file)
+	var size int64
+	lengthBuf := make([]byte, binary.MaxVarintLen64)
+	for _, data := range payloads {
+		n := binary.PutUvarint(lengthBuf, uint64(len(data)))
+		if _, err = writer.Write(lengthBuf[:n]); err == nil {
+			_, err = writer.Write(data)
+		}
+		if err != nil {
+			_ = file.Close()
+			_ = os.Remove(path)
+			return 0, err
+		}
+		size += int64(n + len(data))
+	}
+	if err := writer.Flush(); err != nil {
+		_ = file.Close()
+		_ = os.Remove(path)
+		return 0, err
+	}
+	return size, file.Close()
+}
+
+func readSpoolFile(path string, read func(payload []byte) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	for {
+		length, err := binary.ReadUvarint(reader)
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return err
+		}
+		if err := read(data); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,261 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sink
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"perfprofiler/pkg/core/backend"
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/tools/profiling"
+
+	"github.com/stretchr/testify/assert"
+
+	profiling_v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
+	meter_v3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+// recordSink records the received data, and fails when it is unavailable
+type recordSink struct {
+	lock        sync.Mutex
+	unavailable bool
+	data        []*profiling_v3.EBPFProfilingData
+	meters      []*meter_v3.MeterDataCollection
+	profiles    []*profile.Profile
+}
+
+func (r *recordSink) setUnavailable(unavailable bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.unavailable = unavailable
+}
+
+func (r *recordSink) received() (data, meters int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.data), len(r.meters)
+}
+
+func (r *recordSink) Name() string {
+	return "record"
+}
+
+func (r *recordSink) SendProfilingData(ctx context.Context, data []*profiling_v3.EBPFProfilingData) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.unavailable {
+		return fmt.Errorf("unavailable")
+	}
+	r.data = append(r.data, data...)
+	return nil
+}
+
+func (r *recordSink) SendProfiles(ctx context.Context, profiles []*profile.Profile) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.unavailable {
+		return fmt.Errorf("unavailable")
+	}
+	r.profiles = append(r.profiles, profiles...)
+	return nil
+}
+
+func (r *recordSink) ReportProfilingTask(ctx context.Context, report *profiling_v3.ContinuousProfilingReport) (string, error) {
+	return "task", nil
+}
+
+func (r *recordSink) SendMeters(ctx context.Context, meters []*meter_v3.MeterDataCollection) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.unavailable {
+		return fmt.Errorf("unavailable")
+	}
+	r.meters = append(r.meters, meters...)
+	return nil
+}
+
+func (r *recordSink) Close() error {
+	return nil
+}
+
+func TestSpoolResend(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := NewSpool(&SpoolConfig{Directory: dir}, nil)
+	assert.NoError(t, err)
+	delegate := &recordSink{unavailable: true}
+	s := spool.Wrap(delegate)
+	ctx := context.Background()
+
+	assert.NoError(t, s.SendProfilingData(ctx, testProfilingData()))
+	assert.NoError(t, s.SendMeters(ctx, []*meter_v3.MeterDataCollection{{}, {}}))
+	assert.NoError(t, s.SendProfiles(ctx, []*profile.Profile{testSinkProfile()}))
+	stats := spool.Stats()
+	assert.Equal(t, 3, stats.Files)
+	assert.Equal(t, 4, stats.Items)
+	assert.Equal(t, int64(4), stats.Spooled)
+	assert.False(t, spool.Resend(ctx))
+
+	// the spooled data is loaded after restart
+	reloaded, err := NewSpool(&SpoolConfig{Directory: dir}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, reloaded.Stats().Items)
+	delegate.setUnavailable(false)
+	reloaded.Wrap(delegate)
+	assert.True(t, reloaded.Resend(ctx))
+	data, meters := delegate.received()
+	assert.Equal(t, 1, data)
+	assert.Equal(t, 2, meters)
+	assert.Equal(t, "task", delegate.data[0].Task.TaskId)
+	// the profile is resent with the entity and the symbolized stacks
+	assert.Len(t, delegate.profiles, 1)
+	assert.Equal(t, "task", delegate.profiles[0].TaskID)
+	assert.Equal(t, "svc", delegate.profiles[0].Entity.ServiceName)
+	assert.Equal(t, []string{"main"}, delegate.profiles[0].Samples[0].FunctionNames())
+	assert.Equal(t, &SpoolStats{Resent: 4}, reloaded.Stats())
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// the task report is not spooled
+	taskID, err := s.ReportProfilingTask(ctx, &profiling_v3.ContinuousProfilingReport{})
+	assert.NoError(t, err)
+	assert.Equal(t, "task", taskID)
+}
+
+func TestSpoolLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *SpoolConfig
+		sends       int
+		wantItems   int
+		wantDropped int64
+		wantErr     bool
+	}{
+		{name: "within limits", config: &SpoolConfig{}, sends: 3, wantItems: 3},
+		{name: "exceed size", config: &SpoolConfig{MaxSize: "40B"}, sends: 3, wantItems: 1, wantDropped: 2},
+		{name: "exceed age", config: &SpoolConfig{MaxAge: "1ns"}, sends: 3, wantItems: 0, wantDropped: 3},
+		{name: "illegal size", config: &SpoolConfig{MaxSize: "unknown"}, wantErr: true},
+		{name: "illegal retry", config: &SpoolConfig{RetryInterval: "10m", MaxRetryInterval: "1m"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Directory = t.TempDir()
+			spool, err := NewSpool(tt.config, nil)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			s := spool.Wrap(&recordSink{unavailable: true})
+			for i := 0; i < tt.sends; i++ {
+				assert.NoError(t, s.SendProfilingData(context.Background(), testProfilingData()))
+			}
+			// make sure the age limit is checked
+			time.Sleep(time.Millisecond)
+			spool.Resend(context.Background())
+			stats := spool.Stats()
+			assert.Equal(t, tt.wantItems, stats.Items)
+			assert.Equal(t, tt.wantDropped, stats.Dropped)
+		})
+	}
+}
+
+func TestSpoolBrokenFile(t *testing.T) {
+	dir := t.TempDir()
+	broken := fmt.Sprintf("%d-1-2.data", time.Now().UnixNano())
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, broken), []byte{0x10, 0x01}, 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "unknown.txt"), []byte{}, 0o600))
+	spool, err := NewSpool(&SpoolConfig{Directory: dir}, nil)
+	assert.NoError(t, err)
+	spool.Wrap(&recordSink{})
+	assert.True(t, spool.Resend(context.Background()))
+	assert.Equal(t, &SpoolStats{Dropped: 2}, spool.Stats())
+}
+
+func TestSpoolRetryWhenReconnected(t *testing.T) {
+	statuses := make(chan backend.ConnectionStatus, 1)
+	// the backoff is long enough, so the data could only be resent by the reconnection
+	spool, err := NewSpool(&SpoolConfig{Directory: t.TempDir(), RetryInterval: "1h", MaxRetryInterval: "1h"}, statuses)
+	assert.NoError(t, err)
+	delegate := &recordSink{unavailable: true}
+	s := spool.Wrap(delegate)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	spool.Start(ctx)
+	defer s.Close()
+
+	assert.NoError(t, s.SendProfilingData(ctx, testProfilingData()))
+	delegate.setUnavailable(false)
+	statuses <- backend.Disconnect
+	statuses <- backend.Connected
+	assert.Eventually(t, func() bool {
+		data, _ := delegate.received()
+		return data == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		return spool.Stats().Items == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func testSinkProfile() *profile.Profile {
+	start := time.Unix(1700000000, 0)
+	return &profile.Profile{TaskID: "task", Type: profile.TypeOnCPU, Pid: 10, StartTime: start, EndTime: start.Add(time.Second),
+		Period: int64(time.Millisecond), Entity: &api.ProcessEntity{ServiceName: "svc", InstanceName: "ins"},
+		Samples: []*profile.Sample{{Locations: []*profile.Location{{Address: 0x401000,
+			Frames: []*profiling.Frame{{Name: "main"}}}}, Count: 2, Duration: int64(2 * time.Millisecond)}}}
+}
+
+func TestSpools(t *testing.T) {
+	dir := t.TempDir()
+	statuses := make(chan backend.ConnectionStatus)
+	spools := NewSpools(&SpoolConfig{Directory: dir}, statuses)
+	ctx := context.Background()
+	remote := &recordSink{unavailable: true}
+	backendSink := &fakeSink{name: TypeSkyWalking, err: fmt.Errorf("unavailable")}
+	s1, err := spools.Wrap(remote)
+	assert.NoError(t, err)
+	s2, err := spools.Wrap(backendSink)
+	assert.NoError(t, err)
+	assert.NoError(t, s1.SendProfiles(ctx, []*profile.Profile{testSinkProfile()}))
+	assert.NoError(t, s2.SendProfilingData(ctx, testProfilingData()))
+
+	// each sink has its own directory, and only the skywalking sink receives the backend statuses
+	for _, name := range []string{"record", TypeSkyWalking} {
+		entries, err := os.ReadDir(filepath.Join(dir, name))
+		assert.NoError(t, err)
+		assert.Len(t, entries, 1)
+	}
+	assert.Nil(t, spools.spools[0].statuses)
+	assert.NotNil(t, spools.spools[1].statuses)
+	stats := spools.Stats()
+	assert.Equal(t, 2, stats.Files)
+	assert.Equal(t, 2, stats.Items)
+
+	// the sink is not wrapped when the spool is disabled
+	var disabled *Spools
+	s, err := disabled.Wrap(remote)
+	assert.NoError(t, err)
+	assert.Equal(t, remote, s)
+}
@@ -0,0 +1,141 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"perfprofiler/pkg/profiling/profile"
+
+	"github.com/google/uuid"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	profiling_v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
+	meter_v3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+const (
+	RecordProfilingData = "profiling_data"
+	RecordProfilingTask = "profiling_task"
+	RecordMeters        = "meters"
+)
+
+// Record is a line written by the file and stdout sinks
+type Record struct {
+	Type   string          `json:"type"`
+	Time   time.Time       `json:"time"`
+	TaskID string          `json:"taskId,omitempty"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// Writer writes the data as JSON lines, the continuous profiling tasks are given the local generated task ID
+type Writer struct {
+	name   string
+	lock   sync.Mutex
+	writer io.Writer
+	closer io.Closer
+}
+
+// NewFile appends the data to the file
+func NewFile(path string) (*Writer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open the sink file failure: %v", err)
+	}
+	return &Writer{name: TypeFile, writer: f, closer: f}, nil
+}
+
+// NewStdout writes the data to the standard output
+func NewStdout() *Writer {
+	return NewWriter(TypeStdout, os.Stdout)
+}
+
+func NewWriter(name string, w io.Writer) *Writer {
+	return &Writer{name: name, writer: w}
+}
+
+func (w *Writer) Name() string {
+	return w.name
+}
+
+func (w *Writer) SendProfilingData(ctx context.Context, data []*profiling_v3.EBPFProfilingData) error {
+	messages := make([]proto.Message, 0, len(data))
+	for _, d := range data {
+		messages = append(messages, d)
+	}
+	return w.write(RecordProfilingData, "", messages)
+}
+
+// SendProfiles is ignored, the same stacks are written by the profiling data
+func (w *Writer) SendProfiles(ctx context.Context, profiles []*profile.Profile) error {
+	return nil
+}
+
+func (w *Writer) ReportProfilingTask(ctx context.Context, report *profiling_v3.ContinuousProfilingReport) (string, error) {
+	taskID := uuid.New().String()
+	if err := w.write(RecordProfilingTask, taskID, []proto.Message{report}); err != nil {
+		return "", err
+	}
+	return taskID, nil
+}
+
+func (w *Writer) SendMeters(ctx context.Context, meters []*meter_v3.MeterDataCollection) error {
+	messages := make([]proto.Message, 0, len(meters))
+	for _, m := range meters {
+		messages = append(messages, m)
+	}
+	return w.write(RecordMeters, "", messages)
+}
+
+func (w *Writer) write(recordType, taskID string, messages []proto.Message) error {
+	now := time.Now()
+	buf := make([]byte, 0)
+	for _, m := range messages {
+		data, err := protojson.Marshal(m)
+		if err != nil {
+			return err
+		}
+		line, err := json.Marshal(&Record{Type: recordType, Time: now, TaskID: taskID, Data: data})
+		if err != nil {
+			return err
+		}
+		buf = append(append(buf, line...), '\n')
+	}
+	if len(buf) == 0 {
+		return nil
+	}
+	// write the lines at once, the records of the flushes are not interleaved
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	_, err := w.writer.Write(buf)
+	return err
+}
+
+func (w *Writer) Close() error {
+	if w.closer == nil {
+		return nil
+	}
+	return w.closer.Close()
+}
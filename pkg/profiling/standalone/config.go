@@ -0,0 +1,41 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package standalone
+
+import (
+	"fmt"
+	"time"
+)
+
+const defaultCheckInterval = 5 * time.Second
+
+type Config struct {
+	TaskPath      string `mapstructure:"task_path"`      // The YAML file or directory of the profiling task definitions, disabled when empty
+	CheckInterval string `mapstructure:"check_interval"` // The interval of checking the file changes and the task schedules, default is 5s
+}
+
+func (c *Config) checkInterval() (time.Duration, error) {
+	if c.CheckInterval == "" {
+		return defaultCheckInterval, nil
+	}
+	interval, err := time.ParseDuration(c.CheckInterval)
+	if err != nil || interval <= 0 {
+		return 0, fmt.Errorf("the standalone check interval is invalid: %s", c.CheckInterval)
+	}
+	return interval, nil
+}
@@ -0,0 +1,196 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package standalone
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/task/base"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Definitions is the content of a task definition file
+type Definitions struct {
+	Tasks []*Definition `yaml:"tasks"`
+}
+
+// Definition of a profiling task which running locally
+type Definition struct {
+	Name       string   `yaml:"name"`        // The unique name of the task
+	TargetType string   `yaml:"target_type"` // ON_CPU, OFF_CPU or NETWORK
+	Selector   Selector `yaml:"selector"`    // The processes to profile
+	Schedule   string   `yaml:"schedule"`    // The interval of running the task repeatedly, only running once when empty
+	Duration   string   `yaml:"duration"`    // The running duration of each run
+
+	targetType base.TargetType
+	schedule   time.Duration
+	duration   time.Duration
+}
+
+// Selector of the processes, all the configured conditions must be matched
+type Selector struct {
+	Pids     []int32  `yaml:"pids"`
+	Layer    string   `yaml:"layer"`
+	Service  string   `yaml:"service"`
+	Instance string   `yaml:"instance"`
+	Process  string   `yaml:"process"`
+	Labels   []string `yaml:"labels"` // The process must contain all the labels
+}
+
+// LoadDefinitions from the YAML file, or all YAML files in the directory
+func LoadDefinitions(path string) ([]*Definition, error) {
+	files, err := definitionFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*Definition, 0)
+	names := make(map[string]string)
+	for _, f := range files {
+		content, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		definitions := &Definitions{}
+		if err := yaml.Unmarshal(content, definitions); err != nil {
+			return nil, fmt.Errorf("parsing the task definitions failure: %s, error: %v", f, err)
+		}
+		for _, d := range definitions.Tasks {
+			if err := d.parse(); err != nil {
+				return nil, fmt.Errorf("the task definition is invalid in %s: %v", f, err)
+			}
+			if exist, ok := names[d.Name]; ok {
+				return nil, fmt.Errorf("the task %s is duplicated in %s and %s", d.Name, exist, f)
+			}
+			names[d.Name] = f
+			result = append(result, d)
+		}
+	}
+	return result, nil
+}
+
+// fingerprint of the definition files, changed when any file is added, removed or modified
+func fingerprint(path string) (string, error) {
+	files, err := definitionFiles(path)
+	if err != nil {
+		return "", err
+	}
+	builder := &strings.Builder{}
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(builder, "%s:%d:%d\n", f, info.Size(), info.ModTime().UnixNano())
+	}
+	return builder.String(), nil
+}
+
+func definitionFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, 0)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if ext := filepath.Ext(e.Name()); ext == ".yaml" || ext == ".yml" {
+			result = append(result, filepath.Join(path, e.Name()))
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+func (d *Definition) parse() error {
+	if d.Name == "" {
+		return fmt.Errorf("the task name must be set")
+	}
+	var err error
+	if d.targetType, err = base.ParseTargetType(nil, d.TargetType); err != nil {
+		return fmt.Errorf("task %s: %v", d.Name, err)
+	}
+	if d.duration, err = time.ParseDuration(d.Duration); err != nil || d.duration <= 0 {
+		return fmt.Errorf("task %s: the duration is invalid: %s", d.Name, d.Duration)
+	}
+	if d.Schedule != "" {
+		if d.schedule, err = time.ParseDuration(d.Schedule); err != nil || d.schedule <= 0 {
+			return fmt.Errorf("task %s: the schedule is invalid: %s", d.Name, d.Schedule)
+		}
+		if d.schedule < d.duration {
+			return fmt.Errorf("task %s: the schedule %s could not be shorter than the duration %s", d.Name, d.Schedule, d.Duration)
+		}
+	}
+	if d.Selector.empty() {
+		return fmt.Errorf("task %s: the process selector must be set", d.Name)
+	}
+	return nil
+}
+
+func (s *Selector) empty() bool {
+	return len(s.Pids) == 0 && s.Layer == "" && s.Service == "" && s.Instance == "" && s.Process == "" && len(s.Labels) == 0
+}
+
+// Match the process by the pid and entity
+func (s *Selector) Match(p api.ProcessInterface) bool {
+	if len(s.Pids) > 0 {
+		found := false
+		for _, pid := range s.Pids {
+			if pid == p.Pid() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	entity := p.Entity()
+	if (s.Layer != "" && s.Layer != entity.Layer) || (s.Service != "" && s.Service != entity.ServiceName) ||
+		(s.Instance != "" && s.Instance != entity.InstanceName) || (s.Process != "" && s.Process != entity.ProcessName) {
+		return false
+	}
+	for _, label := range s.Labels {
+		found := false
+		for _, l := range entity.Labels {
+			if l == label {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,226 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package standalone
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"perfprofiler/pkg/logger"
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/task"
+	"perfprofiler/pkg/profiling/task/base"
+)
+
+var log = logger.GetLogger("profiling", "standalone")
+
+// TaskManager runs the profiling tasks through the runner lifecycle
+type TaskManager interface {
+	BuildContextFromContinuous(processes []api.ProcessInterface, taskSetter func(task *base.ProfilingTask),
+		taskIDGenerator func() (string, error)) (*task.Context, error)
+	StartLocalTask(c *task.Context) error
+	ShutdownAndRemoveTask(c *task.Context) error
+}
+
+// ProcessFinder provides the detected processes
+type ProcessFinder interface {
+	GetAllProcesses() []api.ProcessInterface
+}
+
+// Scheduler runs the profiling tasks defined in the local files, the files are reloaded when changed
+type Scheduler struct {
+	path          string
+	checkInterval time.Duration
+	taskManager   TaskManager
+	processes     ProcessFinder
+
+	fingerprint string
+	states      map[string]*taskState
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+type taskState struct {
+	definition *Definition
+	lastStart  time.Time
+	tasks      []*task.Context
+}
+
+func NewScheduler(ctx context.Context, config *Config, taskManager TaskManager, processes ProcessFinder) (*Scheduler, error) {
+	interval, err := config.checkInterval()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := LoadDefinitions(config.TaskPath); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &Scheduler{
+		path:          config.TaskPath,
+		checkInterval: interval,
+		taskManager:   taskManager,
+		processes:     processes,
+		states:        make(map[string]*taskState),
+		ctx:           ctx,
+		cancel:        cancel,
+	}, nil
+}
+
+func (s *Scheduler) Start() {
+	go func() {
+		ticker := time.NewTicker(s.checkInterval)
+		defer ticker.Stop()
+		s.Check(time.Now())
+		for {
+			select {
+			case <-ticker.C:
+				s.Check(time.Now())
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (s *Scheduler) Stop() {
+	s.cancel()
+}
+
+// Check the definitions changes, and start the tasks which reached the schedule
+func (s *Scheduler) Check(now time.Time) {
+	s.reloadIfChanged()
+	for _, state := range s.states {
+		if !state.due(now) {
+			continue
+		}
+		if count := s.startTasks(state, now); count > 0 {
+			state.lastStart = now
+			log.Infof("started %d %s profiling tasks of the standalone task: %s",
+				count, state.definition.targetType, state.definition.Name)
+		}
+	}
+}
+
+func (s *Scheduler) reloadIfChanged() {
+	current, err := fingerprint(s.path)
+	if err != nil {
+		log.Warnf("checking the standalone task definitions failure: %v", err)
+		return
+	}
+	if current == s.fingerprint {
+		return
+	}
+	definitions, err := LoadDefinitions(s.path)
+	if err != nil {
+		// keep the previous definitions running until the files are fixed
+		log.Warnf("reloading the standalone task definitions failure: %v", err)
+		s.fingerprint = current
+		return
+	}
+	s.fingerprint = current
+
+	states := make(map[string]*taskState, len(definitions))
+	for _, d := range definitions {
+		if exist := s.states[d.Name]; exist != nil && reflect.DeepEqual(exist.definition, d) {
+			states[d.Name] = exist
+			continue
+		}
+		states[d.Name] = &taskState{definition: d}
+	}
+	// stop the running tasks of the changed or removed definitions
+	for name, exist := range s.states {
+		if states[name] != exist {
+			s.stopTasks(exist)
+		}
+	}
+	s.states = states
+	log.Infof("loaded %d standalone task definitions from %s", len(definitions), s.path)
+}
+
+func (s *Scheduler) startTasks(state *taskState, now time.Time) int {
+	d := state.definition
+	matched := make([]api.ProcessInterface, 0)
+	for _, p := range s.processes.GetAllProcesses() {
+		if d.Selector.Match(p) {
+			matched = append(matched, p)
+		}
+	}
+	if len(matched) == 0 {
+		log.Debugf("no process matched the standalone task: %s", d.Name)
+		return 0
+	}
+	// the CPU runners only support one process, so each process have a task
+	groups := [][]api.ProcessInterface{matched}
+	if d.targetType != base.TargetTypeNetworkTopology {
+		groups = make([][]api.ProcessInterface, 0, len(matched))
+		for _, p := range matched {
+			groups = append(groups, []api.ProcessInterface{p})
+		}
+	}
+
+	state.tasks = nil
+	for _, processes := range groups {
+		taskID := fmt.Sprintf("standalone-%s-%d", d.Name, now.UnixMilli())
+		if len(groups) > 1 {
+			taskID = fmt.Sprintf("standalone-%s-%d-%d", d.Name, processes[0].Pid(), now.UnixMilli())
+		}
+		c, err := s.taskManager.BuildContextFromContinuous(processes, func(t *base.ProfilingTask) {
+			t.Origin = base.OriginStandalone
+			t.TargetType = d.targetType
+			t.MaxRunningDuration = d.duration
+			t.StartTime = now.UnixMilli()
+			t.UpdateTime = now.UnixMilli()
+		}, func() (string, error) {
+			return taskID, nil
+		})
+		if err != nil {
+			log.Warnf("could not build the standalone task %s: %v", taskID, err)
+			continue
+		}
+		// skip the processes which already have a running task, the task runs again at the next schedule
+		if err := s.taskManager.StartLocalTask(c); err != nil {
+			log.Warnf("could not start the standalone task %s: %v", taskID, err)
+			continue
+		}
+		state.tasks = append(state.tasks, c)
+	}
+	return len(state.tasks)
+}
+
+func (s *Scheduler) stopTasks(state *taskState) {
+	for _, c := range state.tasks {
+		if err := s.taskManager.ShutdownAndRemoveTask(c); err != nil {
+			log.Warnf("stop the standalone task %s failure: %v", c.TaskID(), err)
+		}
+	}
+	state.tasks = nil
+}
+
+// due when never started, or the schedule arrived after the last run finished
+func (t *taskState) due(now time.Time) bool {
+	if t.lastStart.IsZero() {
+		return true
+	}
+	if t.definition.schedule == 0 {
+		return false
+	}
+	return !now.Before(t.lastStart.Add(t.definition.schedule))
+}
@@ -0,0 +1,266 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package standalone
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/task"
+	"perfprofiler/pkg/profiling/task/base"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+}
+
+func TestLoadDefinitions(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		count   int
+		wantErr string
+	}{
+		{
+			name: "valid",
+			content: `
+tasks:
+  - name: api
+    target_type: ON_CPU
+    selector: {service: api, labels: [mesh]}
+    schedule: 10m
+    duration: 1m
+  - name: pid
+    target_type: NETWORK
+    selector: {pids: [1, 2]}
+    duration: 30s
+`,
+			count: 2,
+		},
+		{name: "empty", content: "", count: 0},
+		{name: "unknown target", content: "tasks: [{name: a, target_type: CPU, selector: {pids: [1]}, duration: 1m}]",
+			wantErr: "could not found target type"},
+		{name: "missing duration", content: "tasks: [{name: a, target_type: ON_CPU, selector: {pids: [1]}}]",
+			wantErr: "duration is invalid"},
+		{name: "short schedule", content: "tasks: [{name: a, target_type: ON_CPU, selector: {pids: [1]}, duration: 1m, schedule: 10s}]",
+			wantErr: "could not be shorter"},
+		{name: "empty selector", content: "tasks: [{name: a, target_type: ON_CPU, duration: 1m}]",
+			wantErr: "selector must be set"},
+		{name: "duplicated", content: `
+tasks:
+  - {name: a, target_type: ON_CPU, selector: {pids: [1]}, duration: 1m}
+  - {name: a, target_type: OFF_CPU, selector: {pids: [1]}, duration: 1m}
+`, wantErr: "duplicated"},
+		{name: "invalid yaml", content: "tasks: {", wantErr: "parsing the task definitions failure"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tasks.yaml")
+			writeFile(t, path, tt.content)
+			definitions, err := LoadDefinitions(path)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, definitions, tt.count)
+		})
+	}
+
+	// the directory only loads the YAML files
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.yaml"), "tasks: [{name: a, target_type: ON_CPU, selector: {pids: [1]}, duration: 1m}]")
+	writeFile(t, filepath.Join(dir, "b.yml"), "tasks: [{name: b, target_type: OFF_CPU, selector: {pids: [1]}, duration: 1m}]")
+	writeFile(t, filepath.Join(dir, "c.txt"), "invalid")
+	definitions, err := LoadDefinitions(dir)
+	assert.NoError(t, err)
+	assert.Len(t, definitions, 2)
+	assert.Equal(t, base.TargetTypeOffCPU, definitions[1].targetType)
+	_, err = LoadDefinitions(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err)
+}
+
+type fakeProcess struct {
+	api.ProcessInterface
+	pid    int32
+	entity *api.ProcessEntity
+}
+
+func (p *fakeProcess) ID() string {
+	return fmt.Sprintf("process-%d", p.pid)
+}
+
+func (p *fakeProcess) Pid() int32 {
+	return p.pid
+}
+
+func (p *fakeProcess) Entity() *api.ProcessEntity {
+	return p.entity
+}
+
+func TestSelectorMatch(t *testing.T) {
+	p := &fakeProcess{pid: 10, entity: &api.ProcessEntity{Layer: "OS_LINUX", ServiceName: "api", InstanceName: "node-1",
+		ProcessName: "java", Labels: []string{"mesh", "prod"}}}
+	tests := []struct {
+		name     string
+		selector Selector
+		match    bool
+	}{
+		{name: "pid", selector: Selector{Pids: []int32{1, 10}}, match: true},
+		{name: "other pid", selector: Selector{Pids: []int32{1}}},
+		{name: "entity", selector: Selector{Layer: "OS_LINUX", Service: "api", Instance: "node-1", Process: "java"}, match: true},
+		{name: "other service", selector: Selector{Service: "web"}},
+		{name: "labels", selector: Selector{Service: "api", Labels: []string{"prod", "mesh"}}, match: true},
+		{name: "missing label", selector: Selector{Labels: []string{"prod", "dev"}}},
+		{name: "pid and entity", selector: Selector{Pids: []int32{10}, Process: "python"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.match, tt.selector.Match(p))
+		})
+	}
+}
+
+type fakeTaskManager struct {
+	tasks   []*base.ProfilingTask
+	started []*task.Context
+	stopped []*task.Context
+	// the process IDs which have the running task
+	running map[string]bool
+}
+
+func (m *fakeTaskManager) BuildContextFromContinuous(processes []api.ProcessInterface, taskSetter func(task *base.ProfilingTask),
+	taskIDGenerator func() (string, error)) (*task.Context, error) {
+	t := base.ProfilingTaskFromContinuous(processes, taskSetter)
+	id, err := taskIDGenerator()
+	if err != nil {
+		return nil, err
+	}
+	t.TaskID = id
+	m.tasks = append(m.tasks, t)
+	return &task.Context{}, nil
+}
+
+func (m *fakeTaskManager) StartLocalTask(c *task.Context) error {
+	for _, id := range m.tasks[len(m.tasks)-1].ProcessIDList {
+		if m.running[id] {
+			return fmt.Errorf("%w: %s", task.ErrTaskConflict, id)
+		}
+	}
+	m.started = append(m.started, c)
+	return nil
+}
+
+func (m *fakeTaskManager) ShutdownAndRemoveTask(c *task.Context) error {
+	m.stopped = append(m.stopped, c)
+	return nil
+}
+
+type fakeProcesses []api.ProcessInterface
+
+func (f fakeProcesses) GetAllProcesses() []api.ProcessInterface {
+	return f
+}
+
+func TestScheduler(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.yaml")
+	writeFile(t, path, `
+tasks:
+  - {name: cpu, target_type: ON_CPU, selector: {service: api}, schedule: 10m, duration: 1m}
+  - {name: net, target_type: NETWORK, selector: {service: api}, duration: 1m}
+  - {name: none, target_type: OFF_CPU, selector: {pids: [99]}, duration: 1m}
+`)
+	processes := fakeProcesses{
+		&fakeProcess{pid: 1, entity: &api.ProcessEntity{ServiceName: "api"}},
+		&fakeProcess{pid: 2, entity: &api.ProcessEntity{ServiceName: "api"}},
+		&fakeProcess{pid: 3, entity: &api.ProcessEntity{ServiceName: "web"}},
+	}
+	manager := &fakeTaskManager{}
+	_, err := NewScheduler(context.Background(), &Config{TaskPath: path, CheckInterval: "0s"}, manager, processes)
+	assert.Error(t, err)
+	scheduler, err := NewScheduler(context.Background(), &Config{TaskPath: path}, manager, processes)
+	assert.NoError(t, err)
+
+	// the CPU task runs on each process, the network task runs on all processes
+	now := time.Now()
+	scheduler.Check(now)
+	assert.Len(t, manager.started, 3)
+	taskTypes := make(map[base.TargetType]int)
+	for _, task := range manager.tasks {
+		taskTypes[task.TargetType]++
+		assert.Equal(t, time.Minute, task.MaxRunningDuration)
+		assert.Equal(t, now.UnixMilli(), task.StartTime)
+	}
+	assert.Equal(t, map[base.TargetType]int{base.TargetTypeOnCPU: 2, base.TargetTypeNetworkTopology: 1}, taskTypes)
+
+	// only the scheduled task runs again after the schedule
+	scheduler.Check(now.Add(5 * time.Minute))
+	assert.Len(t, manager.started, 3)
+	scheduler.Check(now.Add(10 * time.Minute))
+	assert.Len(t, manager.started, 5)
+
+	// the changed definition stops the running tasks and starts again, the unchanged definitions are kept
+	writeFile(t, path, `
+tasks:
+  - {name: cpu, target_type: OFF_CPU, selector: {service: api}, schedule: 10m, duration: 1m}
+  - {name: net, target_type: NETWORK, selector: {service: api}, duration: 1m}
+`)
+	assert.NoError(t, os.Chtimes(path, now.Add(time.Hour), now.Add(time.Hour)))
+	scheduler.Check(now.Add(11 * time.Minute))
+	assert.Len(t, manager.stopped, 2)
+	assert.Len(t, manager.started, 7)
+	assert.Equal(t, base.TargetTypeOffCPU, manager.tasks[len(manager.tasks)-1].TargetType)
+
+	// the invalid definitions keep the previous tasks running
+	writeFile(t, path, "tasks: {")
+	scheduler.Check(now.Add(12 * time.Minute))
+	assert.Len(t, manager.stopped, 2)
+	assert.Len(t, scheduler.states, 2)
+}
+
+func TestSchedulerConflict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.yaml")
+	writeFile(t, path, `
+tasks:
+  - {name: cpu, target_type: ON_CPU, selector: {service: api}, schedule: 10m, duration: 1m}
+`)
+	processes := fakeProcesses{
+		&fakeProcess{pid: 1, entity: &api.ProcessEntity{ServiceName: "api"}},
+		&fakeProcess{pid: 2, entity: &api.ProcessEntity{ServiceName: "api"}},
+	}
+	manager := &fakeTaskManager{running: map[string]bool{"process-1": true, "process-2": true}}
+	scheduler, err := NewScheduler(context.Background(), &Config{TaskPath: path}, manager, processes)
+	assert.NoError(t, err)
+
+	// the processes are profiling by other tasks, so the task is checked again at the next check
+	now := time.Now()
+	scheduler.Check(now)
+	assert.Len(t, manager.started, 0)
+
+	delete(manager.running, "process-2")
+	scheduler.Check(now.Add(time.Minute))
+	assert.Len(t, manager.started, 1)
+	assert.Equal(t, now.Add(time.Minute), scheduler.states["cpu"].lastStart)
+}
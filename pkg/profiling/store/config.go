@@ -0,0 +1,76 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package store
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Directory string `mapstructure:"directory"` // The directory of the profile store, disabled when empty
+	MaxSize   string `mapstructure:"max_size"`  // The max total size of the stored profiles, such as "512MB", unlimited when empty
+	MaxAge    string `mapstructure:"max_age"`   // The max age of the stored profiles, such as "168h", unlimited when empty
+}
+
+// Validate the retention limits of the config
+func (c *Config) Validate() error {
+	if c.MaxSize != "" {
+		if _, err := ParseSize(c.MaxSize); err != nil {
+			return fmt.Errorf("parsing the profile store max size failure: %v", err)
+		}
+	}
+	if c.MaxAge != "" {
+		if _, err := time.ParseDuration(c.MaxAge); err != nil {
+			return fmt.Errorf("parsing the profile store max age failure: %v", err)
+		}
+	}
+	return nil
+}
+
+var sizeUnits = []struct {
+	suffix string
+	value  int64
+}{
+	{suffix: "GB", value: 1 << 30},
+	{suffix: "MB", value: 1 << 20},
+	{suffix: "KB", value: 1 << 10},
+	{suffix: "B", value: 1},
+}
+
+// ParseSize parses the bytes size, such as "1GB", "512MB", "64KB" or "1024"
+func ParseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(value, u.suffix) {
+			value, unit = strings.TrimSpace(strings.TrimSuffix(value, u.suffix)), u.value
+			break
+		}
+	}
+	size, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	if size <= 0 {
+		return 0, fmt.Errorf("the size must be bigger than 0")
+	}
+	return size * unit, nil
+}
@@ -0,0 +1,342 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"perfprofiler/pkg/logger"
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/export/pprof"
+	"perfprofiler/pkg/profiling/profile"
+)
+
+var log = logger.GetLogger("profiling", "store")
+
+const (
+	indexFileName   = "index.jsonl"
+	profilesDirName = "profiles"
+)
+
+// Record is the index of a stored profile
+type Record struct {
+	ID        string       `json:"id"`
+	TaskID    string       `json:"taskId"`
+	Type      profile.Type `json:"type"`
+	Pid       int32        `json:"pid"`
+	Layer     string       `json:"layer,omitempty"`
+	Service   string       `json:"service,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Process   string       `json:"process,omitempty"`
+	Labels    []string     `json:"labels,omitempty"`
+	StartTime time.Time    `json:"startTime"`
+	EndTime   time.Time    `json:"endTime"`
+	Samples   int          `json:"samples"`
+	// Size of the profile file in bytes
+	Size int64 `json:"size"`
+}
+
+// Query of the records, the empty conditions are ignored
+type Query struct {
+	Service  string
+	Instance string
+	Process  string
+	TaskID   string
+	Pid      int32
+	Type     profile.Type
+	// the records overlapped with the time range
+	From time.Time
+	To   time.Time
+}
+
+func (q *Query) match(r *Record) bool {
+	return (q.Service == "" || q.Service == r.Service) &&
+		(q.Instance == "" || q.Instance == r.Instance) &&
+		(q.Process == "" || q.Process == r.Process) &&
+		(q.TaskID == "" || q.TaskID == r.TaskID) &&
+		(q.Pid == 0 || q.Pid == r.Pid) &&
+		(q.Type == "" || q.Type == r.Type) &&
+		(q.From.IsZero() || !r.EndTime.Before(q.From))
+}
+
+// Store persists the flushed profiles as the pprof files in the local directory,
+// the records are indexed in the append-only index file, and ordered by the start time in memory
+type Store struct {
+	dir     string
+	maxSize int64
+	maxAge  time.Duration
+
+	lock    sync.Mutex
+	records []*Record
+	ids     map[string]bool
+	size    int64
+}
+
+// NewStore opens or creates the store in the directory of config, the expired profiles are cleaned
+func NewStore(config *Config) (*Store, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: config.Directory}
+	if config.MaxSize != "" {
+		s.maxSize, _ = ParseSize(config.MaxSize)
+	}
+	if config.MaxAge != "" {
+		s.maxAge, _ = time.ParseDuration(config.MaxAge)
+	}
+	if err := os.MkdirAll(filepath.Join(s.dir, profilesDirName), 0o755); err != nil {
+		return nil, fmt.Errorf("could not create the profile store directory: %s, error: %v", s.dir, err)
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.clean(time.Now()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Open the existing store for query, the retention limits are not applied
+func Open(dir string) (*Store, error) {
+	if _, err := os.Stat(filepath.Join(dir, indexFileName)); err != nil {
+		return nil, fmt.Errorf("could not found the profile store in %s: %v", dir, err)
+	}
+	s := &Store{dir: dir}
+	return s, s.load()
+}
+
+func (s *Store) load() error {
+	s.records, s.ids, s.size = nil, make(map[string]bool), 0
+	file, err := os.Open(filepath.Join(s.dir, indexFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		r := &Record{}
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			// the last line may be partially written when the agent crashed
+			log.Warnf("skip the broken profile store index line: %v", err)
+			continue
+		}
+		if s.ids[r.ID] {
+			continue
+		}
+		s.ids[r.ID] = true
+		s.records = append(s.records, r)
+		s.size += r.Size
+	}
+	sort.SliceStable(s.records, func(i, j int) bool {
+		return s.records[i].StartTime.Before(s.records[j].StartTime)
+	})
+	return scanner.Err()
+}
+
+// Write the profile into the store, return the stored file path
+func (s *Store) Write(p *profile.Profile) (string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	r := s.newRecord(p)
+	path := s.profilePath(r.ID)
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err = pprof.Write(file, p); err == nil {
+		var stat os.FileInfo
+		if stat, err = file.Stat(); err == nil {
+			r.Size = stat.Size()
+		}
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = s.appendIndex(r)
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return "", err
+	}
+
+	index := sort.Search(len(s.records), func(i int) bool {
+		return s.records[i].StartTime.After(r.StartTime)
+	})
+	s.records = append(s.records, nil)
+	copy(s.records[index+1:], s.records[index:])
+	s.records[index] = r
+	s.ids[r.ID] = true
+	s.size += r.Size
+	return path, s.clean(time.Now())
+}
+
+func (s *Store) newRecord(p *profile.Profile) *Record {
+	base := fmt.Sprintf("%d-%d-%s", p.StartTime.UnixMilli(), p.Pid, p.Type)
+	id := base
+	for i := 1; s.ids[id]; i++ {
+		id = fmt.Sprintf("%s-%d", base, i)
+	}
+	r := &Record{ID: id, TaskID: p.TaskID, Type: p.Type, Pid: p.Pid,
+		StartTime: p.StartTime, EndTime: p.EndTime, Samples: len(p.Samples)}
+	if e := p.Entity; e != nil {
+		r.Layer, r.Service, r.Instance, r.Process, r.Labels = e.Layer, e.ServiceName, e.InstanceName, e.ProcessName, e.Labels
+	}
+	return r
+}
+
+func (s *Store) profilePath(id string) string {
+	return filepath.Join(s.dir, profilesDirName, id+".pb.gz")
+}
+
+func (s *Store) appendIndex(r *Record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(s.dir, indexFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(data, '\n')); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// clean the records which expired or out of the max size, the oldest records are removed first
+func (s *Store) clean(now time.Time) error {
+	removeCount := 0
+	size := s.size
+	for _, r := range s.records {
+		expired := s.maxAge > 0 && now.Sub(r.EndTime) > s.maxAge
+		oversize := s.maxSize > 0 && size > s.maxSize
+		if !expired && !oversize {
+			break
+		}
+		size -= r.Size
+		removeCount++
+	}
+	if removeCount == 0 {
+		return nil
+	}
+
+	removed := s.records[:removeCount]
+	s.records = append([]*Record{}, s.records[removeCount:]...)
+	s.size = size
+	for _, r := range removed {
+		delete(s.ids, r.ID)
+		if err := os.Remove(s.profilePath(r.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Warnf("removing the expired profile %s failure: %v", r.ID, err)
+		}
+	}
+	return s.rewriteIndex()
+}
+
+// rewriteIndex writes the current records into a temporary index file, then replace the index file
+func (s *Store) rewriteIndex() error {
+	indexPath := filepath.Join(s.dir, indexFileName)
+	tmpPath := indexPath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	for _, r := range s.records {
+		if err = encoder.Encode(r); err != nil {
+			break
+		}
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, indexPath)
+}
+
+// Query the records ordered by the start time
+func (s *Store) Query(q *Query) []*Record {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	end := len(s.records)
+	if !q.To.IsZero() {
+		end = sort.Search(len(s.records), func(i int) bool {
+			return s.records[i].StartTime.After(q.To)
+		})
+	}
+	result := make([]*Record, 0)
+	for _, r := range s.records[:end] {
+		if q.match(r) {
+			result = append(result, r)
+		}
+	}
+	return result
+}
+
+// Find the record by ID, return nil if not found
+func (s *Store) Find(id string) *Record {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, r := range s.records {
+		if r.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+// Load the profile of the record, the entity of the process is restored from the record
+func (s *Store) Load(r *Record) (*profile.Profile, error) {
+	p, err := pprof.ReadFile(s.profilePath(r.ID))
+	if err != nil {
+		return nil, err
+	}
+	p.Entity = &api.ProcessEntity{Layer: r.Layer, ServiceName: r.Service, InstanceName: r.Instance,
+		ProcessName: r.Process, Labels: r.Labels}
+	return p, nil
+}
+
+// LoadAll the profiles of the records
+func (s *Store) LoadAll(records []*Record) ([]*profile.Profile, error) {
+	result := make([]*profile.Profile, 0, len(records))
+	for _, r := range records {
+		p, err := s.Load(r)
+		if err != nil {
+			return nil, fmt.Errorf("loading the profile %s failure: %v", r.ID, err)
+		}
+		result = append(result, p)
+	}
+	return result, nil
+}
@@ -0,0 +1,170 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/tools/profiling"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testProfile(service string, t profile.Type, start time.Time) *profile.Profile {
+	return &profile.Profile{
+		TaskID: "task-" + service, Type: t, Pid: 10,
+		Entity:    &api.ProcessEntity{ServiceName: service, InstanceName: "instance", Labels: []string{"a"}},
+		StartTime: start, EndTime: start.Add(time.Minute), Period: int64(10 * time.Millisecond),
+		Samples: []*profile.Sample{{Locations: []*profile.Location{{Address: 1, Frames: []*profiling.Frame{{Name: "main"}}}},
+			Count: 1, Duration: int64(10 * time.Millisecond)}},
+	}
+}
+
+func recordIDs(records []*Record) []string {
+	result := make([]string, 0, len(records))
+	for _, r := range records {
+		result = append(result, r.ID)
+	}
+	return result
+}
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStore(&Config{Directory: dir})
+	assert.NoError(t, err)
+	now := time.Now().Truncate(time.Millisecond)
+	for _, p := range []*profile.Profile{
+		testProfile("svc", profile.TypeOnCPU, now.Add(-time.Hour)),
+		testProfile("svc", profile.TypeOffCPU, now.Add(-time.Hour)),
+		testProfile("other", profile.TypeOnCPU, now.Add(-2*time.Hour)),
+		testProfile("svc", profile.TypeOnCPU, now),
+		// the same start time and pid with the first one
+		testProfile("svc", profile.TypeOnCPU, now.Add(-time.Hour)),
+	} {
+		path, err := s.Write(p)
+		assert.NoError(t, err)
+		assert.FileExists(t, path)
+	}
+	first := s.Query(&Query{})[0]
+	assert.Equal(t, "other", first.Service)
+	assert.Equal(t, []string{"a"}, first.Labels)
+	assert.Greater(t, first.Size, int64(0))
+
+	// reopen the store by the CLI
+	s, err = Open(dir)
+	assert.NoError(t, err)
+	tests := []struct {
+		name     string
+		query    *Query
+		expected []string
+	}{
+		{name: "all", query: &Query{}, expected: []string{
+			recordID(now.Add(-2*time.Hour), profile.TypeOnCPU), recordID(now.Add(-time.Hour), profile.TypeOnCPU),
+			recordID(now.Add(-time.Hour), profile.TypeOffCPU), recordID(now.Add(-time.Hour), profile.TypeOnCPU) + "-1",
+			recordID(now, profile.TypeOnCPU)}},
+		{name: "service and type", query: &Query{Service: "svc", Type: profile.TypeOnCPU}, expected: []string{
+			recordID(now.Add(-time.Hour), profile.TypeOnCPU), recordID(now.Add(-time.Hour), profile.TypeOnCPU) + "-1",
+			recordID(now, profile.TypeOnCPU)}},
+		{name: "time range", query: &Query{From: now.Add(-90 * time.Minute), To: now.Add(-time.Minute)}, expected: []string{
+			recordID(now.Add(-time.Hour), profile.TypeOnCPU), recordID(now.Add(-time.Hour), profile.TypeOffCPU),
+			recordID(now.Add(-time.Hour), profile.TypeOnCPU) + "-1"}},
+		{name: "task", query: &Query{TaskID: "task-other"}, expected: []string{recordID(now.Add(-2*time.Hour), profile.TypeOnCPU)}},
+		{name: "not found", query: &Query{Pid: 11}, expected: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, recordIDs(s.Query(tt.query)))
+		})
+	}
+
+	loaded, err := s.Load(s.Find(recordID(now, profile.TypeOnCPU)))
+	assert.NoError(t, err)
+	assert.Equal(t, "svc", loaded.Entity.ServiceName)
+	assert.Equal(t, "task-svc", loaded.TaskID)
+	assert.Len(t, loaded.Samples, 1)
+}
+
+func recordID(start time.Time, t profile.Type) string {
+	return (&Store{ids: map[string]bool{}}).newRecord(testProfile("", t, start)).ID
+}
+
+func TestRetention(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewStore(&Config{Directory: dir, MaxAge: "24h"})
+	assert.NoError(t, err)
+	now := time.Now()
+	_, err = s.Write(testProfile("svc", profile.TypeOnCPU, now.Add(-48*time.Hour)))
+	assert.NoError(t, err)
+	_, err = s.Write(testProfile("svc", profile.TypeOnCPU, now.Add(-time.Hour)))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{recordID(now.Add(-time.Hour), profile.TypeOnCPU)}, recordIDs(s.Query(&Query{})))
+	files, err := os.ReadDir(filepath.Join(dir, profilesDirName))
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	// the size limit only keeps the latest profile
+	size := s.Query(&Query{})[0].Size
+	s, err = NewStore(&Config{Directory: dir, MaxSize: "1KB"})
+	assert.NoError(t, err)
+	s.maxSize = size
+	_, err = s.Write(testProfile("svc", profile.TypeOnCPU, now))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{recordID(now, profile.TypeOnCPU)}, recordIDs(s.Query(&Query{})))
+
+	// the broken line of index is skipped
+	index, err := os.OpenFile(filepath.Join(dir, indexFileName), os.O_APPEND|os.O_WRONLY, 0o644)
+	assert.NoError(t, err)
+	_, err = index.WriteString(`{"id":"broken`)
+	assert.NoError(t, err)
+	assert.NoError(t, index.Close())
+	s, err = Open(dir)
+	assert.NoError(t, err)
+	assert.Len(t, s.Query(&Query{}), 1)
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected int64
+		err      bool
+	}{
+		{value: "1024", expected: 1024},
+		{value: "64KB", expected: 64 << 10},
+		{value: "512mb", expected: 512 << 20},
+		{value: "1 GB", expected: 1 << 30},
+		{value: "10B", expected: 10},
+		{value: "0", err: true},
+		{value: "1TB", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			size, err := ParseSize(tt.value)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, size)
+		})
+	}
+}
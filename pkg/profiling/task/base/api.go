@@ -21,11 +21,12 @@ import (
 	"context"
 
 	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/profile"
 
 	v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
 )
 
-const MissingSymbol = "[MISSING]"
+const MissingSymbol = profile.MissingSymbol
 
 type ProfilingRunningSuccessNotify func()
 
@@ -40,3 +41,10 @@ type ProfileTaskRunner interface {
 	// FlushData means dump the exists profiling data and flush them to the backend protocol format
 	FlushData() ([]*v3.EBPFProfilingData, error)
 }
+
+// ProfileRunner is the runner which could provide the stacks with raw addresses of the flushed data,
+// works for exporting the profiling data to the other formats, such as pprof
+type ProfileRunner interface {
+	// LatestProfile returns the profile of the latest FlushData, return nil if no data flushed
+	LatestProfile() *profile.Profile
+}
@@ -28,6 +28,8 @@ import (
 type TaskConfig struct {
 	OnCPU   *OnCPUConfig   `mapstructure:"on_cpu"`  // ON_CPU type of profiling task config
 	Network *NetworkConfig `mapstructure:"network"` // NETWORK type of profiling task config
+
+	SymbolizeParallels int `mapstructure:"symbolize_parallels"` // The parallels of symbolize stacks when flush data, default is the CPU count
 }
 
 type OnCPUConfig struct {
@@ -58,6 +60,7 @@ type HTTPSamplingConfig struct {
 
 func (c *TaskConfig) Validate() error {
 	var err error
+	err = c.biggerThan(err, c.SymbolizeParallels, -1, "symbolize parallels could not be negative")
 	network := c.Network
 	if network != nil {
 		err = c.durationValidate(err, network.ReportInterval, "parsing report interval failure: %v")
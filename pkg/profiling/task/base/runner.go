@@ -19,11 +19,13 @@ package base
 
 import (
 	"math"
+	"runtime"
 	"sync"
 
 	"github.com/cilium/ebpf"
 
 	"perfprofiler/pkg/logger"
+	"perfprofiler/pkg/profiling/profile"
 	"perfprofiler/pkg/tools/profiling"
 
 	v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
@@ -31,31 +33,139 @@ import (
 
 var log = logger.GetLogger("profiling", "task", "base")
 
+// StackSymbolArraySize is the max depth of stack which read from the eBPF stack map
+const StackSymbolArraySize = 100
+
 type Runner struct {
 	StackNotFoundCache map[uint32]bool
 	ShutdownOnce       sync.Once
+
+	// the profile of the latest flushed data
+	latestProfile *profile.Profile
+
+	stackNotFoundMutex sync.Mutex
+	symbolizeParallels int
 }
 
-func NewBaseRunner() *Runner {
-	return &Runner{StackNotFoundCache: make(map[uint32]bool)}
+func NewBaseRunner(config *TaskConfig) *Runner {
+	parallels := config.SymbolizeParallels
+	if parallels <= 0 {
+		parallels = runtime.NumCPU()
+	}
+	return &Runner{StackNotFoundCache: make(map[uint32]bool), symbolizeParallels: parallels}
+}
+
+// ParallelSymbolize executes the symbolize function of each stack on the worker pool, and wait all finished
+// each worker have its own symbol array for reading the stack from the eBPF map
+func (r *Runner) ParallelSymbolize(count int, symbolize func(index int, symbolArray []uint64)) {
+	workers := r.symbolizeParallels
+	if workers > count {
+		workers = count
+	}
+	if workers <= 1 {
+		symbolArray := make([]uint64, StackSymbolArraySize)
+		for i := 0; i < count; i++ {
+			symbolize(i, symbolArray)
+		}
+		return
+	}
+
+	indexes := make(chan int, count)
+	for i := 0; i < count; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			symbolArray := make([]uint64, StackSymbolArraySize)
+			for i := range indexes {
+				symbolize(i, symbolArray)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// UpdateLatestProfile after the data flushed
+func (r *Runner) UpdateLatestProfile(p *profile.Profile) {
+	r.latestProfile = p
+}
+
+func (r *Runner) LatestProfile() *profile.Profile {
+	return r.latestProfile
 }
 
 func (r *Runner) GenerateProfilingData(profilingInfo *profiling.Info, stackID uint32, stackMap *ebpf.Map,
 	stackType v3.EBPFProfilingStackType, symbolArray []uint64) *v3.EBPFProfilingStackMetadata {
+	metadata, _ := r.GenerateStack(profilingInfo, stackID, stackMap, stackType, symbolArray)
+	return metadata
+}
+
+// ProcessStack is the symbolized kernel and user space stack of the process
+type ProcessStack struct {
+	Metadatas []*v3.EBPFProfilingStackMetadata
+	// Locations from the leaf to the root, the kernel locations are before the user space locations
+	Locations []*profile.Location
+}
+
+// GenerateProcessStack symbolize the kernel and user space stacks of the process
+func (r *Runner) GenerateProcessStack(kernelInfo, processInfo *profiling.Info, kernelStackID, userStackID uint32,
+	stackMap *ebpf.Map, symbolArray []uint64) *ProcessStack {
+	result := &ProcessStack{}
+	if d, l := r.GenerateStack(kernelInfo, kernelStackID, stackMap,
+		v3.EBPFProfilingStackType_PROCESS_KERNEL_SPACE, symbolArray); d != nil {
+		result.Metadatas = append(result.Metadatas, d)
+		result.Locations = append(result.Locations, l...)
+	}
+	if d, l := r.GenerateStack(processInfo, userStackID, stackMap,
+		v3.EBPFProfilingStackType_PROCESS_USER_SPACE, symbolArray); d != nil {
+		result.Metadatas = append(result.Metadatas, d)
+		result.Locations = append(result.Locations, l...)
+	}
+	return result
+}
+
+// GenerateStack lookup the stack addresses and symbolize them,
+// returns the backend protocol metadata and the locations(from the leaf to the root) of the stack
+func (r *Runner) GenerateStack(profilingInfo *profiling.Info, stackID uint32, stackMap *ebpf.Map,
+	stackType v3.EBPFProfilingStackType, symbolArray []uint64) (*v3.EBPFProfilingStackMetadata, []*profile.Location) {
 	if profilingInfo == nil || stackID <= 0 || stackID == math.MaxUint32 {
-		return nil
+		return nil, nil
 	}
 	if err := stackMap.Lookup(stackID, symbolArray); err != nil {
+		r.stackNotFoundMutex.Lock()
+		defer r.stackNotFoundMutex.Unlock()
 		if r.StackNotFoundCache[stackID] {
-			return nil
+			return nil, nil
 		}
 		r.StackNotFoundCache[stackID] = true
 		log.Warnf("error to lookup %v stack: %d, error: %v", stackType, stackID, err)
-		return nil
+		return nil, nil
+	}
+	symbols := make([]string, 0)
+	locations := make([]*profile.Location, 0)
+	for _, addr := range symbolArray {
+		if addr <= 0 {
+			continue
+		}
+		frames := profilingInfo.FindFrames(addr)
+		if len(frames) == 0 {
+			frames = []*profiling.Frame{{Name: MissingSymbol}}
+		}
+		for _, f := range frames {
+			symbols = append(symbols, f.Name)
+		}
+		locations = append(locations, &profile.Location{
+			Address: addr,
+			Kernel:  stackType == v3.EBPFProfilingStackType_PROCESS_KERNEL_SPACE,
+			Frames:  frames,
+		})
 	}
-	symbols := profilingInfo.FindSymbols(symbolArray, MissingSymbol)
 	if len(symbols) == 0 {
-		return nil
+		return nil, nil
 	}
 	for _, s := range symbols {
 		if s != "[MISSING]" {
@@ -66,5 +176,5 @@ func (r *Runner) GenerateProfilingData(profilingInfo *profiling.Info, stackID ui
 		StackType:    stackType,
 		StackId:      int32(stackID),
 		StackSymbols: symbols,
-	}
+	}, locations
 }
@@ -0,0 +1,54 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package base
+
+import (
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParallelSymbolize(t *testing.T) {
+	tests := []struct {
+		name      string
+		parallels int
+		count     int
+	}{
+		{name: "single worker", parallels: 1, count: 10},
+		{name: "multiple workers", parallels: 4, count: 100},
+		{name: "workers more than stacks", parallels: 8, count: 3},
+		{name: "no stacks", parallels: 4, count: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewBaseRunner(&TaskConfig{SymbolizeParallels: tt.parallels})
+			results := make([]int, tt.count)
+			var executed int32
+			r.ParallelSymbolize(tt.count, func(index int, symbolArray []uint64) {
+				assert.Len(t, symbolArray, StackSymbolArraySize)
+				atomic.AddInt32(&executed, 1)
+				results[index] = index + 1
+			})
+			assert.Equal(t, int32(tt.count), executed)
+			for i, r := range results {
+				assert.Equal(t, i+1, r)
+			}
+		})
+	}
+}
@@ -29,6 +29,21 @@ import (
 	v3 "skywalking.apache.org/repo/goapi/collect/common/v3"
 )
 
+// Origin of the profiling task
+type Origin string
+
+const (
+	OriginBackend    Origin = "backend"
+	OriginContinuous Origin = "continuous"
+	OriginStandalone Origin = "standalone"
+	OriginLocal      Origin = "local"
+)
+
+// IsLocal means the task is created in the agent and unknown by the backend
+func (o Origin) IsLocal() bool {
+	return o == OriginStandalone || o == OriginLocal
+}
+
 type ProfilingTask struct {
 	// TaskID of profiling task
 	TaskID string
@@ -45,6 +60,8 @@ type ProfilingTask struct {
 	// MaxRunningDuration of task
 	MaxRunningDuration time.Duration
 	ExtensionConfig    *ExtensionConfig
+	// Origin of the task, where the task is created from
+	Origin Origin
 }
 
 func ProfilingTaskFromCommand(command *v3.Command) (*ProfilingTask, error) {
@@ -76,6 +93,7 @@ func ProfilingTaskFromCommand(command *v3.Command) (*ProfilingTask, error) {
 		TargetType:      targetType,
 		TriggerType:     triggerType,
 		ExtensionConfig: extensionConfig,
+		Origin:          OriginBackend,
 	}
 
 	if err := task.TriggerType.InitTask(task, command); err != nil {
@@ -98,6 +116,7 @@ func ProfilingTaskFromContinuous(processes []api.ProcessInterface, taskSetter fu
 		UpdateTime:    0,
 		StartTime:     0,
 		TriggerType:   TriggerTypeFixedTime,
+		Origin:        OriginContinuous,
 	}
 	taskSetter(task)
 
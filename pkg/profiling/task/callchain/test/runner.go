@@ -64,7 +64,7 @@ func NewRunner(config *base.TaskConfig, moduleMgr *module.Manager) (base.Profile
 		return nil, fmt.Errorf("the ON_CPU dump period could not be smaller than 1ms")
 	}
 	return &Runner{
-		base:          base.NewBaseRunner(),
+		base:          base.NewBaseRunner(config),
 		dumpFrequency: time.Second.Milliseconds() / dumpPeriod.Milliseconds(),
 	}, nil
 }
@@ -101,3 +101,32 @@ func (c *Context) IsRunning() bool {
 func (c *Context) RunningTime() time.Time {
 	return c.startRunningTime
 }
+
+// Status of the task, works for displaying the running tasks
+type Status struct {
+	TaskID             string           `json:"taskId"`
+	TargetType         base.TargetType  `json:"targetType"`
+	TriggerType        base.TriggerType `json:"triggerType"`
+	Origin             base.Origin      `json:"origin"`
+	Pids               []int32          `json:"pids"`
+	Running            bool             `json:"running"`
+	StartRunningTime   time.Time        `json:"startRunningTime"`
+	MaxRunningDuration time.Duration    `json:"maxRunningDuration"`
+}
+
+func (c *Context) Status() *Status {
+	pids := make([]int32, 0, len(c.processes))
+	for _, p := range c.processes {
+		pids = append(pids, p.Pid())
+	}
+	return &Status{
+		TaskID:             c.task.TaskID,
+		TargetType:         c.task.TargetType,
+		TriggerType:        c.task.TriggerType,
+		Origin:             c.task.Origin,
+		Pids:               pids,
+		Running:            c.IsRunning(),
+		StartRunningTime:   c.startRunningTime,
+		MaxRunningDuration: c.task.MaxRunningDuration,
+	}
+}
@@ -0,0 +1,96 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package task
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/task/base"
+)
+
+var (
+	// ErrTaskNotFound means the task is not running or already removed
+	ErrTaskNotFound = errors.New("the task is not found")
+	// ErrTaskConflict means there have another running task with the same processes and target type
+	ErrTaskConflict = errors.New("another task of the processes is running")
+)
+
+// CreateLocalTask runs the task as the backend tasks, the task is created locally and the data is sent to the sink.
+// The CPU profiling only supports one process, the network profiling supports the processes of the pids.
+func (m *Manager) CreateLocalTask(pids []int32, targetType base.TargetType, duration time.Duration) (*Status, error) {
+	if len(pids) == 0 {
+		return nil, fmt.Errorf("the pids must be provided")
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("the duration must be bigger than 0")
+	}
+	processes := make([]api.ProcessInterface, 0, len(pids))
+	for _, pid := range pids {
+		found := m.processOperator.FindProcessByPID(pid)
+		if len(found) == 0 {
+			return nil, fmt.Errorf("%w: %d", ErrProcessNotFound, pid)
+		}
+		processes = append(processes, found...)
+	}
+	if targetType != base.TargetTypeNetworkTopology && len(processes) != 1 {
+		return nil, fmt.Errorf("the %s profiling only supports one process, found %d processes", targetType, len(processes))
+	}
+
+	now := time.Now()
+	taskSetter := func(t *base.ProfilingTask) {
+		t.Origin = base.OriginLocal
+		t.TargetType = targetType
+		t.MaxRunningDuration = duration
+		t.StartTime = now.UnixMilli()
+		t.UpdateTime = now.UnixMilli()
+	}
+	c, err := m.BuildContextFromContinuous(processes, taskSetter, func() (string, error) {
+		return fmt.Sprintf("local-%d", now.UnixNano()), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := m.StartLocalTask(c); err != nil {
+		return nil, err
+	}
+	return c.Status(), nil
+}
+
+// StartLocalTask starts the task created in the agent, such as the local and standalone tasks,
+// the task could not replace the running task of the same processes, such as the backend task
+func (m *Manager) StartLocalTask(c *Context) error {
+	if exist := m.findTask(c.BuildTaskIdentity()); exist != nil && exist.status != Stopped {
+		return fmt.Errorf("%w: %s", ErrTaskConflict, exist.TaskID())
+	}
+	m.StartTask(c)
+	return nil
+}
+
+// CancelTask stops the task and removes it from the manager
+func (m *Manager) CancelTask(taskID string) error {
+	for _, t := range m.allTasks() {
+		if t.TaskID() == taskID {
+			log.Infof("cancel the profiling task: %s", taskID)
+			return m.ShutdownAndRemoveTask(t)
+		}
+	}
+	return ErrTaskNotFound
+}
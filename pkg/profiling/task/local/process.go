@@ -0,0 +1,109 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package local
+
+import (
+	"fmt"
+
+	"github.com/shirou/gopsutil/process"
+
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/process/finders/base"
+	"perfprofiler/pkg/tools/profiling"
+)
+
+// NewProcesses by the pids, the entity of the process is optional.
+// The processes should be released by ReleaseProcesses when not used.
+func NewProcesses(pids []int32, entities map[int32]*api.ProcessEntity) ([]api.ProcessInterface, error) {
+	processes := make([]api.ProcessInterface, 0, len(pids))
+	for _, pid := range pids {
+		p, err := newLocalProcess(pid, entities[pid])
+		if err != nil {
+			ReleaseProcesses(processes)
+			return nil, err
+		}
+		processes = append(processes, p)
+	}
+	return processes, nil
+}
+
+// ReleaseProcesses releases the symbol tables of the processes
+func ReleaseProcesses(processes []api.ProcessInterface) {
+	for _, p := range processes {
+		p.ProfilingStat().Release()
+	}
+}
+
+// localProcess is the process found by the pid directly, not tracked by the process finders
+type localProcess struct {
+	original  *process.Process
+	pid       int32
+	entity    *api.ProcessEntity
+	profiling *profiling.Info
+}
+
+func newLocalProcess(pid int32, entity *api.ProcessEntity) (*localProcess, error) {
+	original, err := process.NewProcess(pid)
+	if err != nil {
+		return nil, fmt.Errorf("could not find the process %d: %v", pid, err)
+	}
+	stat, err := base.BuildProfilingStat(original)
+	if err != nil {
+		return nil, fmt.Errorf("the process %d could not be profiling: %v", pid, err)
+	}
+	if entity == nil {
+		name, _ := original.Name()
+		entity = &api.ProcessEntity{ProcessName: name}
+	}
+	return &localProcess{original: original, pid: pid, entity: entity, profiling: stat}, nil
+}
+
+func (p *localProcess) ID() string {
+	return fmt.Sprintf("local-%d", p.pid)
+}
+
+func (p *localProcess) Pid() int32 {
+	return p.pid
+}
+
+func (p *localProcess) DetectType() api.ProcessDetectType {
+	return api.Scanner
+}
+
+func (p *localProcess) Entity() *api.ProcessEntity {
+	return p.entity
+}
+
+func (p *localProcess) ProfilingStat() *profiling.Info {
+	return p.profiling
+}
+
+func (p *localProcess) ExeName() (string, error) {
+	return p.original.Exe()
+}
+
+func (p *localProcess) OriginalProcess() *process.Process {
+	return p.original
+}
+
+func (p *localProcess) PortIsExpose(port int) bool {
+	return false
+}
+
+func (p *localProcess) DetectNewExposePort(port int) {
+}
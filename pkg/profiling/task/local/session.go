@@ -0,0 +1,124 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package local runs the profiling runners on the processes found by the pid directly,
+// works for the command line tools which run without the agent modules.
+package local
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/profiling/task"
+	"perfprofiler/pkg/profiling/task/base"
+)
+
+// Session runs the profiling runners of a target type on the processes, each process has its own runner
+type Session struct {
+	config    *base.TaskConfig
+	processes []api.ProcessInterface
+
+	targetType base.TargetType
+	runners    []base.ProfileTaskRunner
+}
+
+// NewSession for the processes, the entity of the process is optional
+func NewSession(config *base.TaskConfig, pids []int32, entities map[int32]*api.ProcessEntity) (*Session, error) {
+	processes, err := NewProcesses(pids, entities)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{config: config, processes: processes}, nil
+}
+
+// TargetType of the running runners
+func (s *Session) TargetType() base.TargetType {
+	return s.targetType
+}
+
+// Start the runners of the target type, the running runners are stopped first
+func (s *Session) Start(ctx context.Context, targetType base.TargetType) error {
+	s.stopRunners()
+	s.targetType = targetType
+	for _, p := range s.processes {
+		runner, err := StartRunner(ctx, s.config, targetType, p)
+		if err != nil {
+			s.stopRunners()
+			return err
+		}
+		s.runners = append(s.runners, runner)
+	}
+	return nil
+}
+
+// Flush the data of all runners, returns the profiles since the last flush
+func (s *Session) Flush() ([]*profile.Profile, error) {
+	var result []*profile.Profile
+	var err error
+	for _, r := range s.runners {
+		p, e := FlushProfile(r)
+		if e != nil {
+			err = multierror.Append(err, e)
+			continue
+		}
+		if p != nil {
+			result = append(result, p)
+		}
+	}
+	return result, err
+}
+
+// Close stops the runners and releases the processes
+func (s *Session) Close() {
+	s.stopRunners()
+	ReleaseProcesses(s.processes)
+}
+
+func (s *Session) stopRunners() {
+	for _, r := range s.runners {
+		StopRunner(r)
+	}
+	s.runners = nil
+}
+
+// StartRunner of the target type on the process, returns after the runner started.
+// The runner must provide the profile, and should be stopped by StopRunner.
+func StartRunner(ctx context.Context, config *base.TaskConfig, targetType base.TargetType,
+	p api.ProcessInterface) (base.ProfileTaskRunner, error) {
+	return task.StartProfileRunner(ctx, config, nil, &base.ProfilingTask{
+		TaskID:        fmt.Sprintf("local-%d-%d", p.Pid(), time.Now().UnixMilli()),
+		ProcessIDList: []string{p.ID()},
+		StartTime:     time.Now().UnixMilli(),
+		TriggerType:   base.TriggerTypeFixedTime,
+		TargetType:    targetType,
+	}, p)
+}
+
+// FlushProfile of the runner since the last flush, return nil if no data flushed
+func FlushProfile(runner base.ProfileTaskRunner) (*profile.Profile, error) {
+	return task.FlushProfile(runner)
+}
+
+// StopRunner in the background, the final data is flushed before releasing the resources
+func StopRunner(runner base.ProfileTaskRunner) {
+	task.StopProfileRunner(runner)
+}
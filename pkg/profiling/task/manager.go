@@ -20,6 +20,7 @@ package task
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -29,10 +30,14 @@ import (
 	"perfprofiler/pkg/module"
 	"perfprofiler/pkg/process"
 	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/profiling/sink"
 	"perfprofiler/pkg/profiling/task/base"
 
 	common_v3 "skywalking.apache.org/repo/goapi/collect/common/v3"
 	profiling_v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
+
+	"github.com/hashicorp/go-multierror"
 )
 
 var log = logger.GetLogger("profiling", "task")
@@ -41,19 +46,26 @@ type Manager struct {
 	moduleMgr       *module.Manager
 	processOperator process.Operator
 	profilingClient profiling_v3.EBPFProfilingServiceClient
-	ctx             context.Context
-	cancel          context.CancelFunc
-	taskConfig      *base.TaskConfig
+	sink            sink.Sink
+	// the sink of the local tasks, excluding the backend
+	localSink  sink.Sink
+	ctx        context.Context
+	cancel     context.CancelFunc
+	taskConfig *base.TaskConfig
 
 	tasks          map[string]*Context
+	tasksMutex     sync.Mutex
 	instanceID     string
 	lastUpdateTime int64
 }
 
-func NewManager(ctx context.Context, moduleMgr *module.Manager, taskConfig *base.TaskConfig) (*Manager, error) {
+func NewManager(ctx context.Context, moduleMgr *module.Manager, taskConfig *base.TaskConfig, dataSink sink.Sink) (*Manager, error) {
 	coreOperator := moduleMgr.FindModule(core.ModuleName).(core.Operator)
-	connection := coreOperator.BackendOperator().GetConnection()
-	profilingClient := profiling_v3.NewEBPFProfilingServiceClient(connection)
+	// the tasks are not queried when working without the backend
+	var profilingClient profiling_v3.EBPFProfilingServiceClient
+	if backend := coreOperator.BackendOperator(); backend != nil {
+		profilingClient = profiling_v3.NewEBPFProfilingServiceClient(backend.GetConnection())
+	}
 	processOperator := moduleMgr.FindModule(process.ModuleName).(process.Operator)
 	if err := CheckProfilingTaskConfig(taskConfig, moduleMgr); err != nil {
 		return nil, err
@@ -64,6 +76,8 @@ func NewManager(ctx context.Context, moduleMgr *module.Manager, taskConfig *base
 		moduleMgr:       moduleMgr,
 		processOperator: processOperator,
 		profilingClient: profilingClient,
+		sink:            dataSink,
+		localSink:       sink.WithoutBackend(dataSink),
 		taskConfig:      taskConfig,
 		tasks:           make(map[string]*Context),
 		instanceID:      coreOperator.InstanceID(),
@@ -95,7 +109,7 @@ func (m *Manager) BuildContextFromCommand(command *common_v3.Command) (*Context,
 
 	taskContext := &Context{task: t, processes: processes, status: NotRunning, recalcDuration: make(chan bool, 1)}
 	// check existing task, extended the running time
-	existTask := m.tasks[taskContext.BuildTaskIdentity()]
+	existTask := m.findTask(taskContext.BuildTaskIdentity())
 	// if task are same, then just rewrite the task information and return
 	if existTask != nil && existTask.IsSameTask(taskContext) {
 		existTask.task = t
@@ -115,7 +129,7 @@ func (m *Manager) BuildContextFromContinuous(processes []api.ProcessInterface,
 
 	taskContext := &Context{task: task, processes: processes, status: NotRunning, recalcDuration: make(chan bool, 1)}
 	// if the task already exist, then return error
-	existTask := m.tasks[taskContext.BuildTaskIdentity()]
+	existTask := m.findTask(taskContext.BuildTaskIdentity())
 	// if task are same, then just rewrite the task information and return
 	if existTask != nil && existTask.IsSameTask(taskContext) {
 		return nil, fmt.Errorf("already exist profiling task, so ignore")
@@ -154,7 +168,7 @@ func (m *Manager) initTaskContext(taskContext *Context) error {
 func (m *Manager) StartTask(c *Context) {
 	// shutdown task if exists
 	taskIdentity := c.BuildTaskIdentity()
-	existTask := m.tasks[taskIdentity]
+	existTask := m.findTask(taskIdentity)
 	if existTask != nil {
 		// just extend the task time if the task are same
 		if c.IsSameTask(existTask) {
@@ -164,16 +178,18 @@ func (m *Manager) StartTask(c *Context) {
 		}
 
 		// close task if not same
-		id := m.tasks[taskIdentity].TaskID()
+		id := existTask.TaskID()
 		log.Infof("existing profiling task: %s, so need to stop it", id)
-		if err := m.ShutdownAndRemoveTask(m.tasks[taskIdentity]); err != nil {
+		if err := m.ShutdownAndRemoveTask(existTask); err != nil {
 			log.Warnf("shutdown existing profiling task failure, so cannot to start new profiling task: %v. reason: %v", c.task.TaskID, err)
 			return
 		}
 	}
 
 	currentMilli := time.Now().UnixNano() / int64(time.Millisecond)
+	m.tasksMutex.Lock()
 	m.tasks[taskIdentity] = c
+	m.tasksMutex.Unlock()
 
 	// already reach time
 	if currentMilli >= c.task.StartTime {
@@ -202,11 +218,11 @@ func (m *Manager) runTask(c *Context) {
 	go func() {
 		defer func() {
 			wg.Done()
-			c.status = Stopped
+			m.updateStatus(c, Stopped)
 		}()
 
 		notify := func() {
-			c.status = Running
+			m.updateStatus(c, Running)
 			c.startRunningTime = time.Now()
 			m.afterProfilingStartSuccess(c)
 		}
@@ -267,24 +283,97 @@ func (m *Manager) shutdownTask(c *Context) error {
 
 func (m *Manager) ShutdownAndRemoveTask(c *Context) error {
 	err := m.shutdownTask(c)
+	m.tasksMutex.Lock()
 	delete(m.tasks, c.BuildTaskIdentity())
+	m.tasksMutex.Unlock()
 	return err
 }
 
+// latestProfile of the task which flushed, return nil if the runner not support or no samples
+func (m *Manager) latestProfile(t *Context) *profile.Profile {
+	runner, ok := t.runner.(base.ProfileRunner)
+	if !ok {
+		return nil
+	}
+	p := runner.LatestProfile()
+	if p == nil || len(p.Samples) == 0 {
+		return nil
+	}
+	return p
+}
+
+func (m *Manager) findTask(identity string) *Context {
+	m.tasksMutex.Lock()
+	defer m.tasksMutex.Unlock()
+	return m.tasks[identity]
+}
+
+func (m *Manager) allTasks() []*Context {
+	m.tasksMutex.Lock()
+	defer m.tasksMutex.Unlock()
+	result := make([]*Context, 0, len(m.tasks))
+	for _, t := range m.tasks {
+		result = append(result, t)
+	}
+	return result
+}
+
+// ActiveTasks returns the status of the tasks which not removed
+func (m *Manager) ActiveTasks() []*Status {
+	tasks := m.allTasks()
+	result := make([]*Status, 0, len(tasks))
+	for _, t := range tasks {
+		result = append(result, t.Status())
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].TaskID < result[j].TaskID
+	})
+	return result
+}
+
 func (m *Manager) Shutdown() error {
 	m.cancel()
 	return nil
 }
 
-func (m *Manager) checkStoppedTaskAndRemoved() {
-	for identity, t := range m.tasks {
+// updateStatus of the task, the flush reads the status at the same time
+func (m *Manager) updateStatus(c *Context, status RunningStatus) {
+	m.tasksMutex.Lock()
+	defer m.tasksMutex.Unlock()
+	c.status = status
+}
+
+// flushingTasks returns all the tasks and the tasks which already stopped before flushing,
+// only the stopped tasks could be removed after flush, their data is not lost
+func (m *Manager) flushingTasks() (tasks, stopped []*Context) {
+	m.tasksMutex.Lock()
+	defer m.tasksMutex.Unlock()
+	tasks = make([]*Context, 0, len(m.tasks))
+	for _, t := range m.tasks {
+		tasks = append(tasks, t)
 		if t.status == Stopped {
+			stopped = append(stopped, t)
+		}
+	}
+	return tasks, stopped
+}
+
+func (m *Manager) checkStoppedTaskAndRemoved(stopped []*Context) {
+	m.tasksMutex.Lock()
+	defer m.tasksMutex.Unlock()
+	for _, t := range stopped {
+		identity := t.BuildTaskIdentity()
+		// the task could be replaced while flushing
+		if m.tasks[identity] == t {
 			delete(m.tasks, identity)
 		}
 	}
 }
 
 func (m *Manager) StartingWatchTask() error {
+	if m.profilingClient == nil {
+		return nil
+	}
 	// query task
 	tasks, err := m.profilingClient.QueryTasks(m.ctx, &profiling_v3.EBPFProfilingTaskQuery{
 		RoverInstanceId:  m.instanceID,
@@ -339,24 +428,30 @@ func (m *Manager) StartingWatchTask() error {
 }
 
 func (m *Manager) FlushProfilingData() error {
+	tasks, stopped := m.flushingTasks()
 	// cleanup the stopped after flush profiling data to make sure all the profiling data been sent
-	defer m.checkStoppedTaskAndRemoved()
-	if len(m.tasks) == 0 {
+	defer m.checkStoppedTaskAndRemoved(stopped)
+	if len(tasks) == 0 {
 		return nil
 	}
 
-	stream, err := m.profilingClient.CollectProfilingData(m.ctx)
-	if err != nil {
-		return err
-	}
 	currentMilli := time.Now().UnixMilli()
 	totalSendCount := make(map[string]int)
-	for _, t := range m.tasks {
+	sendData := make([]*profiling_v3.EBPFProfilingData, 0)
+	localData := make([]*profiling_v3.EBPFProfilingData, 0)
+	sendProfiles := make([]*profile.Profile, 0)
+	localProfiles := make([]*profile.Profile, 0)
+	for _, t := range tasks {
 		data, err1 := t.runner.FlushData()
 		if err1 != nil {
 			log.Warnf("reading profiling task data failure. taskId: %s, error: %v", t.task.TaskID, err1)
 			continue
 		}
+		if p := m.latestProfile(t); p != nil && t.task.Origin.IsLocal() {
+			localProfiles = append(localProfiles, p)
+		} else if p != nil {
+			sendProfiles = append(sendProfiles, p)
+		}
 
 		if len(data) == 0 {
 			continue
@@ -370,18 +465,40 @@ func (m *Manager) FlushProfilingData() error {
 			ProfilingStartTime: t.startRunningTime.UnixMilli(),
 			CurrentTime:        currentMilli,
 		}
-
-		for _, d := range data {
-			// send each data, stop flush data if the stream have found error
-			if err1 := stream.Send(d); err1 != nil {
-				return err1
-			}
+		// the backend does not know the local tasks, so their data is only kept in the agent
+		if t.task.Origin.IsLocal() {
+			localData = append(localData, data...)
+			continue
 		}
+		sendData = append(sendData, data...)
 	}
 
 	if len(totalSendCount) > 0 {
 		log.Infof("send profiling data summary: %v", totalSendCount)
 	}
-	_, err = stream.CloseAndRecv()
-	return err
+	var result error
+	if len(sendData) > 0 {
+		if err := m.sink.SendProfilingData(m.ctx, sendData); err != nil {
+			result = multierror.Append(result, fmt.Errorf("sending to the %s sink failure: %v", m.sink.Name(), err))
+		}
+	}
+	if len(localData) > 0 {
+		if err := m.localSink.SendProfilingData(m.ctx, localData); err != nil {
+			result = multierror.Append(result, fmt.Errorf("sending the local tasks data to the %s sink failure: %v",
+				m.localSink.Name(), err))
+		}
+	}
+	// the profiles are sent even the profiling data sending failure
+	if len(sendProfiles) > 0 {
+		if err := m.sink.SendProfiles(m.ctx, sendProfiles); err != nil {
+			result = multierror.Append(result, fmt.Errorf("sending the profiles to the %s sink failure: %v", m.sink.Name(), err))
+		}
+	}
+	if len(localProfiles) > 0 {
+		if err := m.localSink.SendProfiles(m.ctx, localProfiles); err != nil {
+			result = multierror.Append(result, fmt.Errorf("sending the local tasks profiles to the %s sink failure: %v",
+				m.localSink.Name(), err))
+		}
+	}
+	return result
 }
@@ -31,6 +31,7 @@ import (
 	"perfprofiler/pkg/logger"
 	"perfprofiler/pkg/module"
 	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/profile"
 	"perfprofiler/pkg/profiling/task/base"
 	"perfprofiler/pkg/tools/btf"
 	"perfprofiler/pkg/tools/process"
@@ -58,9 +59,12 @@ type StackCounter struct {
 
 type Runner struct {
 	base             *base.Runner
+	taskID           string
 	pid              int32
+	entity           *api.ProcessEntity
 	processProfiling *profiling.Info
 	kernelProfiling  *profiling.Info
+	lastFlushTime    time.Time
 
 	// runtime
 	previousStacks  map[ProcessStack]StackCounter
@@ -72,7 +76,7 @@ type Runner struct {
 
 func NewRunner(config *base.TaskConfig, moduleMgr *module.Manager) (base.ProfileTaskRunner, error) {
 	return &Runner{
-		base: base.NewBaseRunner(),
+		base: base.NewBaseRunner(config),
 	}, nil
 }
 
@@ -81,7 +85,9 @@ func (r *Runner) Init(task *base.ProfilingTask, processes []api.ProcessInterface
 		return fmt.Errorf("the processes count must be 1, current is: %d", len(processes))
 	}
 	curProcess := processes[0]
+	r.taskID = task.TaskID
 	r.pid = curProcess.Pid()
+	r.entity = curProcess.Entity()
 	r.processProfiling = curProcess.ProfilingStat()
 	kernelProfiling, err := process.KernelFileProfilingStat()
 	if err != nil {
@@ -90,6 +96,7 @@ func (r *Runner) Init(task *base.ProfilingTask, processes []api.ProcessInterface
 	r.kernelProfiling = kernelProfiling
 	r.previousStacks = make(map[ProcessStack]StackCounter)
 	r.stopChan = make(chan bool, 1)
+	r.lastFlushTime = time.Now()
 	return nil
 }
 
@@ -169,27 +176,41 @@ func (r *Runner) Stop() error {
 
 func (r *Runner) FlushData() ([]*v3.EBPFProfilingData, error) {
 	if r.bpf == nil {
+		r.base.UpdateLatestProfile(nil)
 		return nil, nil
 	}
 	var stack ProcessStack
 	var counter StackCounter
 	iterate := r.bpf.Counts.Iterate()
 	stacks := r.bpf.Stacks
-	result := make([]*v3.EBPFProfilingData, 0)
-	stackSymbols := make([]uint64, 100)
+	processStacks := make([]ProcessStack, 0)
+	counters := make([]StackCounter, 0)
 	for iterate.Next(&stack, &counter) {
-		metadatas := make([]*v3.EBPFProfilingStackMetadata, 0)
-		// kernel stack
-		if d := r.base.GenerateProfilingData(r.kernelProfiling, stack.KernelStackID, stacks,
-			v3.EBPFProfilingStackType_PROCESS_KERNEL_SPACE, stackSymbols); d != nil {
-			metadatas = append(metadatas, d)
-		}
-		// user stack
-		if d := r.base.GenerateProfilingData(r.processProfiling, stack.UserStackID, stacks,
-			v3.EBPFProfilingStackType_PROCESS_USER_SPACE, stackSymbols); d != nil {
-			metadatas = append(metadatas, d)
-		}
+		processStacks = append(processStacks, stack)
+		counters = append(counters, counter)
+	}
+
+	// symbolize the stacks on the worker pool
+	symbolizedStacks := make([]*base.ProcessStack, len(processStacks))
+	r.base.ParallelSymbolize(len(processStacks), func(index int, stackSymbols []uint64) {
+		symbolizedStacks[index] = r.base.GenerateProcessStack(r.kernelProfiling, r.processProfiling,
+			processStacks[index].KernelStackID, processStacks[index].UserStackID, stacks, stackSymbols)
+	})
 
+	result := make([]*v3.EBPFProfilingData, 0)
+	flushTime := time.Now()
+	pro := &profile.Profile{
+		TaskID:    r.taskID,
+		Type:      profile.TypeOffCPU,
+		Pid:       r.pid,
+		Entity:    r.entity,
+		StartTime: r.lastFlushTime,
+		EndTime:   flushTime,
+		Modules:   r.processProfiling.GetModules(),
+	}
+	r.lastFlushTime = flushTime
+	for i, stack := range processStacks {
+		metadatas, counter := symbolizedStacks[i].Metadatas, counters[i]
 		if len(metadatas) == 0 {
 			continue
 		}
@@ -216,10 +237,20 @@ func (r *Runner) FlushData() ([]*v3.EBPFProfilingData, error) {
 				},
 			},
 		})
+		pro.Samples = append(pro.Samples, &profile.Sample{
+			Locations: symbolizedStacks[i].Locations,
+			Count:     int64(switchCount),
+			Duration:  duration,
+		})
 	}
+	r.base.UpdateLatestProfile(pro)
 
 	if r.flushDataNotify != nil {
 		r.flushDataNotify()
 	}
 	return result, nil
 }
+
+func (r *Runner) LatestProfile() *profile.Profile {
+	return r.base.LatestProfile()
+}
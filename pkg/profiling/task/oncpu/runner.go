@@ -30,6 +30,7 @@ import (
 	"perfprofiler/pkg/logger"
 	"perfprofiler/pkg/module"
 	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/profile"
 	"perfprofiler/pkg/profiling/task/base"
 	"perfprofiler/pkg/tools/process"
 	"perfprofiler/pkg/tools/profiling"
@@ -52,10 +53,14 @@ type Event struct {
 
 type Runner struct {
 	base             *base.Runner
+	taskID           string
 	pid              int32
+	entity           *api.ProcessEntity
 	processProfiling *profiling.Info
 	kernelProfiling  *profiling.Info
+	dumpPeriod       time.Duration
 	dumpFrequency    int64
+	lastFlushTime    time.Time
 
 	// runtime
 	perfEventFds    []int
@@ -77,7 +82,8 @@ func NewRunner(config *base.TaskConfig, moduleMgr *module.Manager) (base.Profile
 		return nil, fmt.Errorf("the ON_CPU dump period could not be smaller than 1ms")
 	}
 	return &Runner{
-		base:          base.NewBaseRunner(),
+		base:          base.NewBaseRunner(config),
+		dumpPeriod:    dumpPeriod,
 		dumpFrequency: time.Second.Milliseconds() / dumpPeriod.Milliseconds(),
 	}, nil
 }
@@ -87,7 +93,9 @@ func (r *Runner) Init(task *base.ProfilingTask, processes []api.ProcessInterface
 		return fmt.Errorf("the processes count must be 1, current is: %d", len(processes))
 	}
 	curProcess := processes[0]
+	r.taskID = task.TaskID
 	r.pid = curProcess.Pid()
+	r.entity = curProcess.Entity()
 	// process profiling stat
 	if r.processProfiling = curProcess.ProfilingStat(); r.processProfiling == nil {
 		return fmt.Errorf("this process could not be profiling")
@@ -100,6 +108,7 @@ func (r *Runner) Init(task *base.ProfilingTask, processes []api.ProcessInterface
 	r.kernelProfiling = kernelProfiling
 	r.stackCounter = make(map[Event]uint32)
 	r.stopChan = make(chan bool, 1)
+	r.lastFlushTime = time.Now()
 	return nil
 }
 
@@ -210,28 +219,42 @@ func (r *Runner) Stop() error {
 
 func (r *Runner) FlushData() ([]*v3.EBPFProfilingData, error) {
 	if r.bpf == nil {
+		r.base.UpdateLatestProfile(nil)
 		return nil, nil
 	}
 	var stack Event
 	var counter uint32
 	iterate := r.bpf.Counts.Iterate()
 	stacks := r.bpf.Stacks
-	result := make([]*v3.EBPFProfilingData, 0)
-	stackSymbols := make([]uint64, 100)
+	events := make([]Event, 0)
+	counters := make([]uint32, 0)
 	for iterate.Next(&stack, &counter) {
-		metadatas := make([]*v3.EBPFProfilingStackMetadata, 0)
-		// kernel stack
-		if d := r.base.GenerateProfilingData(r.kernelProfiling, stack.KernelStackID, stacks,
-			v3.EBPFProfilingStackType_PROCESS_KERNEL_SPACE, stackSymbols); d != nil {
-			metadatas = append(metadatas, d)
-		}
+		events = append(events, stack)
+		counters = append(counters, counter)
+	}
 
-		// user stack
-		if d := r.base.GenerateProfilingData(r.processProfiling, stack.UserStackID, stacks,
-			v3.EBPFProfilingStackType_PROCESS_USER_SPACE, stackSymbols); d != nil {
-			metadatas = append(metadatas, d)
-		}
+	// symbolize the stacks on the worker pool
+	processStacks := make([]*base.ProcessStack, len(events))
+	r.base.ParallelSymbolize(len(events), func(index int, stackSymbols []uint64) {
+		processStacks[index] = r.base.GenerateProcessStack(r.kernelProfiling, r.processProfiling,
+			events[index].KernelStackID, events[index].UserStackID, stacks, stackSymbols)
+	})
 
+	result := make([]*v3.EBPFProfilingData, 0)
+	flushTime := time.Now()
+	pro := &profile.Profile{
+		TaskID:    r.taskID,
+		Type:      profile.TypeOnCPU,
+		Pid:       r.pid,
+		Entity:    r.entity,
+		StartTime: r.lastFlushTime,
+		EndTime:   flushTime,
+		Period:    r.dumpPeriod.Nanoseconds(),
+		Modules:   r.processProfiling.GetModules(),
+	}
+	r.lastFlushTime = flushTime
+	for i, stack := range events {
+		metadatas, counter := processStacks[i].Metadatas, counters[i]
 		if len(metadatas) == 0 {
 			continue
 		}
@@ -255,7 +278,13 @@ func (r *Runner) FlushData() ([]*v3.EBPFProfilingData, error) {
 				},
 			},
 		})
+		pro.Samples = append(pro.Samples, &profile.Sample{
+			Locations: processStacks[i].Locations,
+			Count:     int64(dumpCount),
+			Duration:  int64(dumpCount) * pro.Period,
+		})
 	}
+	r.base.UpdateLatestProfile(pro)
 
 	// close the flush data notify if exists
 	if r.flushDataNotify != nil {
@@ -265,6 +294,10 @@ func (r *Runner) FlushData() ([]*v3.EBPFProfilingData, error) {
 	return result, nil
 }
 
+func (r *Runner) LatestProfile() *profile.Profile {
+	return r.base.LatestProfile()
+}
+
 func (r *Runner) closePerfEvent(fd int) error {
 	if fd <= 0 {
 		return nil
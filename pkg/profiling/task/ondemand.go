@@ -0,0 +1,137 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package task
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"perfprofiler/pkg/module"
+	"perfprofiler/pkg/process/api"
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/profiling/task/base"
+)
+
+// ErrProcessNotFound means the process is not tracked by the agent
+var ErrProcessNotFound = errors.New("the process is not tracked")
+
+// ProfileOnDemand runs the profiling runner on the process for the duration, and returns the profile directly,
+// the profile is not uploaded to the backend
+func (m *Manager) ProfileOnDemand(ctx context.Context, pid int32, targetType base.TargetType,
+	duration time.Duration) (*profile.Profile, error) {
+	processes := m.processOperator.FindProcessByPID(pid)
+	if len(processes) == 0 {
+		return nil, ErrProcessNotFound
+	}
+	// the runners only support one process
+	process := processes[0]
+	t := &base.ProfilingTask{
+		TaskID:             fmt.Sprintf("on-demand-%d-%d", pid, time.Now().UnixMilli()),
+		ProcessIDList:      []string{process.ID()},
+		StartTime:          time.Now().UnixMilli(),
+		TriggerType:        base.TriggerTypeFixedTime,
+		TargetType:         targetType,
+		MaxRunningDuration: duration,
+	}
+	runner, err := StartProfileRunner(ctx, m.taskConfig, m.moduleMgr, t, process)
+	if err != nil {
+		return nil, err
+	}
+	log.Infof("on-demand %s profiling started, pid: %d, duration: %s", targetType, pid, duration)
+
+	select {
+	case <-time.After(duration):
+	case <-ctx.Done():
+		StopProfileRunner(runner)
+		return nil, ctx.Err()
+	}
+	result, err := FlushProfile(runner)
+	StopProfileRunner(runner)
+	if err != nil {
+		return nil, err
+	}
+	if result == nil {
+		return nil, fmt.Errorf("no profile flushed from the %s runner", targetType)
+	}
+	return result, nil
+}
+
+// StartProfileRunner of the task on the process, returns after the runner started, the module manager is optional.
+// The runner must provide the profile, and should be stopped by StopProfileRunner.
+func StartProfileRunner(ctx context.Context, config *base.TaskConfig, moduleMgr *module.Manager, t *base.ProfilingTask,
+	p api.ProcessInterface) (base.ProfileTaskRunner, error) {
+	runner, err := NewProfilingRunner(t.TargetType, config, moduleMgr)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := runner.(base.ProfileRunner); !ok {
+		return nil, fmt.Errorf("the %s runner could not provide the profile", t.TargetType)
+	}
+	if err = runner.Init(t, []api.ProcessInterface{p}); err != nil {
+		return nil, fmt.Errorf("could not init %s runner of pid %d: %v", t.TargetType, p.Pid(), err)
+	}
+	started, finished := make(chan struct{}), make(chan error, 1)
+	go func() {
+		finished <- runner.Run(ctx, func() {
+			close(started)
+		})
+	}()
+	select {
+	case <-started:
+		return runner, nil
+	case err = <-finished:
+		return nil, fmt.Errorf("starting the %s runner of pid %d failure: %v", t.TargetType, p.Pid(), err)
+	case <-ctx.Done():
+		// the runner may still be opening the perf events, stop it after started or failed,
+		// otherwise the opened events are never closed
+		go func() {
+			select {
+			case <-started:
+			case <-finished:
+			}
+			stopProfileRunner(runner)
+		}()
+		return nil, ctx.Err()
+	}
+}
+
+// FlushProfile of the runner since the last flush, return nil if no data flushed
+func FlushProfile(runner base.ProfileTaskRunner) (*profile.Profile, error) {
+	if _, err := runner.FlushData(); err != nil {
+		return nil, err
+	}
+	return runner.(base.ProfileRunner).LatestProfile(), nil
+}
+
+// StopProfileRunner in the background, the final data is flushed before releasing the resources
+func StopProfileRunner(runner base.ProfileTaskRunner) {
+	go func() {
+		if _, err := runner.FlushData(); err != nil {
+			log.Warnf("flush the data before stop the runner failure: %v", err)
+		}
+		stopProfileRunner(runner)
+	}()
+}
+
+func stopProfileRunner(runner base.ProfileTaskRunner) {
+	if err := runner.Stop(); err != nil {
+		log.Warnf("stop the profiling runner failure: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package top
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"perfprofiler/pkg/profiling/profile"
+)
+
+// the escape sequences to move the cursor to the top left and clear the screen
+const clearScreen = "\033[H\033[2J"
+
+// View is the content of a refresh in the terminal
+type View struct {
+	Time    time.Time
+	Pids    []int32
+	Table   *Table
+	Threads []*ThreadUsage
+	Frozen  bool
+	// ordered by the cumulative value
+	ByCumulative bool
+	// the max rows of the functions and threads, all rows are shown when not bigger than 0
+	FunctionRows int
+	ThreadRows   int
+	// the terminal width, the function names are truncated to it when bigger than 0
+	Width int
+	// the message of the last operation, such as switch the profiling type failure
+	Message string
+}
+
+// Render the view as text, the screen is cleared first when clear is true
+func Render(w io.Writer, v *View, clear bool) error {
+	out := bufio.NewWriter(w)
+	if clear {
+		out.WriteString(clearScreen)
+	}
+	table := v.Table
+	mode := fmt.Sprintf("%s/%s", typeName(table.Type), table.Space)
+	sortBy := "self"
+	if v.ByCumulative {
+		sortBy = "cumulative"
+	}
+	fmt.Fprintf(out, "perfprofiler top - %s  pids: %s  mode: %s  sort: %s  total: %s",
+		v.Time.Format("15:04:05"), joinPids(v.Pids), mode, sortBy, formatValue(table.Type, table.Total))
+	if v.Frozen {
+		out.WriteString("  [FROZEN]")
+	}
+	out.WriteString("\n")
+	out.WriteString("keys: u user  k kernel  o on-cpu  f off-cpu  c sort  space freeze  q quit\n")
+	if v.Message != "" {
+		fmt.Fprintf(out, "%s\n", v.Message)
+	}
+	out.WriteString("\n")
+
+	fmt.Fprintf(out, "%8s %8s %10s %10s  %s\n", "SELF%", "CUM%", "SELF", "CUM", "FUNCTION")
+	if len(table.Rows) == 0 {
+		out.WriteString("  no samples\n")
+	}
+	nameWidth := v.Width - 41
+	for i, r := range table.Rows {
+		if v.FunctionRows > 0 && i >= v.FunctionRows {
+			break
+		}
+		fmt.Fprintf(out, "%7.2f%% %7.2f%% %10s %10s  %s\n", table.SelfPercent(r), table.CumulativePercent(r),
+			formatValue(table.Type, r.Self), formatValue(table.Type, r.Cumulative), truncate(r.Name, nameWidth))
+	}
+
+	out.WriteString("\n")
+	fmt.Fprintf(out, "%8s %8s %7s %10s %10s  %s\n", "PID", "TID", "CPU%", "VOL-CS", "INVOL-CS", "THREAD")
+	for i, t := range v.Threads {
+		if v.ThreadRows > 0 && i >= v.ThreadRows {
+			break
+		}
+		fmt.Fprintf(out, "%8d %8d %6.1f%% %10d %10d  %s\n", t.Pid, t.Tid, t.CPU,
+			t.VoluntarySwitches, t.InvoluntarySwitches, t.Name)
+	}
+	return out.Flush()
+}
+
+func typeName(t profile.Type) string {
+	if t == profile.TypeOffCPU {
+		return "off-cpu"
+	}
+	return "on-cpu"
+}
+
+// the on-cpu value is the sample count, and the off-cpu value is the duration in nanoseconds
+func formatValue(t profile.Type, v int64) string {
+	if t == profile.TypeOffCPU {
+		return fmt.Sprintf("%.1fms", float64(v)/float64(time.Millisecond))
+	}
+	return fmt.Sprintf("%d", v)
+}
+
+func joinPids(pids []int32) string {
+	result := make([]string, 0, len(pids))
+	for _, pid := range pids {
+		result = append(result, fmt.Sprintf("%d", pid))
+	}
+	return strings.Join(result, ",")
+}
+
+func truncate(name string, width int) string {
+	if width <= 3 || len(name) <= width {
+		return name
+	}
+	return name[:width-3] + "..."
+}
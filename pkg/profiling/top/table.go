@@ -0,0 +1,160 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package top
+
+import (
+	"sort"
+
+	"perfprofiler/pkg/profiling/profile"
+)
+
+// Space of the stack frames shown in the table
+type Space string
+
+const (
+	SpaceUser   Space = "user"
+	SpaceKernel Space = "kernel"
+)
+
+// the pseudo function names of the samples which have no frames in the current space
+const (
+	onlyKernelFrames = "[kernel space]"
+	onlyUserFrames   = "[user space]"
+)
+
+// Row is the statistics of a function in the table
+type Row struct {
+	Name string
+	// Self value of the function is the leaf of the stack
+	Self int64
+	// Cumulative value of the function is anywhere in the stack
+	Cumulative int64
+}
+
+// Table is the aggregated functions of the profiles
+type Table struct {
+	Type  profile.Type
+	Space Space
+	// Total value of all samples, the percentages are based on it
+	Total int64
+	Rows  []*Row
+}
+
+// SelfPercent of the row in the table
+func (t *Table) SelfPercent(r *Row) float64 {
+	return t.percent(r.Self)
+}
+
+// CumulativePercent of the row in the table
+func (t *Table) CumulativePercent(r *Row) float64 {
+	return t.percent(r.Cumulative)
+}
+
+func (t *Table) percent(v int64) float64 {
+	if t.Total == 0 {
+		return 0
+	}
+	return float64(v) * 100 / float64(t.Total)
+}
+
+// Aggregate the samples of the profiles with the same type into the functions table of the space,
+// the on-cpu value is the sample count and the off-cpu value is the switched duration.
+// The rows are ordered by the self value, or the cumulative value when byCumulative is true.
+func Aggregate(profiles []*profile.Profile, typ profile.Type, space Space, byCumulative bool) *Table {
+	table := &Table{Type: typ, Space: space}
+	rows := make(map[string]*Row)
+	row := func(name string) *Row {
+		r := rows[name]
+		if r == nil {
+			r = &Row{Name: name}
+			rows[name] = r
+		}
+		return r
+	}
+	for _, p := range profiles {
+		if p == nil || p.Type != typ {
+			continue
+		}
+		for _, s := range p.Samples {
+			value := sampleValue(typ, s)
+			if value <= 0 {
+				continue
+			}
+			table.Total += value
+			names := spaceFunctionNames(s, space)
+			if len(names) == 0 {
+				if space == SpaceUser {
+					names = []string{onlyKernelFrames}
+				} else {
+					names = []string{onlyUserFrames}
+				}
+			}
+			row(names[0]).Self += value
+			// the recursive function only counted once in a stack
+			seen := make(map[string]bool, len(names))
+			for _, name := range names {
+				if seen[name] {
+					continue
+				}
+				seen[name] = true
+				row(name).Cumulative += value
+			}
+		}
+	}
+
+	table.Rows = make([]*Row, 0, len(rows))
+	for _, r := range rows {
+		table.Rows = append(table.Rows, r)
+	}
+	sort.Slice(table.Rows, func(i, j int) bool {
+		a, b := table.Rows[i], table.Rows[j]
+		first, second := a.Self, b.Self
+		if byCumulative {
+			first, second = a.Cumulative, b.Cumulative
+		}
+		if first != second {
+			return first > second
+		}
+		if a.Cumulative != b.Cumulative {
+			return a.Cumulative > b.Cumulative
+		}
+		return a.Name < b.Name
+	})
+	return table
+}
+
+func sampleValue(typ profile.Type, s *profile.Sample) int64 {
+	if typ == profile.TypeOffCPU {
+		return s.Duration
+	}
+	return s.Count
+}
+
+// function names of the sample in the space from the leaf to the root, the inlined functions are expanded
+func spaceFunctionNames(s *profile.Sample, space Space) []string {
+	result := make([]string, 0, len(s.Locations))
+	for _, l := range s.Locations {
+		if l.Kernel != (space == SpaceKernel) {
+			continue
+		}
+		for _, f := range l.Frames {
+			result = append(result, f.Name)
+		}
+	}
+	return result
+}
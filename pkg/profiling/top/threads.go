@@ -0,0 +1,159 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package top
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the clock ticks per second of the utime and stime in the stat file, it's 100 on almost all Linux distributions
+const clockTicks = 100
+
+// ThreadUsage is the usage of a thread between two samplings
+type ThreadUsage struct {
+	Pid  int32
+	Tid  int32
+	Name string
+	// CPU usage in percentage of a single core
+	CPU float64
+	// context switches of the thread
+	VoluntarySwitches   int64
+	InvoluntarySwitches int64
+}
+
+type threadStat struct {
+	pid, tid    int32
+	name        string
+	ticks       int64
+	voluntary   int64
+	involuntary int64
+}
+
+// ThreadSampler reads the thread statistics from the proc filesystem, the usage is the delta of two samplings
+type ThreadSampler struct {
+	procRoot string
+	last     map[int32]*threadStat
+	lastTime time.Time
+}
+
+func NewThreadSampler(procRoot string) *ThreadSampler {
+	if procRoot == "" {
+		procRoot = "/proc"
+	}
+	return &ThreadSampler{procRoot: procRoot, last: make(map[int32]*threadStat)}
+}
+
+// Sample the threads of the processes, ordered by the CPU usage.
+// The first sampling of a thread only records the statistics, so the usage is zero.
+func (s *ThreadSampler) Sample(pids []int32, now time.Time) []*ThreadUsage {
+	current := make(map[int32]*threadStat)
+	for _, pid := range pids {
+		tasks, err := os.ReadDir(filepath.Join(s.procRoot, strconv.Itoa(int(pid)), "task"))
+		if err != nil {
+			continue
+		}
+		for _, t := range tasks {
+			tid, err := strconv.ParseInt(t.Name(), 10, 32)
+			if err != nil {
+				continue
+			}
+			stat, err := s.readThread(pid, int32(tid))
+			if err != nil {
+				continue
+			}
+			current[stat.tid] = stat
+		}
+	}
+
+	elapsed := now.Sub(s.lastTime).Seconds()
+	result := make([]*ThreadUsage, 0, len(current))
+	for tid, stat := range current {
+		usage := &ThreadUsage{Pid: stat.pid, Tid: tid, Name: stat.name}
+		if last := s.last[tid]; last != nil && elapsed > 0 {
+			usage.CPU = float64(stat.ticks-last.ticks) * 100 / clockTicks / elapsed
+			usage.VoluntarySwitches = stat.voluntary - last.voluntary
+			usage.InvoluntarySwitches = stat.involuntary - last.involuntary
+		}
+		result = append(result, usage)
+	}
+	s.last, s.lastTime = current, now
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].CPU != result[j].CPU {
+			return result[i].CPU > result[j].CPU
+		}
+		return result[i].Tid < result[j].Tid
+	})
+	return result
+}
+
+func (s *ThreadSampler) readThread(pid, tid int32) (*threadStat, error) {
+	dir := filepath.Join(s.procRoot, strconv.Itoa(int(pid)), "task", strconv.Itoa(int(tid)))
+	data, err := os.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return nil, err
+	}
+	stat, err := parseThreadStat(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("parsing the stat of thread %d failure: %v", tid, err)
+	}
+	stat.pid, stat.tid = pid, tid
+	// the context switches are optional, the usage is still available without them
+	if status, err := os.Open(filepath.Join(dir, "status")); err == nil {
+		defer status.Close()
+		scanner := bufio.NewScanner(status)
+		for scanner.Scan() {
+			if v, ok := strings.CutPrefix(scanner.Text(), "voluntary_ctxt_switches:"); ok {
+				stat.voluntary, _ = strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			} else if v, ok := strings.CutPrefix(scanner.Text(), "nonvoluntary_ctxt_switches:"); ok {
+				stat.involuntary, _ = strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			}
+		}
+	}
+	return stat, nil
+}
+
+// parse the name and CPU ticks from the content of /proc/<pid>/task/<tid>/stat,
+// the name is in the parentheses and may contain the spaces
+func parseThreadStat(content string) (*threadStat, error) {
+	start, end := strings.IndexByte(content, '('), strings.LastIndexByte(content, ')')
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("the name not found")
+	}
+	// the fields after the name start from the state(3rd field), utime and stime are the 14th and 15th fields
+	fields := strings.Fields(content[end+1:])
+	if len(fields) < 13 {
+		return nil, fmt.Errorf("the fields count is not enough: %d", len(fields))
+	}
+	utime, err := strconv.ParseInt(fields[11], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	stime, err := strconv.ParseInt(fields[12], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &threadStat{name: content[start+1 : end], ticks: utime + stime}, nil
+}
@@ -0,0 +1,153 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package top
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"perfprofiler/pkg/profiling/profile"
+	"perfprofiler/pkg/tools/profiling"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sample(count int64, kernel []string, user ...string) *profile.Sample {
+	s := &profile.Sample{Count: count, Duration: count * int64(time.Millisecond)}
+	for _, name := range kernel {
+		s.Locations = append(s.Locations, &profile.Location{Kernel: true, Frames: []*profiling.Frame{{Name: name}}})
+	}
+	for _, name := range user {
+		s.Locations = append(s.Locations, &profile.Location{Frames: []*profiling.Frame{{Name: name}}})
+	}
+	return s
+}
+
+func TestAggregate(t *testing.T) {
+	profiles := []*profile.Profile{
+		{Type: profile.TypeOnCPU, Samples: []*profile.Sample{
+			sample(6, nil, "work", "main"),
+			sample(2, []string{"sys_write"}, "write", "main"),
+		}},
+		{Type: profile.TypeOnCPU, Samples: []*profile.Sample{
+			sample(2, nil, "fib", "fib", "main"),
+		}},
+		{Type: profile.TypeOffCPU, Samples: []*profile.Sample{sample(100, nil, "sleep")}},
+		nil,
+	}
+	tests := []struct {
+		name         string
+		typ          profile.Type
+		space        Space
+		byCumulative bool
+		total        int64
+		rows         []Row
+	}{
+		{
+			name: "user by self", typ: profile.TypeOnCPU, space: SpaceUser, total: 10,
+			rows: []Row{{"work", 6, 6}, {"fib", 2, 2}, {"write", 2, 2}, {"main", 0, 10}},
+		},
+		{
+			name: "user by cumulative", typ: profile.TypeOnCPU, space: SpaceUser, byCumulative: true, total: 10,
+			rows: []Row{{"main", 0, 10}, {"work", 6, 6}, {"fib", 2, 2}, {"write", 2, 2}},
+		},
+		{
+			name: "kernel", typ: profile.TypeOnCPU, space: SpaceKernel, total: 10,
+			rows: []Row{{onlyUserFrames, 8, 8}, {"sys_write", 2, 2}},
+		},
+		{
+			name: "off-cpu duration", typ: profile.TypeOffCPU, space: SpaceUser, total: 100 * int64(time.Millisecond),
+			rows: []Row{{"sleep", 100 * int64(time.Millisecond), 100 * int64(time.Millisecond)}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := Aggregate(profiles, tt.typ, tt.space, tt.byCumulative)
+			assert.Equal(t, tt.total, table.Total)
+			rows := make([]Row, 0, len(table.Rows))
+			for _, r := range table.Rows {
+				rows = append(rows, *r)
+			}
+			assert.Equal(t, tt.rows, rows)
+		})
+	}
+
+	table := Aggregate(profiles, profile.TypeOnCPU, SpaceUser, false)
+	assert.InDelta(t, 60, table.SelfPercent(table.Rows[0]), 0.001)
+	assert.InDelta(t, 100, table.CumulativePercent(table.Rows[3]), 0.001)
+	assert.Zero(t, Aggregate(nil, profile.TypeOnCPU, SpaceUser, false).SelfPercent(&Row{Self: 1}))
+}
+
+func TestRender(t *testing.T) {
+	table := Aggregate([]*profile.Profile{{Type: profile.TypeOnCPU, Samples: []*profile.Sample{
+		sample(3, nil, "work", "main"),
+		sample(1, nil, "a.very.long.function.name.which.should.be.truncated", "main"),
+	}}}, profile.TypeOnCPU, SpaceUser, false)
+	out := &bytes.Buffer{}
+	assert.NoError(t, Render(out, &View{
+		Time: time.Now(), Pids: []int32{1, 2}, Table: table, Frozen: true, FunctionRows: 2, Width: 60,
+		Threads:    []*ThreadUsage{{Pid: 1, Tid: 1, Name: "main", CPU: 50}, {Pid: 1, Tid: 2, Name: "worker"}},
+		ThreadRows: 1,
+	}, true))
+	content := out.String()
+	assert.True(t, strings.HasPrefix(content, clearScreen))
+	assert.Contains(t, content, "pids: 1,2  mode: on-cpu/user  sort: self  total: 4  [FROZEN]")
+	assert.Contains(t, content, "75.00%   75.00%          3          3  work\n")
+	assert.Contains(t, content, "a.very.long.func...\n")
+	assert.NotContains(t, content, "100.00%")
+	assert.Contains(t, content, "50.0%")
+	assert.NotContains(t, content, "worker")
+}
+
+func TestThreadSampler(t *testing.T) {
+	root := t.TempDir()
+	writeThread := func(tid, name string, utime, stime, voluntary int) {
+		dir := filepath.Join(root, "10", "task", tid)
+		assert.NoError(t, os.MkdirAll(dir, 0o755))
+		stat := strings.Join([]string{tid, "(" + name + ")", "S", "1", "10", "10", "0", "-1", "4194560", "100", "0",
+			"0", "0", strconv.Itoa(utime), strconv.Itoa(stime), "0", "0", "20", "0", "2"}, " ")
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0o600))
+		status := "Name:\t" + name + "\nvoluntary_ctxt_switches:\t" + strconv.Itoa(voluntary) + "\nnonvoluntary_ctxt_switches:\t1\n"
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, "status"), []byte(status), 0o600))
+	}
+	writeThread("10", "main", 10, 10, 5)
+	writeThread("11", "worker (1)", 100, 0, 0)
+
+	sampler := NewThreadSampler(root)
+	now := time.Now()
+	first := sampler.Sample([]int32{10, 99}, now)
+	assert.Len(t, first, 2)
+	assert.Zero(t, first[0].CPU)
+
+	writeThread("10", "main", 20, 15, 8)
+	writeThread("11", "worker (1)", 250, 0, 0)
+	threads := sampler.Sample([]int32{10}, now.Add(2*time.Second))
+	assert.Len(t, threads, 2)
+	assert.Equal(t, &ThreadUsage{Pid: 10, Tid: 11, Name: "worker (1)", CPU: 75}, threads[0])
+	assert.Equal(t, &ThreadUsage{Pid: 10, Tid: 10, Name: "main", CPU: 7.5, VoluntarySwitches: 3}, threads[1])
+
+	_, err := parseThreadStat("10 (main) S 1")
+	assert.Error(t, err)
+	_, err = parseThreadStat("no name")
+	assert.Error(t, err)
+}
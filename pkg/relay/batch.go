@@ -0,0 +1,199 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package relay
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	profiling_v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
+	meter_v3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+// batch buffers the data of the node agents between two flushes
+type batch struct {
+	lock    sync.Mutex
+	maxSize int
+
+	groups []*profilingGroup
+	// the group index by the task, process and the flush time of the node agent
+	groupIndex map[string]*profilingGroup
+	// the symbols shared by the stacks in the batch, the same symbol of the node agents only keep one copy
+	symbols map[string]string
+	meters  []*meter_v3.MeterDataCollection
+	size    int
+	dropped int
+}
+
+// profilingGroup is the profiling data of a process in a flush of the task, the same stacks are merged
+type profilingGroup struct {
+	task   *profiling_v3.EBPFProfilingTaskMetadata
+	data   []*profiling_v3.EBPFProfilingData
+	stacks map[string]*profiling_v3.EBPFProfilingData
+}
+
+type batchSnapshot struct {
+	groups  []*profilingGroup
+	meters  []*meter_v3.MeterDataCollection
+	dropped int
+}
+
+func newBatch(maxSize int) *batch {
+	b := &batch{maxSize: maxSize}
+	b.reset()
+	return b
+}
+
+func (b *batch) reset() {
+	b.groups, b.groupIndex, b.symbols, b.meters = nil, make(map[string]*profilingGroup), make(map[string]string), nil
+	b.size, b.dropped = 0, 0
+}
+
+// addProfiling data of the task, returns false when the batch is full and the data is dropped
+func (b *batch) addProfiling(task *profiling_v3.EBPFProfilingTaskMetadata, data *profiling_v3.EBPFProfilingData) bool {
+	stacks := data.GetOnCPU().GetStacks()
+	if data.GetOffCPU() != nil {
+		stacks = data.GetOffCPU().GetStacks()
+	}
+	key := stacksKey(data, stacks)
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.addToGroup(b.group(task), key, data, stacks)
+}
+
+// group of the task, the flushes of the node agent are kept separately by the current time,
+// so the upstream still receives the data of each period
+func (b *batch) group(task *profiling_v3.EBPFProfilingTaskMetadata) *profilingGroup {
+	groupKey := task.TaskId + "/" + task.ProcessId + "/" + strconv.FormatInt(task.CurrentTime, 10)
+	group := b.groupIndex[groupKey]
+	if group == nil {
+		group = &profilingGroup{task: task, stacks: make(map[string]*profiling_v3.EBPFProfilingData)}
+		b.groupIndex[groupKey] = group
+		b.groups = append(b.groups, group)
+	}
+	return group
+}
+
+func (b *batch) addToGroup(group *profilingGroup, key string, data *profiling_v3.EBPFProfilingData,
+	stacks []*profiling_v3.EBPFProfilingStackMetadata) bool {
+	if exist := group.stacks[key]; exist != nil {
+		mergeProfilingData(exist, data)
+		return true
+	}
+	if b.size >= b.maxSize {
+		b.dropped++
+		return false
+	}
+	for _, s := range stacks {
+		for i, symbol := range s.StackSymbols {
+			s.StackSymbols[i] = b.intern(symbol)
+		}
+	}
+	data.Task = nil
+	group.stacks[key] = data
+	group.data = append(group.data, data)
+	b.size++
+	return true
+}
+
+// addMeters collection, returns false when the batch is full and the data is dropped
+func (b *batch) addMeters(collection *meter_v3.MeterDataCollection) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.size >= b.maxSize {
+		b.dropped++
+		return false
+	}
+	b.meters = append(b.meters, collection)
+	b.size++
+	return true
+}
+
+// take all buffered data, and reset the batch
+func (b *batch) take() *batchSnapshot {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	result := &batchSnapshot{groups: b.groups, meters: b.meters, dropped: b.dropped}
+	b.reset()
+	return result
+}
+
+// restore the data which failed to forward, they are flushed again with the new data,
+// the data is dropped when the batch is full
+func (b *batch) restore(groups []*profilingGroup, meters []*meter_v3.MeterDataCollection) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	for _, g := range groups {
+		group := b.group(g.task)
+		for _, d := range g.data {
+			stacks := d.GetOnCPU().GetStacks()
+			if d.GetOffCPU() != nil {
+				stacks = d.GetOffCPU().GetStacks()
+			}
+			b.addToGroup(group, stacksKey(d, stacks), d, stacks)
+		}
+	}
+	for _, m := range meters {
+		if b.size >= b.maxSize {
+			b.dropped++
+			continue
+		}
+		b.meters = append(b.meters, m)
+		b.size++
+	}
+}
+
+func (b *batch) intern(symbol string) string {
+	if s, ok := b.symbols[symbol]; ok {
+		return s
+	}
+	b.symbols[symbol] = symbol
+	return symbol
+}
+
+// the stacks identity of the data, the stack IDs are ignored since they are only unique in the node agent
+func stacksKey(data *profiling_v3.EBPFProfilingData, stacks []*profiling_v3.EBPFProfilingStackMetadata) string {
+	builder := &strings.Builder{}
+	if data.GetOffCPU() != nil {
+		builder.WriteString("off")
+	} else {
+		builder.WriteString("on")
+	}
+	for _, s := range stacks {
+		builder.WriteString("|")
+		builder.WriteString(s.StackType.String())
+		for _, symbol := range s.StackSymbols {
+			builder.WriteByte(0)
+			builder.WriteString(symbol)
+		}
+	}
+	return builder.String()
+}
+
+func mergeProfilingData(exist, data *profiling_v3.EBPFProfilingData) {
+	if off := exist.GetOffCPU(); off != nil {
+		off.SwitchCount += data.GetOffCPU().GetSwitchCount()
+		off.Duration += data.GetOffCPU().GetDuration()
+		return
+	}
+	if on := exist.GetOnCPU(); on != nil {
+		on.DumpCount += data.GetOnCPU().GetDumpCount()
+	}
+}
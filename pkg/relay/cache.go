@@ -0,0 +1,90 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package relay
+
+import (
+	"sync"
+	"time"
+
+	commonv3 "skywalking.apache.org/repo/goapi/collect/common/v3"
+)
+
+// commandsCache caches the query results by the request key, the concurrent queries of the same key
+// only query the upstream once. The failure results are not cached.
+type commandsCache struct {
+	ttl     time.Duration
+	lock    sync.Mutex
+	entries map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	done     chan struct{}
+	commands *commonv3.Commands
+	err      error
+	expireAt time.Time
+}
+
+func newCommandsCache(ttl time.Duration) *commandsCache {
+	return &commandsCache{ttl: ttl, entries: make(map[string]*cacheEntry)}
+}
+
+// get the commands of the key, or load from the upstream when not cached or expired
+func (c *commandsCache) get(key string, load func() (*commonv3.Commands, error)) (*commonv3.Commands, error) {
+	c.lock.Lock()
+	entry := c.entries[key]
+	if entry != nil && !entry.expired(time.Now()) {
+		c.lock.Unlock()
+		<-entry.done
+		return entry.commands, entry.err
+	}
+	entry = &cacheEntry{done: make(chan struct{})}
+	c.entries[key] = entry
+	c.lock.Unlock()
+
+	entry.commands, entry.err = load()
+	c.lock.Lock()
+	entry.expireAt = time.Now().Add(c.ttl)
+	if entry.err != nil && c.entries[key] == entry {
+		delete(c.entries, key)
+	}
+	c.lock.Unlock()
+	close(entry.done)
+	return entry.commands, entry.err
+}
+
+// cleanup the expired entries
+func (c *commandsCache) cleanup(now time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for key, entry := range c.entries {
+		if entry.expired(now) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+func (c *commandsCache) size() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.entries)
+}
+
+// the loading entry is never expired
+func (e *cacheEntry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
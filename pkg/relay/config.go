@@ -0,0 +1,71 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package relay
+
+import (
+	"fmt"
+	"time"
+
+	"perfprofiler/pkg/module"
+)
+
+type Config struct {
+	module.Config `mapstructure:",squash"`
+
+	Address        string `mapstructure:"address"`         // The gRPC address accepts the node agents
+	Authentication string `mapstructure:"authentication"`  // The auth value required from the node agents, not checked when empty
+	FlushPeriod    string `mapstructure:"flush_period"`    // The period of forwarding the batched profiling and meter data, default is 1s
+	CacheTTL       string `mapstructure:"cache_ttl"`       // The duration of caching the tasks and policies query results, default is 10s
+	MaxBufferSize  int    `mapstructure:"max_buffer_size"` // The max count of the buffered data between two flushes, default is 100000
+}
+
+const (
+	defaultFlushPeriod   = time.Second
+	defaultCacheTTL      = 10 * time.Second
+	defaultMaxBufferSize = 100000
+)
+
+type parsedConfig struct {
+	flushPeriod time.Duration
+	cacheTTL    time.Duration
+	bufferSize  int
+}
+
+func (c *Config) parse() (*parsedConfig, error) {
+	if c.Address == "" {
+		return nil, fmt.Errorf("the relay address must be set")
+	}
+	result := &parsedConfig{flushPeriod: defaultFlushPeriod, cacheTTL: defaultCacheTTL, bufferSize: c.MaxBufferSize}
+	var err error
+	if c.FlushPeriod != "" {
+		if result.flushPeriod, err = time.ParseDuration(c.FlushPeriod); err != nil || result.flushPeriod <= 0 {
+			return nil, fmt.Errorf("the relay flush period is invalid: %s", c.FlushPeriod)
+		}
+	}
+	if c.CacheTTL != "" {
+		if result.cacheTTL, err = time.ParseDuration(c.CacheTTL); err != nil || result.cacheTTL < 0 {
+			return nil, fmt.Errorf("the relay cache TTL is invalid: %s", c.CacheTTL)
+		}
+	}
+	if result.bufferSize < 0 {
+		return nil, fmt.Errorf("the relay max buffer size could not be negative")
+	} else if result.bufferSize == 0 {
+		result.bufferSize = defaultMaxBufferSize
+	}
+	return result, nil
+}
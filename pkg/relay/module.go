@@ -0,0 +1,77 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package relay
+
+import (
+	"context"
+	"fmt"
+
+	"perfprofiler/pkg/core"
+	"perfprofiler/pkg/logger"
+	"perfprofiler/pkg/module"
+)
+
+const ModuleName = "relay"
+
+var log = logger.GetLogger("relay")
+
+// Module runs the agent as a relay, the node agents connect to it instead of the backend
+type Module struct {
+	config *Config
+
+	server *Server
+}
+
+func NewModule() *Module {
+	return &Module{config: &Config{}}
+}
+
+func (m *Module) Name() string {
+	return ModuleName
+}
+
+func (m *Module) RequiredModules() []string {
+	return []string{core.ModuleName}
+}
+
+func (m *Module) Config() module.ConfigInterface {
+	return m.config
+}
+
+func (m *Module) Start(ctx context.Context, mgr *module.Manager) error {
+	backend := mgr.FindModule(core.ModuleName).(core.Operator).BackendOperator()
+	if backend == nil {
+		return fmt.Errorf("the relay requires the backend connection of the core module")
+	}
+	server, err := NewServer(m.config, backend.GetConnection())
+	if err != nil {
+		return err
+	}
+	if err := server.Start(ctx); err != nil {
+		return err
+	}
+	m.server = server
+	return nil
+}
+
+func (m *Module) NotifyStartSuccess() {
+}
+
+func (m *Module) Shutdown(ctx context.Context, mgr *module.Manager) error {
+	return m.server.Stop(ctx)
+}
@@ -0,0 +1,375 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package relay
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	commonv3 "skywalking.apache.org/repo/goapi/collect/common/v3"
+	process_v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/process/v3"
+	profiling_v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
+	meter_v3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+type fakeUpstream struct {
+	profiling_v3.UnimplementedEBPFProfilingServiceServer
+	profiling_v3.UnimplementedContinuousProfilingServiceServer
+	process_v3.UnimplementedEBPFProcessServiceServer
+	meter_v3.UnimplementedMeterReportServiceServer
+
+	lock          sync.Mutex
+	taskQueries   int
+	policyQueries int
+	keepAlives    int
+	streams       int
+	data          []*profiling_v3.EBPFProfilingData
+	meters        []*meter_v3.MeterDataCollection
+	// the data streams are rejected when not nil
+	err error
+}
+
+func (f *fakeUpstream) rejectErr() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.err
+}
+
+func (f *fakeUpstream) QueryTasks(ctx context.Context, q *profiling_v3.EBPFProfilingTaskQuery) (*commonv3.Commands, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.taskQueries++
+	return &commonv3.Commands{Commands: []*commonv3.Command{{Command: "task"}}}, nil
+}
+
+func (f *fakeUpstream) CollectProfilingData(stream profiling_v3.EBPFProfilingService_CollectProfilingDataServer) error {
+	f.lock.Lock()
+	f.streams++
+	f.lock.Unlock()
+	if err := f.rejectErr(); err != nil {
+		return err
+	}
+	for {
+		data, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&commonv3.Commands{})
+		} else if err != nil {
+			return err
+		}
+		f.lock.Lock()
+		f.data = append(f.data, data)
+		f.lock.Unlock()
+	}
+}
+
+func (f *fakeUpstream) QueryPolicies(ctx context.Context,
+	q *profiling_v3.ContinuousProfilingPolicyQuery) (*commonv3.Commands, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.policyQueries++
+	return &commonv3.Commands{}, nil
+}
+
+func (f *fakeUpstream) KeepAlive(ctx context.Context, l *process_v3.EBPFProcessPingPkgList) (*commonv3.Commands, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.keepAlives++
+	return &commonv3.Commands{}, nil
+}
+
+func (f *fakeUpstream) CollectBatch(stream meter_v3.MeterReportService_CollectBatchServer) error {
+	if err := f.rejectErr(); err != nil {
+		return err
+	}
+	for {
+		collection, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&commonv3.Commands{})
+		} else if err != nil {
+			return err
+		}
+		f.lock.Lock()
+		f.meters = append(f.meters, collection)
+		f.lock.Unlock()
+	}
+}
+
+func startUpstream(t *testing.T) (*fakeUpstream, *grpc.ClientConn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	server := grpc.NewServer()
+	fake := &fakeUpstream{}
+	profiling_v3.RegisterEBPFProfilingServiceServer(server, fake)
+	profiling_v3.RegisterContinuousProfilingServiceServer(server, fake)
+	process_v3.RegisterEBPFProcessServiceServer(server, fake)
+	meter_v3.RegisterMeterReportServiceServer(server, fake)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+	conn, err := grpc.Dial(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return fake, conn
+}
+
+func startRelay(t *testing.T, config *Config) (*Server, *grpc.ClientConn) {
+	_, upstream := startUpstream(t)
+	return startRelayWithUpstream(t, config, upstream)
+}
+
+func startRelayWithUpstream(t *testing.T, config *Config, upstream *grpc.ClientConn) (*Server, *grpc.ClientConn) {
+	server, err := NewServer(config, upstream)
+	assert.NoError(t, err)
+	assert.NoError(t, server.Start(context.Background()))
+	t.Cleanup(func() {
+		_ = server.Stop(context.Background())
+	})
+	conn, err := grpc.Dial(server.Addr(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return server, conn
+}
+
+func onCPUData(task *profiling_v3.EBPFProfilingTaskMetadata, stackID int32, count int32,
+	symbols ...string) *profiling_v3.EBPFProfilingData {
+	return &profiling_v3.EBPFProfilingData{
+		Task: task,
+		Profiling: &profiling_v3.EBPFProfilingData_OnCPU{OnCPU: &profiling_v3.EBPFOnCPUProfiling{
+			Stacks: []*profiling_v3.EBPFProfilingStackMetadata{{
+				StackType: profiling_v3.EBPFProfilingStackType_PROCESS_USER_SPACE, StackId: stackID, StackSymbols: symbols}},
+			DumpCount: count,
+		}},
+	}
+}
+
+func TestConfigParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr bool
+	}{
+		{name: "default", config: &Config{Address: ":0"}},
+		{name: "missing address", config: &Config{}, wantErr: true},
+		{name: "invalid flush period", config: &Config{Address: ":0", FlushPeriod: "0s"}, wantErr: true},
+		{name: "invalid cache TTL", config: &Config{Address: ":0", CacheTTL: "ten"}, wantErr: true},
+		{name: "negative buffer", config: &Config{Address: ":0", MaxBufferSize: -1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := tt.config.parse()
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, defaultFlushPeriod, parsed.flushPeriod)
+			assert.Equal(t, defaultCacheTTL, parsed.cacheTTL)
+			assert.Equal(t, defaultMaxBufferSize, parsed.bufferSize)
+		})
+	}
+}
+
+func TestQueryCache(t *testing.T) {
+	fake, upstream := startUpstream(t)
+	_, conn := startRelayWithUpstream(t, &Config{Address: "127.0.0.1:0", FlushPeriod: "1h"}, upstream)
+	ctx := context.Background()
+
+	profilingClient := profiling_v3.NewEBPFProfilingServiceClient(conn)
+	for i := 0; i < 3; i++ {
+		commands, err := profilingClient.QueryTasks(ctx, &profiling_v3.EBPFProfilingTaskQuery{RoverInstanceId: "node", LatestUpdateTime: 1})
+		assert.NoError(t, err)
+		assert.Len(t, commands.Commands, 1)
+	}
+	_, err := profilingClient.QueryTasks(ctx, &profiling_v3.EBPFProfilingTaskQuery{RoverInstanceId: "node", LatestUpdateTime: 2})
+	assert.NoError(t, err)
+
+	continuousClient := profiling_v3.NewContinuousProfilingServiceClient(conn)
+	for _, policies := range [][]*profiling_v3.ContinuousProfilingServicePolicyQuery{
+		{{ServiceName: "a", Uuid: "1"}, {ServiceName: "b", Uuid: "2"}},
+		{{ServiceName: "b", Uuid: "2"}, {ServiceName: "a", Uuid: "1"}},
+		{{ServiceName: "a", Uuid: "3"}},
+	} {
+		_, err = continuousClient.QueryPolicies(ctx, &profiling_v3.ContinuousProfilingPolicyQuery{Policies: policies})
+		assert.NoError(t, err)
+	}
+
+	// the keep alive is not cached
+	processClient := process_v3.NewEBPFProcessServiceClient(conn)
+	for i := 0; i < 2; i++ {
+		_, err = processClient.KeepAlive(ctx, &process_v3.EBPFProcessPingPkgList{})
+		assert.NoError(t, err)
+	}
+
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	assert.Equal(t, 2, fake.taskQueries)
+	assert.Equal(t, 2, fake.policyQueries)
+	assert.Equal(t, 2, fake.keepAlives)
+}
+
+func TestForwardProfiling(t *testing.T) {
+	fake, upstream := startUpstream(t)
+	server, conn := startRelayWithUpstream(t, &Config{Address: "127.0.0.1:0", FlushPeriod: "1h"}, upstream)
+	ctx := context.Background()
+	client := profiling_v3.NewEBPFProfilingServiceClient(conn)
+
+	// two node agents report the same stacks with different stack IDs, the later flush is kept separately
+	for node, current := range []int64{100, 100, 200} {
+		stream, err := client.CollectProfilingData(ctx)
+		assert.NoError(t, err)
+		task := &profiling_v3.EBPFProfilingTaskMetadata{TaskId: "task", ProcessId: "process", CurrentTime: current}
+		assert.NoError(t, stream.Send(onCPUData(task, int32(node), 2, "work", "main")))
+		assert.NoError(t, stream.Send(onCPUData(nil, int32(node+10), 1, "idle", "main")))
+		_, err = stream.CloseAndRecv()
+		assert.NoError(t, err)
+	}
+	// the stream without the task metadata is rejected
+	stream, err := client.CollectProfilingData(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, stream.Send(onCPUData(nil, 1, 1, "main")))
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	assert.NoError(t, server.Flush(ctx))
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	assert.Equal(t, 1, fake.streams)
+	assert.Len(t, fake.data, 4)
+	assert.Equal(t, int64(100), fake.data[0].Task.CurrentTime)
+	assert.Nil(t, fake.data[1].Task)
+	assert.Equal(t, int32(4), fake.data[0].GetOnCPU().DumpCount)
+	assert.Equal(t, []string{"work", "main"}, fake.data[0].GetOnCPU().Stacks[0].StackSymbols)
+	assert.Equal(t, int32(2), fake.data[1].GetOnCPU().DumpCount)
+	assert.Equal(t, int64(200), fake.data[2].Task.CurrentTime)
+	assert.Equal(t, int32(2), fake.data[2].GetOnCPU().DumpCount)
+}
+
+func TestBatchSymbols(t *testing.T) {
+	b := newBatch(2)
+	task := &profiling_v3.EBPFProfilingTaskMetadata{TaskId: "task", ProcessId: "process"}
+	first := onCPUData(task, 1, 1, string([]byte("main")))
+	second := onCPUData(task, 2, 1, "work", string([]byte("main")))
+	assert.True(t, b.addProfiling(task, first))
+	assert.True(t, b.addProfiling(task, second))
+	assert.False(t, b.addProfiling(task, onCPUData(task, 3, 1, "other")))
+	// the existing stacks still merged when full
+	assert.True(t, b.addProfiling(task, onCPUData(task, 4, 1, "main")))
+	assert.Len(t, b.symbols, 2)
+	assert.Equal(t, b.symbols["main"], second.GetOnCPU().Stacks[0].StackSymbols[1])
+
+	snapshot := b.take()
+	assert.Equal(t, 1, snapshot.dropped)
+	assert.Len(t, snapshot.groups, 1)
+	assert.Equal(t, int32(2), snapshot.groups[0].data[0].GetOnCPU().DumpCount)
+	assert.Empty(t, b.take().groups)
+}
+
+func TestForwardMeters(t *testing.T) {
+	fake, upstream := startUpstream(t)
+	server, conn := startRelayWithUpstream(t, &Config{Address: "127.0.0.1:0", FlushPeriod: "1h"}, upstream)
+	ctx := context.Background()
+	client := meter_v3.NewMeterReportServiceClient(conn)
+
+	meter := func(name string) *meter_v3.MeterData {
+		return &meter_v3.MeterData{Metric: &meter_v3.MeterData_SingleValue{SingleValue: &meter_v3.MeterSingleValue{Name: name, Value: 1}}}
+	}
+	single, err := client.Collect(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, single.Send(meter("a")))
+	assert.NoError(t, single.Send(meter("b")))
+	_, err = single.CloseAndRecv()
+	assert.NoError(t, err)
+	batch, err := client.CollectBatch(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, batch.Send(&meter_v3.MeterDataCollection{MeterData: []*meter_v3.MeterData{meter("c")}}))
+	_, err = batch.CloseAndRecv()
+	assert.NoError(t, err)
+
+	assert.NoError(t, server.Flush(ctx))
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	assert.Len(t, fake.meters, 2)
+	assert.Len(t, fake.meters[0].MeterData, 2)
+	assert.Equal(t, "c", fake.meters[1].MeterData[0].GetSingleValue().Name)
+}
+
+func TestFlushRetry(t *testing.T) {
+	fake, upstream := startUpstream(t)
+	fake.err = status.Error(codes.Unavailable, "unavailable")
+	server, conn := startRelayWithUpstream(t, &Config{Address: "127.0.0.1:0", FlushPeriod: "1h"}, upstream)
+	ctx := context.Background()
+
+	stream, err := profiling_v3.NewEBPFProfilingServiceClient(conn).CollectProfilingData(ctx)
+	assert.NoError(t, err)
+	task := &profiling_v3.EBPFProfilingTaskMetadata{TaskId: "task", ProcessId: "process", CurrentTime: 100}
+	assert.NoError(t, stream.Send(onCPUData(task, 1, 2, "work", "main")))
+	assert.NoError(t, stream.Send(onCPUData(nil, 2, 1, "idle", "main")))
+	_, err = stream.CloseAndRecv()
+	assert.NoError(t, err)
+	meters, err := meter_v3.NewMeterReportServiceClient(conn).CollectBatch(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, meters.Send(&meter_v3.MeterDataCollection{MeterData: []*meter_v3.MeterData{{}}}))
+	_, err = meters.CloseAndRecv()
+	assert.NoError(t, err)
+
+	// the failed data is kept and forwarded in the next flush
+	assert.Error(t, server.Flush(ctx))
+	fake.lock.Lock()
+	fake.err = nil
+	fake.lock.Unlock()
+	assert.NoError(t, server.Flush(ctx))
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+	assert.Len(t, fake.data, 2)
+	assert.Equal(t, "task", fake.data[0].Task.TaskId)
+	assert.Nil(t, fake.data[1].Task)
+	assert.Equal(t, int32(2), fake.data[0].GetOnCPU().DumpCount)
+	assert.Len(t, fake.meters, 1)
+	assert.Empty(t, server.batch.take().groups)
+}
+
+func TestAuthentication(t *testing.T) {
+	_, conn := startRelay(t, &Config{Address: "127.0.0.1:0", Authentication: "secret"})
+	client := profiling_v3.NewEBPFProfilingServiceClient(conn)
+	query := &profiling_v3.EBPFProfilingTaskQuery{RoverInstanceId: "node"}
+
+	_, err := client.QueryTasks(context.Background(), query)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	stream, err := client.CollectProfilingData(metadata.AppendToOutgoingContext(context.Background(), "Authentication", "wrong"))
+	if err == nil {
+		_, err = stream.CloseAndRecv()
+	}
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.QueryTasks(metadata.AppendToOutgoingContext(context.Background(), "Authentication", "secret"), query)
+	assert.NoError(t, err)
+}
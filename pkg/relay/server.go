@@ -0,0 +1,354 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package relay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	commonv3 "skywalking.apache.org/repo/goapi/collect/common/v3"
+	process_v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/process/v3"
+	profiling_v3 "skywalking.apache.org/repo/goapi/collect/ebpf/profiling/v3"
+	meter_v3 "skywalking.apache.org/repo/goapi/collect/language/agent/v3"
+)
+
+// Server accepts the requests of the node agents, and forwards them to the upstream through one connection.
+// The profiling and meter data are batched and flushed periodically, the tasks and policies queries are cached.
+type Server struct {
+	config   *Config
+	parsed   *parsedConfig
+	server   *grpc.Server
+	listener net.Listener
+
+	profilingClient  profiling_v3.EBPFProfilingServiceClient
+	processClient    process_v3.EBPFProcessServiceClient
+	continuousClient profiling_v3.ContinuousProfilingServiceClient
+	meterClient      meter_v3.MeterReportServiceClient
+
+	tasksCache    *commandsCache
+	policiesCache *commandsCache
+	batch         *batch
+	flushLock     sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewServer(config *Config, upstream grpc.ClientConnInterface) (*Server, error) {
+	parsed, err := config.parse()
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{
+		config:           config,
+		parsed:           parsed,
+		profilingClient:  profiling_v3.NewEBPFProfilingServiceClient(upstream),
+		processClient:    process_v3.NewEBPFProcessServiceClient(upstream),
+		continuousClient: profiling_v3.NewContinuousProfilingServiceClient(upstream),
+		meterClient:      meter_v3.NewMeterReportServiceClient(upstream),
+		tasksCache:       newCommandsCache(parsed.cacheTTL),
+		policiesCache:    newCommandsCache(parsed.cacheTTL),
+		batch:            newBatch(parsed.bufferSize),
+		ctx:              context.Background(),
+	}
+	s.server = grpc.NewServer(grpc.UnaryInterceptor(s.authenticateUnary), grpc.StreamInterceptor(s.authenticateStream))
+	profiling_v3.RegisterEBPFProfilingServiceServer(s.server, &profilingService{s: s})
+	process_v3.RegisterEBPFProcessServiceServer(s.server, &processService{s: s})
+	profiling_v3.RegisterContinuousProfilingServiceServer(s.server, &continuousService{s: s})
+	meter_v3.RegisterMeterReportServiceServer(s.server, &meterService{s: s})
+	return s, nil
+}
+
+// Start listening and flushing the data in the background
+func (s *Server) Start(parent context.Context) error {
+	listener, err := net.Listen("tcp", s.config.Address)
+	if err != nil {
+		return fmt.Errorf("listen the relay address failure: %v", err)
+	}
+	s.listener = listener
+	s.ctx, s.cancel = context.WithCancel(parent)
+	log.Infof("the relay is listening on %s", listener.Addr())
+
+	s.wg.Add(2)
+	go func() {
+		defer s.wg.Done()
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, grpc.ErrServerStopped) {
+			log.Warnf("the relay server stopped: %v", err)
+		}
+	}()
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.parsed.flushPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.Flush(s.ctx); err != nil {
+					log.Warnf("flush the relay data failure: %v", err)
+				}
+				s.tasksCache.cleanup(time.Now())
+				s.policiesCache.cleanup(time.Now())
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// Addr of the listening address
+func (s *Server) Addr() string {
+	if s.listener == nil {
+		return s.config.Address
+	}
+	return s.listener.Addr().String()
+}
+
+// Stop accepting the requests, and flush the buffered data to the upstream
+func (s *Server) Stop(ctx context.Context) error {
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		s.server.Stop()
+	}
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+	return s.Flush(ctx)
+}
+
+// Flush the batched data to the upstream, the data is kept in the batch and flushed again when the upstream failure
+func (s *Server) Flush(ctx context.Context) error {
+	s.flushLock.Lock()
+	defer s.flushLock.Unlock()
+	snapshot := s.batch.take()
+	if snapshot.dropped > 0 {
+		log.Warnf("the relay buffer is full, %d data dropped", snapshot.dropped)
+	}
+	var result error
+	if len(snapshot.groups) > 0 {
+		if err := s.flushProfiling(ctx, snapshot.groups); err != nil {
+			s.batch.restore(snapshot.groups, nil)
+			result = fmt.Errorf("forward %d profiling groups failure: %v", len(snapshot.groups), err)
+		}
+	}
+	if len(snapshot.meters) > 0 {
+		if err := s.flushMeters(ctx, snapshot.meters); err != nil {
+			s.batch.restore(nil, snapshot.meters)
+			err = fmt.Errorf("forward %d meter collections failure: %v", len(snapshot.meters), err)
+			if result != nil {
+				err = fmt.Errorf("%v, %v", result, err)
+			}
+			result = err
+		}
+	}
+	return result
+}
+
+func (s *Server) flushProfiling(ctx context.Context, groups []*profilingGroup) error {
+	stream, err := s.profilingClient.CollectProfilingData(ctx)
+	if err != nil {
+		return err
+	}
+	count := 0
+	for _, g := range groups {
+		// only the first data of the task have the metadata
+		for i, d := range g.data {
+			if i == 0 {
+				d.Task = g.task
+			}
+			if err := stream.Send(d); err != nil {
+				return err
+			}
+			count++
+		}
+	}
+	if _, err = stream.CloseAndRecv(); err != nil {
+		return err
+	}
+	log.Debugf("forward %d profiling data of %d tasks to the upstream", count, len(groups))
+	return nil
+}
+
+func (s *Server) flushMeters(ctx context.Context, meters []*meter_v3.MeterDataCollection) error {
+	stream, err := s.meterClient.CollectBatch(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range meters {
+		if err := stream.Send(m); err != nil {
+			return err
+		}
+	}
+	_, err = stream.CloseAndRecv()
+	return err
+}
+
+func (s *Server) authenticateUnary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.authenticate(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) authenticateStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler) error {
+	if err := s.authenticate(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+func (s *Server) authenticate(ctx context.Context) error {
+	if s.config.Authentication == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("Authentication"); len(values) > 0 && values[0] == s.config.Authentication {
+		return nil
+	}
+	return status.Error(codes.Unauthenticated, "the authentication is invalid")
+}
+
+type profilingService struct {
+	profiling_v3.UnimplementedEBPFProfilingServiceServer
+	s *Server
+}
+
+// QueryTasks are cached by the node agent and the latest update time, the new tasks could be delayed by the TTL
+func (p *profilingService) QueryTasks(ctx context.Context, query *profiling_v3.EBPFProfilingTaskQuery) (*commonv3.Commands, error) {
+	key := query.RoverInstanceId + "/" + strconv.FormatInt(query.LatestUpdateTime, 10)
+	return p.s.tasksCache.get(key, func() (*commonv3.Commands, error) {
+		return p.s.profilingClient.QueryTasks(p.s.ctx, query)
+	})
+}
+
+func (p *profilingService) CollectProfilingData(stream profiling_v3.EBPFProfilingService_CollectProfilingDataServer) error {
+	// the data without the task metadata belongs to the latest task in the stream
+	var task *profiling_v3.EBPFProfilingTaskMetadata
+	for {
+		data, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&commonv3.Commands{})
+		} else if err != nil {
+			return err
+		}
+		if data.Task != nil {
+			task = data.Task
+		}
+		if task == nil {
+			return status.Error(codes.InvalidArgument, "the first profiling data must have the task metadata")
+		}
+		p.s.batch.addProfiling(task, data)
+	}
+}
+
+type processService struct {
+	process_v3.UnimplementedEBPFProcessServiceServer
+	s *Server
+}
+
+// ReportProcesses is forwarded directly, the process IDs are required by the node agent
+func (p *processService) ReportProcesses(ctx context.Context,
+	list *process_v3.EBPFProcessReportList) (*process_v3.EBPFReportProcessDownstream, error) {
+	return p.s.processClient.ReportProcesses(ctx, list)
+}
+
+func (p *processService) KeepAlive(ctx context.Context, list *process_v3.EBPFProcessPingPkgList) (*commonv3.Commands, error) {
+	return p.s.processClient.KeepAlive(ctx, list)
+}
+
+type continuousService struct {
+	profiling_v3.UnimplementedContinuousProfilingServiceServer
+	s *Server
+}
+
+// QueryPolicies are cached by the services and their policy UUIDs, the node agents with the same services
+// share the same result
+func (c *continuousService) QueryPolicies(ctx context.Context,
+	query *profiling_v3.ContinuousProfilingPolicyQuery) (*commonv3.Commands, error) {
+	services := make([]string, 0, len(query.Policies))
+	for _, p := range query.Policies {
+		services = append(services, p.ServiceName+"="+p.Uuid)
+	}
+	sort.Strings(services)
+	return c.s.policiesCache.get(strings.Join(services, "\n"), func() (*commonv3.Commands, error) {
+		return c.s.continuousClient.QueryPolicies(c.s.ctx, query)
+	})
+}
+
+func (c *continuousService) ReportProfilingTask(ctx context.Context,
+	report *profiling_v3.ContinuousProfilingReport) (*commonv3.Commands, error) {
+	return c.s.continuousClient.ReportProfilingTask(ctx, report)
+}
+
+type meterService struct {
+	meter_v3.UnimplementedMeterReportServiceServer
+	s *Server
+}
+
+// Collect the meters of a stream as one collection, the stream is an input data set
+func (m *meterService) Collect(stream meter_v3.MeterReportService_CollectServer) error {
+	collection := &meter_v3.MeterDataCollection{}
+	for {
+		data, err := stream.Recv()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		collection.MeterData = append(collection.MeterData, data)
+	}
+	if len(collection.MeterData) > 0 {
+		m.s.batch.addMeters(collection)
+	}
+	return stream.SendAndClose(&commonv3.Commands{})
+}
+
+func (m *meterService) CollectBatch(stream meter_v3.MeterReportService_CollectBatchServer) error {
+	for {
+		collection, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&commonv3.Commands{})
+		} else if err != nil {
+			return err
+		}
+		m.s.batch.addMeters(collection)
+	}
+}
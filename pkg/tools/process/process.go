@@ -19,11 +19,14 @@ package process
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"perfprofiler/pkg/logger"
 	host2 "perfprofiler/pkg/tools/host"
@@ -31,6 +34,15 @@ import (
 	"perfprofiler/pkg/tools/profiling"
 )
 
+const (
+	// the suffix of module name in the maps file when the file has been deleted or replaced
+	deletedModuleSuffix = " (deleted)"
+	// the max count of shared modules which not referenced by any process
+	idleSharedModuleCount = 200
+	// the min interval of re-scan the process modules when the address could not be found in any module
+	modulesRefreshInterval = 10 * time.Second
+)
+
 var (
 	// NotSupportProfilingExe mean which program are not support for profiling
 	// Not Support JIT and Script language for now
@@ -40,12 +52,16 @@ var (
 
 	// executable file profiling finders
 	profilingStatFinderList = []profiling.StatFinder{
+		profiling.NewGoPclntabLibrary(),
 		profiling.NewGoLibrary(),
 	}
 
 	// kernel profiling finder
 	kernelFinder = profiling.NewKernelFinder()
 
+	// the symbol tables shared between all processes
+	sharedModules, _ = profiling.NewModuleCache(idleSharedModuleCount)
+
 	// process map file analyze(/proc/{pid}/maps)
 	mapFileContentRegex = regexp.MustCompile("(?P<StartAddr>[a-f\\d]+)\\-(?P<EndAddr>[a-f\\d]+)\\s(?P<Perm>[^\\s]+)" +
 		"\\s(?P<Offset>[a-f\\d]+)\\s[a-f\\d]+\\:[a-f\\d]+\\s\\d+\\s+(?P<Name>[^\\n]+)")
@@ -62,30 +78,43 @@ func KernelFileProfilingStat() (*profiling.Info, error) {
 }
 
 // ProfilingStat is validating the exe file could be profiling and get info
+// the symbol tables in the result are shared with other processes, should be released by profiling.Info.Release
 func ProfilingStat(pid int32, exePath string) (*profiling.Info, error) {
 	stat, err := os.Stat(exePath)
 	if err != nil {
 		return nil, fmt.Errorf("check file error: %v", err)
 	}
+	exeName := stat.Name()
+	// the executable file is read from /proc/{pid}/exe when it has been deleted
+	if target, err := os.Readlink(exePath); err == nil && strings.HasSuffix(target, deletedModuleSuffix) {
+		exeName = filepath.Base(strings.TrimSuffix(target, deletedModuleSuffix))
+	}
 	for _, notSupport := range NotSupportProfilingExe {
-		if strings.HasPrefix(stat.Name(), notSupport) {
+		if strings.HasPrefix(exeName, notSupport) {
 			return nil, fmt.Errorf("not support %s language profiling", notSupport)
 		}
 	}
-	context := newAnalyzeContext()
+	context := newAnalyzeContext(sharedModules)
 
 	// the executable file must have the symbols
-	symbols, err := context.GetFinder(exePath).AnalyzeSymbols(exePath)
-	if err != nil || len(symbols) == 0 {
+	exe, err := context.LoadModule(pid, exePath, exePath, nil)
+	if err != nil || len(exe.Symbols) == 0 {
+		exe.Release()
 		return nil, fmt.Errorf("could not found any symbol in the execute file: %s, error: %v", exePath, err)
 	}
+	defer exe.Release()
 
-	return analyzeProfilingInfo(context, pid)
+	info, err := analyzeProfilingInfo(context, pid)
+	if err != nil {
+		return nil, err
+	}
+	info.SetModulesRefresher(refreshModules(pid), modulesRefreshInterval)
+	return info, nil
 }
 
 // Modules Read the profiling info of the process, without the symbol check
 func Modules(pid int32) ([]*profiling.Module, error) {
-	context := newAnalyzeContext()
+	context := newAnalyzeContext(nil)
 	info, err := analyzeProfilingInfo(context, pid)
 	if err != nil {
 		return nil, err
@@ -93,9 +122,52 @@ func Modules(pid int32) ([]*profiling.Module, error) {
 	return info.Modules, nil
 }
 
+// LoadModuleFile loads the module with the symbols from the file, the file could be copied from other machines,
+// such as re-symbolizing the addresses collected in other environments
+func LoadModuleFile(modName, modPath string, moduleRange []*profiling.ModuleRange) (*profiling.Module, error) {
+	return newAnalyzeContext(nil).LoadModule(0, modName, modPath, moduleRange)
+}
+
 func analyzeProfilingInfo(context *analyzeContext, pid int32) (*profiling.Info, error) {
-	// analyze process mapping
-	mapFile, _ := os.Open(host2.GetFileInHost(fmt.Sprintf("/proc/%d/maps", pid)))
+	modules, err := analyzeModules(context, pid, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return profiling.NewInfo(modules), nil
+}
+
+// refreshModules find the modules which loaded after the profiling info created, such as the library loaded by dlopen,
+// the modules failed to load are not loaded again, and the refreshing is stopped after the process exited
+func refreshModules(pid int32) profiling.ModulesRefresher {
+	failed := make(map[string]bool)
+	return func(exists []*profiling.Module) ([]*profiling.Module, error) {
+		existNames := make(map[string]bool, len(exists))
+		for _, m := range exists {
+			existNames[m.Name] = true
+		}
+		modules, err := analyzeModules(newAnalyzeContext(sharedModules), pid, existNames, failed)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("%w: the process %d is exited", profiling.ErrRefreshStopped, pid)
+		} else if err != nil {
+			return nil, err
+		}
+		result := make([]*profiling.Module, 0, len(modules))
+		for _, m := range modules {
+			result = append(result, m)
+		}
+		return result, nil
+	}
+}
+
+// analyzeModules from the process mapping, the modules in the ignored names are skipped.
+// When the failed names exist, the modules failed to load are skipped and recorded, otherwise an error is returned
+func analyzeModules(context *analyzeContext, pid int32,
+	ignoredNames, failedNames map[string]bool) (map[string]*profiling.Module, error) {
+	mapFile, err := os.Open(host2.GetFileInHost(fmt.Sprintf("/proc/%d/maps", pid)))
+	if err != nil {
+		return nil, err
+	}
+	defer mapFile.Close()
 	scanner := bufio.NewScanner(mapFile)
 	modules := make(map[string]*profiling.Module)
 	for scanner.Scan() {
@@ -107,7 +179,9 @@ func analyzeProfilingInfo(context *analyzeContext, pid int32) (*profiling.Info,
 			continue
 		}
 		moduleName := submatch[5]
-		if isIgnoreModuleName(moduleName) {
+		deleted := strings.HasSuffix(moduleName, deletedModuleSuffix)
+		moduleName = strings.TrimSuffix(moduleName, deletedModuleSuffix)
+		if isIgnoreModuleName(moduleName) || ignoredNames[moduleName] || failedNames[moduleName] {
 			continue
 		}
 
@@ -118,6 +192,7 @@ func analyzeProfilingInfo(context *analyzeContext, pid int32) (*profiling.Info,
 		moduleRange.EndAddr, err = parseUInt64InModule(err, moduleName, "end address", submatch[2])
 		moduleRange.FileOffset, err = parseUInt64InModule(err, moduleName, "file offset", submatch[4])
 		if err != nil {
+			releaseModules(modules)
 			return nil, err
 		}
 
@@ -126,19 +201,59 @@ func analyzeProfilingInfo(context *analyzeContext, pid int32) (*profiling.Info,
 			module.Ranges = append(module.Ranges, moduleRange)
 			continue
 		}
-		modulePath := host2.GetFileInHost(fmt.Sprintf("/proc/%d/root%s", pid, moduleName))
-		if !path.Exists(modulePath) {
-			log.Debugf("could not found the module, ignore. name: %s, path: %s", moduleName, modulePath)
+		modulePath := findModulePath(pid, moduleName, deleted, fmt.Sprintf("%s-%s", submatch[1], submatch[2]))
+		if modulePath == "" {
+			log.Debugf("could not found the module, ignore. name: %s, deleted: %t", moduleName, deleted)
 			continue
 		}
 
-		module, err = context.GetFinder(modulePath).ToModule(pid, moduleName, modulePath, []*profiling.ModuleRange{moduleRange})
-		if err != nil {
+		module, err = context.LoadModule(pid, moduleName, modulePath, []*profiling.ModuleRange{moduleRange})
+		if err != nil && failedNames != nil {
+			log.Warnf("could not init the module, ignore. name: %s, error: %v", moduleName, err)
+			failedNames[moduleName] = true
+			continue
+		} else if err != nil {
+			releaseModules(modules)
 			return nil, fmt.Errorf("could not init the module: %s, error: %v", moduleName, err)
 		}
 		modules[moduleName] = module
 	}
-	return profiling.NewInfo(modules), nil
+	return modules, nil
+}
+
+// findModulePath of the module file which could be read in the host,
+// the deleted file(such as replaced by the rolling deploy) is read through the mapped file of the process
+func findModulePath(pid int32, moduleName string, deleted bool, mapRange string) string {
+	if !deleted {
+		if modulePath := host2.GetFileInHost(fmt.Sprintf("/proc/%d/root%s", pid, moduleName)); path.Exists(modulePath) {
+			return modulePath
+		}
+	}
+	// reading the map files requires the CAP_SYS_ADMIN
+	if mapFile := host2.GetFileInHost(fmt.Sprintf("/proc/%d/map_files/%s", pid, mapRange)); isReadable(mapFile) {
+		return mapFile
+	}
+	exe := host2.GetFileInHost(fmt.Sprintf("/proc/%d/exe", pid))
+	if target, err := os.Readlink(exe); err == nil && strings.TrimSuffix(target, deletedModuleSuffix) == moduleName &&
+		isReadable(exe) {
+		return exe
+	}
+	return ""
+}
+
+func isReadable(file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	_ = f.Close()
+	return true
+}
+
+func releaseModules(modules map[string]*profiling.Module) {
+	for _, m := range modules {
+		m.Release()
+	}
 }
 
 func parseUInt64InModule(err error, moduleName, key, val string) (uint64, error) {
@@ -169,12 +284,25 @@ func isIgnoreModuleName(name string) bool {
 
 type analyzeContext struct {
 	pathToFinder map[string]profiling.StatFinder
+	// optional, share the symbol tables with other processes
+	cache *profiling.ModuleCache
 }
 
-func newAnalyzeContext() *analyzeContext {
+func newAnalyzeContext(cache *profiling.ModuleCache) *analyzeContext {
 	return &analyzeContext{
 		pathToFinder: make(map[string]profiling.StatFinder),
+		cache:        cache,
+	}
+}
+
+func (a *analyzeContext) LoadModule(pid int32, modName, modPath string, moduleRange []*profiling.ModuleRange) (*profiling.Module, error) {
+	loader := func() (*profiling.Module, error) {
+		return a.GetFinder(modPath).ToModule(pid, modName, modPath, moduleRange)
+	}
+	if a.cache == nil {
+		return loader()
 	}
+	return a.cache.Load(modName, modPath, moduleRange, loader)
 }
 
 func (a *analyzeContext) GetFinder(name string) profiling.StatFinder {
@@ -0,0 +1,81 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package process
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"perfprofiler/pkg/tools/profiling"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModulesOfDeletedBinary(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skipf("could not found the sleep command: %v", err)
+	}
+	content, err := os.ReadFile(sleep)
+	assert.NoError(t, err)
+	binary := filepath.Join(t.TempDir(), "sleep-deleted")
+	assert.NoError(t, os.WriteFile(binary, content, 0o700))
+
+	cmd := exec.Command(binary, "10")
+	assert.NoError(t, cmd.Start())
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	// wait for the binary mapped, then replace the binary
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, os.Remove(binary))
+
+	modules, err := Modules(int32(cmd.Process.Pid))
+	assert.NoError(t, err)
+	var found bool
+	for _, m := range modules {
+		if m.Name == binary {
+			found = true
+			assert.NotContains(t, m.Path, binary)
+			assert.NotEmpty(t, m.Ranges)
+		}
+	}
+	assert.True(t, found, "the deleted binary should be found in modules")
+}
+
+func TestRefreshModulesAfterExited(t *testing.T) {
+	sleep, err := exec.LookPath("sleep")
+	if err != nil {
+		t.Skipf("could not found the sleep command: %v", err)
+	}
+	cmd := exec.Command(sleep, "10")
+	assert.NoError(t, cmd.Start())
+	refresher := refreshModules(int32(cmd.Process.Pid))
+	_, err = refresher(nil)
+	assert.NoError(t, err)
+
+	_ = cmd.Process.Kill()
+	_ = cmd.Wait()
+	_, err = refresher(nil)
+	assert.True(t, errors.Is(err, profiling.ErrRefreshStopped), "unexpected error: %v", err)
+}
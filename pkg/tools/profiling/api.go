@@ -18,12 +18,16 @@
 package profiling
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"perfprofiler/pkg/logger"
 
-	"github.com/ianlancetaylor/demangle"
+	lru "github.com/hashicorp/golang-lru"
 )
 
 type ModuleType int8
@@ -31,9 +35,16 @@ type ModuleType int8
 var (
 	KernelSymbolFilePath = "/proc/kallsyms"
 
+	// ErrRefreshStopped is returned by the refresher when the modules would never change, such as the process exited,
+	// the refresher is not executed anymore
+	ErrRefreshStopped = errors.New("the modules refreshing is stopped")
+
 	log = logger.GetLogger("tools", "profiling")
 )
 
+// the max count of the cached address symbols in each profiling info
+const symbolCacheSize = 10000
+
 const (
 	ModuleTypeExec ModuleType = iota
 	ModuleTypeSo
@@ -42,10 +53,38 @@ const (
 	ModuleTypeUnknown
 )
 
-// Info of profiling process
+// Info of profiling process, it's safe to find the symbols concurrently
 type Info struct {
-	Modules           []*Module
-	cacheAddrToSymbol map[uint64]string
+	Modules      []*Module
+	modulesMutex sync.RWMutex
+
+	cacheAddrToFrames *lru.Cache
+	cacheHit          uint64
+	cacheMiss         uint64
+
+	// re-scan the modules when the address not in any module, such as the library loaded by dlopen
+	refresher           ModulesRefresher
+	refreshInterval     time.Duration
+	lastRefreshTime     time.Time
+	refreshModulesMutex sync.Mutex
+}
+
+// ModulesRefresher find the new modules of the process which not in the exists modules
+type ModulesRefresher func(exists []*Module) ([]*Module, error)
+
+// SymbolCacheStats is the statistics of the address symbol cache
+type SymbolCacheStats struct {
+	Hit  uint64
+	Miss uint64
+	Size int
+}
+
+// HitRate of the cache, return 0 if no any lookup
+func (s *SymbolCacheStats) HitRate() float64 {
+	if s.Hit+s.Miss == 0 {
+		return 0
+	}
+	return float64(s.Hit) / float64(s.Hit+s.Miss)
 }
 
 type Module struct {
@@ -54,7 +93,14 @@ type Module struct {
 	Path             string
 	Type             ModuleType
 	SoOffset, SoAddr uint64
-	Symbols          []*Symbol
+	// BuildID of the module file, empty if not exists
+	BuildID string
+	Symbols []*Symbol
+	// Resolver is optional, works for resolve the inlined functions and source lines of the address
+	Resolver FrameResolver
+
+	// the symbol table shared with other processes, only exists when the module loaded from ModuleCache
+	shared *sharedModule
 }
 
 type ModuleRange struct {
@@ -68,6 +114,19 @@ type Symbol struct {
 	Size     uint64
 }
 
+// Frame is the function call of the address, an address could have multiple frames when the functions are inlined
+type Frame struct {
+	Name string
+	File string
+	Line int
+}
+
+type FrameResolver interface {
+	// ResolveFrames of the address in module, the inlined frames are ordered from the innermost to the outermost
+	// return nil if the address could not be resolved
+	ResolveFrames(address uint64) []*Frame
+}
+
 type StatFinder interface {
 	// IsSupport to stat the executable file for profiling
 	IsSupport(filePath string) bool
@@ -82,10 +141,38 @@ func NewInfo(modules map[string]*Module) *Info {
 	for _, m := range modules {
 		ls = append(ls, m)
 	}
-	return &Info{Modules: ls, cacheAddrToSymbol: make(map[uint64]string)}
+	cache, _ := lru.New(symbolCacheSize)
+	return &Info{Modules: ls, cacheAddrToFrames: cache}
+}
+
+// GetModules returns the snapshot of the modules, the modules could be appended when refresh
+func (i *Info) GetModules() []*Module {
+	if i == nil {
+		return nil
+	}
+	i.modulesMutex.RLock()
+	defer i.modulesMutex.RUnlock()
+	return i.Modules
+}
+
+// SymbolCacheStats returns the statistics of the address symbol cache
+func (i *Info) SymbolCacheStats() *SymbolCacheStats {
+	return &SymbolCacheStats{
+		Hit:  atomic.LoadUint64(&i.cacheHit),
+		Miss: atomic.LoadUint64(&i.cacheMiss),
+		Size: i.cacheAddrToFrames.Len(),
+	}
+}
+
+// SetModulesRefresher for find the modules loaded after the info created, the refresher is executed at most once
+// in each interval
+func (i *Info) SetModulesRefresher(refresher ModulesRefresher, interval time.Duration) {
+	i.refresher = refresher
+	i.refreshInterval = interval
 }
 
 // FindSymbols from address list, if could not found symbol name then append default symbol to array
+// the inlined functions of the address are expanded as multiple symbols
 func (i *Info) FindSymbols(addresses []uint64, defaultSymbol string) []string {
 	if len(addresses) == 0 {
 		return nil
@@ -95,43 +182,99 @@ func (i *Info) FindSymbols(addresses []uint64, defaultSymbol string) []string {
 		if addr <= 0 {
 			continue
 		}
-		s := i.FindSymbolName(addr)
-		if s == "" {
-			s = defaultSymbol
+		frames := i.FindFrames(addr)
+		if len(frames) == 0 {
+			result = append(result, defaultSymbol)
+			continue
+		}
+		for _, f := range frames {
+			result = append(result, f.Name)
 		}
-		result = append(result, s)
 	}
 	return result
 }
 
-// FindSymbolName by address
+// FindSymbolName by address, return the name of function which the address is located(not inlined)
 func (i *Info) FindSymbolName(address uint64) string {
-	if d := i.cacheAddrToSymbol[address]; d != "" {
-		return d
+	frames := i.FindFrames(address)
+	if len(frames) == 0 {
+		return ""
+	}
+	return frames[len(frames)-1].Name
+}
+
+// FindFrames by address, the inlined frames are ordered from the innermost to the outermost
+func (i *Info) FindFrames(address uint64) []*Frame {
+	if d, ok := i.cacheAddrToFrames.Get(address); ok {
+		atomic.AddUint64(&i.cacheHit, 1)
+		return d.([]*Frame)
 	}
+	atomic.AddUint64(&i.cacheMiss, 1)
 	log.Debugf("ready to find the symbol from address: %d", address)
-	foundModule := false
-	for _, mod := range i.Modules {
+	frames, foundModule := i.findFramesInModules(i.GetModules(), address)
+	if !foundModule {
+		if modules := i.refreshModules(); len(modules) > 0 {
+			frames, foundModule = i.findFramesInModules(modules, address)
+		}
+	}
+	if !foundModule {
+		log.Debugf("could not found any module to handle address: %d", address)
+	}
+	if len(frames) > 0 {
+		i.cacheAddrToFrames.Add(address, frames)
+	}
+	return frames
+}
+
+func (i *Info) findFramesInModules(modules []*Module, address uint64) (frames []*Frame, foundModule bool) {
+	for _, mod := range modules {
 		offset, c := mod.contains(address)
 		if !c {
 			continue
 		}
 		foundModule = true
 
-		if sym := mod.findAddr(offset); sym != nil {
-			name := processSymbolName(sym.Name)
-			i.cacheAddrToSymbol[address] = name
-			return name
+		if f := mod.findFrames(offset); len(f) > 0 {
+			return f, true
 		}
 	}
-	if !foundModule {
-		log.Debugf("could not found any module to handle address: %d", address)
+	return nil, foundModule
+}
+
+// refreshModules append the new modules into the info, return the new modules
+func (i *Info) refreshModules() []*Module {
+	i.refreshModulesMutex.Lock()
+	defer i.refreshModulesMutex.Unlock()
+	if i.refresher == nil || time.Since(i.lastRefreshTime) < i.refreshInterval {
+		return nil
+	}
+	i.lastRefreshTime = time.Now()
+
+	modules, err := i.refresher(i.GetModules())
+	if errors.Is(err, ErrRefreshStopped) {
+		log.Debugf("stop refreshing the modules: %v", err)
+		i.refresher = nil
+		return nil
+	} else if err != nil {
+		log.Warnf("refresh the modules failure: %v", err)
+		return nil
 	}
-	return ""
+	if len(modules) == 0 {
+		return nil
+	}
+	for _, m := range modules {
+		log.Debugf("detected new module: %s", m.Name)
+	}
+	i.modulesMutex.Lock()
+	defer i.modulesMutex.Unlock()
+	result := make([]*Module, 0, len(i.Modules)+len(modules))
+	result = append(result, i.Modules...)
+	i.Modules = append(result, modules...)
+	return modules
 }
 
 func (i *Info) FindSymbolAddress(name string) uint64 {
-	for _, m := range i.Modules {
+	for _, m := range i.GetModules() {
 		for _, sym := range m.Symbols {
 			if sym.Name == name {
 				return sym.Location
@@ -146,7 +289,7 @@ func (i *Info) FindSymbolByRegex(rep string) (string, error) {
 	if err != nil {
 		return "", err
 	}
-	for _, m := range i.Modules {
+	for _, m := range i.GetModules() {
 		for _, sym := range m.Symbols {
 			if compile.MatchString(sym.Name) {
 				return sym.Name, nil
@@ -172,6 +315,21 @@ func (m *Module) contains(addr uint64) (uint64, bool) {
 	return 0, false
 }
 
+func (m *Module) findFrames(offset uint64) []*Frame {
+	if m.Resolver != nil {
+		if frames := m.Resolver.ResolveFrames(offset); len(frames) > 0 {
+			for _, f := range frames {
+				f.Name = processSymbolName(f.Name)
+			}
+			return frames
+		}
+	}
+	if sym := m.findAddr(offset); sym != nil {
+		return []*Frame{{Name: processSymbolName(sym.Name)}}
+	}
+	return nil
+}
+
 func (m *Module) findAddr(offset uint64) *Symbol {
 	start := 0
 	end := len(m.Symbols) - 1
@@ -195,15 +353,3 @@ func (m *Module) findAddr(offset uint64) *Symbol {
 
 	return nil
 }
-
-func processSymbolName(name string) string {
-	if name == "" {
-		return ""
-	}
-	// fix process demangle symbol name, such as c++ language symbol
-	skip := 0
-	if name[0] == '.' || name[0] == '$' {
-		skip++
-	}
-	return demangle.Filter(name[skip:])
-}
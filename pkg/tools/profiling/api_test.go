@@ -0,0 +1,93 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package profiling
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInfoRefreshModules(t *testing.T) {
+	newModule := func(name string, start, end uint64) *Module {
+		return &Module{
+			Name:    name,
+			Type:    ModuleTypeExec,
+			Ranges:  []*ModuleRange{{StartAddr: start, EndAddr: end}},
+			Symbols: []*Symbol{{Name: name + "_func", Location: start}, {Name: "end", Location: end}},
+		}
+	}
+	info := NewInfo(map[string]*Module{"exe": newModule("exe", 100, 200)})
+
+	// the library is loaded after the info created
+	loaded := []*Module{newModule("lib.so", 300, 400)}
+	refreshCount := 0
+	info.SetModulesRefresher(func(exists []*Module) ([]*Module, error) {
+		refreshCount++
+		assert.Len(t, exists, 1)
+		return loaded, nil
+	}, time.Hour)
+
+	assert.Equal(t, "exe_func", info.FindSymbolName(150))
+	assert.Equal(t, 0, refreshCount)
+	assert.Equal(t, "lib.so_func", info.FindSymbolName(350))
+	assert.Equal(t, 1, refreshCount)
+	assert.Len(t, info.Modules, 2)
+
+	// the refresh is limited by the interval
+	assert.Equal(t, "", info.FindSymbolName(550))
+	assert.Equal(t, 1, refreshCount)
+
+	// the refresher is removed after stopped
+	info.SetModulesRefresher(func(exists []*Module) ([]*Module, error) {
+		refreshCount++
+		return nil, fmt.Errorf("%w: exited", ErrRefreshStopped)
+	}, 0)
+	assert.Equal(t, "", info.FindSymbolName(550))
+	assert.Equal(t, "", info.FindSymbolName(550))
+	assert.Equal(t, 2, refreshCount)
+}
+
+func TestInfoFindSymbolsConcurrently(t *testing.T) {
+	info := NewInfo(map[string]*Module{"exe": {
+		Name:    "exe",
+		Type:    ModuleTypeExec,
+		Ranges:  []*ModuleRange{{StartAddr: 100, EndAddr: 300}},
+		Symbols: []*Symbol{{Name: "a", Location: 100}, {Name: "b", Location: 200}, {Name: "end", Location: 300}},
+	}})
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				assert.Equal(t, []string{"a", "b"}, info.FindSymbols([]uint64{150, 250}, "[MISSING]"))
+			}
+		}()
+	}
+	wg.Wait()
+
+	stats := info.SymbolCacheStats()
+	assert.Equal(t, uint64(800), stats.Hit+stats.Miss)
+	assert.Equal(t, 2, stats.Size)
+	assert.True(t, stats.HitRate() > 0.9)
+}
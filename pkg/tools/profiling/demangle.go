@@ -0,0 +1,134 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package profiling
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ianlancetaylor/demangle"
+)
+
+// SymbolNameStyle is the style of the demangled symbol name
+type SymbolNameStyle string
+
+const (
+	// SymbolNameStyleFull keeps the template(generic) arguments, function parameters and clone suffixes
+	SymbolNameStyleFull SymbolNameStyle = "full"
+	// SymbolNameStyleSimplified removes the template(generic) arguments, function parameters and clone suffixes,
+	// so the same function with different instantiations could be merged in the flame graph
+	SymbolNameStyleSimplified SymbolNameStyle = "simplified"
+)
+
+var (
+	symbolNameStyle = SymbolNameStyleFull
+
+	// the legacy rust symbol is end with "17h" and 16 hex digits hash, such as: _ZN3std2rt10lang_start17h0123456789abcdefE
+	legacyRustSymbolRegex = regexp.MustCompile(`^_ZN.*17h[0-9a-f]{16}E(\..*)?$`)
+)
+
+// ParseSymbolNameStyle from the config, the empty value means the full style
+func ParseSymbolNameStyle(style string) (SymbolNameStyle, error) {
+	switch SymbolNameStyle(style) {
+	case "", SymbolNameStyleFull:
+		return SymbolNameStyleFull, nil
+	case SymbolNameStyleSimplified:
+		return SymbolNameStyleSimplified, nil
+	}
+	return "", fmt.Errorf("unknown symbol name style: %s", style)
+}
+
+// SetSymbolNameStyle of all the symbolized names, should be set before profiling
+func SetSymbolNameStyle(style SymbolNameStyle) {
+	symbolNameStyle = style
+}
+
+func processSymbolName(name string) string {
+	return demangleSymbolName(name, symbolNameStyle)
+}
+
+func demangleSymbolName(name string, style SymbolNameStyle) string {
+	if name == "" {
+		return ""
+	}
+	// the swift symbol(such as: $s4main5helloyyF) is not supported to demangle, keep the original name
+	if isSwiftSymbol(name) {
+		return name
+	}
+	// fix process demangle symbol name, such as c++ language symbol
+	skip := 0
+	if name[0] == '.' || name[0] == '$' {
+		skip++
+	}
+	name = name[skip:]
+
+	if style != SymbolNameStyleSimplified {
+		return demangle.Filter(name)
+	}
+	result := demangle.Filter(name, demangle.NoParams, demangle.NoTemplateParams, demangle.NoClones)
+	// the template options only works on the C++ symbol, the rust generic arguments should be removed manually
+	if strings.HasPrefix(name, "_R") || legacyRustSymbolRegex.MatchString(name) {
+		result = removeRustGenericArgs(result)
+	}
+	return result
+}
+
+func isSwiftSymbol(name string) bool {
+	for _, prefix := range []string{"$s", "$S", "_$s", "_$S"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeRustGenericArgs such as "core::ptr::drop_in_place::<alloc::vec::Vec<u8>>" to "core::ptr::drop_in_place",
+// the qualified path(such as "<std::path::PathBuf as core::clone::Clone>::clone") are kept
+func removeRustGenericArgs(name string) string {
+	result := strings.Builder{}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c != '<' || i == 0 || !isRustGenericArgsStart(name[i-1]) {
+			result.WriteByte(c)
+			continue
+		}
+		// skip the balanced generic arguments
+		depth := 0
+		for ; i < len(name); i++ {
+			if name[i] == '<' {
+				depth++
+			} else if name[i] == '>' && name[i-1] != '-' {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+		// remove the path separator before the generic arguments(turbofish)
+		str := strings.TrimSuffix(result.String(), "::")
+		result.Reset()
+		result.WriteString(str)
+	}
+	return result.String()
+}
+
+func isRustGenericArgsStart(prev byte) bool {
+	return prev == ':' || prev == '_' || (prev >= 'a' && prev <= 'z') || (prev >= 'A' && prev <= 'Z') ||
+		(prev >= '0' && prev <= '9')
+}
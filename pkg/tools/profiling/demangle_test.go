@@ -0,0 +1,125 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package profiling
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDemangleSymbolName(t *testing.T) {
+	tests := []struct {
+		name       string
+		symbol     string
+		full       string
+		simplified string
+	}{
+		{
+			name:       "rust v0",
+			symbol:     "_RNvMsr_NtCs3ssYzQotkvD_3std4pathNtB5_7PathBuf3new",
+			full:       "<std::path::PathBuf>::new",
+			simplified: "<std::path::PathBuf>::new",
+		},
+		{
+			name:       "rust v0 with generic arguments",
+			symbol:     "_RINbNbCskIICzLVDPPb_5alloc5alloc8box_freeDINbNiB4_5boxed5FnBoxuEp6OutputuEL_ECs1iopQbuBiw2_3std",
+			full:       "alloc::alloc::box_free::<dyn alloc::boxed::FnBox<(), Output = ()>>",
+			simplified: "alloc::alloc::box_free",
+		},
+		{
+			name: "rust v0 with trait implement and closures",
+			symbol: "_RNCINkXs25_NgCsbmNqQUJIY6D_4core5sliceINyB9_4IterhENuNgNoBb_4iter8iterator8Iterator9rpositionNCNgNp" +
+				"B9_6memchr7memrchrs_0E0Bb_",
+			full: "<core::slice::Iter<u8> as core::iter::iterator::Iterator>::rposition::" +
+				"<core::slice::memchr::memrchr::{closure#1}>::{closure#0}",
+			simplified: "<core::slice::Iter as core::iter::iterator::Iterator>::rposition::{closure#0}",
+		},
+		{
+			name:       "rust v0 with const generic",
+			symbol:     "_RNvMC0INtC8arrayvec8ArrayVechKj7b_E3new",
+			full:       "<arrayvec::ArrayVec<u8, 123>>::new",
+			simplified: "<arrayvec::ArrayVec>::new",
+		},
+		{
+			name:       "rust v0 with llvm suffix",
+			symbol:     "_RNvNtCs1234_7mycrate3foo3bar.llvm.123456",
+			full:       "mycrate::foo::bar",
+			simplified: "mycrate::foo::bar",
+		},
+		{
+			name:       "rust legacy",
+			symbol:     "_ZN3std2rt10lang_start17h0123456789abcdefE",
+			full:       "std::rt::lang_start",
+			simplified: "std::rt::lang_start",
+		},
+		{
+			name:       "c++ template",
+			symbol:     "_ZNSt6vectorIiSaIiEE9push_backERKi",
+			full:       "std::vector<int, std::allocator<int> >::push_back(int const&)",
+			simplified: "std::vector::push_back",
+		},
+		{
+			name:       "c++ clone",
+			symbol:     "_ZL3foov.isra.0",
+			full:       "foo() [clone .isra.0]",
+			simplified: "foo",
+		},
+		{
+			name:       "c++ operator",
+			symbol:     "_ZN3FooltERKS_",
+			full:       "Foo::operator<(Foo const&)",
+			simplified: "Foo::operator<",
+		},
+		{
+			name:       "swift",
+			symbol:     "$s4main5helloyyF",
+			full:       "$s4main5helloyyF",
+			simplified: "$s4main5helloyyF",
+		},
+		{
+			name:       "swift with underline prefix",
+			symbol:     "_$sSS5countSivg",
+			full:       "_$sSS5countSivg",
+			simplified: "_$sSS5countSivg",
+		},
+		{
+			name:       "c function",
+			symbol:     "main",
+			full:       "main",
+			simplified: "main",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.full, demangleSymbolName(tt.symbol, SymbolNameStyleFull))
+			assert.Equal(t, tt.simplified, demangleSymbolName(tt.symbol, SymbolNameStyleSimplified))
+		})
+	}
+}
+
+func TestParseSymbolNameStyle(t *testing.T) {
+	style, err := ParseSymbolNameStyle("")
+	assert.NoError(t, err)
+	assert.Equal(t, SymbolNameStyleFull, style)
+	style, err = ParseSymbolNameStyle("simplified")
+	assert.NoError(t, err)
+	assert.Equal(t, SymbolNameStyleSimplified, style)
+	_, err = ParseSymbolNameStyle("unknown")
+	assert.Error(t, err)
+}
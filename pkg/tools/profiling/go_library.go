@@ -73,16 +73,34 @@ func (l *GoLibrary) AnalyzeSymbols(filePath string) ([]*Symbol, error) {
 }
 
 func (l *GoLibrary) ToModule(pid int32, modName, modPath string, moduleRange []*ModuleRange) (*Module, error) {
-	res := &Module{}
-	res.Name = modName
-	res.Path = modPath
-	res.Ranges = moduleRange
 	file, err := elf.Open(modPath)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
+	res, err := newElfModule(file, modName, modPath, moduleRange)
+	if err != nil {
+		return nil, err
+	}
+
+	// load all symbols
+	res.Symbols, err = l.AnalyzeSymbols(modPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// newElfModule build the module by the elf file header, without the symbols
+func newElfModule(file *elf.File, modName, modPath string, moduleRange []*ModuleRange) (*Module, error) {
+	res := &Module{}
+	res.Name = modName
+	res.Path = modPath
+	res.Ranges = moduleRange
+	res.BuildID = readBuildID(file)
+
 	header := file.FileHeader
 	mType := ModuleTypeUnknown
 	switch header.Type {
@@ -107,12 +125,5 @@ func (l *GoLibrary) ToModule(pid int32, modName, modPath string, moduleRange []*
 		res.SoOffset = section.Offset
 	}
 	res.Type = mType
-
-	// load all symbols
-	res.Symbols, err = l.AnalyzeSymbols(modPath)
-	if err != nil {
-		return nil, err
-	}
-
 	return res, nil
 }
@@ -0,0 +1,87 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package profiling
+
+import (
+	"debug/elf"
+	"fmt"
+)
+
+// GoPclntabLibrary is reading the symbols from the Go runtime function table(.gopclntab),
+// so the stripped Go binary could be profiling, and the inlined functions and source lines are recovered
+type GoPclntabLibrary struct {
+}
+
+func NewGoPclntabLibrary() *GoPclntabLibrary {
+	return &GoPclntabLibrary{}
+}
+
+func (l *GoPclntabLibrary) IsSupport(filePath string) bool {
+	file, err := elf.Open(filePath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	if findPclntabSection(file) == nil {
+		return false
+	}
+	// make sure the pclntab version could be analyzed, otherwise fallback to the generic elf reader
+	_, err = newPclntab(file)
+	return err == nil
+}
+
+func (l *GoPclntabLibrary) AnalyzeSymbols(filePath string) ([]*Symbol, error) {
+	file, err := elf.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	tab, err := newPclntab(file)
+	if err != nil {
+		return nil, err
+	}
+	return tab.symbols(), nil
+}
+
+func (l *GoPclntabLibrary) ToModule(pid int32, modName, modPath string, moduleRange []*ModuleRange) (*Module, error) {
+	file, err := elf.Open(modPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	res, err := newElfModule(file, modName, modPath, moduleRange)
+	if err != nil {
+		return nil, err
+	}
+	tab, err := newPclntab(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not analyze the pclntab in module: %s, error: %v", modName, err)
+	}
+	// prefer the symbol table when the binary is not stripped, it also contains the non-Go(cgo) functions
+	if res.Symbols, err = NewGoLibrary().AnalyzeSymbols(modPath); err != nil || len(res.Symbols) == 0 {
+		res.Symbols = tab.symbols()
+	}
+	res.Resolver = tab
+	return res, nil
+}
+
+// ResolveFrames of the address in the Go binary
+func (t *pclntab) ResolveFrames(address uint64) []*Frame {
+	return t.frames(address)
+}
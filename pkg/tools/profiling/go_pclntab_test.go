@@ -0,0 +1,134 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package profiling
+
+import (
+	"debug/elf"
+	"debug/gosym"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const pclntabTestProgram = `package main
+
+import "fmt"
+
+func add(a, b int) int {
+	return a*b + a
+}
+
+func main() {
+	var s int
+	for i := 0; i < 10; i++ {
+		s += add(i, s)
+	}
+	fmt.Println(s)
+}
+`
+
+func buildPclntabTestBinary(t *testing.T, ldflags string) string {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "main.go"), []byte(pclntabTestProgram), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module pclntabtest\n\ngo 1.20\n"), 0o600))
+	output := filepath.Join(dir, "test.bin")
+	cmd := exec.Command("go", "build", "-ldflags="+ldflags, "-o", output, ".")
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Skipf("could not build the test binary: %v, %s", err, out)
+	}
+	return output
+}
+
+func TestPclntabSameWithGoSym(t *testing.T) {
+	binary := buildPclntabTestBinary(t, "")
+	file, err := elf.Open(binary)
+	assert.NoError(t, err)
+	defer file.Close()
+
+	// the reference implementation
+	data, err := findPclntabSection(file).Data()
+	assert.NoError(t, err)
+	table, err := gosym.NewTable(nil, gosym.NewLineTable(data, file.Section(".text").Addr))
+	assert.NoError(t, err)
+
+	tab, err := newPclntab(file)
+	assert.NoError(t, err)
+	symbols := tab.symbols()
+	assert.Equal(t, len(table.Funcs), len(symbols))
+	for i, f := range table.Funcs {
+		assert.Equal(t, f.Name, symbols[i].Name)
+		assert.Equal(t, f.Entry, symbols[i].Location)
+	}
+
+	mainFunc := table.LookupFunc("main.main")
+	assert.NotNil(t, mainFunc)
+	for pc := mainFunc.Entry; pc < mainFunc.End; pc++ {
+		file, line, _ := table.PCToLine(pc)
+		frames := tab.frames(pc)
+		if !assert.NotEmpty(t, frames) {
+			return
+		}
+		assert.Equal(t, "main.main", frames[len(frames)-1].Name)
+		if len(frames) == 1 && line > 0 {
+			assert.Equal(t, file, frames[0].File)
+			assert.Equal(t, line, frames[0].Line)
+		}
+	}
+}
+
+func TestPclntabStrippedBinary(t *testing.T) {
+	binary := buildPclntabTestBinary(t, "-s -w")
+	symbols, _ := NewGoLibrary().AnalyzeSymbols(binary)
+	assert.Empty(t, symbols)
+
+	library := NewGoPclntabLibrary()
+	assert.True(t, library.IsSupport(binary))
+	module, err := library.ToModule(0, "test.bin", binary, []*ModuleRange{{StartAddr: 0, EndAddr: ^uint64(0)}})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, module.Symbols)
+
+	var mainSymbol *Symbol
+	for _, s := range module.Symbols {
+		if s.Name == "main.main" {
+			mainSymbol = s
+		}
+	}
+	if !assert.NotNil(t, mainSymbol) {
+		return
+	}
+
+	// the "add" function should be inlined into the main function
+	info := NewInfo(map[string]*Module{"test.bin": module})
+	foundInlined := false
+	for pc := mainSymbol.Location; pc < mainSymbol.Location+mainSymbol.Size; pc++ {
+		assert.Equal(t, "main.main", info.FindSymbolName(pc))
+		frames := info.FindFrames(pc)
+		if len(frames) == 2 && frames[0].Name == "main.add" {
+			foundInlined = true
+			assert.Equal(t, "main.go", filepath.Base(frames[0].File))
+			assert.Equal(t, 6, frames[0].Line)
+			assert.Equal(t, 12, frames[1].Line)
+			assert.Equal(t, []string{"main.add", "main.main"}, info.FindSymbols([]uint64{pc}, "[MISSING]"))
+		}
+	}
+	assert.True(t, foundInlined, "could not found the inlined function")
+}
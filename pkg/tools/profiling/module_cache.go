@@ -0,0 +1,216 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package profiling
+
+import (
+	"debug/elf"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sync"
+	"syscall"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+)
+
+// ModuleCache shares the symbol tables of the same module file between processes.
+// The module file is identified by the build-id, or the device, inode and modify time when the build-id not exists.
+// The referenced modules are always kept, and the idle(no reference) modules are evicted by LRU.
+type ModuleCache struct {
+	lock    sync.Mutex
+	modules map[string]*sharedModule
+	idle    *simplelru.LRU
+}
+
+type sharedModule struct {
+	key    string
+	cache  *ModuleCache
+	refs   int
+	once   sync.Once
+	module *Module
+	err    error
+}
+
+func NewModuleCache(idleSize int) (*ModuleCache, error) {
+	c := &ModuleCache{modules: make(map[string]*sharedModule)}
+	idle, err := simplelru.NewLRU(idleSize, func(key, _ interface{}) {
+		// the module could be referenced again before removed from the idle list
+		if m := c.modules[key.(string)]; m != nil && m.refs == 0 {
+			delete(c.modules, m.key)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.idle = idle
+	return c, nil
+}
+
+// Load the module from cache, or using the loader to build the module when not exists.
+// The returned module must be released by Module.Release when not used.
+func (c *ModuleCache) Load(modName, modPath string, moduleRange []*ModuleRange,
+	loader func() (*Module, error)) (*Module, error) {
+	key, err := moduleCacheKey(modPath)
+	if err != nil {
+		log.Debugf("could not generate the cache key of module: %s, error: %v", modPath, err)
+		return loader()
+	}
+
+	shared := c.acquire(key)
+	shared.once.Do(func() {
+		shared.module, shared.err = loader()
+	})
+	if shared.err != nil {
+		c.release(shared, true)
+		return nil, shared.err
+	}
+
+	module := *shared.module
+	module.Name = modName
+	module.Path = modPath
+	module.Ranges = moduleRange
+	module.shared = shared
+	return &module, nil
+}
+
+// Size of the modules in the cache, including the referenced and idle modules
+func (c *ModuleCache) Size() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.modules)
+}
+
+func (c *ModuleCache) acquire(key string) *sharedModule {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	m := c.modules[key]
+	if m == nil {
+		m = &sharedModule{key: key, cache: c}
+		c.modules[key] = m
+	}
+	m.refs++
+	if m.refs == 1 {
+		c.idle.Remove(key)
+	}
+	return m
+}
+
+func (c *ModuleCache) release(m *sharedModule, failure bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	m.refs--
+	if m.refs > 0 {
+		return
+	}
+	// the failure module should be reloaded next time
+	if failure {
+		if c.modules[m.key] == m {
+			delete(c.modules, m.key)
+		}
+		return
+	}
+	c.idle.Add(m.key, m)
+}
+
+// Release the reference of the shared symbol table
+func (m *Module) Release() {
+	if m == nil || m.shared == nil {
+		return
+	}
+	m.shared.cache.release(m.shared, false)
+	m.shared = nil
+}
+
+// Release all modules in the profiling info
+func (i *Info) Release() {
+	if i == nil {
+		return
+	}
+	for _, m := range i.GetModules() {
+		m.Release()
+	}
+}
+
+func moduleCacheKey(modPath string) (string, error) {
+	if file, err := elf.Open(modPath); err == nil {
+		buildID := readBuildID(file)
+		_ = file.Close()
+		if buildID != "" {
+			return "build-id:" + buildID, nil
+		}
+	}
+
+	stat, err := os.Stat(modPath)
+	if err != nil {
+		return "", err
+	}
+	sys, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", fmt.Errorf("could not read the inode of file")
+	}
+	return fmt.Sprintf("inode:%d_%d_%d_%d", sys.Dev, sys.Ino, stat.ModTime().UnixNano(), stat.Size()), nil
+}
+
+// FileBuildID of the ELF file, return empty when the file has no build-id
+func FileBuildID(path string) (string, error) {
+	file, err := elf.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return readBuildID(file), nil
+}
+
+// readBuildID from the GNU build-id note, or the Go build-id note when the GNU build-id not exists
+func readBuildID(file *elf.File) string {
+	if id := readNoteDesc(file, ".note.gnu.build-id", "GNU", 3); len(id) > 0 {
+		return hex.EncodeToString(id)
+	}
+	if id := readNoteDesc(file, ".note.go.buildid", "Go", 4); len(id) > 0 {
+		return string(id)
+	}
+	return ""
+}
+
+func readNoteDesc(file *elf.File, sectionName, noteName string, noteType uint32) []byte {
+	section := file.Section(sectionName)
+	if section == nil || section.Type != elf.SHT_NOTE {
+		return nil
+	}
+	data, err := section.Data()
+	if err != nil {
+		return nil
+	}
+	align := func(n uint32) uint64 {
+		return (uint64(n) + 3) &^ 3
+	}
+	for len(data) >= 12 {
+		nameSize, descSize, t := file.ByteOrder.Uint32(data), file.ByteOrder.Uint32(data[4:]), file.ByteOrder.Uint32(data[8:])
+		data = data[12:]
+		if align(nameSize)+align(descSize) > uint64(len(data)) {
+			return nil
+		}
+		name := cString(data[:nameSize])
+		desc := data[align(nameSize) : align(nameSize)+uint64(descSize)]
+		if name == noteName && t == noteType {
+			return desc
+		}
+		data = data[align(nameSize)+align(descSize):]
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package profiling
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModuleCache(t *testing.T) {
+	dir := t.TempDir()
+	files := make([]string, 3)
+	for i := range files {
+		files[i] = filepath.Join(dir, fmt.Sprintf("lib%d.so", i))
+		assert.NoError(t, os.WriteFile(files[i], []byte(files[i]), 0o600))
+	}
+	cache, err := NewModuleCache(1)
+	assert.NoError(t, err)
+
+	loadCount := 0
+	load := func(file, name string) *Module {
+		m, err := cache.Load(name, file, []*ModuleRange{{StartAddr: 1}}, func() (*Module, error) {
+			loadCount++
+			return &Module{Symbols: []*Symbol{{Name: file}}}, nil
+		})
+		assert.NoError(t, err)
+		return m
+	}
+
+	// the same file in different processes share the symbols
+	m1, m2 := load(files[0], "p1"), load(files[0], "p2")
+	assert.Equal(t, 1, loadCount)
+	assert.Equal(t, "p1", m1.Name)
+	assert.Equal(t, "p2", m2.Name)
+	assert.Same(t, m1.Symbols[0], m2.Symbols[0])
+
+	// the referenced module is never evicted
+	m1.Release()
+	m3 := load(files[1], "p3")
+	m3.Release()
+	load(files[2], "p4").Release()
+	assert.Equal(t, 2, cache.Size())
+	load(files[0], "p5").Release()
+	assert.Equal(t, 3, loadCount)
+
+	// the idle module is evicted by LRU
+	m2.Release()
+	assert.Equal(t, 1, cache.Size())
+	load(files[1], "p6").Release()
+	assert.Equal(t, 1, cache.Size())
+	load(files[0], "p7").Release()
+	assert.Equal(t, 5, loadCount)
+
+	// the failure should not be cached
+	_, err = cache.Load("p8", files[2], nil, func() (*Module, error) {
+		return nil, fmt.Errorf("failure")
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 1, cache.Size())
+}
+
+func TestReadBuildID(t *testing.T) {
+	exe, err := os.Executable()
+	assert.NoError(t, err)
+	file, err := elf.Open(exe)
+	if err != nil {
+		t.Skipf("the test binary is not elf file: %v", err)
+	}
+	defer file.Close()
+	assert.NotEmpty(t, readBuildID(file))
+
+	key1, err := moduleCacheKey(exe)
+	assert.NoError(t, err)
+	key2, err := moduleCacheKey(exe)
+	assert.NoError(t, err)
+	assert.Equal(t, key1, key2)
+}
@@ -0,0 +1,537 @@
+// Licensed to Apache Software Foundation (ASF) under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Apache Software Foundation (ASF) licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package profiling
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+type pclntabVersion int8
+
+const (
+	_ pclntabVersion = iota
+	pclntabVersion116
+	pclntabVersion118
+	pclntabVersion120
+)
+
+const (
+	pclntabMagic116 = 0xfffffffa
+	pclntabMagic118 = 0xfffffff0
+	pclntabMagic120 = 0xfffffff1
+
+	// the index of inline tree in the pcdata and funcdata, same as the runtime/symtab.go
+	pcdataInlTreeIndex = 2
+	funcdataInlTree    = 3
+
+	// the max depth of inlined functions, avoid the dead loop when the data is broken
+	maxInlineDepth = 100
+
+	// the range of rodata field index in the runtime.moduledata
+	moduleDataRodataMinIndex = 30
+	moduleDataRodataMaxIndex = 60
+)
+
+// pclntab is the parser of the Go runtime function table(.gopclntab), which is always kept in the Go binary
+// even if the binary is built with "-ldflags=-s -w"
+type pclntab struct {
+	data    []byte
+	order   binary.ByteOrder
+	version pclntabVersion
+	ptrSize int
+	quantum uint64
+
+	nfunc       int
+	textStart   uint64
+	funcnametab []byte
+	cutab       []byte
+	filetab     []byte
+	pctab       []byte
+	funcdata    []byte
+	functab     []byte
+
+	// the base address of the funcdata(go:func.*), only works on the Go 1.18+
+	gofunc uint64
+	// memory of the elf file, for read the inline tree by the virtual address
+	memory *elfMemory
+}
+
+// pclntabFunc is the function metadata(runtime._func) in the pclntab
+type pclntabFunc struct {
+	entry     uint64
+	end       uint64
+	nameOff   int32
+	pcfile    uint32
+	pcln      uint32
+	npcdata   uint32
+	cuOffset  uint32
+	nfuncdata uint8
+	// the offset of the _func struct in the funcdata
+	offset uint64
+}
+
+func findPclntabSection(file *elf.File) *elf.Section {
+	for _, name := range []string{".gopclntab", ".data.rel.ro.gopclntab"} {
+		if s := file.Section(name); s != nil && s.Type != elf.SHT_NOBITS {
+			return s
+		}
+	}
+	return nil
+}
+
+func newPclntab(file *elf.File) (*pclntab, error) {
+	section := findPclntabSection(file)
+	if section == nil {
+		return nil, fmt.Errorf("could not found the .gopclntab section")
+	}
+	data, err := section.Data()
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 16 || data[4] != 0 || data[5] != 0 {
+		return nil, fmt.Errorf("the pclntab header is illegal")
+	}
+
+	t := &pclntab{data: data, order: file.ByteOrder, quantum: uint64(data[6]), ptrSize: int(data[7])}
+	if t.ptrSize != 4 && t.ptrSize != 8 {
+		return nil, fmt.Errorf("unknown pointer size in the pclntab: %d", t.ptrSize)
+	}
+	switch magic := t.order.Uint32(data); magic {
+	case pclntabMagic116:
+		t.version = pclntabVersion116
+	case pclntabMagic118:
+		t.version = pclntabVersion118
+	case pclntabMagic120:
+		t.version = pclntabVersion120
+	default:
+		return nil, fmt.Errorf("not support the pclntab version, magic: %#x", magic)
+	}
+
+	// header fields after the magic, quantum and pointer size
+	headerFieldCount := 7
+	if t.version >= pclntabVersion118 {
+		headerFieldCount = 8
+	}
+	if len(data) < 8+headerFieldCount*t.ptrSize {
+		return nil, fmt.Errorf("the pclntab header is too short")
+	}
+	offset := func(word int) uint64 {
+		return t.uintptr(data[8+word*t.ptrSize:])
+	}
+	t.nfunc = int(offset(0))
+	fieldStart := 2
+	if t.version >= pclntabVersion118 {
+		t.textStart = offset(2)
+		if t.textStart == 0 {
+			// the text start is relocated at runtime when the binary is PIE
+			if text := file.Section(".text"); text != nil {
+				t.textStart = text.Addr
+			}
+		}
+		fieldStart = 3
+	}
+	sections := make([][]byte, 5)
+	for i := range sections {
+		start := offset(fieldStart + i)
+		if start > uint64(len(data)) {
+			return nil, fmt.Errorf("the pclntab offset is out of range: %d", start)
+		}
+		sections[i] = data[start:]
+	}
+	t.funcnametab, t.cutab, t.filetab, t.pctab, t.funcdata = sections[0], sections[1], sections[2], sections[3], sections[4]
+	t.functab = t.funcdata
+	if uint64(len(t.functab)) < uint64(2*t.nfunc+1)*uint64(t.functabFieldSize()) {
+		return nil, fmt.Errorf("the function table in pclntab is too short")
+	}
+
+	// the inline trees are saved in the go:func.*, which usually in the .rodata section
+	if t.version >= pclntabVersion118 {
+		t.gofunc = findGoFuncAddress(file, t, section.Addr)
+		t.memory = loadElfMemory(file, t.gofunc)
+	} else if rodata := file.Section(".rodata"); rodata != nil {
+		t.memory = loadElfMemory(file, rodata.Addr)
+	} else {
+		t.memory = &elfMemory{}
+	}
+	return t, nil
+}
+
+func (t *pclntab) uintptr(b []byte) uint64 {
+	if t.ptrSize == 4 {
+		return uint64(t.order.Uint32(b))
+	}
+	return t.order.Uint64(b)
+}
+
+func (t *pclntab) functabFieldSize() int {
+	if t.version >= pclntabVersion118 {
+		return 4
+	}
+	return t.ptrSize
+}
+
+// functabEntry read the entry address and function offset of the index in the function table
+func (t *pclntab) functabEntry(index int) (entry, funcOffset uint64) {
+	size := t.functabFieldSize()
+	b := t.functab[2*index*size:]
+	if t.version >= pclntabVersion118 {
+		entry = t.textStart + uint64(t.order.Uint32(b))
+	} else {
+		entry = t.uintptr(b)
+	}
+	// the last entry only contains the end address of the text
+	if index >= t.nfunc {
+		return entry, 0
+	}
+	if t.version >= pclntabVersion118 {
+		return entry, uint64(t.order.Uint32(b[size:]))
+	}
+	return entry, t.uintptr(b[size:])
+}
+
+// funcAt read the function metadata by the index of function table
+func (t *pclntab) funcAt(index int) (*pclntabFunc, error) {
+	entry, offset := t.functabEntry(index)
+	end, _ := t.functabEntry(index + 1)
+	if offset >= uint64(len(t.funcdata)) {
+		return nil, fmt.Errorf("the function offset is out of range: %d", offset)
+	}
+	b := t.funcdata[offset:]
+	fieldStart, nfuncdataOffset := 4, 39
+	switch t.version {
+	case pclntabVersion116:
+		fieldStart, nfuncdataOffset = t.ptrSize, t.ptrSize+35
+	case pclntabVersion120:
+		nfuncdataOffset = 43
+	}
+	if len(b) <= nfuncdataOffset {
+		return nil, fmt.Errorf("the function data is too short")
+	}
+	field := func(index int) uint32 {
+		return t.order.Uint32(b[fieldStart+(index-1)*4:])
+	}
+	return &pclntabFunc{
+		entry:     entry,
+		end:       end,
+		nameOff:   int32(field(1)),
+		pcfile:    field(5),
+		pcln:      field(6),
+		npcdata:   field(7),
+		cuOffset:  field(8),
+		nfuncdata: b[nfuncdataOffset],
+		offset:    offset,
+	}, nil
+}
+
+// findFunc by the virtual address, return nil if not found
+func (t *pclntab) findFunc(pc uint64) *pclntabFunc {
+	first, _ := t.functabEntry(0)
+	last, _ := t.functabEntry(t.nfunc)
+	if pc < first || pc >= last {
+		return nil
+	}
+	index := sort.Search(t.nfunc, func(i int) bool {
+		entry, _ := t.functabEntry(i + 1)
+		return entry > pc
+	})
+	if index >= t.nfunc {
+		return nil
+	}
+	f, err := t.funcAt(index)
+	if err != nil {
+		log.Debugf("read the function in pclntab failure: %v", err)
+		return nil
+	}
+	return f
+}
+
+func (t *pclntab) funcName(nameOff int32) string {
+	if nameOff < 0 || int(nameOff) >= len(t.funcnametab) {
+		return ""
+	}
+	return cString(t.funcnametab[nameOff:])
+}
+
+// fileLine of the pc in the function
+func (t *pclntab) fileLine(f *pclntabFunc, pc uint64) (file string, line int) {
+	if fileNo, ok := t.pcvalue(f, f.pcfile, pc); ok && fileNo >= 0 {
+		index := (uint64(f.cuOffset) + uint64(fileNo)) * 4
+		if index+4 <= uint64(len(t.cutab)) {
+			if fileOff := t.order.Uint32(t.cutab[index:]); fileOff != ^uint32(0) && uint64(fileOff) < uint64(len(t.filetab)) {
+				file = cString(t.filetab[fileOff:])
+			}
+		}
+	}
+	if l, ok := t.pcvalue(f, f.pcln, pc); ok {
+		line = int(l)
+	}
+	return file, line
+}
+
+// pcdata read the pcdata table offset of the function
+func (t *pclntab) pcdata(f *pclntabFunc, index uint32) uint32 {
+	if index >= f.npcdata {
+		return 0
+	}
+	start := f.offset + uint64(t.funcFixedSize()) + uint64(index)*4
+	if start+4 > uint64(len(t.funcdata)) {
+		return 0
+	}
+	return t.order.Uint32(t.funcdata[start:])
+}
+
+// funcdataAddress read the virtual address of the funcdata, return 0 if not exists
+func (t *pclntab) funcdataAddress(f *pclntabFunc, index uint8) uint64 {
+	if index >= f.nfuncdata {
+		return 0
+	}
+	start := f.offset + uint64(t.funcFixedSize()) + uint64(f.npcdata)*4
+	if t.version >= pclntabVersion118 {
+		start += uint64(index) * 4
+		if start+4 > uint64(len(t.funcdata)) || t.gofunc == 0 {
+			return 0
+		}
+		off := t.order.Uint32(t.funcdata[start:])
+		if off == ^uint32(0) {
+			return 0
+		}
+		return t.gofunc + uint64(off)
+	}
+	// the funcdata is pointer array and aligned to the pointer size before Go 1.18
+	if t.ptrSize == 8 && start&4 != 0 {
+		start += 4
+	}
+	start += uint64(index) * uint64(t.ptrSize)
+	if start+uint64(t.ptrSize) > uint64(len(t.funcdata)) {
+		return 0
+	}
+	return t.uintptr(t.funcdata[start:])
+}
+
+func (t *pclntab) funcFixedSize() int {
+	switch t.version {
+	case pclntabVersion116:
+		return t.ptrSize + 36
+	case pclntabVersion118:
+		return 40
+	default:
+		return 44
+	}
+}
+
+// pcvalue decode the value of the pc in the pc-value table, same as the runtime.pcvalue
+func (t *pclntab) pcvalue(f *pclntabFunc, tableOffset uint32, targetPC uint64) (int32, bool) {
+	if tableOffset == 0 || uint64(tableOffset) >= uint64(len(t.pctab)) {
+		return -1, false
+	}
+	p := t.pctab[tableOffset:]
+	pc := f.entry
+	val := int32(-1)
+	first := true
+	for {
+		uvdelta, n := binary.Uvarint(p)
+		if n <= 0 || (uvdelta == 0 && !first) {
+			return -1, false
+		}
+		p = p[n:]
+		if uvdelta&1 != 0 {
+			uvdelta = ^(uvdelta >> 1)
+		} else {
+			uvdelta >>= 1
+		}
+		val += int32(uvdelta)
+		pcdelta, n := binary.Uvarint(p)
+		if n <= 0 {
+			return -1, false
+		}
+		p = p[n:]
+		pc += pcdelta * t.quantum
+		first = false
+		if targetPC < pc {
+			return val, true
+		}
+	}
+}
+
+// inlinedCall read the inlined function name offset and parent pc offset in the inline tree
+func (t *pclntab) inlinedCall(treeAddr uint64, index int32) (nameOff, parentPC int32, ok bool) {
+	if t.version >= pclntabVersion120 {
+		// funcID uint8, _ [3]byte, nameOff int32, parentPc int32, startLine int32
+		b := t.memory.read(treeAddr+uint64(index)*16, 16)
+		if b == nil {
+			return 0, 0, false
+		}
+		return int32(t.order.Uint32(b[4:])), int32(t.order.Uint32(b[8:])), true
+	}
+	// parent int16, funcID uint8, _ byte, file int32, line int32, func_ int32, parentPc int32
+	b := t.memory.read(treeAddr+uint64(index)*20, 20)
+	if b == nil {
+		return 0, 0, false
+	}
+	return int32(t.order.Uint32(b[12:])), int32(t.order.Uint32(b[16:])), true
+}
+
+// frames of the pc, the inlined functions are expanded from the innermost to the outermost
+func (t *pclntab) frames(pc uint64) []*Frame {
+	f := t.findFunc(pc)
+	if f == nil {
+		return nil
+	}
+	result := make([]*Frame, 0, 1)
+	if treeAddr := t.funcdataAddress(f, funcdataInlTree); treeAddr != 0 {
+		inlTable := t.pcdata(f, pcdataInlTreeIndex)
+		index, ok := t.pcvalue(f, inlTable, pc)
+		for depth := 0; ok && index >= 0 && depth < maxInlineDepth; depth++ {
+			nameOff, parentPC, found := t.inlinedCall(treeAddr, index)
+			if !found {
+				break
+			}
+			file, line := t.fileLine(f, pc)
+			result = append(result, &Frame{Name: t.funcName(nameOff), File: file, Line: line})
+			pc = f.entry + uint64(parentPC)
+			index, ok = t.pcvalue(f, inlTable, pc)
+		}
+	}
+	file, line := t.fileLine(f, pc)
+	return append(result, &Frame{Name: t.funcName(f.nameOff), File: file, Line: line})
+}
+
+// symbols of all functions in the pclntab, sorted by the location
+func (t *pclntab) symbols() []*Symbol {
+	result := make([]*Symbol, 0, t.nfunc)
+	for i := 0; i < t.nfunc; i++ {
+		f, err := t.funcAt(i)
+		if err != nil {
+			log.Debugf("read the function in pclntab failure: %v", err)
+			continue
+		}
+		result = append(result, &Symbol{Name: t.funcName(f.nameOff), Location: f.entry, Size: f.end - f.entry})
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Location < result[j].Location
+	})
+	return result
+}
+
+// findGoFuncAddress find the address of go:func.* symbol, the funcdata offset is related with it since Go 1.18
+func findGoFuncAddress(file *elf.File, t *pclntab, pclntabAddr uint64) uint64 {
+	if symbols, err := file.Symbols(); err == nil {
+		for _, s := range symbols {
+			if s.Name == "go:func.*" || s.Name == "go.func.*" {
+				return s.Value
+			}
+		}
+	}
+
+	// the binary is stripped, so find the runtime.firstmoduledata, the first field is the pointer to the pclntab
+	// and the second field is the pointer to the function name table.
+	// the gofunc field is always after the rodata field, which is the start address of .rodata section,
+	// but the fields before them are different in each Go version.
+	// the types field may also point to the start of .rodata(followed by the etypes at the end of .rodata),
+	// so use the last matched field
+	rodata := file.Section(".rodata")
+	if rodata == nil {
+		return 0
+	}
+	funcnametabAddr := pclntabAddr + uint64(len(t.data)-len(t.funcnametab))
+	for _, name := range []string{".go.module", ".noptrdata", ".data"} {
+		section := file.Section(name)
+		if section == nil || section.Type == elf.SHT_NOBITS {
+			continue
+		}
+		data, err := section.Data()
+		if err != nil {
+			continue
+		}
+		for i := 0; i+2*t.ptrSize <= len(data); i += t.ptrSize {
+			if t.uintptr(data[i:]) != pclntabAddr || t.uintptr(data[i+t.ptrSize:]) != funcnametabAddr {
+				continue
+			}
+			var gofunc uint64
+			for field := moduleDataRodataMinIndex; field < moduleDataRodataMaxIndex; field++ {
+				start := i + field*t.ptrSize
+				if start+2*t.ptrSize > len(data) {
+					break
+				}
+				next := t.uintptr(data[start+t.ptrSize:])
+				if t.uintptr(data[start:]) == rodata.Addr && next != 0 && next != rodata.Addr+rodata.Size {
+					gofunc = next
+				}
+			}
+			if gofunc != 0 {
+				return gofunc
+			}
+		}
+	}
+	return 0
+}
+
+// elfMemory is the loaded sections of elf file, for reading the data by the virtual address
+type elfMemory struct {
+	sections []*elfMemorySection
+}
+
+type elfMemorySection struct {
+	addr uint64
+	data []byte
+}
+
+// loadElfMemory load the sections which contains the addresses
+func loadElfMemory(file *elf.File, addresses ...uint64) *elfMemory {
+	m := &elfMemory{}
+	for _, s := range file.Sections {
+		if s.Type == elf.SHT_NOBITS || s.Flags&elf.SHF_ALLOC == 0 {
+			continue
+		}
+		for _, addr := range addresses {
+			if addr < s.Addr || addr >= s.Addr+s.Size {
+				continue
+			}
+			data, err := s.Data()
+			if err != nil {
+				log.Debugf("read the section %s failure: %v", s.Name, err)
+				break
+			}
+			m.sections = append(m.sections, &elfMemorySection{addr: s.Addr, data: data})
+			break
+		}
+	}
+	return m
+}
+
+func (m *elfMemory) read(addr, size uint64) []byte {
+	for _, s := range m.sections {
+		if addr < s.addr || addr+size > s.addr+uint64(len(s.data)) {
+			continue
+		}
+		start := addr - s.addr
+		return s.data[start : start+size]
+	}
+	return nil
+}
+
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		return string(b[:i])
+	}
+	return string(b)
+}